@@ -11,7 +11,6 @@ import (
 	"net"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/google/uuid"
 
@@ -30,8 +29,11 @@ var (
 
 	address = flag.String("address", "0.0.0.0:43210", "The IP address and port to use for listening for client connections")
 	labels  = flag.String("labels", "", "Comma separated list of key=value pairs")
-	taints  = flag.String("taints", "", "Comma separated list of key=value pairs")
+	taints  = flag.String("taints", "", "Comma separated list of key=value pairs, each value may be followed by the effect of the taint, one of :NoSchedule, :PreferNoSchedule or :NoExecute")
 	poolId  = flag.String("pool-id", "", "The ID of the pool this agent belongs to")
+
+	placement         = flag.String("placement", "first-fit", "The strategy used to choose GPUs for a session, one of first-fit, best-fit or worst-fit")
+	maxSessionsPerGpu = flag.Uint("max-sessions-per-gpu", 0, "The most sessions which may share a GPU, 0 for no limit")
 )
 
 type EventListener interface {
@@ -59,6 +61,9 @@ type Agent struct {
 	sessions    *utilities.ConcurrentMap[string, *Session]
 	taskManager *task.TaskManager
 
+	// Follows the drain state set on the controller
+	drainState *utilities.ConcurrentVariable[string]
+
 	controllerData
 }
 
@@ -76,48 +81,30 @@ func NewAgent(ctx context.Context, tlsConfig *tls.Config) (*Agent, error) {
 		Id:          uuid.NewString(),
 		JuicePath:   *juicePath,
 		Server:      server,
-		labels:      map[string]string{},
-		taints:      map[string]string{},
 		sessions:    utilities.NewConcurrentMap[string, *Session](),
 		taskManager: task.NewTaskManager(ctx),
+		drainState:  utilities.NewConcurrentVariableD(restapi.AgentSchedulable),
 	}
 
-	if *labels != "" {
-		var err error
-		for _, tag := range strings.Split(*labels, ",") {
-			keyValue := strings.Split(tag, "=")
-			if len(keyValue) != 2 {
-				err = errors.Join(err, errors.Newf("tag '%s' must be in the format key=value", tag))
-			} else {
-				agent.labels[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
-			}
-		}
-
-		if err != nil {
-			return nil, errors.New("failed to parse --labels").Wrap(err)
-		}
+	agent.labels, err = restapi.ParseLabels(*labels)
+	if err != nil {
+		return nil, errors.New("failed to parse --labels").Wrap(err)
 	}
 
-	if *taints != "" {
-		var err error
-		for _, taint := range strings.Split(*taints, ",") {
-			keyValue := strings.Split(taint, "=")
-			if len(keyValue) != 2 {
-				err = errors.Join(err, errors.Newf("taint '%s' must be in the format key=value", taint))
-			} else {
-				agent.taints[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
-			}
-		}
-
-		if err != nil {
-			return nil, errors.New("failed to parse --taints").Wrap(err)
-		}
+	agent.taints, err = restapi.ParseTaints(*taints)
+	if err != nil {
+		return nil, errors.New("failed to parse --taints").Wrap(err)
 	}
 
 	if *poolId != "" {
 		agent.poolId = *poolId
 	}
 
+	placementStrategy, err := gpu.ParsePlacementStrategy(*placement)
+	if err != nil {
+		return nil, errors.New("failed to parse --placement").Wrap(err)
+	}
+
 	if agent.JuicePath == "" {
 		executable, err := os.Executable()
 		if err != nil {
@@ -141,6 +128,9 @@ func NewAgent(ctx context.Context, tlsConfig *tls.Config) (*Agent, error) {
 		return nil, errors.New("failed to detect GPUs").Wrap(err)
 	}
 
+	agent.Gpus.SetPlacementStrategy(placementStrategy)
+	agent.Gpus.SetMaxSessions(int(*maxSessionsPerGpu))
+
 	logger.Info("GPUs")
 	for _, gpu := range agent.Gpus.GetGpus() {
 		logger.Infof("  %d @ %s: %s %dMB", gpu.Index, gpu.PciBus, gpu.Name, gpu.Vram/(1024*1024))
@@ -165,7 +155,7 @@ func (agent *Agent) Run(group task.Group) error {
 func (agent *Agent) getSession(sessionId string) (*Session, error) {
 	session, found := agent.sessions.Get(sessionId)
 	if !found {
-		return nil, errors.Newf("session with id %s not found", sessionId)
+		return nil, ErrNotFound.Wrap(errors.Newf("unknown session %s", sessionId))
 	}
 
 	return session, nil
@@ -208,7 +198,24 @@ func (agent *Agent) connect(sessionId string, connectionData restapi.ConnectionD
 	return err
 }
 
+// validateRequirements ensures the GPU requirements of a session can be matched
+func validateRequirements(sessionRequirements restapi.SessionRequirements) error {
+	for _, gpu := range sessionRequirements.Gpus {
+		err := gpu.Validate()
+		if err != nil {
+			return ErrInvalidRequirements.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
 func (agent *Agent) requestSession(sessionRequirements restapi.SessionRequirements) (string, error) {
+	err := validateRequirements(sessionRequirements)
+	if err != nil {
+		return "", err
+	}
+
 	selectedGpus, err := agent.Gpus.Find(sessionRequirements.Gpus)
 	if err != nil {
 		return "", errors.New("unable to find a matching set of GPUs").Wrap(err)
@@ -229,6 +236,26 @@ func (agent *Agent) registerSession(session restapi.Session) error {
 	return nil
 }
 
+// updateDrainState follows the drain state set on the controller, a draining
+// agent considers itself drained once its sessions have closed
+func (agent *Agent) updateDrainState(drainState string) string {
+	// Controllers without drain support do not set a drain state
+	if drainState == "" {
+		drainState = restapi.AgentSchedulable
+	}
+
+	if drainState == restapi.AgentDraining && agent.sessions.Empty() {
+		drainState = restapi.AgentDrained
+	}
+
+	if agent.drainState.Get() != drainState {
+		logger.Infof("drain state changed to %s", drainState)
+		agent.drainState.Set(drainState)
+	}
+
+	return drainState
+}
+
 func (agent *Agent) SessionActive(id string) {
 	logger.Debugf("session %s active", id)
 
@@ -276,6 +303,7 @@ func (agent *Agent) ConnectionClosed(sessionId string, connection restapi.Connec
 				ConnectionData: connection,
 				ExitCode:       exitCode,
 			},
+			Closed: true,
 		}
 	}
 }
@@ -0,0 +1,144 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+const (
+	// The GPU metrics are sent at this interval while nothing else changes
+	channelHeartbeatInterval = 5 * time.Second
+
+	// The controller resends the agent periodically, a channel without any
+	// message for this long is considered lost
+	channelReceiveTimeout = 20 * time.Second
+
+	// The delays between attempts to open the channel while polling
+	channelInitialBackoff = 1 * time.Second
+	channelMaxBackoff     = 1 * time.Minute
+
+	// Controllers without agent channels are checked again at this interval
+	channelUnsupportedInterval = 10 * time.Minute
+)
+
+// runChannel opens a channel to the controller and keeps the controller up to
+// date through it until the channel fails. Sessions assigned to the agent are
+// received as they happen and the updates of the sessions are sent immediately.
+// Returns whether any message was received prior to the channel failing.
+func (agent *Agent) runChannel(ctx context.Context, pending map[string]restapi.SessionUpdate) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	openCtx, cancelOpen := context.WithTimeout(ctx, controllerUpdateTimeout)
+	channel, err := agent.api.OpenAgentChannelWithContext(openCtx, agent.Id)
+	cancelOpen()
+	if err != nil {
+		return false, err
+	}
+
+	defer channel.Close()
+
+	logger.Info("opened a channel to the controller")
+
+	received := make(chan restapi.Agent)
+	failed := make(chan error, 1)
+
+	go func() {
+		for {
+			controllerAgent, err := channel.Receive()
+			if err != nil {
+				failed <- err
+				return
+			}
+
+			select {
+			case received <- controllerAgent:
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	watchdog := time.NewTimer(channelReceiveTimeout)
+	defer watchdog.Stop()
+
+	heartbeat := time.NewTicker(channelHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	opened := false
+	for {
+		select {
+		case <-ctx.Done():
+			return opened, ctx.Err()
+
+		case err = <-failed:
+			return opened, err
+
+		case <-watchdog.C:
+			return opened, fmt.Errorf("no message received from the controller in %s", channelReceiveTimeout)
+
+		case controllerAgent := <-received:
+			opened = true
+
+			if !watchdog.Stop() {
+				select {
+				case <-watchdog.C:
+				default:
+				}
+			}
+			watchdog.Reset(channelReceiveTimeout)
+
+			agent.collectSessionUpdates(pending)
+			agent.reconcileSessions(controllerAgent, pending)
+			drainState := agent.updateDrainState(controllerAgent.DrainState)
+
+			// Only the changes are sent, the controller resending the agent would
+			// otherwise turn into a loop
+			agent.collectSessionUpdates(pending)
+			if len(pending) > 0 || drainState != controllerAgent.DrainState {
+				err = agent.sendChannelUpdate(channel, pending, drainState)
+			}
+
+		case <-heartbeat.C:
+			agent.collectSessionUpdates(pending)
+			err = agent.sendChannelUpdate(channel, pending, agent.drainState.Get())
+
+		case update := <-agent.sessionUpdates:
+			setPendingState(pending, update.Id, update.State)
+			agent.collectSessionUpdates(pending)
+			err = agent.sendChannelUpdate(channel, pending, agent.drainState.Get())
+
+		case update := <-agent.connectionUpdates:
+			setPendingConnection(pending, update)
+			agent.collectSessionUpdates(pending)
+			err = agent.sendChannelUpdate(channel, pending, agent.drainState.Get())
+		}
+
+		if err != nil {
+			return opened, err
+		}
+	}
+}
+
+// sendChannelUpdate sends the pending updates through the channel, the pending
+// updates are cleared once sent
+func (agent *Agent) sendChannelUpdate(channel *restapi.AgentChannel, pending map[string]restapi.SessionUpdate, drainState string) error {
+	err := channel.Send(agent.agentUpdate(pending, drainState))
+	if err != nil {
+		return err
+	}
+
+	for id := range pending {
+		delete(pending, id)
+	}
+
+	return nil
+}
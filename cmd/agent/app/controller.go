@@ -4,6 +4,7 @@
 package app
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
@@ -14,8 +15,19 @@ import (
 
 	"github.com/Juice-Labs/Juice-Labs/cmd/internal/build"
 	"github.com/Juice-Labs/Juice-Labs/pkg/errors"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
 	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
 	"github.com/Juice-Labs/Juice-Labs/pkg/task"
+	"github.com/Juice-Labs/Juice-Labs/pkg/utilities"
+)
+
+const (
+	controllerUpdateInterval = 1 * time.Second
+	controllerUpdateTimeout  = 30 * time.Second
+
+	// The delays between attempts to reach the controller while it is unavailable
+	reconnectInitialBackoff = 1 * time.Second
+	reconnectMaxBackoff     = 1 * time.Minute
 )
 
 var (
@@ -34,6 +46,7 @@ type connectionUpdate struct {
 	restapi.Connection
 
 	SessionId string
+	Closed    bool
 }
 
 type controllerData struct {
@@ -78,23 +91,11 @@ func (agent *Agent) ConnectToController(group task.Group, tlsConfig *tls.Config)
 			return errors.New("--expose must be set when connecting to a controller")
 		}
 
-		id, err := agent.api.RegisterAgentWithContext(group.Ctx(), restapi.Agent{
-			Id:       agent.Id,
-			State:    restapi.AgentActive,
-			Hostname: agent.Hostname,
-			Address:  *expose,
-			Version:  build.Version,
-			Gpus:     agent.Gpus.GetGpus(),
-			Labels:   agent.labels,
-			Taints:   agent.taints,
-			PoolId:   agent.poolId,
-		})
+		err := agent.registerWithController(group.Ctx())
 		if err != nil {
 			return fmt.Errorf("Agent.ConnectToController: failed to register with Controller at %s with %s", *controllerAddress, err)
 		}
 
-		agent.Id = id
-
 		// When connected to the controller, the agent must not allow requests
 		agent.Server.RemoveEndpointByName(RequestSessionName)
 
@@ -109,8 +110,18 @@ func (agent *Agent) ConnectToController(group task.Group, tlsConfig *tls.Config)
 		})
 
 		group.GoFn("Controller Update", func(group task.Group) error {
-			ticker := time.NewTicker(1 * time.Second)
-			defer ticker.Stop()
+			// The updates not yet received by the controller, kept while the controller is unavailable
+			pending := map[string]restapi.SessionUpdate{}
+
+			backoff := utilities.NewBackoff(reconnectInitialBackoff, reconnectMaxBackoff)
+			reconnecting := false
+
+			// The controller is polled while the channel is unavailable
+			channelBackoff := utilities.NewBackoff(channelInitialBackoff, channelMaxBackoff)
+			var channelRetry time.Time
+
+			timer := time.NewTimer(controllerUpdateInterval)
+			defer timer.Stop()
 
 			for {
 				select {
@@ -120,62 +131,68 @@ func (agent *Agent) ConnectToController(group task.Group, tlsConfig *tls.Config)
 						State: restapi.AgentClosed,
 					})
 
-				case <-ticker.C:
-					// Update our state from what is on the controller
-					controllerAgent, err := agent.api.GetAgentWithContext(group.Ctx(), agent.Id)
-					if err != nil {
-						return err
-					}
+				case <-timer.C:
+					if !reconnecting && time.Now().After(channelRetry) {
+						opened, err := agent.runChannel(group.Ctx(), pending)
+						if group.Ctx().Err() != nil {
+							continue
+						}
 
-					for _, session := range controllerAgent.Sessions {
-						switch session.State {
-						case restapi.SessionAssigned:
-							err = errors.Join(err, agent.registerSession(session))
+						if errors.Is(err, restapi.ErrChannelUnsupported) {
+							logger.Debug("the controller does not support agent channels, polling the controller")
+							channelRetry = time.Now().Add(channelUnsupportedInterval)
+						} else {
+							if opened {
+								channelBackoff.Reset()
+							}
 
-						case restapi.SessionCanceling:
-							err = errors.Join(err, agent.cancelSession(session.Id))
+							delay := channelBackoff.Next()
+							logger.Warningf("agent channel closed, polling the controller until reopened in %s, %s", delay, err.Error())
+							channelRetry = time.Now().Add(delay)
 						}
 					}
 
-					// Update the controller with our current state
-					// Multiple updates can occur within one cycle so create a map to get the latest updates
-					sessionUpdates := map[string]restapi.SessionUpdate{}
-
-				CopySessions:
-					for {
-						select {
-						case update := <-agent.sessionUpdates:
-							session, found := sessionUpdates[update.Id]
-							if !found {
-								session.Connections = map[string]restapi.Connection{}
-							}
+					err := agent.updateController(group.Ctx(), pending)
+					if err == nil {
+						if reconnecting {
+							logger.Info("reconnected to the controller")
+							reconnecting = false
+						}
 
-							session.State = update.State
-							sessionUpdates[update.Id] = session
+						backoff.Reset()
+						timer.Reset(controllerUpdateInterval)
+						continue
+					}
 
-						case update := <-agent.connectionUpdates:
-							session, found := sessionUpdates[update.SessionId]
-							if !found {
-								session.Connections = map[string]restapi.Connection{}
-							}
+					if group.Ctx().Err() != nil {
+						continue
+					}
 
-							session.Connections[update.Id] = update.Connection
-							sessionUpdates[update.SessionId] = session
+					// The controller removes the agents it has not heard from in a while
+					if errors.Is(err, restapi.ErrNotFound) {
+						logger.Warningf("agent %s is unknown to the controller, registering again", agent.Id)
 
-						default:
-							break CopySessions
+						err = agent.registerWithController(group.Ctx())
+						if err == nil {
+							// The pending updates belong to the previous registration, the
+							// sessions unknown to the controller are canceled on the next update
+							for id := range pending {
+								delete(pending, id)
+							}
+
+							// The channel of the new registration is opened on the next update
+							channelRetry = time.Time{}
+							backoff.Reset()
+							timer.Reset(controllerUpdateInterval)
+							continue
 						}
 					}
 
-					err = errors.Join(err, agent.api.UpdateAgentWithContext(group.Ctx(), restapi.AgentUpdate{
-						Id:             agent.Id,
-						State:          restapi.AgentActive,
-						SessionsUpdate: sessionUpdates,
-						Gpus:           agent.getGpuMetrics(),
-					}))
-					if err != nil {
-						return err
-					}
+					reconnecting = true
+
+					delay := backoff.Next()
+					logger.Warningf("unable to reach the controller, retrying in %s, %s", delay, err.Error())
+					timer.Reset(delay)
 				}
 			}
 		})
@@ -184,6 +201,190 @@ func (agent *Agent) ConnectToController(group task.Group, tlsConfig *tls.Config)
 	return nil
 }
 
+func (agent *Agent) registerWithController(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, controllerUpdateTimeout)
+	defer cancel()
+
+	id, err := agent.api.RegisterAgentWithContext(ctx, restapi.Agent{
+		Id:       agent.Id,
+		State:    restapi.AgentActive,
+		Hostname: agent.Hostname,
+		Address:  *expose,
+		Version:  build.Version,
+		Gpus:     agent.Gpus.GetGpus(),
+		Labels:   agent.labels,
+		Taints:   agent.taints,
+		PoolId:   agent.poolId,
+	})
+	if err != nil {
+		return err
+	}
+
+	agent.Id = id
+	return nil
+}
+
+// updateController retrieves the sessions assigned to the agent and sends the
+// updates of the sessions to the controller. The pending updates are cleared
+// once received by the controller.
+func (agent *Agent) updateController(ctx context.Context, pending map[string]restapi.SessionUpdate) error {
+	ctx, cancel := context.WithTimeout(ctx, controllerUpdateTimeout)
+	defer cancel()
+
+	agent.collectSessionUpdates(pending)
+
+	// Update our state from what is on the controller
+	controllerAgent, err := agent.api.GetAgentWithContext(ctx, agent.Id)
+	if err != nil {
+		return err
+	}
+
+	agent.reconcileSessions(controllerAgent, pending)
+
+	drainState := agent.updateDrainState(controllerAgent.DrainState)
+
+	// Include the updates of the sessions started while reconciling
+	agent.collectSessionUpdates(pending)
+
+	// Update the controller with our current state
+	err = agent.api.UpdateAgentWithContext(ctx, agent.agentUpdate(pending, drainState))
+	if err != nil {
+		return err
+	}
+
+	for id := range pending {
+		delete(pending, id)
+	}
+
+	return nil
+}
+
+func (agent *Agent) agentUpdate(pending map[string]restapi.SessionUpdate, drainState string) restapi.AgentUpdate {
+	// The idle time of a session only changes along with its connections, which
+	// are pending whenever they change
+	for id, update := range pending {
+		session, found := agent.sessions.Get(id)
+		if !found || update.State == restapi.SessionClosed {
+			continue
+		}
+
+		// Connection updates do not carry the state of the session
+		if update.State == "" {
+			update.State = session.Session().State
+		}
+
+		update.IdleSince = session.IdleSince()
+		pending[id] = update
+	}
+
+	return restapi.AgentUpdate{
+		Id:             agent.Id,
+		State:          restapi.AgentActive,
+		SessionsUpdate: pending,
+		Gpus:           agent.getGpuMetrics(),
+		DrainState:     drainState,
+	}
+}
+
+func setPendingState(pending map[string]restapi.SessionUpdate, id string, state string) {
+	session, found := pending[id]
+	if !found {
+		session.Connections = map[string]restapi.Connection{}
+	}
+
+	session.State = state
+	pending[id] = session
+}
+
+func setPendingConnection(pending map[string]restapi.SessionUpdate, update connectionUpdate) {
+	session, found := pending[update.SessionId]
+	if !found {
+		session.Connections = map[string]restapi.Connection{}
+	}
+
+	session.Connections[update.Id] = update.Connection
+	if update.Closed {
+		session.ClosedConnections = append(session.ClosedConnections, update.Id)
+	}
+	pending[update.SessionId] = session
+}
+
+// collectSessionUpdates merges the queued updates into pending, multiple
+// updates can occur between updates of the controller so only the latest is kept
+func (agent *Agent) collectSessionUpdates(pending map[string]restapi.SessionUpdate) {
+	for {
+		select {
+		case update := <-agent.sessionUpdates:
+			setPendingState(pending, update.Id, update.State)
+
+		case update := <-agent.connectionUpdates:
+			setPendingConnection(pending, update)
+
+		default:
+			return
+		}
+	}
+}
+
+// reconcileSessions brings the local sessions in line with the controller. The
+// two can differ after the controller has been unavailable or the agent has
+// registered again: local sessions unknown to the controller are canceled and
+// sessions the controller believes are running but are not are reported closed.
+func (agent *Agent) reconcileSessions(controllerAgent restapi.Agent, pending map[string]restapi.SessionUpdate) {
+	known := map[string]bool{}
+
+	for _, session := range controllerAgent.Sessions {
+		known[session.Id] = true
+
+		// The controller has yet to receive the session closing
+		if update, found := pending[session.Id]; found && update.State == restapi.SessionClosed {
+			continue
+		}
+
+		_, running := agent.sessions.Get(session.Id)
+
+		switch session.State {
+		case restapi.SessionAssigned:
+			if !running {
+				err := agent.registerSession(session)
+				if err != nil {
+					logger.Errorf("unable to start session %s, %s", session.Id, err.Error())
+					setPendingState(pending, session.Id, restapi.SessionClosed)
+				}
+			}
+
+		case restapi.SessionActive:
+			if !running {
+				logger.Warningf("session %s is no longer running", session.Id)
+				setPendingState(pending, session.Id, restapi.SessionClosed)
+			}
+
+		case restapi.SessionCanceling:
+			if running {
+				err := agent.cancelSession(session.Id)
+				if err != nil {
+					logger.Error(err)
+				}
+			} else {
+				setPendingState(pending, session.Id, restapi.SessionClosed)
+			}
+		}
+	}
+
+	unknown := make([]*Session, 0)
+	agent.sessions.Foreach(func(id string, session *Session) bool {
+		if !known[id] {
+			unknown = append(unknown, session)
+		}
+		return true
+	})
+
+	for _, session := range unknown {
+		logger.Warningf("canceling session %s, it is unknown to the controller", session.Id)
+		session.Cancel()
+	}
+}
+
 func (agent *Agent) getGpuMetrics() []restapi.GpuMetrics {
 	agent.gpuMetricsMutex.Lock()
 	defer agent.gpuMetricsMutex.Unlock()
@@ -25,24 +25,40 @@ const (
 )
 
 func (agent *Agent) initializeEndpoints() {
-	agent.Server.AddEndpointFunc("GET", "/v1/status", agent.getStatusEp, false)
-	agent.Server.AddNamedEndpointFunc(RequestSessionName, "POST", "/v1/request/session", agent.requestSessionEp, true)
-	agent.Server.AddEndpointFunc("GET", "/v1/session/{id}", agent.getSessionEp, true)
-	agent.Server.AddEndpointFunc("DELETE", "/v1/session/{id}", agent.cancelSessionEp, true)
-	agent.Server.AddEndpointFunc("POST", "/v1/connect/session/{id}", agent.connectSessionEp, true)
+	agent.Server.SetInfo("Juice Agent", build.Version)
 
-	agent.Server.AddEndpointHandler("GET", "/metrics", promhttp.Handler(), true)
+	agent.Server.AddEndpointFunc("GET", "/v1/status", agent.getStatusEp, false).WithResponse(restapi.Status{})
+	agent.Server.AddNamedEndpointFunc(RequestSessionName, "POST", "/v1/request/session", agent.requestSessionEp, true).WithRequest(restapi.SessionRequirements{}).WithTextResponse()
+	agent.Server.AddEndpointFunc("GET", "/v1/session/{id}", agent.getSessionEp, true).WithResponse(restapi.Session{})
+	agent.Server.AddEndpointFunc("DELETE", "/v1/session/{id}", agent.cancelSessionEp, true).WithResponse("")
+	agent.Server.AddEndpointFunc("POST", "/v1/connect/session/{id}", agent.connectSessionEp, true).WithRequest(restapi.ConnectionData{})
+
+	agent.Server.AddEndpointHandler("GET", "/metrics", promhttp.Handler(), true).WithTextResponse()
+}
+
+// errorStatus returns the HTTP status describing the error
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, pkgnet.ErrInvalidBody), errors.Is(err, ErrInvalidRequirements):
+		return http.StatusBadRequest
+
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
 }
 
 func (agent *Agent) getStatusEp(w http.ResponseWriter, r *http.Request) {
 	err := pkgnet.Respond(w, http.StatusOK, restapi.Status{
-		State:    "Active",
-		Version:  build.Version,
-		Hostname: agent.Hostname,
+		State:      "Active",
+		Version:    build.Version,
+		Hostname:   agent.Hostname,
+		DrainState: agent.drainState.Get(),
 	})
 
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 	}
 }
@@ -50,14 +66,14 @@ func (agent *Agent) getStatusEp(w http.ResponseWriter, r *http.Request) {
 func (agent *Agent) requestSessionEp(w http.ResponseWriter, r *http.Request) {
 	sessionRequirements, err := pkgnet.ReadRequestBody[restapi.SessionRequirements](r)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
 	id, err := agent.requestSession(sessionRequirements)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -73,7 +89,7 @@ func (agent *Agent) getSessionEp(w http.ResponseWriter, r *http.Request) {
 
 	session, err := agent.getSession(id)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -89,7 +105,7 @@ func (agent *Agent) cancelSessionEp(w http.ResponseWriter, r *http.Request) {
 
 	err := agent.cancelSession(id)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -104,7 +120,7 @@ func (agent *Agent) connectSessionEp(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 	connectionData, err := pkgnet.ReadRequestBody[restapi.ConnectionData](r)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -123,7 +139,7 @@ func (agent *Agent) connectSessionEp(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -0,0 +1,37 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/server"
+	"github.com/Juice-Labs/Juice-Labs/pkg/server/servertest"
+)
+
+// The methods of restapi.Client juicify calls on an agent it connects to directly
+var agentClientMethods = map[string]bool{
+	"Status":         true,
+	"RequestSession": true,
+	"GetSession":     true,
+	"CancelSession":  true,
+	"ReleaseSession": true,
+}
+
+// TestClientMatchesOpenApi calls the methods of restapi.Client served by the
+// agent and checks the request made is described by the OpenAPI document of the agent
+func TestClientMatchesOpenApi(t *testing.T) {
+	agentServer, err := server.NewServer("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := &Agent{Server: agentServer}
+	agent.initializeEndpoints()
+
+	servertest.CheckClient(t, agentServer.OpenApi(), func(method string) bool {
+		return agentClientMethods[strings.TrimSuffix(method, "WithContext")]
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/Juice-Labs/Juice-Labs/pkg/errors"
 	"github.com/Juice-Labs/Juice-Labs/pkg/gpu"
@@ -17,7 +18,9 @@ import (
 )
 
 var (
-	ErrClosed = errors.New("session is closed")
+	ErrClosed              = errors.New("session is closed")
+	ErrNotFound            = errors.New("session not found")
+	ErrInvalidRequirements = errors.New("invalid session requirements")
 )
 
 type Session struct {
@@ -30,6 +33,10 @@ type Session struct {
 	closed      *utilities.ConcurrentVariable[bool]
 	connections *utilities.ConcurrentMap[string, *Connection]
 
+	// The time the last connection closed, or the session started, zero while
+	// connections are active. Guards adding and removing connections.
+	idleSince *utilities.ConcurrentVariable[time.Time]
+
 	taskManager *task.TaskManager
 
 	eventListener EventListener
@@ -43,6 +50,7 @@ func newSession(ctx context.Context, id string, version string, juicePath string
 		gpus:          gpus,
 		closed:        utilities.NewConcurrentVariableD[bool](false),
 		connections:   utilities.NewConcurrentMap[string, *Connection](),
+		idleSince:     utilities.NewConcurrentVariableD[time.Time](time.Now()),
 		taskManager:   task.NewTaskManager(ctx),
 		eventListener: eventListener,
 	}
@@ -76,6 +84,17 @@ func (session *Session) Session() restapi.Session {
 	})
 }
 
+// IdleSince returns the time the session became idle, nil while the session
+// has active connections
+func (session *Session) IdleSince() *time.Time {
+	idleSince := session.idleSince.Get()
+	if idleSince.IsZero() {
+		return nil
+	}
+
+	return &idleSince
+}
+
 func (session *Session) Run(group task.Group) error {
 	group.GoFn(fmt.Sprintf("session %s close", session.Id), func(g task.Group) error {
 		select {
@@ -148,13 +167,21 @@ func (session *Session) addConnection(connectionData restapi.ConnectionData) (*C
 		}
 		close(exitCodeCh)
 
-		session.connections.Delete(connection.Id)
+		utilities.WithRef(session.idleSince, func(idleSince *time.Time) {
+			session.connections.Delete(connection.Id)
+			if session.connections.Empty() {
+				*idleSince = time.Now()
+			}
+		})
 		session.eventListener.ConnectionClosed(session.Id, connection.ConnectionData, exitCode)
 
 		return nil
 	})
 
-	session.connections.Set(connection.Id, connection)
+	utilities.WithRef(session.idleSince, func(idleSince *time.Time) {
+		session.connections.Set(connection.Id, connection)
+		*idleSince = time.Time{}
+	})
 	session.eventListener.ConnectionCreated(session.Id, connection.ConnectionData)
 
 	return connection, nil
@@ -6,8 +6,11 @@ package backend
 import (
 	"context"
 	"errors"
+	"flag"
+	"sort"
 	"time"
 
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/events"
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
 	"github.com/Juice-Labs/Juice-Labs/pkg/gpu"
 	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
@@ -15,17 +18,64 @@ import (
 	"github.com/Juice-Labs/Juice-Labs/pkg/task"
 )
 
+var (
+	enablePreemption = flag.Bool("enable-preemption", false, "Cancels lower priority sessions when a higher priority session cannot otherwise be scheduled")
+	placement        = flag.String("placement", "first-fit", "The strategy used to choose agents and GPUs for a session, one of first-fit, best-fit or worst-fit")
+
+	enableFairShare   = flag.Bool("enable-fair-share", false, "Schedules the queued sessions of equal priority by the deficit between the share of the GPUs of their user and pool and their recent usage, instead of in the order they were requested")
+	fairShareHalfLife = flag.Duration("fair-share-half-life", 24*time.Hour, "The time after which the GPU usage counted towards the fair-share of a user is halved")
+	fairShareWeights  = flag.String("fair-share-weights", "", "The weights of the pools sharing GPUs as a comma separated list of pool ID=weight, pools not listed have a weight of 1")
+)
+
 type Backend struct {
 	storage storage.Storage
+	events  *events.Broker
+
+	preemption bool
+	placement  gpu.PlacementStrategy
+	fairShare  *fairShare // Nil unless fair-share scheduling is enabled
 }
 
-func NewBackend(storage storage.Storage) *Backend {
-	return &Backend{
-		storage: storage,
+func NewBackend(storage storage.Storage, events *events.Broker) (*Backend, error) {
+	placementStrategy, err := gpu.ParsePlacementStrategy(*placement)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to parse --placement"), err)
 	}
+
+	var share *fairShare
+	if *enableFairShare {
+		if *fairShareHalfLife <= 0 {
+			return nil, errors.New("--fair-share-half-life must be positive")
+		}
+
+		weights, err := parseFairShareWeights(*fairShareWeights)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to parse --fair-share-weights"), err)
+		}
+
+		share = &fairShare{
+			halfLife: *fairShareHalfLife,
+			weights:  weights,
+		}
+	}
+
+	return &Backend{
+		storage:    storage,
+		events:     events,
+		preemption: *enablePreemption,
+		placement:  placementStrategy,
+		fairShare:  share,
+	}, nil
 }
 
 func (backend *Backend) Run(group task.Group) error {
+	// Sessions are scheduled as soon as a change allowing them to be is published,
+	// the periodic update remains for the changes made through other frontends
+	subscription := backend.events.Subscribe(restapi.EventFilter{})
+	defer func() {
+		subscription.Close()
+	}()
+
 	err := backend.update(group.Ctx())
 	if err == nil {
 		ticker := time.NewTicker(1 * time.Second)
@@ -38,6 +88,21 @@ func (backend *Backend) Run(group task.Group) error {
 
 			case <-ticker.C:
 				err = backend.update(group.Ctx())
+
+			case event, ok := <-subscription.Events():
+				if !ok {
+					subscription = backend.events.Subscribe(restapi.EventFilter{})
+					continue
+				}
+
+				if triggersUpdate(event) {
+					// Coalesce the events already queued into a single update
+					for len(subscription.Events()) > 0 {
+						<-subscription.Events()
+					}
+
+					err = backend.update(group.Ctx())
+				}
 			}
 		}
 	}
@@ -45,10 +110,57 @@ func (backend *Backend) Run(group task.Group) error {
 	return err
 }
 
-func isSubset(set, subset map[string]string) bool {
-	for key, value := range subset {
-		checkValue, present := set[key]
-		if !present || value != checkValue {
+// triggersUpdate returns whether the event may allow a queued session to be scheduled
+func triggersUpdate(event restapi.Event) bool {
+	switch event.Type {
+	case restapi.EventAgentRegistered:
+		return true
+
+	case restapi.EventAgentDrainState:
+		return event.State == restapi.AgentSchedulable
+
+	case restapi.EventSessionState:
+		return event.State == restapi.SessionQueued || event.State == restapi.SessionClosed
+	}
+
+	return false
+}
+
+func matchesPool(poolId string, reqPoolId string) bool {
+	if reqPoolId == "" {
+		return true
+	}
+	return poolId == reqPoolId
+}
+
+// A check an agent must pass to host a session, regardless of its GPUs
+type agentCheck struct {
+	reason  string // The reason given when the agent fails the check
+	accepts func(agent restapi.Agent, requirements restapi.SessionRequirements) bool
+}
+
+// The checks are shared by scheduling and the explanations of the scheduler
+var agentChecks = []agentCheck{
+	{restapi.RejectUnschedulable, func(agent restapi.Agent, requirements restapi.SessionRequirements) bool {
+		return isSchedulable(agent)
+	}},
+	{restapi.RejectPool, func(agent restapi.Agent, requirements restapi.SessionRequirements) bool {
+		return matchesPool(agent.PoolId, requirements.PoolId)
+	}},
+	{restapi.RejectLabels, func(agent restapi.Agent, requirements restapi.SessionRequirements) bool {
+		return matchesLabels(agent.Labels, requirements.MatchLabels)
+	}},
+	{restapi.RejectExpressions, func(agent restapi.Agent, requirements restapi.SessionRequirements) bool {
+		return matchesExpressions(agent.Labels, requirements.MatchExpressions)
+	}},
+	{restapi.RejectTaint, func(agent restapi.Agent, requirements restapi.SessionRequirements) bool {
+		return canTolerate(agent.Taints, requirements.Tolerates)
+	}},
+}
+
+func agentAccepts(agent restapi.Agent, requirements restapi.SessionRequirements) bool {
+	for _, check := range agentChecks {
+		if !check.accepts(agent, requirements) {
 			return false
 		}
 	}
@@ -56,43 +168,127 @@ func isSubset(set, subset map[string]string) bool {
 	return true
 }
 
-func matchesLabels(set, subset map[string]string) bool {
-	return isSubset(set, subset)
+// newAgentGpuSet returns the GPUs of the agent with those of the sessions selected
+func newAgentGpuSet(agent restapi.Agent, sessions []restapi.Session, placement gpu.PlacementStrategy) (*gpu.GpuSet, error) {
+	var err error
+
+	gpuSet := gpu.NewGpuSet(agent.Gpus)
+	gpuSet.SetPlacementStrategy(placement)
+
+	// Add the currently assigned sessions to the gpuSet
+	for _, session := range sessions {
+		_, err_ := gpuSet.Select(session.Gpus)
+		err = errors.Join(err, err_)
+	}
+
+	return gpuSet, err
+}
+
+func findGpus(agent restapi.Agent, sessions []restapi.Session, requirements restapi.SessionRequirements, placement gpu.PlacementStrategy) (*gpu.SelectedGpuSet, uint64, error) {
+	// Need to ensure the agent has the GPU capacity to support this session
+	gpuSet, err := newAgentGpuSet(agent, sessions, placement)
+
+	selectedGpus, err_ := gpuSet.Find(requirements.Gpus)
+	err = errors.Join(err, err_)
+	return selectedGpus, gpuSet.VramAvailable(), err
 }
 
-func canTolerate(taints, tolerates map[string]string) bool {
-	// tolerates must be a superset of taints to be acceptable
-	return isSubset(tolerates, taints)
+// agentMatches returns the GPUs chosen on the agent for the session and the
+// VRAM left available on the agent once they are in use
+func agentMatches(agent restapi.Agent, requirements restapi.SessionRequirements, placement gpu.PlacementStrategy) (*gpu.SelectedGpuSet, uint64, error) {
+	if agentAccepts(agent, requirements) {
+		return findGpus(agent, agent.Sessions, requirements, placement)
+	}
+
+	return nil, 0, nil
 }
 
-func matchesPool(poolId string, reqPoolId string) bool {
-	if reqPoolId == "" {
-		return true
+// preemptionVictims returns the lowest priority sessions on the agent that
+// must be canceled to make room for a session with the given requirements.
+// Returns nil if the session cannot be placed on the agent, or if it already
+// fits once the sessions being canceled have exited. The GPUs held for a
+// reservation are never preempted.
+func preemptionVictims(agent restapi.Agent, requirements restapi.SessionRequirements, placement gpu.PlacementStrategy, holds *reservationHolds) []restapi.Session {
+	if !agentAccepts(agent, requirements) {
+		return nil
+	}
+
+	var remaining, candidates []restapi.Session
+	for _, session := range agent.Sessions {
+		switch session.State {
+		case restapi.SessionCanceling, restapi.SessionClosed:
+			// Already on the way out, the GPUs will be released shortly
+
+		default:
+			remaining = append(remaining, session)
+			if session.Priority < requirements.Priority && !holds.held(session) {
+				candidates = append(candidates, session)
+			}
+		}
+	}
+
+	// Preempt the lowest priority sessions first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Priority < candidates[j].Priority
+	})
+
+	victims := make([]restapi.Session, 0, len(candidates))
+	for {
+		selectedGpus, _, err := findGpus(agent, remaining, requirements, placement)
+		if err == nil && selectedGpus != nil {
+			return victims
+		}
+
+		if len(candidates) == 0 {
+			return nil
+		}
+
+		victim := candidates[0]
+		candidates = candidates[1:]
+		victims = append(victims, victim)
+
+		for index, session := range remaining {
+			if session.Id == victim.Id {
+				remaining = append(remaining[:index], remaining[index+1:]...)
+				break
+			}
+		}
 	}
-	return poolId == reqPoolId
 }
 
-func agentMatches(agent restapi.Agent, requirements restapi.SessionRequirements) (*gpu.SelectedGpuSet, error) {
-	if matchesPool(agent.PoolId, requirements.PoolId) &&
-		matchesLabels(agent.Labels, requirements.MatchLabels) &&
-		canTolerate(agent.Taints, requirements.Tolerates) {
-		var err error
+// preempt cancels lower priority sessions on the first agent able to host the
+// session once they have exited, leaving the GPUs held for reservations other
+// than the one the session is admitted to. The session remains queued and is
+// assigned by a later update once the agent reports the GPUs as released.
+func (backend *Backend) preempt(session storage.QueuedSession, holds *reservationHolds, reservationId string) error {
+	agents, err := backend.storage.GetAvailableAgentsMatching(0)
+	if err != nil {
+		return err
+	}
+
+	agentIterator := holds.iterator(agents, reservationId)
+
+	for agentIterator.Next() {
+		agent := agentIterator.Value()
 
-		// Need to ensure the agent has the GPU capacity to support this session
-		gpuSet := gpu.NewGpuSet(agent.Gpus)
+		victims := preemptionVictims(agent, session.Requirements, backend.placement, holds)
+		if victims == nil {
+			continue
+		}
 
-		// Add the currently assigned sessions to the gpuSet
-		for _, session := range agent.Sessions {
-			_, err_ := gpuSet.Select(session.Gpus)
+		for _, victim := range victims {
+			logger.Debugf("preempting %s on %s for %s", victim.Id, agent.Id, session.Id)
+			err_ := backend.storage.CancelSession(victim.Id)
+			if err_ == nil {
+				backend.publishSessionState(victim.Id, agent.Id)
+			}
 			err = errors.Join(err, err_)
 		}
 
-		selectedGpus, err_ := gpuSet.Find(requirements.Gpus)
-		err = errors.Join(err, err_)
-		return selectedGpus, err
+		break
 	}
 
-	return nil, nil
+	return err
 }
 
 func validateSession(session storage.QueuedSession) error {
@@ -100,62 +296,218 @@ func validateSession(session storage.QueuedSession) error {
 		return errors.New("session must request at least one GPU")
 	}
 
+	for _, gpu := range session.Requirements.Gpus {
+		err := gpu.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, expression := range session.Requirements.MatchExpressions {
+		err := expression.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, preference := range session.Requirements.Preferences {
+		err := preference.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// publishSessionState publishes the current state of the session
+func (backend *Backend) publishSessionState(sessionId string, agentId string) {
+	if !backend.events.HasSubscribers() {
+		return
+	}
+
+	session, err := backend.storage.GetSessionById(sessionId)
+	if err != nil {
+		logger.Debugf("unable to publish the state of session %s, %s", sessionId, err.Error())
+		return
+	}
+
+	backend.events.Publish(restapi.Event{
+		Type:      restapi.EventSessionState,
+		PoolId:    session.PoolId,
+		AgentId:   agentId,
+		SessionId: session.Id,
+		State:     session.State,
+	})
+}
+
+func (backend *Backend) publishAgentStates(agents []restapi.Agent) {
+	for _, agent := range agents {
+		backend.events.Publish(restapi.Event{
+			Type:    restapi.EventAgentState,
+			PoolId:  agent.PoolId,
+			AgentId: agent.Id,
+			State:   agent.State,
+		})
+	}
+}
+
+// scheduleSession assigns the session to the best agent able to host it, or
+// preempts sessions to make room for it when it cannot be assigned. The quotas
+// and reservations only account for the session once it is assigned.
+func (backend *Backend) scheduleSession(session storage.QueuedSession, queue sessionQueue, quotas *quotaTracker, holds *reservationHolds, now time.Time) error {
+	// Sessions admitted to a reservation are not held to the quotas of
+	// the pool, the sessions of a reservation yet to start remain queued
+	reservationId, reason := holds.admit(session.Requirements, 1)
+	if reservationId == "" && reason == "" {
+		// Sessions exceeding a quota remain queued, the reason is stored with the session
+		var err error
+		reason, err = quotas.check(session, 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	if reason != session.Reason {
+		err := backend.storage.SetSessionReason(session.Id, reason)
+		if err != nil {
+			return err
+		}
+	}
+
+	if reason != "" {
+		logger.Debugf("session %s remains queued, %s", session.Id, reason)
+		return nil
+	}
+
+	// Get an iterator of the agents matching a subset of the requirements
+	agentIterator, err := backend.storage.GetAvailableAgentsMatching(storage.TotalVramRequired(session.Requirements))
+	if err != nil {
+		return err
+	}
+
+	candidates := backend.rankAgents(holds.iterator(agentIterator, reservationId), session.Requirements)
+	if len(candidates) > 0 {
+		agent, selectedGpus := candidates[0].agent, candidates[0].gpus
+		logger.Debugf("assigning %s to %s", session.Id, agent.Id)
+		err = backend.storage.AssignSession(session.Id, agent.Id, selectedGpus.GetGpus())
+		if err == nil {
+			queue.assigned(session, 1)
+			quotas.assigned(session, 1)
+			holds.release(reservationId, len(session.Requirements.Gpus))
+
+			backend.recordPlacement(backend.placementOf(session.Id, candidates, now))
+			backend.events.Publish(restapi.Event{
+				Type:      restapi.EventSessionState,
+				PoolId:    session.Requirements.PoolId,
+				AgentId:   agent.Id,
+				SessionId: session.Id,
+				State:     restapi.SessionAssigned,
+			})
+
+			return nil
+		}
+	}
+
+	if backend.preemption {
+		err = errors.Join(err, backend.preempt(session, holds, reservationId))
+	}
+
+	return err
+}
+
 func (backend *Backend) update(ctx context.Context) error {
-	err := backend.storage.SetAgentsMissingIfNotUpdatedFor(30 * time.Second)
+	agents, err := backend.storage.SetAgentsMissingIfNotUpdatedFor(30 * time.Second)
 	if err != nil {
 		return err
 	}
 
-	err = backend.storage.RemoveMissingAgentsIfNotUpdatedFor(5 * time.Minute)
+	backend.publishAgentStates(agents)
+
+	agents, err = backend.storage.RemoveMissingAgentsIfNotUpdatedFor(5 * time.Minute)
+	if err != nil {
+		return err
+	}
+
+	backend.publishAgentStates(agents)
+
+	err = backend.drainAgents()
+	if err != nil {
+		return err
+	}
+
+	// The agents are only retrieved once for each update
+	agents, err = backend.getAgents("")
+	if err != nil {
+		return err
+	}
+
+	err = backend.evictSessions(agents)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	err = backend.expireSessions(now)
 	if err != nil {
 		return err
 	}
 
-	sessionIterator, err := backend.storage.GetQueuedSessionsIterator()
+	err = backend.expireLeases(now)
 	if err != nil {
 		return err
 	}
 
-	for sessionIterator.Next() {
+	holds, err := backend.holdReservations(now)
+	if err != nil {
+		return err
+	}
+
+	queue, err := backend.queuedSessions(now)
+	if err != nil {
+		return err
+	}
+
+	quotas := newQuotaTracker(backend.storage)
+
+	// Groups are scheduled when their first queued member is reached
+	groups := map[string]bool{}
+
+	for queue.Next() {
 		select {
 		case <-ctx.Done():
 			return nil
 
 		default:
-			session := sessionIterator.Value()
+			session := queue.Value()
 			err_ := validateSession(session)
 			if err_ != nil {
-				err = errors.Join(err_, backend.storage.CancelSession(session.Id))
-				logger.Debugf("invalid session, %s", err.Error())
+				err_ = errors.Join(err_, backend.storage.CancelSession(session.Id))
+				logger.Debugf("invalid session, %s", err_.Error())
+				backend.publishSessionState(session.Id, "")
 				continue
 			}
 
-			// Get an iterator of the agents matching a subset of the requirements
-			agentIterator, err_ := backend.storage.GetAvailableAgentsMatching(storage.TotalVramRequired(session.Requirements))
-			err = errors.Join(err, err_)
-			if err_ == nil {
-				for agentIterator.Next() {
-					agent := agentIterator.Value()
-
-					selectedGpus, err_ := agentMatches(agent, session.Requirements)
-					err = err_
-					if err != nil {
-						logger.Debugf("unable to match agent, %s", err.Error())
-						continue
-					}
+			if session.GroupId != "" {
+				if !groups[session.GroupId] {
+					groups[session.GroupId] = true
 
-					if selectedGpus != nil {
-						logger.Debugf("assigning %s to %s", session.Id, agent.Id)
-						err = errors.Join(err, backend.storage.AssignSession(session.Id, agent.Id, selectedGpus.GetGpus()))
-						break
+					err_ = backend.scheduleGroup(session, queue, quotas, holds)
+					if err_ != nil {
+						logger.Errorf("unable to schedule group %s, %s", session.GroupId, err_.Error())
 					}
 				}
+
+				continue
+			}
+
+			err_ = backend.scheduleSession(session, queue, quotas, holds, now)
+			if err_ != nil {
+				logger.Errorf("unable to schedule session %s, %s", session.Id, err_.Error())
 			}
 		}
 	}
 
-	return err
+	return nil
 }
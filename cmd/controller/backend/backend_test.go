@@ -6,16 +6,36 @@ package backend
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"math/rand"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
 
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage/memdb"
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage/postgres"
+	"github.com/Juice-Labs/Juice-Labs/pkg/gpu"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
 	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
 )
 
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	err := logger.Configure()
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
 func openMemdb(t *testing.T) storage.Storage {
 	db, err := memdb.OpenStorage(context.Background())
 	if err != nil {
@@ -50,10 +70,11 @@ func defaultAgent(gpuVram uint64) restapi.Agent {
 				Vram:        gpuVram,
 			},
 		},
-		Labels:   map[string]string{},
-		Taints:   map[string]string{},
-		Sessions: make([]restapi.Session, 0),
-		PoolId:   "TestPool",
+		Labels:     map[string]string{},
+		Taints:     map[string]string{},
+		Sessions:   make([]restapi.Session, 0),
+		DrainState: restapi.AgentSchedulable,
+		PoolId:     "TestPool",
 	}
 }
 
@@ -72,14 +93,15 @@ func defaultSessionRequirements(gpuVram uint64) restapi.SessionRequirements {
 
 func createAgent() restapi.Agent {
 	agent := restapi.Agent{
-		State:    restapi.AgentActive,
-		Hostname: "Test",
-		Address:  "127.0.0.1:43210",
-		Version:  "Test",
-		Labels:   map[string]string{},
-		Taints:   map[string]string{},
-		PoolId:   "TestPool",
-		Sessions: make([]restapi.Session, 0),
+		State:      restapi.AgentActive,
+		Hostname:   "Test",
+		Address:    "127.0.0.1:43210",
+		Version:    "Test",
+		Labels:     map[string]string{},
+		Taints:     map[string]string{},
+		PoolId:     "TestPool",
+		Sessions:   make([]restapi.Session, 0),
+		DrainState: restapi.AgentSchedulable,
 	}
 
 	agent.Gpus = make([]restapi.Gpu, rand.Intn(7)+1)
@@ -174,7 +196,7 @@ func registerAgent(t *testing.T, db storage.Storage, agent restapi.Agent) restap
 }
 
 func queueSession(t *testing.T, db storage.Storage, requirements restapi.SessionRequirements) string {
-	sessionId, err := db.RequestSession(requirements)
+	sessionId, err := db.RequestSession(requirements, "")
 	if err != nil {
 		t.Log(err)
 		t.FailNow()
@@ -182,9 +204,28 @@ func queueSession(t *testing.T, db storage.Storage, requirements restapi.Session
 	return sessionId
 }
 
+// failingStorage fails to cancel the sessions given, as when a session closes
+// while being canceled
+type failingStorage struct {
+	storage.Storage
+
+	failCancel map[string]bool
+}
+
+func (db failingStorage) CancelSession(id string) error {
+	if db.failCancel[id] {
+		return errors.New("unable to cancel session")
+	}
+
+	return db.Storage.CancelSession(id)
+}
+
 func TestGetAvailableAgentsMatching(t *testing.T) {
 	run := func(t *testing.T, db storage.Storage) {
-		backend := NewBackend(db)
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		agentIds := []string{
 			registerAgent(t, db, defaultAgent(24*1024*1024*1024)).Id,
@@ -199,7 +240,7 @@ func TestGetAvailableAgentsMatching(t *testing.T) {
 			queueSession(t, db, defaultSessionRequirements(4*1024*1024*1024)),
 		}
 
-		err := backend.update(context.Background())
+		err = backend.update(context.Background())
 		if err != nil {
 			t.Error(err)
 		}
@@ -246,3 +287,1759 @@ func TestGetAvailableAgentsMatching(t *testing.T) {
 		run(t, db)
 	})
 }
+
+func TestPriorityOrdering(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		agentId := registerAgent(t, db, defaultAgent(8*1024*1024*1024)).Id
+
+		low := defaultSessionRequirements(8 * 1024 * 1024 * 1024)
+		low.Priority = restapi.SessionPriorityLow
+		lowId := queueSession(t, db, low)
+
+		high := defaultSessionRequirements(8 * 1024 * 1024 * 1024)
+		high.Priority = restapi.SessionPriorityHigh
+		highId := queueSession(t, db, high)
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		session, err := db.GetSessionById(highId)
+		if err != nil {
+			t.Error(err)
+		} else if session.State != restapi.SessionAssigned {
+			t.Errorf("expected high priority session to be assigned, state = %s", session.State)
+		}
+
+		session, err = db.GetSessionById(lowId)
+		if err != nil {
+			t.Error(err)
+		} else if session.State != restapi.SessionQueued {
+			t.Errorf("expected low priority session to be queued, state = %s", session.State)
+		}
+
+		agent, err := db.GetAgentById(agentId)
+		if err != nil {
+			t.Error(err)
+		} else if len(agent.Sessions) != 1 || agent.Sessions[0].Id != highId {
+			t.Error("expected only the high priority session to be assigned to the agent")
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestPreemption(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage, preemption bool) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backend.preemption = preemption
+
+		agentId := registerAgent(t, db, defaultAgent(8*1024*1024*1024)).Id
+
+		normal := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		normalId := queueSession(t, db, normal)
+
+		low := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		low.Priority = restapi.SessionPriorityLow
+		lowId := queueSession(t, db, low)
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		high := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		high.Priority = restapi.SessionPriorityHigh
+		highId := queueSession(t, db, high)
+
+		// Run twice to ensure no additional sessions are preempted while
+		// the first victim is still canceling
+		for i := 0; i < 2; i++ {
+			err = backend.update(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+		}
+
+		expectedLowState := restapi.SessionAssigned
+		if preemption {
+			expectedLowState = restapi.SessionCanceling
+		}
+
+		expected := map[string]string{
+			normalId: restapi.SessionAssigned,
+			lowId:    expectedLowState,
+			highId:   restapi.SessionQueued,
+		}
+
+		for id, state := range expected {
+			session, err := db.GetSessionById(id)
+			if err != nil {
+				t.Error(err)
+			} else if session.State != state {
+				t.Errorf("expected session %s to be %s, state = %s", id, state, session.State)
+			}
+		}
+
+		agent, err := db.GetAgentById(agentId)
+		if err != nil {
+			t.Error(err)
+		}
+
+		for _, session := range agent.Sessions {
+			if session.State != expected[session.Id] {
+				t.Errorf("expected agent session %s to be %s, state = %s", session.Id, expected[session.Id], session.State)
+			}
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		t.Run("disabled", func(t *testing.T) {
+			db := openMemdb(t)
+			defer db.Close()
+			run(t, db, false)
+		})
+
+		t.Run("enabled", func(t *testing.T) {
+			db := openMemdb(t)
+			defer db.Close()
+			run(t, db, true)
+		})
+	})
+}
+
+func TestPreemptionReservations(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backend.preemption = true
+
+		registerAgent(t, db, defaultAgent(8*1024*1024*1024))
+
+		// Half of the GPU is held for the reservation
+		_, err = db.CreateReservation(restapi.Reservation{
+			PoolId: "TestPool",
+			Gpus:   defaultSessionRequirements(4 * 1024 * 1024 * 1024).Gpus,
+			Start:  time.Now().Add(-time.Minute),
+			End:    time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		low := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		low.PoolId = "TestPool"
+		low.Priority = restapi.SessionPriorityLow
+		lowId := queueSession(t, db, low)
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		high := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		high.PoolId = "TestPool"
+		high.Priority = restapi.SessionPriorityHigh
+		highId := queueSession(t, db, high)
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		// The held GPU is not free for the session, the low priority session is preempted instead
+		for id, state := range map[string]string{lowId: restapi.SessionCanceling, highId: restapi.SessionQueued} {
+			session, err := db.GetSessionById(id)
+			if err != nil {
+				t.Error(err)
+			} else if session.State != state {
+				t.Errorf("expected session %s to be %s, state = %s", id, state, session.State)
+			}
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestPlacement(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage, placement gpu.PlacementStrategy, expectedVram uint64) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backend.placement = placement
+
+		registerAgent(t, db, defaultAgent(24*1024*1024*1024))
+		registerAgent(t, db, defaultAgent(8*1024*1024*1024))
+		registerAgent(t, db, defaultAgent(16*1024*1024*1024))
+
+		sessionId := queueSession(t, db, defaultSessionRequirements(4*1024*1024*1024))
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		session, err := db.GetSessionById(sessionId)
+		if err != nil {
+			t.Fatal(err)
+		} else if session.State != restapi.SessionAssigned {
+			t.Fatalf("expected session to be assigned, state = %s", session.State)
+		}
+
+		agents, _, err := db.ListAgents(storage.AgentFilter{}, storage.Page{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, agent := range agents {
+			if len(agent.Sessions) > 0 && agent.Gpus[0].Vram != expectedVram {
+				t.Errorf("expected session on the agent with %d VRAM, got %d", expectedVram, agent.Gpus[0].Vram)
+			}
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		t.Run("best-fit", func(t *testing.T) {
+			db := openMemdb(t)
+			defer db.Close()
+			run(t, db, gpu.BestFit, 8*1024*1024*1024)
+		})
+
+		t.Run("worst-fit", func(t *testing.T) {
+			db := openMemdb(t)
+			defer db.Close()
+			run(t, db, gpu.WorstFit, 24*1024*1024*1024)
+		})
+	})
+}
+
+func TestQuotas(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		poolId := uuid.NewString()
+
+		agent := defaultAgent(24 * 1024 * 1024 * 1024)
+		agent.PoolId = poolId
+		registerAgent(t, db, agent)
+
+		err = db.SetQuota(poolId, "", restapi.QuotaLimits{MaxSessions: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.SetQuota(poolId, "Limited", restapi.QuotaLimits{MaxVram: 4 * 1024 * 1024 * 1024})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		requirements := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		requirements.PoolId = poolId
+
+		request := func(userId string) string {
+			sessionId, err := db.RequestSession(requirements, userId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sessionId
+		}
+
+		// The first session of Limited consumes the user quota, the second
+		// exceeds it. The pool quota then allows one more session from User.
+		expected := []struct {
+			id        string
+			state     string
+			hasReason bool
+		}{
+			{request("Limited"), restapi.SessionAssigned, false},
+			{request("Limited"), restapi.SessionQueued, true},
+			{request("User"), restapi.SessionAssigned, false},
+			{request("User"), restapi.SessionQueued, true},
+		}
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		for index, check := range expected {
+			session, err := db.GetSessionById(check.id)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+
+			if session.State != check.state {
+				t.Errorf("expected session %d to be %s, state = %s", index, check.state, session.State)
+			}
+
+			if (session.Reason != "") != check.hasReason {
+				t.Errorf("unexpected reason for session %d, '%s'", index, session.Reason)
+			}
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestDraining(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		agent := registerAgent(t, db, defaultAgent(24*1024*1024*1024))
+
+		checkState := func(sessionId string, state string) {
+			t.Helper()
+
+			session, err := db.GetSessionById(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			} else if session.State != state {
+				t.Fatalf("expected session to be %s, state = %s", state, session.State)
+			}
+		}
+
+		checkDrainState := func(drainState string) {
+			t.Helper()
+
+			agent, err := db.GetAgentById(agent.Id)
+			if err != nil {
+				t.Fatal(err)
+			} else if agent.DrainState != drainState {
+				t.Fatalf("expected agent to be %s, drain state = %s", drainState, agent.DrainState)
+			}
+		}
+
+		update := func() {
+			t.Helper()
+
+			err := backend.update(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+		}
+
+		runningId := queueSession(t, db, defaultSessionRequirements(4*1024*1024*1024))
+		update()
+		checkState(runningId, restapi.SessionAssigned)
+
+		// A draining agent is not assigned new sessions and waits for its sessions to close
+		deadline := time.Now().Add(time.Hour)
+		err = db.SetAgentDrainState(agent.Id, restapi.AgentDraining, &deadline)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		queuedId := queueSession(t, db, defaultSessionRequirements(4*1024*1024*1024))
+		update()
+		checkState(queuedId, restapi.SessionQueued)
+		checkState(runningId, restapi.SessionAssigned)
+		checkDrainState(restapi.AgentDraining)
+
+		// Sessions remaining after the deadline are canceled
+		deadline = time.Now().Add(-time.Second)
+		err = db.SetAgentDrainState(agent.Id, restapi.AgentDraining, &deadline)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		update()
+		checkState(runningId, restapi.SessionCanceling)
+
+		err = db.UpdateAgent(restapi.AgentUpdate{
+			Id:    agent.Id,
+			State: restapi.AgentActive,
+			SessionsUpdate: map[string]restapi.SessionUpdate{
+				runningId: {
+					State: restapi.SessionClosed,
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		update()
+		checkDrainState(restapi.AgentDrained)
+		checkState(queuedId, restapi.SessionQueued)
+
+		err = db.SetAgentDrainState(agent.Id, restapi.AgentSchedulable, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		update()
+		checkState(queuedId, restapi.SessionAssigned)
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		agent := registerAgent(t, db, defaultAgent(24*1024*1024*1024))
+
+		err = db.SetSessionDefaults(agent.PoolId, restapi.SessionTimeouts{IdleTimeout: 60})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkState := func(sessionId string, state string) {
+			t.Helper()
+
+			session, err := db.GetSessionById(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			} else if session.State != state {
+				t.Fatalf("expected session to be %s, state = %s", state, session.State)
+			}
+		}
+
+		expire := func(after time.Duration) {
+			t.Helper()
+
+			err := backend.expireSessions(time.Now().Add(after))
+			if err != nil {
+				t.Error(err)
+			}
+		}
+
+		limitedRequirements := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		limitedRequirements.PoolId = agent.PoolId
+		limitedRequirements.MaxDuration = 60 * 60
+		limitedId := queueSession(t, db, limitedRequirements)
+
+		defaultRequirements := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		defaultRequirements.PoolId = agent.PoolId
+		defaultId := queueSession(t, db, defaultRequirements)
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkState(limitedId, restapi.SessionAssigned)
+		checkState(defaultId, restapi.SessionAssigned)
+
+		// Sessions are not idle until their agent reports them as such
+		expire(30 * time.Minute)
+		checkState(limitedId, restapi.SessionAssigned)
+		checkState(defaultId, restapi.SessionAssigned)
+
+		idleSince := time.Now()
+		err = db.UpdateAgent(restapi.AgentUpdate{
+			Id:    agent.Id,
+			State: restapi.AgentActive,
+			SessionsUpdate: map[string]restapi.SessionUpdate{
+				limitedId: {
+					State: restapi.SessionActive,
+				},
+				defaultId: {
+					State:     restapi.SessionActive,
+					IdleSince: &idleSince,
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The idle timeout is taken from the defaults of the pool
+		expire(30 * time.Second)
+		checkState(defaultId, restapi.SessionActive)
+
+		expire(2 * time.Minute)
+		checkState(limitedId, restapi.SessionActive)
+		checkState(defaultId, restapi.SessionCanceling)
+
+		expire(2 * time.Hour)
+		checkState(limitedId, restapi.SessionCanceling)
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestSessionLeases(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		agent := registerAgent(t, db, defaultAgent(24*1024*1024*1024))
+
+		requirements := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		requirements.PoolId = agent.PoolId
+		leasedId := queueSession(t, db, requirements)
+		unleasedId := queueSession(t, db, requirements)
+
+		err = db.RenewSessionLease(leasedId, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkState := func(sessionId string, state string) {
+			t.Helper()
+
+			session, err := db.GetSessionById(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			} else if session.State != state {
+				t.Fatalf("expected session to be %s, state = %s", state, session.State)
+			}
+		}
+
+		err = backend.expireLeases(time.Now())
+		if err != nil {
+			t.Error(err)
+		}
+
+		checkState(leasedId, restapi.SessionQueued)
+
+		err = backend.expireLeases(time.Now().Add(2 * time.Minute))
+		if err != nil {
+			t.Error(err)
+		}
+
+		// Queued sessions close as soon as they are canceled, sessions without a
+		// lease are left alone
+		checkState(leasedId, restapi.SessionClosed)
+		checkState(unleasedId, restapi.SessionQueued)
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestSessionGroups(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vram := uint64(8 * 1024 * 1024 * 1024)
+
+		racks := map[string]string{}
+		for _, rack := range []string{"a", "a", "b", "b", "b"} {
+			agent := defaultAgent(vram)
+			agent.Labels = map[string]string{"rack": rack}
+			agent = registerAgent(t, db, agent)
+			racks[agent.Id] = rack
+		}
+
+		requestGroup := func(members int, sameLabel string) string {
+			t.Helper()
+
+			requirements := defaultSessionRequirements(vram)
+			requirements.PoolId = "TestPool"
+
+			id, err := db.RequestSessionGroup(restapi.SessionGroupRequirements{
+				Members:  members,
+				Topology: restapi.GroupTopology{SameLabel: sameLabel},
+				Session:  requirements,
+			}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return id
+		}
+
+		getGroup := func(id string, state string) restapi.SessionGroup {
+			t.Helper()
+
+			group, err := db.GetSessionGroup(id)
+			if err != nil {
+				t.Fatal(err)
+			} else if group.State != state {
+				t.Fatalf("expected group to be %s, state = %s", state, group.State)
+			}
+
+			return group
+		}
+
+		update := func() {
+			t.Helper()
+
+			err := backend.update(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+		}
+
+		rackedId := requestGroup(3, "rack")
+		update()
+
+		// Only rack b has room for every member
+		group := getGroup(rackedId, restapi.SessionAssigned)
+		for _, session := range group.Sessions {
+			if session.State != restapi.SessionAssigned || session.Address == "" {
+				t.Errorf("expected member %s to be assigned with an address, got %+v", session.Id, session)
+			}
+		}
+
+		agents, _, err := db.ListAgents(storage.AgentFilter{}, storage.Page{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, agent := range agents {
+			if len(agent.Sessions) > 0 && racks[agent.Id] != "b" {
+				t.Errorf("expected members on the agents of rack b, got %s on rack %s", agent.Id, racks[agent.Id])
+			}
+		}
+
+		// Rack a has room for two of the three members, none are assigned
+		waitingId := requestGroup(3, "")
+		update()
+
+		group = getGroup(waitingId, restapi.SessionQueued)
+		for _, session := range group.Sessions {
+			if session.State != restapi.SessionQueued {
+				t.Errorf("expected member %s to remain queued, state = %s", session.Id, session.State)
+			}
+		}
+
+		fittingId := requestGroup(2, "")
+		update()
+
+		getGroup(fittingId, restapi.SessionAssigned)
+
+		// The remaining members are canceled once a member of a queued group is
+		err = db.CancelSession(group.Sessions[0].Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		update()
+		getGroup(waitingId, restapi.SessionClosed)
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestReservations(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vram := uint64(8 * 1024 * 1024 * 1024)
+		registerAgent(t, db, defaultAgent(vram))
+		registerAgent(t, db, defaultAgent(vram))
+
+		now := time.Now()
+		createReservation := func(start time.Time) string {
+			t.Helper()
+
+			reservation, err := db.CreateReservation(restapi.Reservation{
+				PoolId: "TestPool",
+				Gpus:   defaultSessionRequirements(vram).Gpus,
+				Start:  start,
+				End:    start.Add(time.Hour),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return reservation.Id
+		}
+
+		currentId := createReservation(now.Add(-time.Minute))
+		laterId := createReservation(now.Add(time.Hour))
+
+		requestSession := func(reservationId string) string {
+			t.Helper()
+
+			requirements := defaultSessionRequirements(vram)
+			requirements.PoolId = "TestPool"
+			requirements.ReservationId = reservationId
+			return queueSession(t, db, requirements)
+		}
+
+		firstId := requestSession("")
+		secondId := requestSession("")
+		reservedId := requestSession(currentId)
+		waitingId := requestSession(laterId)
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		checkState := func(sessionId string, state string) restapi.Session {
+			t.Helper()
+
+			session, err := db.GetSessionById(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			} else if session.State != state {
+				t.Fatalf("expected session to be %s, state = %s", state, session.State)
+			}
+
+			return session
+		}
+
+		// The GPU held for the current reservation is only available to its sessions
+		checkState(firstId, restapi.SessionAssigned)
+		checkState(secondId, restapi.SessionQueued)
+		checkState(reservedId, restapi.SessionAssigned)
+
+		session := checkState(waitingId, restapi.SessionQueued)
+		if !strings.Contains(session.Reason, "starts at") {
+			t.Errorf("expected the session to wait for its reservation to start, reason = %s", session.Reason)
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestReservationOversubscribed(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vram := uint64(8 * 1024 * 1024 * 1024)
+		registerAgent(t, db, defaultAgent(vram))
+		registerAgent(t, db, defaultAgent(vram))
+
+		err = db.SetQuota("TestPool", "", restapi.QuotaLimits{MaxSessions: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now := time.Now()
+		reservation, err := db.CreateReservation(restapi.Reservation{
+			PoolId: "TestPool",
+			Gpus:   defaultSessionRequirements(vram).Gpus,
+			Start:  now.Add(-time.Minute),
+			End:    now.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		requirements := defaultSessionRequirements(vram)
+		requirements.PoolId = "TestPool"
+		requirements.ReservationId = reservation.Id
+
+		reservedId := queueSession(t, db, requirements)
+		extraId := queueSession(t, db, requirements)
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		session, err := db.GetSessionById(reservedId)
+		if err != nil {
+			t.Fatal(err)
+		} else if session.State != restapi.SessionAssigned {
+			t.Errorf("expected the session to be assigned to the reservation, state = %s", session.State)
+		}
+
+		// The reservation's only GPU is in use so the extra session is held to the quota
+		session, err = db.GetSessionById(extraId)
+		if err != nil {
+			t.Fatal(err)
+		} else if session.State != restapi.SessionQueued {
+			t.Errorf("expected the session to remain queued, state = %s", session.State)
+		} else if !strings.Contains(session.Reason, "quota exceeded") {
+			t.Errorf("expected the session to exceed the quota, reason = %s", session.Reason)
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestFairShare(t *testing.T) {
+	// Returns the number of updates until every session of the light user is assigned
+	run := func(t *testing.T, db storage.Storage, share *fairShare) int {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backend.fairShare = share
+
+		vram := uint64(8 * 1024 * 1024 * 1024)
+		registerAgent(t, db, defaultAgent(vram))
+		registerAgent(t, db, defaultAgent(vram))
+
+		requestSession := func(userId string) string {
+			t.Helper()
+
+			requirements := defaultSessionRequirements(vram)
+			requirements.PoolId = "TestPool"
+
+			id, err := db.RequestSession(requirements, userId)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return id
+		}
+
+		// The heavy user floods the queue before the light user requests any session
+		for i := 0; i < 6; i++ {
+			requestSession("heavy")
+		}
+
+		light := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			light[requestSession("light")] = true
+		}
+
+		for updates := 1; updates <= 4; updates++ {
+			err = backend.update(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+
+			agents, _, err := db.ListAgents(storage.AgentFilter{}, storage.Page{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every assigned session closes before the next update
+			for _, agent := range agents {
+				sessionsUpdate := map[string]restapi.SessionUpdate{}
+				for _, session := range agent.Sessions {
+					delete(light, session.Id)
+					sessionsUpdate[session.Id] = restapi.SessionUpdate{State: restapi.SessionClosed}
+				}
+
+				err = db.UpdateAgent(restapi.AgentUpdate{
+					Id:             agent.Id,
+					State:          restapi.AgentActive,
+					SessionsUpdate: sessionsUpdate,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if len(light) == 0 {
+				return updates
+			}
+		}
+
+		t.Fatalf("expected the sessions of the light user to be assigned, %d remain queued", len(light))
+		return 0
+	}
+
+	t.Run("memdb fifo", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+
+		if updates := run(t, db, nil); updates != 4 {
+			t.Errorf("expected the light user to wait for every session of the heavy user, assigned after %d updates", updates)
+		}
+	})
+
+	t.Run("memdb fair-share", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+
+		if updates := run(t, db, &fairShare{halfLife: time.Hour}); updates != 2 {
+			t.Errorf("expected the light user to be assigned once the heavy user used GPUs, assigned after %d updates", updates)
+		}
+	})
+}
+
+func TestFairShareOrder(t *testing.T) {
+	weights, err := parseFairShareWeights("a=1, b=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	share := &fairShare{halfLife: time.Hour, weights: weights}
+
+	session := func(id string, poolId string, userId string, priority int) storage.QueuedSession {
+		return storage.QueuedSession{
+			Id:     id,
+			UserId: userId,
+			Requirements: restapi.SessionRequirements{
+				PoolId:   poolId,
+				Priority: priority,
+			},
+		}
+	}
+
+	sessions := []storage.QueuedSession{
+		session("1", "a", "alice", restapi.SessionPriorityNormal),
+		session("2", "a", "alice", restapi.SessionPriorityNormal),
+		session("3", "b", "bob", restapi.SessionPriorityNormal),
+		session("4", "a", "carol", restapi.SessionPriorityHigh),
+		session("5", "b", "bob", restapi.SessionPriorityNormal),
+	}
+
+	drain := func(queue *fairShareQueue, assign bool) []string {
+		var ids []string
+		for queue.Next() {
+			session := queue.Value()
+			ids = append(ids, session.Id)
+
+			if assign {
+				queue.assigned(session, 1)
+			}
+		}
+
+		return ids
+	}
+
+	// Pool b is entitled to three quarters of the GPUs and used two thirds
+	ids := drain(share.queue(sessions, map[quotaKey]float64{
+		{poolId: "a", userId: "alice"}: 1,
+		{poolId: "b", userId: "bob"}:   2,
+	}, time.Now()), false)
+
+	if expected := []string{"4", "3", "5", "1", "2"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected sessions in order %v, got %v", expected, ids)
+	}
+
+	withGpu := func(session storage.QueuedSession) storage.QueuedSession {
+		session.Requirements.Gpus = []restapi.GpuRequirements{{}}
+		return session
+	}
+
+	sessions = []storage.QueuedSession{
+		withGpu(session("1", "a", "alice", restapi.SessionPriorityNormal)),
+		withGpu(session("2", "a", "alice", restapi.SessionPriorityNormal)),
+		withGpu(session("3", "a", "alice", restapi.SessionPriorityNormal)),
+		withGpu(session("4", "a", "dave", restapi.SessionPriorityNormal)),
+		withGpu(session("5", "a", "dave", restapi.SessionPriorityNormal)),
+	}
+
+	// The deficits are recomputed as the sessions are assigned
+	ids = drain(share.queue(sessions, map[quotaKey]float64{}, time.Now()), true)
+
+	if expected := []string{"1", "4", "2", "5", "3"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected sessions assigned in order %v, got %v", expected, ids)
+	}
+
+	for _, value := range []string{"a", "a=x", "a=0", "=1"} {
+		_, err = parseFairShareWeights(value)
+		if err == nil {
+			t.Errorf("expected weights %s to be invalid", value)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	labels := map[string]string{
+		"zone":   "us-east",
+		"memory": "48",
+		"arch":   "ampere",
+	}
+
+	for _, test := range []struct {
+		expression restapi.SelectorRequirement
+		matches    bool
+	}{
+		{restapi.SelectorRequirement{Key: "zone", Operator: restapi.SelectorOpIn, Values: []string{"us-west", "us-east"}}, true},
+		{restapi.SelectorRequirement{Key: "zone", Operator: restapi.SelectorOpIn, Values: []string{"us-west"}}, false},
+		{restapi.SelectorRequirement{Key: "rack", Operator: restapi.SelectorOpIn, Values: []string{"a"}}, false},
+		{restapi.SelectorRequirement{Key: "zone", Operator: restapi.SelectorOpNotIn, Values: []string{"us-west"}}, true},
+		{restapi.SelectorRequirement{Key: "zone", Operator: restapi.SelectorOpNotIn, Values: []string{"us-east"}}, false},
+		{restapi.SelectorRequirement{Key: "rack", Operator: restapi.SelectorOpNotIn, Values: []string{"a"}}, true},
+		{restapi.SelectorRequirement{Key: "arch", Operator: restapi.SelectorOpExists}, true},
+		{restapi.SelectorRequirement{Key: "rack", Operator: restapi.SelectorOpExists}, false},
+		{restapi.SelectorRequirement{Key: "rack", Operator: restapi.SelectorOpDoesNotExist}, true},
+		{restapi.SelectorRequirement{Key: "arch", Operator: restapi.SelectorOpDoesNotExist}, false},
+		{restapi.SelectorRequirement{Key: "memory", Operator: restapi.SelectorOpGt, Values: []string{"24"}}, true},
+		{restapi.SelectorRequirement{Key: "memory", Operator: restapi.SelectorOpGt, Values: []string{"48"}}, false},
+		{restapi.SelectorRequirement{Key: "memory", Operator: restapi.SelectorOpLt, Values: []string{"80"}}, true},
+		{restapi.SelectorRequirement{Key: "memory", Operator: restapi.SelectorOpLt, Values: []string{"48"}}, false},
+		{restapi.SelectorRequirement{Key: "arch", Operator: restapi.SelectorOpGt, Values: []string{"1"}}, false},
+		{restapi.SelectorRequirement{Key: "rack", Operator: restapi.SelectorOpLt, Values: []string{"1"}}, false},
+		{restapi.SelectorRequirement{Key: "zone", Operator: "Near", Values: []string{"us-east"}}, false},
+	} {
+		if matches := matchesExpression(labels, test.expression); matches != test.matches {
+			t.Errorf("expected %+v to match %v, got %v", test.expression, test.matches, matches)
+		}
+	}
+
+	if !matchesExpressions(labels, nil) {
+		t.Error("expected no expressions to match every agent")
+	}
+
+	if matchesExpressions(labels, []restapi.SelectorRequirement{
+		{Key: "zone", Operator: restapi.SelectorOpExists},
+		{Key: "rack", Operator: restapi.SelectorOpExists},
+	}) {
+		t.Error("expected every expression to be required to match")
+	}
+}
+
+func TestValidateSelectorRequirement(t *testing.T) {
+	for _, test := range []struct {
+		expression restapi.SelectorRequirement
+		valid      bool
+	}{
+		{restapi.SelectorRequirement{Key: "zone", Operator: restapi.SelectorOpIn, Values: []string{"a"}}, true},
+		{restapi.SelectorRequirement{Key: "zone", Operator: restapi.SelectorOpNotIn}, false},
+		{restapi.SelectorRequirement{Key: "zone", Operator: restapi.SelectorOpExists}, true},
+		{restapi.SelectorRequirement{Key: "zone", Operator: restapi.SelectorOpDoesNotExist, Values: []string{"a"}}, false},
+		{restapi.SelectorRequirement{Key: "memory", Operator: restapi.SelectorOpGt, Values: []string{"24"}}, true},
+		{restapi.SelectorRequirement{Key: "memory", Operator: restapi.SelectorOpLt, Values: []string{"large"}}, false},
+		{restapi.SelectorRequirement{Key: "memory", Operator: restapi.SelectorOpLt, Values: []string{"1", "2"}}, false},
+		{restapi.SelectorRequirement{Operator: restapi.SelectorOpExists}, false},
+		{restapi.SelectorRequirement{Key: "zone", Operator: "Near"}, false},
+	} {
+		if err := test.expression.Validate(); (err == nil) != test.valid {
+			t.Errorf("expected %+v to be valid %v, got %v", test.expression, test.valid, err)
+		}
+	}
+}
+
+func TestParseLabelsAndTaints(t *testing.T) {
+	labels, err := restapi.ParseLabels(" zone = us-east,memory=48")
+	compare(t, labels, map[string]string{"zone": "us-east", "memory": "48"}, err)
+
+	labels, err = restapi.ParseLabels("")
+	compare(t, labels, map[string]string{}, err)
+
+	taints, err := restapi.ParseTaints("gpu=shared:NoExecute,team=ml:PreferNoSchedule,spot=true")
+	compare(t, taints, map[string]string{"gpu": "shared:NoExecute", "team": "ml:PreferNoSchedule", "spot": "true"}, err)
+
+	for _, value := range []string{"zone", "=us-east", "zone=us=east"} {
+		_, err = restapi.ParseLabels(value)
+		if err == nil {
+			t.Errorf("expected labels %s to be invalid", value)
+		}
+	}
+
+	_, err = restapi.ParseTaints("gpu=shared:NoRun")
+	if err == nil {
+		t.Error("expected a taint with an unknown effect to be invalid")
+	}
+
+	for taint, expected := range map[string][2]string{
+		"shared":                  {"shared", restapi.TaintNoSchedule},
+		"shared:NoSchedule":       {"shared", restapi.TaintNoSchedule},
+		"shared:PreferNoSchedule": {"shared", restapi.TaintPreferNoSchedule},
+		"shared:NoExecute":        {"shared", restapi.TaintNoExecute},
+		":NoExecute":              {"", restapi.TaintNoExecute},
+	} {
+		value, effect := restapi.ParseTaint(taint)
+		if value != expected[0] || effect != expected[1] {
+			t.Errorf("expected taint %s to have value %s and effect %s, got %s and %s", taint, expected[0], expected[1], value, effect)
+		}
+	}
+}
+
+func TestTaintEffects(t *testing.T) {
+	taints := map[string]string{
+		"spot":  "true",
+		"team":  "ml:PreferNoSchedule",
+		"maint": "yes:NoExecute",
+	}
+
+	for _, test := range []struct {
+		tolerates   map[string]string
+		tolerated   bool
+		avoided     bool
+		evicted     bool
+		description string
+	}{
+		{map[string]string{}, false, true, true, "no tolerations"},
+		{map[string]string{"spot": "true", "maint": "yes"}, true, true, false, "tolerating the NoSchedule and NoExecute taints"},
+		{map[string]string{"spot": "true", "maint": "yes", "team": "ml"}, true, false, false, "tolerating every taint"},
+		{map[string]string{"spot": "true", "maint": "no", "team": "ml"}, false, false, true, "tolerating another value of the NoExecute taint"},
+		{map[string]string{"maint": "yes"}, false, true, false, "not tolerating the NoSchedule taint"},
+	} {
+		if tolerated := canTolerate(taints, test.tolerates); tolerated != test.tolerated {
+			t.Errorf("%s: expected tolerated %v, got %v", test.description, test.tolerated, tolerated)
+		}
+
+		if avoided := prefersToAvoid(taints, test.tolerates); avoided != test.avoided {
+			t.Errorf("%s: expected avoided %v, got %v", test.description, test.avoided, avoided)
+		}
+
+		if evicted := evicts(taints, test.tolerates); evicted != test.evicted {
+			t.Errorf("%s: expected evicted %v, got %v", test.description, test.evicted, evicted)
+		}
+	}
+
+	if !canTolerate(nil, nil) || prefersToAvoid(nil, nil) || evicts(nil, nil) {
+		t.Error("expected an agent without taints to accept every session")
+	}
+}
+
+func TestSelectorPlacement(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vram := uint64(8 * 1024 * 1024 * 1024)
+
+		registerLabeledAgent := func(labels map[string]string, taints map[string]string) string {
+			t.Helper()
+
+			agent := defaultAgent(vram)
+			agent.Labels = labels
+			agent.Taints = taints
+			return registerAgent(t, db, agent).Id
+		}
+
+		smallId := registerLabeledAgent(map[string]string{"memory": "24"}, map[string]string{})
+		largeId := registerLabeledAgent(map[string]string{"memory": "80"}, map[string]string{})
+		avoidedId := registerLabeledAgent(map[string]string{"memory": "80"}, map[string]string{"team": "ml:PreferNoSchedule"})
+
+		requestSession := func() string {
+			t.Helper()
+
+			requirements := defaultSessionRequirements(vram)
+			requirements.MatchExpressions = []restapi.SelectorRequirement{
+				{Key: "memory", Operator: restapi.SelectorOpGt, Values: []string{"48"}},
+			}
+			return queueSession(t, db, requirements)
+		}
+
+		update := func() {
+			t.Helper()
+
+			err := backend.update(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+		}
+
+		checkAgentOf := func(sessionId string, agentId string) {
+			t.Helper()
+
+			agent, err := db.GetAgentById(agentId)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, session := range agent.Sessions {
+				if session.Id == sessionId {
+					return
+				}
+			}
+
+			t.Errorf("expected session %s on agent %s", sessionId, agentId)
+		}
+
+		// The agent with the PreferNoSchedule taint is only used once the other
+		// agent matching the expression is full
+		firstId := requestSession()
+		update()
+		checkAgentOf(firstId, largeId)
+
+		secondId := requestSession()
+		update()
+		checkAgentOf(secondId, avoidedId)
+
+		thirdId := requestSession()
+		update()
+
+		session, err := db.GetSessionById(thirdId)
+		if err != nil {
+			t.Fatal(err)
+		} else if session.State != restapi.SessionQueued {
+			t.Errorf("expected the session not to be assigned to agent %s, state = %s", smallId, session.State)
+		}
+
+		// Sessions not tolerating a NoExecute taint added to their agent are canceled
+		err = db.SetAgentTaints(largeId, map[string]string{"maint": "yes:NoExecute"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		update()
+
+		session, err = db.GetSessionById(firstId)
+		if err != nil {
+			t.Fatal(err)
+		} else if session.State != restapi.SessionCanceling {
+			t.Errorf("expected the session to be evicted, state = %s", session.State)
+		}
+
+		session, err = db.GetSessionById(secondId)
+		if err != nil {
+			t.Fatal(err)
+		} else if session.State != restapi.SessionAssigned {
+			t.Errorf("expected the session on the agent without a NoExecute taint to remain assigned, state = %s", session.State)
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestValidatePreference(t *testing.T) {
+	for _, test := range []struct {
+		preference restapi.Preference
+		valid      bool
+	}{
+		{restapi.Preference{Type: restapi.PreferLabel, Weight: 10, Key: "zone"}, true},
+		{restapi.Preference{Type: restapi.PreferLabel, Weight: 10}, false},
+		{restapi.Preference{Type: restapi.PreferGpu, Weight: 100, Values: []string{"A100"}}, true},
+		{restapi.Preference{Type: restapi.PreferGpu, Weight: 10}, false},
+		{restapi.Preference{Type: restapi.PreferLowUtilization, Weight: 1}, true},
+		{restapi.Preference{Type: restapi.PreferLowUtilization}, false},
+		{restapi.Preference{Type: restapi.PreferLowUtilization, Weight: 101}, false},
+		{restapi.Preference{Type: "fastest", Weight: 10}, false},
+	} {
+		if err := test.preference.Validate(); (err == nil) != test.valid {
+			t.Errorf("expected %+v to be valid %v, got %v", test.preference, test.valid, err)
+		}
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vram := uint64(8 * 1024 * 1024 * 1024)
+
+		registerScoredAgent := func(zone string, name string, utilization uint32) string {
+			t.Helper()
+
+			agent := defaultAgent(vram)
+			if zone != "" {
+				agent.Labels = map[string]string{"zone": zone}
+			}
+			agent.Gpus[0].Name = name
+			agent.Gpus[0].Metrics.UtilizationGpu = utilization
+			return registerAgent(t, db, agent).Id
+		}
+
+		busyId := registerScoredAgent("a", "T4", 90)
+		idleId := registerScoredAgent("b", "A100", 10)
+		registerScoredAgent("", "A100", 50)
+
+		assign := func(preferences ...restapi.Preference) restapi.SessionPlacement {
+			t.Helper()
+
+			requirements := defaultSessionRequirements(vram / 8)
+			requirements.Preferences = preferences
+			sessionId := queueSession(t, db, requirements)
+
+			err := backend.update(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+
+			placement, err := db.GetSessionPlacement(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			session, err := db.GetSessionById(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			} else if session.State != restapi.SessionAssigned {
+				t.Errorf("expected the session to be assigned, state = %s", session.State)
+			}
+
+			return placement
+		}
+
+		// Every agent able to host the session is scored, the label outweighs
+		// the utilization of the agent
+		placement := assign(
+			restapi.Preference{Type: restapi.PreferLabel, Weight: 50, Key: "zone", Values: []string{"a"}},
+			restapi.Preference{Type: restapi.PreferLowUtilization, Weight: 10},
+		)
+
+		if placement.AgentId != busyId {
+			t.Errorf("expected the agent with the preferred label, got %s", placement.AgentId)
+		}
+
+		if len(placement.Candidates) != 3 {
+			t.Fatalf("expected 3 candidates, got %d", len(placement.Candidates))
+		}
+
+		if score := placement.Candidates[0].Score; score != 51 {
+			t.Errorf("expected a score of 51, got %v", score)
+		}
+
+		if len(placement.Candidates[0].Components) != 2 {
+			t.Errorf("expected a score component for each preference, got %+v", placement.Candidates[0].Components)
+		}
+
+		// Among the agents with the preferred GPU, the least utilized is chosen
+		placement = assign(
+			restapi.Preference{Type: restapi.PreferGpu, Weight: 20, Values: []string{"A100"}},
+			restapi.Preference{Type: restapi.PreferLowUtilization, Weight: 10},
+		)
+
+		if placement.AgentId != idleId {
+			t.Errorf("expected the least utilized agent with the preferred GPU, got %s", placement.AgentId)
+		}
+
+		if score := placement.Candidates[0].Score; score != 29 {
+			t.Errorf("expected a score of 29, got %v", score)
+		}
+
+		if score := placement.Candidates[2].Score; score != 1 {
+			t.Errorf("expected the agent without the preferred GPU to rank last with a score of 1, got %v", score)
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestComputeShare(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vram := uint64(8 * 1024 * 1024 * 1024)
+		registerAgent(t, db, defaultAgent(vram))
+
+		requestSession := func(computeShare int) string {
+			t.Helper()
+
+			requirements := defaultSessionRequirements(vram / 8)
+			requirements.Gpus[0].ComputeShare = computeShare
+			return queueSession(t, db, requirements)
+		}
+
+		checkState := func(sessionId string, state string) {
+			t.Helper()
+
+			session, err := db.GetSessionById(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			} else if session.State != state {
+				t.Errorf("expected session %s to be %s, got %s", sessionId, state, session.State)
+			}
+		}
+
+		// The VRAM of the GPU fits every session but its compute does not
+		firstId := requestSession(60)
+		secondId := requestSession(60)
+		thirdId := requestSession(40)
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		checkState(firstId, restapi.SessionAssigned)
+		checkState(secondId, restapi.SessionQueued)
+		checkState(thirdId, restapi.SessionAssigned)
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestExplain(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		backend, err := NewBackend(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vram := uint64(8 * 1024 * 1024 * 1024)
+
+		registerExplainedAgent := func(update func(agent *restapi.Agent)) string {
+			t.Helper()
+
+			agent := defaultAgent(vram)
+			agent.Labels = map[string]string{"gpu": "a100"}
+			update(&agent)
+			return registerAgent(t, db, agent).Id
+		}
+
+		matchingId := registerExplainedAgent(func(agent *restapi.Agent) {})
+		noPoolId := registerExplainedAgent(func(agent *restapi.Agent) { agent.PoolId = "" })
+		registerExplainedAgent(func(agent *restapi.Agent) { agent.PoolId = "OtherPool" })
+		unlabeledId := registerExplainedAgent(func(agent *restapi.Agent) { agent.Labels = map[string]string{} })
+		taintedId := registerExplainedAgent(func(agent *restapi.Agent) { agent.Taints = map[string]string{"team": "ml"} })
+		smallId := registerExplainedAgent(func(agent *restapi.Agent) { agent.Gpus[0].Vram = vram / 4 })
+		splitId := registerExplainedAgent(func(agent *restapi.Agent) {
+			agent.Gpus[0].Vram = vram / 2
+			agent.Gpus = append(agent.Gpus, agent.Gpus[0])
+			agent.Gpus[1].Index = 1
+		})
+		missingId := registerExplainedAgent(func(agent *restapi.Agent) {})
+
+		err = db.UpdateAgent(restapi.AgentUpdate{Id: missingId, State: restapi.AgentMissing})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		requirements := defaultSessionRequirements(vram / 2)
+		requirements.PoolId = "TestPool"
+		requirements.MatchLabels = map[string]string{"gpu": "a100"}
+		requirements.Gpus[0].VramRequired = vram * 3 / 4
+
+		explanation, err := backend.Explain(storage.QueuedSession{Requirements: requirements}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if explanation.Reason != "" {
+			t.Errorf("expected the session to be schedulable, got %s", explanation.Reason)
+		}
+
+		if explanation.AgentId != matchingId {
+			t.Errorf("expected agent %s, got %s", matchingId, explanation.AgentId)
+		}
+
+		expected := map[string]string{
+			matchingId:  "",
+			noPoolId:    restapi.RejectPool,
+			unlabeledId: restapi.RejectLabels,
+			taintedId:   restapi.RejectTaint,
+			smallId:     restapi.RejectVram,
+			splitId:     restapi.RejectGpus,
+			missingId:   restapi.RejectAgentState,
+		}
+
+		if len(explanation.Agents) != len(expected) {
+			t.Errorf("expected %d agents to be explained, got %d", len(expected), len(explanation.Agents))
+		}
+
+		for _, agent := range explanation.Agents {
+			reason, found := expected[agent.AgentId]
+			if !found {
+				t.Errorf("unexpected agent %s", agent.AgentId)
+				continue
+			}
+
+			if reason == "" {
+				if len(agent.Rejections) != 0 || agent.Score == nil {
+					t.Errorf("expected agent %s to be scored, got %v", agent.AgentId, agent.Rejections)
+				}
+			} else if len(agent.Rejections) != 1 || agent.Rejections[0].Reason != reason {
+				t.Errorf("expected agent %s to be rejected for %s, got %v", agent.AgentId, reason, agent.Rejections)
+			}
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestExpireSessionFailures(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		agent := registerAgent(t, db, defaultAgent(24*1024*1024*1024))
+
+		requirements := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		requirements.PoolId = agent.PoolId
+		requirements.MaxDuration = 60
+		failingId := queueSession(t, db, requirements)
+		expiredId := queueSession(t, db, requirements)
+
+		backend, err := NewBackend(failingStorage{db, map[string]bool{failingId: true}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A session failing to be canceled does not prevent the others from expiring
+		err = backend.expireSessions(time.Now().Add(time.Hour))
+		if err != nil {
+			t.Error(err)
+		}
+
+		for sessionId, state := range map[string]string{failingId: restapi.SessionAssigned, expiredId: restapi.SessionCanceling} {
+			session, err := db.GetSessionById(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			} else if session.State != state {
+				t.Errorf("expected session %s to be %s, state = %s", sessionId, state, session.State)
+			}
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestExpireLeaseFailures(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		requirements := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		failingId := queueSession(t, db, requirements)
+		expiredId := queueSession(t, db, requirements)
+
+		backend, err := NewBackend(failingStorage{db, map[string]bool{failingId: true}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, sessionId := range []string{failingId, expiredId} {
+			err = db.RenewSessionLease(sessionId, time.Now().Add(time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// A session failing to be canceled does not prevent the others from expiring
+		err = backend.expireLeases(time.Now().Add(2 * time.Minute))
+		if err != nil {
+			t.Error(err)
+		}
+
+		for sessionId, state := range map[string]string{failingId: restapi.SessionQueued, expiredId: restapi.SessionClosed} {
+			session, err := db.GetSessionById(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			} else if session.State != state {
+				t.Errorf("expected session %s to be %s, state = %s", sessionId, state, session.State)
+			}
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestDrainFailures(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		agent := registerAgent(t, db, defaultAgent(24*1024*1024*1024))
+
+		requirements := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		requirements.PoolId = agent.PoolId
+		failingId := queueSession(t, db, requirements)
+		drainedId := queueSession(t, db, requirements)
+
+		backend, err := NewBackend(failingStorage{db, map[string]bool{failingId: true}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deadline := time.Now().Add(-time.Second)
+		err = db.SetAgentDrainState(agent.Id, restapi.AgentDraining, &deadline)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A session failing to be canceled does not prevent the others from being drained
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		for sessionId, state := range map[string]string{failingId: restapi.SessionAssigned, drainedId: restapi.SessionCanceling} {
+			session, err := db.GetSessionById(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			} else if session.State != state {
+				t.Errorf("expected session %s to be %s, state = %s", sessionId, state, session.State)
+			}
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestEvictSessionFailures(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		agent := registerAgent(t, db, defaultAgent(24*1024*1024*1024))
+
+		requirements := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		requirements.PoolId = agent.PoolId
+		failingId := queueSession(t, db, requirements)
+		evictedId := queueSession(t, db, requirements)
+
+		backend, err := NewBackend(failingStorage{db, map[string]bool{failingId: true}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.SetAgentTaints(agent.Id, map[string]string{"maint": "yes:NoExecute"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A session failing to be canceled does not prevent the others from being evicted
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		for sessionId, state := range map[string]string{failingId: restapi.SessionAssigned, evictedId: restapi.SessionCanceling} {
+			session, err := db.GetSessionById(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			} else if session.State != state {
+				t.Errorf("expected session %s to be %s, state = %s", sessionId, state, session.State)
+			}
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestSessionGroupFailures(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		vram := uint64(8 * 1024 * 1024 * 1024)
+		registerAgent(t, db, defaultAgent(vram))
+
+		requirements := defaultSessionRequirements(vram)
+		requirements.PoolId = "TestPool"
+
+		groupId, err := db.RequestSessionGroup(restapi.SessionGroupRequirements{
+			Members: 3,
+			Session: requirements,
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		group, err := db.GetSessionGroup(groupId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The group lost a member, its remaining members are canceled
+		err = db.CancelSession(group.Sessions[0].Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		failingId, canceledId := group.Sessions[1].Id, group.Sessions[2].Id
+		sessionId := queueSession(t, db, requirements)
+
+		backend, err := NewBackend(failingStorage{db, map[string]bool{failingId: true}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A member failing to be canceled does not prevent the other sessions
+		// from being scheduled
+		err = backend.update(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+
+		for sessionId, state := range map[string]string{failingId: restapi.SessionQueued, canceledId: restapi.SessionClosed, sessionId: restapi.SessionAssigned} {
+			session, err := db.GetSessionById(sessionId)
+			if err != nil {
+				t.Fatal(err)
+			} else if session.State != state {
+				t.Errorf("expected session %s to be %s, state = %s", sessionId, state, session.State)
+			}
+		}
+	}
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
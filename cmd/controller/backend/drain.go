@@ -0,0 +1,70 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package backend
+
+import (
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// Agents registered prior to the drain state being stored have an empty drain state
+func isSchedulable(agent restapi.Agent) bool {
+	return agent.DrainState == "" || agent.DrainState == restapi.AgentSchedulable
+}
+
+// drainAgents marks the draining agents without open sessions as drained and
+// cancels the sessions of the draining agents whose deadline has passed.
+// Sessions which fail to be canceled are logged and retried on the next update.
+func (backend *Backend) drainAgents() error {
+	agents, err := backend.storage.GetDrainingAgents()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, agent := range agents {
+		if len(agent.Sessions) == 0 {
+			logger.Debugf("agent %s has drained", agent.Id)
+
+			err = backend.storage.SetAgentDrainState(agent.Id, restapi.AgentDrained, nil)
+			if err != nil {
+				logger.Errorf("unable to mark agent %s as drained, %s", agent.Id, err.Error())
+				continue
+			}
+
+			backend.events.Publish(restapi.Event{
+				Type:    restapi.EventAgentDrainState,
+				PoolId:  agent.PoolId,
+				AgentId: agent.Id,
+				State:   restapi.AgentDrained,
+			})
+			continue
+		}
+
+		if agent.DrainDeadline == nil || now.Before(*agent.DrainDeadline) {
+			continue
+		}
+
+		for _, session := range agent.Sessions {
+			if session.State == restapi.SessionCanceling || session.State == restapi.SessionClosed {
+				continue
+			}
+
+			logger.Debugf("canceling session %s, agent %s has passed its drain deadline", session.Id, agent.Id)
+
+			err = backend.storage.CancelSession(session.Id)
+			if err != nil {
+				logger.Errorf("unable to cancel session %s, %s", session.Id, err.Error())
+				continue
+			}
+
+			backend.publishSessionState(session.Id, agent.Id)
+		}
+	}
+
+	return nil
+}
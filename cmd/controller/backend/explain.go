@@ -0,0 +1,227 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// describeRejection returns why the agent failed the check giving the reason
+func describeRejection(reason string, agent restapi.Agent, requirements restapi.SessionRequirements) string {
+	switch reason {
+	case restapi.RejectUnschedulable:
+		return fmt.Sprintf("agent is %s", agent.DrainState)
+
+	case restapi.RejectPool:
+		return fmt.Sprintf("agent belongs to pool %s, pool %s requested", agent.PoolId, requirements.PoolId)
+
+	case restapi.RejectLabels:
+		var mismatches []string
+		for key, value := range requirements.MatchLabels {
+			actual, present := agent.Labels[key]
+			if !present {
+				mismatches = append(mismatches, fmt.Sprintf("label %s is missing", key))
+			} else if actual != value {
+				mismatches = append(mismatches, fmt.Sprintf("label %s is %s, %s required", key, actual, value))
+			}
+		}
+		sort.Strings(mismatches)
+
+		return strings.Join(mismatches, ", ")
+
+	case restapi.RejectExpressions:
+		var mismatches []string
+		for _, expression := range requirements.MatchExpressions {
+			if !matchesExpression(agent.Labels, expression) {
+				mismatches = append(mismatches, fmt.Sprintf("%s %s %v", expression.Key, expression.Operator, expression.Values))
+			}
+		}
+
+		return "labels do not satisfy " + strings.Join(mismatches, ", ")
+
+	case restapi.RejectTaint:
+		var untolerated []string
+		for key, taint := range agent.Taints {
+			if !canTolerate(map[string]string{key: taint}, requirements.Tolerates) {
+				untolerated = append(untolerated, fmt.Sprintf("%s=%s", key, taint))
+			}
+		}
+		sort.Strings(untolerated)
+
+		return "taints are not tolerated, " + strings.Join(untolerated, ", ")
+	}
+
+	return reason
+}
+
+// explainGpus returns why no set of the GPUs of the agent satisfies the session
+func (backend *Backend) explainGpus(agent restapi.Agent, requirements restapi.SessionRequirements, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+
+	gpuSet, err := newAgentGpuSet(agent, agent.Sessions, backend.placement)
+	if err != nil {
+		return err.Error()
+	}
+
+	reasons := gpuSet.Explain(requirements.Gpus)
+	if len(reasons) == 0 {
+		return fmt.Sprintf("fewer than %d distinct GPUs satisfy the requirements", len(requirements.Gpus))
+	}
+
+	return strings.Join(reasons, ", ")
+}
+
+// getAgents returns every agent of the pool and every agent without a pool, of
+// any state. Every agent is returned when the pool is empty.
+func (backend *Backend) getAgents(poolId string) ([]restapi.Agent, error) {
+	agents := make([]restapi.Agent, 0)
+
+	// Agents without a pool are excluded by the pools of the filter
+	page := storage.Page{Limit: storage.MaxPageLimit}
+	for {
+		pageAgents, next, err := backend.storage.ListAgents(storage.AgentFilter{}, page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, agent := range pageAgents {
+			if poolId == "" || agent.PoolId == poolId || agent.PoolId == "" {
+				agents = append(agents, agent)
+			}
+		}
+
+		if next == "" {
+			return agents, nil
+		}
+
+		page.Cursor = next
+	}
+}
+
+// Explain reports how an update would treat the session at the time given,
+// using the checks of the update. The members of a group are explained as if
+// scheduled alone, regardless of the topology of the group.
+func (backend *Backend) Explain(session storage.QueuedSession, now time.Time) (restapi.SchedulingExplanation, error) {
+	explanation := restapi.SchedulingExplanation{
+		SessionId: session.Id,
+		Agents:    make([]restapi.AgentExplanation, 0),
+	}
+
+	err := validateSession(session)
+	if err != nil {
+		explanation.Reason = err.Error()
+		return explanation, nil
+	}
+
+	holds, err := backend.holdReservations(now)
+	if err != nil {
+		return restapi.SchedulingExplanation{}, err
+	}
+
+	reservationId, reason := holds.admit(session.Requirements, 1)
+	if reservationId == "" && reason == "" {
+		members := 1
+		if session.GroupId != "" {
+			group, err := backend.storage.GetSessionGroup(session.GroupId)
+			if err != nil {
+				return restapi.SchedulingExplanation{}, err
+			}
+
+			members = len(group.Sessions)
+		}
+
+		reason, err = newQuotaTracker(backend.storage).check(session, members)
+		if err != nil {
+			return restapi.SchedulingExplanation{}, err
+		}
+	}
+
+	explanation.Reason = reason
+
+	// The agents an update considers, with the GPUs held for reservations
+	agentIterator, err := backend.storage.GetAvailableAgentsMatching(storage.TotalVramRequired(session.Requirements))
+	if err != nil {
+		return restapi.SchedulingExplanation{}, err
+	}
+
+	available := map[string]restapi.Agent{}
+	heldIterator := holds.iterator(agentIterator, reservationId)
+	for heldIterator.Next() {
+		agent := heldIterator.Value()
+		available[agent.Id] = agent
+	}
+
+	agents, err := backend.getAgents(session.Requirements.PoolId)
+	if err != nil {
+		return restapi.SchedulingExplanation{}, err
+	}
+
+	var candidates []restapi.Agent
+	for _, agent := range agents {
+		agentExplanation := restapi.AgentExplanation{
+			AgentId:    agent.Id,
+			Hostname:   agent.Hostname,
+			State:      agent.State,
+			Rejections: make([]restapi.Rejection, 0),
+		}
+
+		reject := func(reason string, message string) {
+			agentExplanation.Rejections = append(agentExplanation.Rejections, restapi.Rejection{
+				Reason:  reason,
+				Message: message,
+			})
+		}
+
+		if held, found := available[agent.Id]; found {
+			for _, check := range agentChecks {
+				if !check.accepts(held, session.Requirements) {
+					reject(check.reason, describeRejection(check.reason, held, session.Requirements))
+				}
+			}
+
+			if len(agentExplanation.Rejections) == 0 {
+				selectedGpus, _, err := agentMatches(held, session.Requirements, backend.placement)
+				if err != nil || selectedGpus == nil {
+					reject(restapi.RejectGpus, backend.explainGpus(held, session.Requirements, err))
+				} else {
+					candidates = append(candidates, held)
+				}
+			}
+		} else if agent.State != restapi.AgentActive {
+			reject(restapi.RejectAgentState, fmt.Sprintf("agent is %s", agent.State))
+		} else {
+			reject(restapi.RejectVram, fmt.Sprintf("agent has less VRAM available than the %dMB required",
+				storage.TotalVramRequired(session.Requirements)/(1024*1024)))
+		}
+
+		explanation.Agents = append(explanation.Agents, agentExplanation)
+	}
+
+	ranked := backend.rankAgents(storage.NewDefaultIterator(candidates), session.Requirements)
+
+	scores := make(map[string]restapi.AgentScore, len(ranked))
+	for _, candidate := range ranked {
+		scores[candidate.agent.Id] = candidate.score
+	}
+
+	for index := range explanation.Agents {
+		if score, found := scores[explanation.Agents[index].AgentId]; found {
+			explanation.Agents[index].Score = &score
+		}
+	}
+
+	if reason == "" && len(ranked) > 0 {
+		explanation.AgentId = ranked[0].agent.Id
+	}
+
+	return explanation, nil
+}
@@ -0,0 +1,249 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package backend
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+)
+
+// Usage older than this many half-lives is negligible and not retrieved
+const fairShareHalfLives = 8
+
+// fairShare orders the queued sessions of equal priority by the deficit between
+// the share of the GPUs of their user and pool and their recent usage
+type fairShare struct {
+	halfLife time.Duration
+	weights  map[string]float64 // The weight of each pool, pools not listed have a weight of 1
+}
+
+// parseFairShareWeights parses a comma separated list of pool ID=weight
+func parseFairShareWeights(value string) (map[string]float64, error) {
+	weights := map[string]float64{}
+	if value == "" {
+		return weights, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		poolId, weightStr, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || poolId == "" {
+			return nil, fmt.Errorf("expected pool ID=weight, got %s", entry)
+		}
+
+		weight, err := strconv.ParseFloat(weightStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("weight of pool %s is invalid, %w", poolId, err)
+		}
+
+		if weight <= 0 {
+			return nil, fmt.Errorf("weight of pool %s must be positive", poolId)
+		}
+
+		weights[poolId] = weight
+	}
+
+	return weights, nil
+}
+
+func (share *fairShare) weight(poolId string) float64 {
+	weight, found := share.weights[poolId]
+	if !found {
+		return 1
+	}
+
+	return weight
+}
+
+// decayedUsage returns the GPU hours used between start and end, each instant
+// of use decaying by half every half-life until now
+func decayedUsage(gpus int, start time.Time, end time.Time, now time.Time, halfLife time.Duration) float64 {
+	if gpus == 0 || !start.Before(end) {
+		return 0
+	}
+
+	decay := math.Ln2 / halfLife.Hours()
+	return float64(gpus) / decay *
+		(math.Exp(-decay*now.Sub(end).Hours()) - math.Exp(-decay*now.Sub(start).Hours()))
+}
+
+// usage returns the decayed GPU usage of every user of every pool, from the
+// sessions closed within the history considered and the sessions still open
+func (share *fairShare) usage(db storage.Storage, now time.Time) (map[quotaKey]float64, error) {
+	usage := map[quotaKey]float64{}
+
+	records, err := db.GetUsageRecords(storage.UsageFilter{
+		From: now.Add(-fairShareHalfLives * share.halfLife),
+		To:   now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		if record.AssignedAt != nil {
+			key := quotaKey{poolId: record.PoolId, userId: record.UserId}
+			usage[key] += decayedUsage(len(record.Gpus), *record.AssignedAt, record.ClosedAt, now, share.halfLife)
+		}
+	}
+
+	sessions, err := db.GetOpenSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		key := quotaKey{poolId: session.PoolId, userId: session.UserId}
+		usage[key] += decayedUsage(len(session.Gpus), session.Assigned, now, now, share.halfLife)
+	}
+
+	return usage, nil
+}
+
+// fairShareQueue yields the queued sessions by priority and then by the deficit
+// of their user, sessions of the same deficit in the order they were requested.
+// The share of a pool is its weight over the weights of the pools with queued
+// sessions or recent usage, split evenly between the users of the pool. The
+// deficit is the share less the fraction of the recent usage of the user. The
+// deficits are recomputed as sessions are assigned, each GPU assigned is charged
+// the usage of running for one half-life.
+type fairShareQueue struct {
+	share *fairShare
+	now   time.Time
+
+	sessions []storage.QueuedSession // The sessions yet to be yielded
+	current  storage.QueuedSession
+
+	usage       map[quotaKey]float64
+	users       map[string]map[string]bool
+	totalUsage  float64
+	totalWeight float64
+}
+
+func (share *fairShare) queue(sessions []storage.QueuedSession, usage map[quotaKey]float64, now time.Time) *fairShareQueue {
+	queue := &fairShareQueue{
+		share:    share,
+		now:      now,
+		sessions: sessions,
+		usage:    usage,
+		users:    map[string]map[string]bool{},
+	}
+
+	addUser := func(key quotaKey) {
+		if queue.users[key.poolId] == nil {
+			queue.users[key.poolId] = map[string]bool{}
+		}
+
+		queue.users[key.poolId][key.userId] = true
+	}
+
+	for key, used := range usage {
+		addUser(key)
+		queue.totalUsage += used
+	}
+
+	for _, session := range sessions {
+		addUser(quotaKey{poolId: session.Requirements.PoolId, userId: session.UserId})
+	}
+
+	for poolId := range queue.users {
+		queue.totalWeight += share.weight(poolId)
+	}
+
+	return queue
+}
+
+func (queue *fairShareQueue) deficit(session storage.QueuedSession) float64 {
+	key := quotaKey{poolId: session.Requirements.PoolId, userId: session.UserId}
+
+	entitled := queue.share.weight(key.poolId) / queue.totalWeight / float64(len(queue.users[key.poolId]))
+	if queue.totalUsage == 0 {
+		return entitled
+	}
+
+	return entitled - queue.usage[key]/queue.totalUsage
+}
+
+// before returns whether the session a is scheduled before the session b
+func (queue *fairShareQueue) before(a, b storage.QueuedSession) bool {
+	if a.Requirements.Priority != b.Requirements.Priority {
+		return a.Requirements.Priority > b.Requirements.Priority
+	}
+
+	return queue.deficit(a) > queue.deficit(b)
+}
+
+func (queue *fairShareQueue) Next() bool {
+	if len(queue.sessions) == 0 {
+		return false
+	}
+
+	next := 0
+	for index := 1; index < len(queue.sessions); index++ {
+		if queue.before(queue.sessions[index], queue.sessions[next]) {
+			next = index
+		}
+	}
+
+	queue.current = queue.sessions[next]
+	queue.sessions = append(queue.sessions[:next], queue.sessions[next+1:]...)
+	return true
+}
+
+func (queue *fairShareQueue) Value() storage.QueuedSession {
+	return queue.current
+}
+
+// assigned charges the user of the session for the sessions assigned
+func (queue *fairShareQueue) assigned(session storage.QueuedSession, sessions int) {
+	gpus := sessions * len(session.Requirements.Gpus)
+	used := decayedUsage(gpus, queue.now.Add(-queue.share.halfLife), queue.now, queue.now, queue.share.halfLife)
+
+	queue.usage[quotaKey{poolId: session.Requirements.PoolId, userId: session.UserId}] += used
+	queue.totalUsage += used
+}
+
+// sessionQueue yields the queued sessions in the order they are scheduled in
+// and is told of the sessions assigned along the way
+type sessionQueue interface {
+	storage.Iterator[storage.QueuedSession]
+
+	assigned(session storage.QueuedSession, sessions int)
+}
+
+// requestQueue yields the queued sessions in the order returned by storage
+type requestQueue struct {
+	storage.Iterator[storage.QueuedSession]
+}
+
+func (requestQueue) assigned(session storage.QueuedSession, sessions int) {}
+
+// queuedSessions returns the queued sessions in the order they are scheduled
+// in, ordered by fair-share when enabled
+func (backend *Backend) queuedSessions(now time.Time) (sessionQueue, error) {
+	sessionIterator, err := backend.storage.GetQueuedSessionsIterator()
+	if err != nil {
+		return nil, err
+	}
+
+	if backend.fairShare == nil {
+		return requestQueue{sessionIterator}, nil
+	}
+
+	var sessions []storage.QueuedSession
+	for sessionIterator.Next() {
+		sessions = append(sessions, sessionIterator.Value())
+	}
+
+	usage, err := backend.fairShare.usage(backend.storage, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.fairShare.queue(sessions, usage, now), nil
+}
@@ -0,0 +1,191 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package backend
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// placeMembers places every session on the agents, each session accounting for
+// the GPUs reserved by the sessions placed before it. Returns the assignment
+// and placement of every session, nil unless every session can be placed.
+func (backend *Backend) placeMembers(agents []restapi.Agent, sessionIds []string, requirements restapi.SessionRequirements, now time.Time) ([]storage.SessionAssignment, []restapi.SessionPlacement) {
+	// The sessions of the agents are copied as the members placed are added to them
+	for index := range agents {
+		agents[index].Sessions = append([]restapi.Session{}, agents[index].Sessions...)
+	}
+
+	assignments := make([]storage.SessionAssignment, 0, len(sessionIds))
+	placements := make([]restapi.SessionPlacement, 0, len(sessionIds))
+	for _, sessionId := range sessionIds {
+		candidates := backend.rankAgents(storage.NewDefaultIterator(agents), requirements)
+		if len(candidates) == 0 {
+			return nil, nil
+		}
+
+		agent, gpus := candidates[0].agent, candidates[0].gpus.GetGpus()
+		assignments = append(assignments, storage.SessionAssignment{
+			SessionId: sessionId,
+			AgentId:   agent.Id,
+			Gpus:      gpus,
+		})
+		placements = append(placements, backend.placementOf(sessionId, candidates, now))
+
+		for index := range agents {
+			if agents[index].Id == agent.Id {
+				agents[index].Sessions = append(agents[index].Sessions, restapi.Session{
+					Id:    sessionId,
+					State: restapi.SessionAssigned,
+					Gpus:  gpus,
+				})
+			}
+		}
+	}
+
+	return assignments, placements
+}
+
+// placeGroup chooses the agent and GPUs of every member of a group among the
+// agents of the iterator, members may share an agent. With a topology label,
+// every member is placed on agents sharing the same value of the label.
+// Returns nil unless every member can be placed.
+func (backend *Backend) placeGroup(sessionIds []string, requirements restapi.SessionRequirements, topology restapi.GroupTopology, agentIterator storage.Iterator[restapi.Agent], now time.Time) ([]storage.SessionAssignment, []restapi.SessionPlacement) {
+	// The agents are split by the value of the topology label, a single domain
+	// holds every agent without one
+	domains := map[string][]restapi.Agent{}
+	for agentIterator.Next() {
+		agent := agentIterator.Value()
+		if !agentAccepts(agent, requirements) {
+			continue
+		}
+
+		domain := ""
+		if topology.SameLabel != "" {
+			value, found := agent.Labels[topology.SameLabel]
+			if !found {
+				continue
+			}
+
+			domain = value
+		}
+
+		domains[domain] = append(domains[domain], agent)
+	}
+
+	names := make([]string, 0, len(domains))
+	for name := range domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		assignments, placements := backend.placeMembers(domains[name], sessionIds, requirements, now)
+		if assignments != nil {
+			return assignments, placements
+		}
+	}
+
+	return nil, nil
+}
+
+// scheduleGroup assigns every queued member of the group of the session at
+// once. Groups which lost a member before being assigned can no longer be
+// assigned together, their remaining members are canceled, members failing to
+// be canceled are retried on the next update. Groups are not considered for
+// preemption.
+func (backend *Backend) scheduleGroup(session storage.QueuedSession, queue sessionQueue, quotas *quotaTracker, holds *reservationHolds) error {
+	group, err := backend.storage.GetSessionGroup(session.GroupId)
+	if err != nil {
+		return err
+	}
+
+	queued := make([]string, 0, len(group.Sessions))
+	for _, member := range group.Sessions {
+		if member.State == restapi.SessionQueued {
+			queued = append(queued, member.Id)
+		}
+	}
+
+	if len(queued) < len(group.Sessions) {
+		for _, sessionId := range queued {
+			logger.Debugf("canceling session %s, a member of group %s is no longer queued", sessionId, group.Id)
+
+			err = backend.storage.CancelSession(sessionId)
+			if err != nil {
+				logger.Errorf("unable to cancel session %s, %s", sessionId, err.Error())
+				continue
+			}
+
+			backend.publishSessionState(sessionId, "")
+		}
+
+		return nil
+	}
+
+	// Members exceeding a quota remain queued, the reason is stored with each
+	// member. Members admitted to a reservation are not held to the quotas.
+	reservationId, reason := holds.admit(session.Requirements, len(queued))
+	if reservationId == "" && reason == "" {
+		reason, err = quotas.check(session, len(queued))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, member := range group.Sessions {
+		if member.Reason != reason {
+			err = backend.storage.SetSessionReason(member.Id, reason)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if reason != "" {
+		logger.Debugf("group %s remains queued, %s", group.Id, reason)
+		return nil
+	}
+
+	agentIterator, err := backend.storage.GetAvailableAgentsMatching(storage.TotalVramRequired(session.Requirements))
+	if err != nil {
+		return err
+	}
+
+	assignments, placements := backend.placeGroup(queued, session.Requirements, group.Topology, holds.iterator(agentIterator, reservationId), holds.now)
+	if assignments == nil {
+		return nil
+	}
+
+	logger.Debugf("assigning the %d members of group %s", len(assignments), group.Id)
+
+	err = backend.storage.AssignSessions(assignments)
+	if err != nil {
+		return err
+	}
+
+	for _, placement := range placements {
+		backend.recordPlacement(placement)
+	}
+
+	queue.assigned(session, len(assignments))
+	quotas.assigned(session, len(assignments))
+	holds.release(reservationId, len(assignments)*len(session.Requirements.Gpus))
+
+	for _, assignment := range assignments {
+		backend.events.Publish(restapi.Event{
+			Type:      restapi.EventSessionState,
+			PoolId:    session.Requirements.PoolId,
+			AgentId:   assignment.AgentId,
+			SessionId: assignment.SessionId,
+			State:     restapi.SessionAssigned,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package backend
+
+import (
+	"fmt"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+type quotaKey struct {
+	poolId string
+	userId string
+}
+
+// quotaTracker caches the quotas and their usage for the duration of a single
+// update, accounting for the sessions assigned during the update
+type quotaTracker struct {
+	storage storage.Storage
+
+	quotas map[string]restapi.PoolQuota
+	usage  map[quotaKey]storage.QuotaUsage
+}
+
+func newQuotaTracker(db storage.Storage) *quotaTracker {
+	return &quotaTracker{
+		storage: db,
+		quotas:  map[string]restapi.PoolQuota{},
+		usage:   map[quotaKey]storage.QuotaUsage{},
+	}
+}
+
+func (tracker *quotaTracker) getQuota(poolId string) (restapi.PoolQuota, error) {
+	quota, found := tracker.quotas[poolId]
+	if !found {
+		var err error
+		quota, err = tracker.storage.GetPoolQuota(poolId)
+		if err != nil {
+			return restapi.PoolQuota{}, err
+		}
+
+		tracker.quotas[poolId] = quota
+	}
+
+	return quota, nil
+}
+
+func (tracker *quotaTracker) getUsage(key quotaKey) (storage.QuotaUsage, error) {
+	usage, found := tracker.usage[key]
+	if !found {
+		var err error
+		usage, err = tracker.storage.GetQuotaUsage(key.poolId, key.userId)
+		if err != nil {
+			return storage.QuotaUsage{}, err
+		}
+
+		tracker.usage[key] = usage
+	}
+
+	return usage, nil
+}
+
+func (tracker *quotaTracker) checkLimits(scope string, key quotaKey, limits restapi.QuotaLimits, requirements restapi.SessionRequirements, sessions int) (string, error) {
+	if limits == (restapi.QuotaLimits{}) {
+		return "", nil
+	}
+
+	usage, err := tracker.getUsage(key)
+	if err != nil {
+		return "", err
+	}
+
+	vramRequired := uint64(sessions) * storage.TotalVramRequired(requirements)
+	gpusRequired := sessions * len(requirements.Gpus)
+
+	if limits.MaxSessions > 0 && usage.Sessions+sessions > limits.MaxSessions {
+		return fmt.Sprintf("%s quota exceeded, %d of %d sessions in use", scope, usage.Sessions, limits.MaxSessions), nil
+	}
+
+	if limits.MaxGpus > 0 && usage.Gpus+gpusRequired > limits.MaxGpus {
+		return fmt.Sprintf("%s quota exceeded, requires %d GPUs with %d of %d in use", scope, gpusRequired, usage.Gpus, limits.MaxGpus), nil
+	}
+
+	if limits.MaxVram > 0 && usage.Vram+vramRequired > limits.MaxVram {
+		return fmt.Sprintf("%s quota exceeded, requires %dMB of VRAM with %dMB of %dMB in use", scope,
+			vramRequired/(1024*1024), usage.Vram/(1024*1024), limits.MaxVram/(1024*1024)), nil
+	}
+
+	return "", nil
+}
+
+// check returns the reason assigning the sessions would exceed the quota of
+// their pool or of their user within the pool, empty if the sessions are within
+// quota. The sessions share the requirements and user of the session given.
+func (tracker *quotaTracker) check(session storage.QueuedSession, sessions int) (string, error) {
+	poolId := session.Requirements.PoolId
+	if poolId == "" {
+		return "", nil
+	}
+
+	quota, err := tracker.getQuota(poolId)
+	if err != nil {
+		return "", err
+	}
+
+	reason, err := tracker.checkLimits("pool", quotaKey{poolId, ""}, quota.Pool, session.Requirements, sessions)
+	if reason != "" || err != nil {
+		return reason, err
+	}
+
+	if session.UserId != "" {
+		limits, found := quota.Users[session.UserId]
+		if found {
+			return tracker.checkLimits("user", quotaKey{poolId, session.UserId}, limits, session.Requirements, sessions)
+		}
+	}
+
+	return "", nil
+}
+
+// assigned records the resources of the newly assigned sessions against the
+// cached usage, the sessions share the requirements of the session given
+func (tracker *quotaTracker) assigned(session storage.QueuedSession, sessions int) {
+	poolId := session.Requirements.PoolId
+	if poolId == "" {
+		return
+	}
+
+	keys := []quotaKey{{poolId, ""}}
+	if session.UserId != "" {
+		keys = append(keys, quotaKey{poolId, session.UserId})
+	}
+
+	for _, key := range keys {
+		usage, found := tracker.usage[key]
+		if found {
+			usage.Sessions += sessions
+			usage.Vram += uint64(sessions) * storage.TotalVramRequired(session.Requirements)
+			usage.Gpus += sessions * len(session.Requirements.Gpus)
+			tracker.usage[key] = usage
+		}
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package backend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// A GPU held back on an agent for a reservation, represented as a session
+type heldGpu struct {
+	reservationId string
+	session       restapi.Session
+}
+
+// reservationHolds are the GPUs held back for the reservations whose window is
+// open during an update
+type reservationHolds struct {
+	now time.Time
+
+	reservations map[string]restapi.Reservation // The reservations yet to end by id
+	agents       map[string][]heldGpu           // The GPUs held on each agent by agent id
+	inUse        map[string]int                 // The GPUs used by the sessions of each reservation by id
+}
+
+// heldAgentIterator returns the agents along with the GPUs held on them as
+// sessions, except for those held for the reservation the session is admitted to
+type heldAgentIterator struct {
+	storage.Iterator[restapi.Agent]
+
+	holds         *reservationHolds
+	reservationId string
+}
+
+func (iterator heldAgentIterator) Value() restapi.Agent {
+	agent := iterator.Iterator.Value()
+
+	held := iterator.holds.agents[agent.Id]
+	if len(held) == 0 {
+		return agent
+	}
+
+	sessions := append([]restapi.Session{}, agent.Sessions...)
+	for _, gpu := range held {
+		if gpu.reservationId != iterator.reservationId {
+			sessions = append(sessions, gpu.session)
+		}
+	}
+	agent.Sessions = sessions
+
+	return agent
+}
+
+// iterator returns the agents of the iterator with the GPUs held for every
+// reservation but the one given, which may be empty
+func (holds *reservationHolds) iterator(agentIterator storage.Iterator[restapi.Agent], reservationId string) storage.Iterator[restapi.Agent] {
+	return heldAgentIterator{
+		Iterator:      agentIterator,
+		holds:         holds,
+		reservationId: reservationId,
+	}
+}
+
+// held returns whether the session stands for GPUs held for a reservation
+func (holds *reservationHolds) held(session restapi.Session) bool {
+	_, found := holds.reservations[session.Id]
+	return found
+}
+
+// admit returns the reservation whose held GPUs the sessions with the
+// requirements may use, empty if they are not admitted to one. Sessions whose
+// reservation has yet to start are given the reason they remain queued.
+// Sessions of a reservation which has ended, or whose GPUs would be exceeded
+// along with those in use, are scheduled like any other session.
+func (holds *reservationHolds) admit(requirements restapi.SessionRequirements, sessions int) (string, string) {
+	if requirements.ReservationId == "" {
+		return "", ""
+	}
+
+	reservation, found := holds.reservations[requirements.ReservationId]
+	if !found {
+		return "", ""
+	}
+
+	if reservation.Start.After(holds.now) {
+		return "", fmt.Sprintf("reservation %s starts at %s", reservation.Id, reservation.Start.UTC().Format(time.RFC3339))
+	}
+
+	if holds.inUse[reservation.Id]+sessions*len(requirements.Gpus) > len(reservation.Gpus) {
+		return "", ""
+	}
+
+	return reservation.Id, ""
+}
+
+// release stops holding as many GPUs of the reservation as were assigned to a
+// session admitted to it
+func (holds *reservationHolds) release(reservationId string, gpus int) {
+	if reservationId == "" {
+		return
+	}
+
+	holds.inUse[reservationId] += gpus
+
+	for agentId, held := range holds.agents {
+		remaining := held[:0]
+		for _, gpu := range held {
+			if gpus > 0 && gpu.reservationId == reservationId {
+				gpus--
+				continue
+			}
+
+			remaining = append(remaining, gpu)
+		}
+
+		holds.agents[agentId] = remaining
+	}
+}
+
+// holdReservations holds back the GPUs of the reservations whose window is
+// open, less the GPUs used by the sessions admitted to them. The GPUs are held
+// on the agents of the pool of the reservation using the placement strategy.
+func (backend *Backend) holdReservations(now time.Time) (*reservationHolds, error) {
+	holds := &reservationHolds{
+		now:          now,
+		reservations: map[string]restapi.Reservation{},
+		agents:       map[string][]heldGpu{},
+		inUse:        map[string]int{},
+	}
+
+	reservations, err := backend.storage.GetReservations(storage.ReservationFilter{From: now})
+	if err != nil {
+		return nil, err
+	}
+
+	open := make([]restapi.Reservation, 0, len(reservations))
+	for _, reservation := range reservations {
+		holds.reservations[reservation.Id] = reservation
+		if !reservation.Start.After(now) {
+			open = append(open, reservation)
+		}
+	}
+
+	if len(open) == 0 {
+		return holds, nil
+	}
+
+	sessions, err := backend.storage.GetOpenSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		if session.Requirements.ReservationId != "" {
+			holds.inUse[session.Requirements.ReservationId] += len(session.Gpus)
+		}
+	}
+
+	agentIterator, err := backend.storage.GetAvailableAgentsMatching(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var agents []restapi.Agent
+	for agentIterator.Next() {
+		agents = append(agents, agentIterator.Value())
+	}
+
+	for _, reservation := range open {
+		gpus := reservation.Gpus
+		if inUse := holds.inUse[reservation.Id]; inUse < len(gpus) {
+			gpus = gpus[inUse:]
+		} else {
+			continue
+		}
+
+		for _, gpu := range gpus {
+			requirements := restapi.SessionRequirements{
+				PoolId: reservation.PoolId,
+				Gpus:   []restapi.GpuRequirements{gpu},
+			}
+
+			agent, selectedGpus := backend.selectAgent(holds.iterator(storage.NewDefaultIterator(agents), ""), requirements)
+			if selectedGpus == nil {
+				logger.Debugf("unable to hold every GPU of reservation %s", reservation.Id)
+				break
+			}
+
+			holds.agents[agent.Id] = append(holds.agents[agent.Id], heldGpu{
+				reservationId: reservation.Id,
+				session: restapi.Session{
+					Id:     reservation.Id,
+					State:  restapi.SessionAssigned,
+					PoolId: reservation.PoolId,
+					Gpus:   selectedGpus.GetGpus(),
+				},
+			})
+		}
+	}
+
+	return holds, nil
+}
@@ -0,0 +1,214 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package backend
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	"github.com/Juice-Labs/Juice-Labs/pkg/gpu"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// The most candidates recorded with the placement of a session
+const maxPlacementCandidates = 10
+
+// An agent able to host a session along with the GPUs chosen on it
+type candidate struct {
+	agent restapi.Agent
+	gpus  *gpu.SelectedGpuSet
+	score restapi.AgentScore
+}
+
+// scorePreference returns the part of the weight of the preference satisfied
+// by the agent and the GPUs chosen on it
+func scorePreference(preference restapi.Preference, agent restapi.Agent, selectedGpus []restapi.SessionGpu) float64 {
+	weight := float64(preference.Weight)
+
+	gpus := make(map[int]restapi.Gpu, len(agent.Gpus))
+	for _, gpu := range agent.Gpus {
+		gpus[gpu.Index] = gpu
+	}
+
+	switch preference.Type {
+	case restapi.PreferLabel:
+		value, present := agent.Labels[preference.Key]
+		if !present {
+			return 0
+		}
+
+		if len(preference.Values) == 0 {
+			return weight
+		}
+
+		for _, expected := range preference.Values {
+			if value == expected {
+				return weight
+			}
+		}
+
+	case restapi.PreferGpu:
+		if len(selectedGpus) == 0 {
+			return 0
+		}
+
+		matching := 0
+		for _, selected := range selectedGpus {
+			gpu := gpus[selected.Index]
+			for _, expected := range preference.Values {
+				if gpu.Name == expected || gpu.Model == expected {
+					matching++
+					break
+				}
+			}
+		}
+
+		return weight * float64(matching) / float64(len(selectedGpus))
+
+	case restapi.PreferLowUtilization:
+		if len(agent.Gpus) == 0 {
+			return 0
+		}
+
+		var utilization float64
+		for _, gpu := range agent.Gpus {
+			if gpu.Metrics.UtilizationGpu < 100 {
+				utilization += float64(gpu.Metrics.UtilizationGpu)
+			} else {
+				utilization += 100
+			}
+		}
+		utilization /= float64(len(agent.Gpus))
+
+		return weight * (100 - utilization) / 100
+	}
+
+	return 0
+}
+
+// scoreAgent returns the score of an agent able to host a session, the sum of
+// the parts of the preferences of the session it satisfies
+func scoreAgent(agent restapi.Agent, selectedGpus *gpu.SelectedGpuSet, vramAvailable uint64, requirements restapi.SessionRequirements) restapi.AgentScore {
+	score := restapi.AgentScore{
+		AgentId:       agent.Id,
+		Avoided:       prefersToAvoid(agent.Taints, requirements.Tolerates),
+		VramAvailable: vramAvailable,
+		Components:    make([]restapi.ScoreComponent, 0, len(requirements.Preferences)),
+	}
+
+	gpus := selectedGpus.GetGpus()
+	for _, preference := range requirements.Preferences {
+		component := restapi.ScoreComponent{
+			Preference: preference,
+			Score:      scorePreference(preference, agent, gpus),
+		}
+
+		score.Score += component.Score
+		score.Components = append(score.Components, component)
+	}
+
+	return score
+}
+
+// better returns whether the candidate a ranks before the candidate b. Agents
+// with a PreferNoSchedule taint the session does not tolerate rank last, then
+// agents rank by score. Ties are broken by the placement strategy and then by
+// the agent id, except for FirstFit which keeps the order of the agents.
+func (backend *Backend) better(a, b candidate) bool {
+	if a.score.Avoided != b.score.Avoided {
+		return !a.score.Avoided
+	}
+
+	if a.score.Score != b.score.Score {
+		return a.score.Score > b.score.Score
+	}
+
+	if backend.placement == gpu.FirstFit {
+		return false
+	}
+
+	if a.score.VramAvailable != b.score.VramAvailable {
+		return backend.placement.Prefers(a.score.VramAvailable, b.score.VramAvailable)
+	}
+
+	return a.agent.Id < b.agent.Id
+}
+
+// rankAgents returns the agents able to host a session, best first. Agents are
+// considered in the order returned by storage. Without preferences, FirstFit
+// stops at the first agent which is not avoided.
+func (backend *Backend) rankAgents(agentIterator storage.Iterator[restapi.Agent], requirements restapi.SessionRequirements) []candidate {
+	var candidates []candidate
+
+	for agentIterator.Next() {
+		agent := agentIterator.Value()
+
+		selectedGpus, vramAvailable, err := agentMatches(agent, requirements, backend.placement)
+		if err != nil {
+			logger.Debugf("unable to match agent, %s", err.Error())
+			continue
+		}
+
+		if selectedGpus == nil {
+			continue
+		}
+
+		score := scoreAgent(agent, selectedGpus, vramAvailable, requirements)
+		candidates = append(candidates, candidate{agent, selectedGpus, score})
+
+		if backend.placement == gpu.FirstFit && len(requirements.Preferences) == 0 && !score.Avoided {
+			break
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return backend.better(candidates[i], candidates[j])
+	})
+
+	return candidates
+}
+
+// selectAgent chooses the agent to host a session, the highest ranked of the
+// agents able to host it. Returns nil GPUs when no agent can host the session.
+func (backend *Backend) selectAgent(agentIterator storage.Iterator[restapi.Agent], requirements restapi.SessionRequirements) (restapi.Agent, *gpu.SelectedGpuSet) {
+	candidates := backend.rankAgents(agentIterator, requirements)
+	if len(candidates) == 0 {
+		return restapi.Agent{}, nil
+	}
+
+	return candidates[0].agent, candidates[0].gpus
+}
+
+// placementOf returns the placement of a session assigned to the first of the
+// candidates at the time given
+func (backend *Backend) placementOf(sessionId string, candidates []candidate, now time.Time) restapi.SessionPlacement {
+	if len(candidates) > maxPlacementCandidates {
+		candidates = candidates[:maxPlacementCandidates]
+	}
+
+	placement := restapi.SessionPlacement{
+		SessionId:  sessionId,
+		AgentId:    candidates[0].agent.Id,
+		Placement:  backend.placement.String(),
+		AssignedAt: now.UTC(),
+		Candidates: make([]restapi.AgentScore, 0, len(candidates)),
+	}
+
+	for _, candidate := range candidates {
+		placement.Candidates = append(placement.Candidates, candidate.score)
+	}
+
+	return placement
+}
+
+// recordPlacement stores the placement of a session, failing to do so does not
+// prevent the session from running
+func (backend *Backend) recordPlacement(placement restapi.SessionPlacement) {
+	err := backend.storage.SetSessionPlacement(placement)
+	if err != nil {
+		logger.Debugf("unable to record the placement of session %s, %s", placement.SessionId, err.Error())
+	}
+}
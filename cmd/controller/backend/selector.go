@@ -0,0 +1,157 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package backend
+
+import (
+	"strconv"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+func isSubset(set, subset map[string]string) bool {
+	for key, value := range subset {
+		checkValue, present := set[key]
+		if !present || value != checkValue {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchesLabels(set, subset map[string]string) bool {
+	return isSubset(set, subset)
+}
+
+// matchesExpression returns whether the labels satisfy the expression, labels
+// compared with Gt or Lt which are not integers never match
+func matchesExpression(labels map[string]string, expression restapi.SelectorRequirement) bool {
+	value, present := labels[expression.Key]
+
+	switch expression.Operator {
+	case restapi.SelectorOpIn, restapi.SelectorOpNotIn:
+		in := false
+		if present {
+			for _, expected := range expression.Values {
+				if value == expected {
+					in = true
+					break
+				}
+			}
+		}
+
+		return in == (expression.Operator == restapi.SelectorOpIn)
+
+	case restapi.SelectorOpExists:
+		return present
+
+	case restapi.SelectorOpDoesNotExist:
+		return !present
+
+	case restapi.SelectorOpGt, restapi.SelectorOpLt:
+		if !present || len(expression.Values) != 1 {
+			return false
+		}
+
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+
+		bound, err := strconv.ParseInt(expression.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+
+		if expression.Operator == restapi.SelectorOpGt {
+			return number > bound
+		}
+
+		return number < bound
+	}
+
+	return false
+}
+
+func matchesExpressions(labels map[string]string, expressions []restapi.SelectorRequirement) bool {
+	for _, expression := range expressions {
+		if !matchesExpression(labels, expression) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// untoleratedEffects returns the effects of the taints which are not tolerated.
+// A taint is tolerated when the tolerates hold its key with the same value,
+// whatever its effect.
+func untoleratedEffects(taints, tolerates map[string]string) map[string]bool {
+	effects := map[string]bool{}
+	for key, taint := range taints {
+		value, effect := restapi.ParseTaint(taint)
+
+		tolerated, present := tolerates[key]
+		if !present || tolerated != value {
+			effects[effect] = true
+		}
+	}
+
+	return effects
+}
+
+// canTolerate returns whether a session may be assigned to an agent with the
+// taints, taints with the PreferNoSchedule effect do not prevent it
+func canTolerate(taints, tolerates map[string]string) bool {
+	effects := untoleratedEffects(taints, tolerates)
+	return !effects[restapi.TaintNoSchedule] && !effects[restapi.TaintNoExecute]
+}
+
+// prefersToAvoid returns whether an agent with the taints should only host a
+// session when no other agent can
+func prefersToAvoid(taints, tolerates map[string]string) bool {
+	return untoleratedEffects(taints, tolerates)[restapi.TaintPreferNoSchedule]
+}
+
+// evicts returns whether a session running on an agent with the taints must be
+// canceled
+func evicts(taints, tolerates map[string]string) bool {
+	return untoleratedEffects(taints, tolerates)[restapi.TaintNoExecute]
+}
+
+// evictSessions cancels the open sessions running on one of the agents with a
+// NoExecute taint the session does not tolerate. Sessions which fail to be
+// canceled are logged and retried on the next update.
+func (backend *Backend) evictSessions(agents []restapi.Agent) error {
+	sessions, err := backend.storage.GetOpenSessions()
+	if err != nil {
+		return err
+	}
+
+	taints := make(map[string]map[string]string, len(agents))
+	for _, agent := range agents {
+		taints[agent.Id] = agent.Taints
+	}
+
+	for _, session := range sessions {
+		// Agents which have been removed no longer run any session
+		agentTaints, found := taints[session.AgentId]
+		if !found || !evicts(agentTaints, session.Requirements.Tolerates) {
+			continue
+		}
+
+		logger.Debugf("canceling session %s, agent %s has a NoExecute taint it does not tolerate", session.Id, session.AgentId)
+
+		err = backend.storage.CancelSession(session.Id)
+		if err != nil {
+			logger.Errorf("unable to evict session %s, %s", session.Id, err.Error())
+			continue
+		}
+
+		backend.publishSessionState(session.Id, session.AgentId)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package backend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// sessionTimeouts returns the timeouts of the session, the timeouts the session
+// did not request are taken from the defaults of its pool
+func sessionTimeouts(session storage.OpenSession, defaults restapi.SessionTimeouts) restapi.SessionTimeouts {
+	timeouts := session.Requirements.SessionTimeouts
+
+	if timeouts.MaxDuration == 0 {
+		timeouts.MaxDuration = defaults.MaxDuration
+	}
+
+	if timeouts.IdleTimeout == 0 {
+		timeouts.IdleTimeout = defaults.IdleTimeout
+	}
+
+	return timeouts
+}
+
+// sessionExpired returns why the session has exceeded one of its timeouts,
+// empty if it has not
+func sessionExpired(session storage.OpenSession, timeouts restapi.SessionTimeouts, now time.Time) string {
+	if timeouts.MaxDuration > 0 {
+		maxDuration := time.Duration(timeouts.MaxDuration) * time.Second
+		if now.Sub(session.Assigned) > maxDuration {
+			return fmt.Sprintf("exceeded its maximum duration of %s", maxDuration)
+		}
+	}
+
+	if timeouts.IdleTimeout > 0 && session.IdleSince != nil {
+		idleTimeout := time.Duration(timeouts.IdleTimeout) * time.Second
+		if now.Sub(*session.IdleSince) > idleTimeout {
+			return fmt.Sprintf("idle for longer than %s", idleTimeout)
+		}
+	}
+
+	return ""
+}
+
+// expireSessions cancels the sessions which have been assigned for longer than
+// their maximum duration or have been idle for longer than their idle timeout.
+// Sessions failing to be checked or canceled are retried on the next update.
+func (backend *Backend) expireSessions(now time.Time) error {
+	sessions, err := backend.storage.GetOpenSessions()
+	if err != nil {
+		return err
+	}
+
+	// The defaults are only retrieved once per pool for each update
+	defaults := map[string]restapi.SessionTimeouts{}
+
+	for _, session := range sessions {
+		poolDefaults, found := defaults[session.PoolId]
+		if !found && session.PoolId != "" {
+			poolDefaults, err = backend.storage.GetSessionDefaults(session.PoolId)
+			if err != nil {
+				logger.Errorf("unable to retrieve the session defaults of pool %s, %s", session.PoolId, err.Error())
+				continue
+			}
+
+			defaults[session.PoolId] = poolDefaults
+		}
+
+		reason := sessionExpired(session, sessionTimeouts(session, poolDefaults), now)
+		if reason == "" {
+			continue
+		}
+
+		logger.Debugf("canceling session %s, %s", session.Id, reason)
+
+		err = backend.storage.CancelSession(session.Id)
+		if err != nil {
+			logger.Errorf("unable to cancel session %s, %s", session.Id, err.Error())
+			continue
+		}
+
+		backend.publishSessionState(session.Id, session.AgentId)
+	}
+
+	return nil
+}
+
+// expireLeases cancels the sessions whose client stopped renewing their lease.
+// Sessions failing to be canceled, such as those the client closed meanwhile,
+// are retried on the next update.
+func (backend *Backend) expireLeases(now time.Time) error {
+	sessions, err := backend.storage.GetSessionsWithExpiredLease(now)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		logger.Debugf("canceling session %s, its lease has expired", session.Id)
+
+		err = backend.storage.CancelSession(session.Id)
+		if err != nil {
+			logger.Errorf("unable to cancel session %s, %s", session.Id, err.Error())
+			continue
+		}
+
+		backend.publishSessionState(session.Id, "")
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// The number of events buffered for a subscriber before it is considered too
+// slow and is dropped
+const subscriptionBufferSize = 256
+
+// Broker distributes the events published by the frontend and backend to the
+// subscribers within the same process. The methods of a nil Broker do nothing.
+type Broker struct {
+	mutex sync.Mutex
+
+	nextId      uint64
+	subscribers map[*Subscription]struct{}
+}
+
+type Subscription struct {
+	broker *Broker
+	filter restapi.EventFilter
+	events chan restapi.Event
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// HasSubscribers allows publishers to skip gathering the state required to
+// build events when no one is listening
+func (broker *Broker) HasSubscribers() bool {
+	if broker == nil {
+		return false
+	}
+
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	return len(broker.subscribers) > 0
+}
+
+// Publish sends the event to every subscriber with a matching filter. Publish
+// never blocks, a subscriber unable to keep up is closed.
+func (broker *Broker) Publish(event restapi.Event) {
+	if broker == nil {
+		return
+	}
+
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	broker.nextId++
+	event.Id = broker.nextId
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	for subscription := range broker.subscribers {
+		if !subscription.filter.Matches(event) {
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+
+		default:
+			broker.unsubscribe(subscription)
+		}
+	}
+}
+
+// Subscribe returns a subscription receiving the events matching the filter,
+// the subscription must be closed once it is no longer used
+func (broker *Broker) Subscribe(filter restapi.EventFilter) *Subscription {
+	subscription := &Subscription{
+		broker: broker,
+		filter: filter,
+		events: make(chan restapi.Event, subscriptionBufferSize),
+	}
+
+	if broker != nil {
+		broker.mutex.Lock()
+		broker.subscribers[subscription] = struct{}{}
+		broker.mutex.Unlock()
+	}
+
+	return subscription
+}
+
+func (broker *Broker) unsubscribe(subscription *Subscription) {
+	if _, found := broker.subscribers[subscription]; found {
+		delete(broker.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+// Events returns the channel the events are delivered on. The channel is
+// closed when the subscription is closed or when the subscriber falls behind.
+func (subscription *Subscription) Events() <-chan restapi.Event {
+	return subscription.events
+}
+
+func (subscription *Subscription) Close() {
+	broker := subscription.broker
+	if broker == nil {
+		return
+	}
+
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	broker.unsubscribe(subscription)
+}
@@ -0,0 +1,84 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package events
+
+import (
+	"testing"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+func TestFilter(t *testing.T) {
+	broker := NewBroker()
+
+	all := broker.Subscribe(restapi.EventFilter{})
+	defer all.Close()
+
+	pool := broker.Subscribe(restapi.EventFilter{PoolId: "pool"})
+	defer pool.Close()
+
+	session := broker.Subscribe(restapi.EventFilter{SessionId: "session"})
+	defer session.Close()
+
+	broker.Publish(restapi.Event{Type: restapi.EventAgentRegistered, PoolId: "pool", AgentId: "agent"})
+	broker.Publish(restapi.Event{Type: restapi.EventSessionState, PoolId: "other", SessionId: "session", State: restapi.SessionQueued})
+
+	if len(all.Events()) != 2 {
+		t.Errorf("expected 2 events, received %d", len(all.Events()))
+	}
+
+	if len(pool.Events()) != 1 || (<-pool.Events()).AgentId != "agent" {
+		t.Error("expected only the agent event for the pool subscription")
+	}
+
+	if len(session.Events()) != 1 || (<-session.Events()).State != restapi.SessionQueued {
+		t.Error("expected only the session event for the session subscription")
+	}
+
+	first := <-all.Events()
+	second := <-all.Events()
+	if first.Id == 0 || second.Id <= first.Id {
+		t.Errorf("expected increasing event ids, received %d and %d", first.Id, second.Id)
+	}
+
+	if first.Time.IsZero() {
+		t.Error("expected the event time to be set")
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	broker := NewBroker()
+
+	subscription := broker.Subscribe(restapi.EventFilter{})
+	defer subscription.Close()
+
+	for i := 0; i <= subscriptionBufferSize; i++ {
+		broker.Publish(restapi.Event{Type: restapi.EventAgentState})
+	}
+
+	if broker.HasSubscribers() {
+		t.Error("expected the slow subscriber to be removed")
+	}
+
+	count := 0
+	for range subscription.Events() {
+		count++
+	}
+
+	if count != subscriptionBufferSize {
+		t.Errorf("expected %d buffered events, received %d", subscriptionBufferSize, count)
+	}
+}
+
+func TestNilBroker(t *testing.T) {
+	var broker *Broker
+
+	subscription := broker.Subscribe(restapi.EventFilter{})
+	broker.Publish(restapi.Event{Type: restapi.EventAgentState})
+	subscription.Close()
+
+	if broker.HasSubscribers() {
+		t.Error("expected a nil broker to have no subscribers")
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+var (
+	errForbidden = errors.New("forbidden")
+
+	// Any permission within a pool grants read access to the pool
+	poolMember = []restapi.Permission{
+		restapi.PermissionCreateSession,
+		restapi.PermissionRegisterAgent,
+		restapi.PermissionAdmin,
+	}
+)
+
+// Returns the validated claims of the request, nil if token validation is disabled
+func claimsFromRequest(r *http.Request) *validator.ValidatedClaims {
+	claims, ok := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		return nil
+	}
+
+	return claims
+}
+
+// Returns the subject of the validated JWT, empty if authentication is disabled
+func userIdFromRequest(r *http.Request) string {
+	claims := claimsFromRequest(r)
+	if claims == nil {
+		return ""
+	}
+
+	return claims.RegisteredClaims.Subject
+}
+
+// authorizedPools returns the set of pools in which the user making the request
+// holds any of the permissions. Returns nil if token validation is disabled.
+func (frontend *Frontend) authorizedPools(r *http.Request, permissions ...restapi.Permission) (map[string]bool, error) {
+	claims := claimsFromRequest(r)
+	if claims == nil {
+		return nil, nil
+	}
+
+	userId := claims.RegisteredClaims.Subject
+	if userId == "" {
+		return nil, errors.Join(errForbidden, errors.New("token does not specify a subject"))
+	}
+
+	userPermissions, err := frontend.getPermissions(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	pools := map[string]bool{}
+	for _, permission := range append(permissions, restapi.PermissionAdmin) {
+		for _, pool := range userPermissions.Permissions[permission] {
+			pools[pool.Id] = true
+		}
+	}
+
+	return pools, nil
+}
+
+// authorize ensures the user making the request holds one of the permissions
+// within the pool, the admin permission grants every permission. Resources not
+// belonging to a pool are only accessible when token validation is disabled, as
+// no permission is held outside of a pool. Every request is authorized when token
+// validation is disabled.
+func (frontend *Frontend) authorize(r *http.Request, poolId string, permissions ...restapi.Permission) error {
+	pools, err := frontend.authorizedPools(r, permissions...)
+	if err != nil || pools == nil {
+		return err
+	}
+
+	if poolId == "" {
+		return errors.Join(errForbidden, fmt.Errorf("user %s does not have permission %v for resources without a pool",
+			userIdFromRequest(r), permissions))
+	}
+
+	if !pools[poolId] {
+		return errors.Join(errForbidden, fmt.Errorf("user %s does not have permission %v for pool %s",
+			userIdFromRequest(r), permissions, poolId))
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage/gorm"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+func requestWithSubject(subject string) *http.Request {
+	return withSubject(httptest.NewRequest("GET", "/", nil), subject)
+}
+
+// withSubject returns the request as if made with a validated token of the subject
+func withSubject(r *http.Request, subject string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), jwtmiddleware.ContextKey{}, &validator.ValidatedClaims{
+		RegisteredClaims: validator.RegisteredClaims{
+			Subject: subject,
+		},
+	}))
+}
+
+func TestAuthorize(t *testing.T) {
+	logger.Configure()
+
+	db, err := gorm.OpenStorage(context.Background(), "sqlite", "file::memory:?cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	frontend := &Frontend{
+		storage: db,
+	}
+
+	pool, err := db.CreatePool("Pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPool, err := db.CreatePool("Other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = errors.Join(
+		db.AddPermission(pool.Id, "Admin", restapi.PermissionAdmin),
+		db.AddPermission(pool.Id, "User", restapi.PermissionCreateSession),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		request    *http.Request
+		poolId     string
+		permission restapi.Permission
+		allowed    bool
+	}{
+		{"validation disabled", httptest.NewRequest("GET", "/", nil), pool.Id, restapi.PermissionAdmin, true},
+		{"missing subject", requestWithSubject(""), pool.Id, restapi.PermissionCreateSession, false},
+		{"admin", requestWithSubject("Admin"), pool.Id, restapi.PermissionAdmin, true},
+		{"admin grants all", requestWithSubject("Admin"), pool.Id, restapi.PermissionRegisterAgent, true},
+		{"user", requestWithSubject("User"), pool.Id, restapi.PermissionCreateSession, true},
+		{"user not admin", requestWithSubject("User"), pool.Id, restapi.PermissionAdmin, false},
+		{"other pool", requestWithSubject("Admin"), otherPool.Id, restapi.PermissionCreateSession, false},
+		{"unknown user", requestWithSubject("Unknown"), pool.Id, restapi.PermissionCreateSession, false},
+		{"without pool", requestWithSubject("Admin"), "", restapi.PermissionRegisterAgent, false},
+		{"without pool validation disabled", httptest.NewRequest("GET", "/", nil), "", restapi.PermissionRegisterAgent, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := frontend.authorize(test.request, test.poolId, test.permission)
+			if test.allowed && err != nil {
+				t.Errorf("expected request to be authorized, %s", err.Error())
+			} else if !test.allowed {
+				if err == nil {
+					t.Error("expected request to be forbidden")
+				} else if errorStatus(err) != http.StatusForbidden {
+					t.Errorf("expected status %d, got %d", http.StatusForbidden, errorStatus(err))
+				}
+			}
+		})
+	}
+}
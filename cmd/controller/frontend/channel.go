@@ -0,0 +1,192 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	pkgnet "github.com/Juice-Labs/Juice-Labs/pkg/net"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+const (
+	// The agent is resent periodically, changes made through another frontend
+	// are not published to this one and the agent relies on receiving messages
+	// to determine the channel is still alive
+	channelResyncInterval = 5 * time.Second
+
+	channelWriteTimeout = 10 * time.Second
+)
+
+var channelUpgrader = websocket.Upgrader{
+	Subprotocols: []string{restapi.AgentChannelProtocol},
+	Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		err := errors.Join(reason, pkgnet.RespondWithError(w, status, reason))
+		logger.Error(err)
+	},
+}
+
+// agentChannelEp upgrades the request into a WebSocket carrying the agent
+// channel. The updates sent by the agent are applied as they are received and
+// the agent is sent back whenever one of its sessions or its drain state changes.
+func (frontend *Frontend) agentChannelEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	agent, err := frontend.getAgentById(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, agent.PoolId, restapi.PermissionRegisterAgent)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	if !websocket.IsWebSocketUpgrade(r) {
+		err = fmt.Errorf("/v1/agent/%s/channel: expected a WebSocket upgrade", id)
+		w.Header().Set("Connection", "Upgrade")
+		w.Header().Set("Upgrade", "websocket")
+		err = errors.Join(err, pkgnet.RespondWithError(w, http.StatusUpgradeRequired, err))
+		logger.Error(err)
+		return
+	}
+
+	// HTTP/2 connections cannot be upgraded, agents fall back to polling when
+	// the channel is not implemented
+	if _, ok := w.(http.Hijacker); !ok {
+		err = fmt.Errorf("/v1/agent/%s/channel: the connection cannot be upgraded", id)
+		err = errors.Join(err, pkgnet.RespondWithError(w, http.StatusNotImplemented, err))
+		logger.Error(err)
+		return
+	}
+
+	// Subscribe prior to sending the agent to avoid missing a change
+	subscription := frontend.events.Subscribe(restapi.EventFilter{})
+	defer func() {
+		subscription.Close()
+	}()
+
+	conn, err := channelUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded
+		return
+	}
+
+	defer conn.Close()
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- frontend.readAgentChannel(id, conn)
+	}()
+
+	// The sessions of the agent as last sent, canceling a session publishes an
+	// event without the id of the agent
+	sessions := map[string]bool{}
+
+	err = frontend.sendAgentChannel(conn, id, sessions)
+
+	resync := time.NewTicker(channelResyncInterval)
+	defer resync.Stop()
+
+	for err == nil {
+		select {
+		case <-r.Context().Done():
+			err = r.Context().Err()
+
+		case err = <-closed:
+			if err == nil {
+				logger.Debugf("agent %s closed its channel", id)
+				return
+			}
+
+		case <-resync.C:
+			err = frontend.sendAgentChannel(conn, id, sessions)
+
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// The channel fell behind, resubscribe and resend the agent
+				subscription = frontend.events.Subscribe(restapi.EventFilter{})
+				err = frontend.sendAgentChannel(conn, id, sessions)
+				continue
+			}
+
+			if channelEventChangesAgent(event, id, sessions) {
+				err = frontend.sendAgentChannel(conn, id, sessions)
+			}
+		}
+	}
+
+	logger.Debugf("agent %s channel closed, %s", id, err.Error())
+}
+
+// channelEventChangesAgent returns whether the agent sent over its channel is
+// affected by the event
+func channelEventChangesAgent(event restapi.Event, id string, sessions map[string]bool) bool {
+	switch event.Type {
+	case restapi.EventSessionState:
+		return event.AgentId == id || sessions[event.SessionId]
+
+	case restapi.EventAgentDrainState, restapi.EventAgentState:
+		return event.AgentId == id
+	}
+
+	return false
+}
+
+// sendAgentChannel writes the current state of the agent to the channel
+func (frontend *Frontend) sendAgentChannel(conn *websocket.Conn, id string, sessions map[string]bool) error {
+	agent, err := frontend.getAgentById(id)
+	if err != nil {
+		return err
+	}
+
+	for sessionId := range sessions {
+		delete(sessions, sessionId)
+	}
+
+	for _, session := range agent.Sessions {
+		sessions[session.Id] = true
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(channelWriteTimeout))
+	return conn.WriteJSON(agent)
+}
+
+// readAgentChannel applies the updates sent by the agent until the channel is
+// closed, returns nil if the agent closed the channel
+func (frontend *Frontend) readAgentChannel(id string, conn *websocket.Conn) error {
+	for {
+		var update restapi.AgentUpdate
+		err := conn.ReadJSON(&update)
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if update.Id != id {
+			return fmt.Errorf("/v1/agent/%s/channel: ids do not match", id)
+		}
+
+		agent, err := frontend.getAgentById(id)
+		if err == nil {
+			err = frontend.updateAgent(agent, update)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
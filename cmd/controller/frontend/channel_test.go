@@ -0,0 +1,177 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/events"
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage/memdb"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// receiveSession waits for the agent to be sent with the session in the state
+func receiveSession(t *testing.T, channel *restapi.AgentChannel, sessionId string, state string) {
+	for attempt := 0; attempt < 10; attempt++ {
+		agent, err := channel.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, session := range agent.Sessions {
+			if session.Id == sessionId && session.State == state {
+				return
+			}
+		}
+	}
+
+	t.Fatalf("expected session %s to be %s", sessionId, state)
+}
+
+func TestAgentChannel(t *testing.T) {
+	logger.Configure()
+
+	db, err := memdb.OpenStorage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	frontend := &Frontend{
+		storage: db,
+		events:  events.NewBroker(),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/agent/{id}/channel", frontend.agentChannelEp).Methods("GET")
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := restapi.Client{
+		Client:  server.Client(),
+		Address: strings.TrimPrefix(server.URL, "http://"),
+	}
+
+	_, err = client.OpenAgentChannel("unknown")
+	if err == nil {
+		t.Error("expected opening the channel of an unknown agent to fail")
+	}
+
+	agentId, err := frontend.registerAgent(restapi.Agent{PoolId: "Pool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel, err := client.OpenAgentChannel(agentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer channel.Close()
+
+	agent, err := channel.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if agent.Id != agentId || len(agent.Sessions) != 0 {
+		t.Fatalf("expected agent %s without sessions, received %+v", agentId, agent)
+	}
+
+	sessionId, err := frontend.requestSession(restapi.SessionRequirements{PoolId: "Pool"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assigned by the backend
+	err = db.AssignSession(sessionId, agentId, []restapi.SessionGpu{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frontend.events.Publish(restapi.Event{
+		Type:      restapi.EventSessionState,
+		PoolId:    "Pool",
+		AgentId:   agentId,
+		SessionId: sessionId,
+		State:     restapi.SessionAssigned,
+	})
+
+	receiveSession(t, channel, sessionId, restapi.SessionAssigned)
+
+	err = channel.Send(restapi.AgentUpdate{
+		Id:    agentId,
+		State: restapi.AgentActive,
+		SessionsUpdate: map[string]restapi.SessionUpdate{
+			sessionId: {State: restapi.SessionActive},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiveSession(t, channel, sessionId, restapi.SessionActive)
+
+	// Canceling the session is sent to the agent without waiting for it to poll
+	start := time.Now()
+
+	err = frontend.cancelSession(sessionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiveSession(t, channel, sessionId, restapi.SessionCanceling)
+
+	if time.Since(start) >= channelResyncInterval {
+		t.Error("expected the canceled session to be sent immediately")
+	}
+}
+
+func TestAgentChannelUnsupported(t *testing.T) {
+	logger.Configure()
+
+	db, err := memdb.OpenStorage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	frontend := &Frontend{
+		storage: db,
+		events:  events.NewBroker(),
+	}
+
+	// Connections which cannot be hijacked, such as HTTP/2 connections, cannot be upgraded
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/agent/{id}/channel", func(w http.ResponseWriter, r *http.Request) {
+		frontend.agentChannelEp(struct{ http.ResponseWriter }{w}, r)
+	}).Methods("GET")
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := restapi.Client{
+		Client:  server.Client(),
+		Address: strings.TrimPrefix(server.URL, "http://"),
+	}
+
+	agentId, err := frontend.registerAgent(restapi.Agent{PoolId: "Pool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.OpenAgentChannel(agentId)
+	if !errors.Is(err, restapi.ErrChannelUnsupported) {
+		t.Errorf("expected the channel to be unsupported, received %v", err)
+	}
+}
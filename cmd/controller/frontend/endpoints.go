@@ -7,9 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
-	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
-	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/gorilla/mux"
 
 	"github.com/Juice-Labs/Juice-Labs/cmd/internal/build"
@@ -20,26 +20,56 @@ import (
 )
 
 func (frontend *Frontend) initializeEndpoints(server *server.Server) {
-	server.AddEndpointFunc("GET", "/status", frontend.getStatusFormerEp, false)
-	server.AddEndpointFunc("GET", "/v1/status", frontend.getStatusEp, false)
-	server.AddEndpointFunc("POST", "/v1/register/agent", frontend.registerAgentEp, true)
-	server.AddEndpointFunc("GET", "/v1/agent/{id}", frontend.getAgentEp, true)
-	server.AddEndpointFunc("PUT", "/v1/agent/{id}", frontend.updateAgentEp, true)
-	server.AddEndpointFuncWithQuery("GET", "/v1/agents", frontend.getAgentsForPoolEp, true, []string{"pool_id", "{pool_id}"})
-	server.AddEndpointFunc("GET", "/v1/agents", frontend.getAgentsEp, true)
-	server.AddEndpointFunc("POST", "/v1/request/session", frontend.requestSessionEp, true)
-	server.AddEndpointFunc("GET", "/v1/session/{id}", frontend.getSessionEp, true)
-	server.AddEndpointFunc("DELETE", "/v1/session/{id}", frontend.cancelSessionEp, true)
-
-	server.AddEndpointFunc("PUT", "/v1/pool", frontend.createPoolEp, true)
-	server.AddEndpointFunc("GET", "/v1/pool/{id}", frontend.getPoolEp, true)
-	server.AddEndpointFunc("GET", "/v1/pool/{id}/permissions", frontend.getPoolPermissionsEp, true)
-
-	server.AddEndpointFunc("DELETE", "/v1/pool/{id}", frontend.deletePoolEp, true)
-
-	server.AddEndpointFunc("GET", "/v1/user/permissions/{id}", frontend.getPermissionsEp, true)
-	server.AddEndpointFunc("DELETE", "/v1/user/permissions", frontend.deletePermissionEp, true)
-	server.AddEndpointFunc("PUT", "/v1/user/permissions", frontend.addPermissionEp, true)
+	server.SetInfo("Juice Controller", build.Version)
+
+	server.AddEndpointFunc("GET", "/status", frontend.getStatusFormerEp, false).WithResponse(StatusFormer{})
+	server.AddEndpointFunc("GET", "/v1/status", frontend.getStatusEp, false).WithResponse(restapi.Status{})
+	server.AddEndpointFunc("POST", "/v1/register/agent", frontend.registerAgentEp, true).WithRequest(restapi.Agent{}).WithTextResponse()
+	server.AddEndpointFunc("GET", "/v1/agent/{id}", frontend.getAgentEp, true).WithResponse(restapi.Agent{})
+	server.AddEndpointFunc("PUT", "/v1/agent/{id}", frontend.updateAgentEp, true).WithRequest(restapi.AgentUpdate{})
+	server.AddEndpointFunc("GET", "/v1/agent/{id}/channel", frontend.agentChannelEp, true)
+	server.AddEndpointFunc("POST", "/v1/agent/{id}/cordon", frontend.cordonAgentEp, true).WithResponse(restapi.Agent{})
+	server.AddEndpointFunc("POST", "/v1/agent/{id}/drain", frontend.drainAgentEp, true).WithOptionalRequest(restapi.DrainParams{}).WithResponse(restapi.Agent{})
+	server.AddEndpointFunc("POST", "/v1/agent/{id}/uncordon", frontend.uncordonAgentEp, true).WithResponse(restapi.Agent{})
+	server.AddEndpointFunc("PUT", "/v1/agent/{id}/taints", frontend.setAgentTaintsEp, true).WithRequest(restapi.TaintsParams{}).WithResponse(restapi.Agent{})
+	server.AddEndpointFunc("GET", "/v1/agents", frontend.getAgentsEp, true).WithQueryParameters(append(agentQueryParameters, pageQueryParameters...)...).WithResponse(restapi.AgentPage{})
+	server.AddEndpointFunc("POST", "/v1/request/session", frontend.requestSessionEp, true).WithRequest(restapi.SessionRequirements{}).WithTextResponse()
+	server.AddEndpointFunc("GET", "/v1/session/{id}", frontend.getSessionEp, true).WithResponse(restapi.Session{})
+	server.AddEndpointFunc("GET", "/v1/session/{id}/placement", frontend.getSessionPlacementEp, true).WithResponse(restapi.SessionPlacement{})
+	server.AddEndpointFunc("GET", "/v1/sessions", frontend.getSessionsEp, true).WithQueryParameters(append(sessionQueryParameters, pageQueryParameters...)...).WithResponse(restapi.SessionPage{})
+	server.AddEndpointFunc("DELETE", "/v1/session/{id}", frontend.cancelSessionEp, true).WithResponse("")
+	server.AddEndpointFunc("POST", "/v1/request/group", frontend.requestSessionGroupEp, true).WithRequest(restapi.SessionGroupRequirements{}).WithTextResponse()
+	server.AddEndpointFunc("GET", "/v1/group/{id}", frontend.getSessionGroupEp, true).WithResponse(restapi.SessionGroup{})
+	server.AddEndpointFunc("DELETE", "/v1/group/{id}", frontend.cancelSessionGroupEp, true).WithResponse("")
+	server.AddEndpointFunc("POST", "/v1/session/{id}/heartbeat", frontend.heartbeatSessionEp, true).WithOptionalRequest(restapi.LeaseParams{}).WithResponse(restapi.SessionLease{})
+	server.AddEndpointFunc("GET", "/v1/usage", frontend.getUsageEp, true).WithQueryParameters(usageQueryParameters...).WithResponse(restapi.UsageReport{})
+	server.AddEndpointFunc("GET", "/v1/usage/sessions", frontend.getUsageRecordsEp, true).WithQueryParameters("from", "to", "pool_id", "user_id").WithResponse([]restapi.UsageRecord{})
+	server.AddEndpointFunc("POST", "/v1/reservations", frontend.createReservationEp, true).WithRequest(restapi.Reservation{}).WithResponse(restapi.Reservation{})
+	server.AddEndpointFunc("GET", "/v1/reservations", frontend.getReservationsEp, true).WithQueryParameters(reservationQueryParameters...).WithResponse([]restapi.Reservation{})
+	server.AddEndpointFunc("GET", "/v1/reservations/{id}", frontend.getReservationEp, true).WithResponse(restapi.Reservation{})
+	server.AddEndpointFunc("DELETE", "/v1/reservations/{id}", frontend.deleteReservationEp, true).WithResponse("")
+	server.AddEndpointFunc("POST", "/v1/scheduler/explain", frontend.explainEp, true).WithRequest(restapi.ExplainParams{}).WithResponse(restapi.SchedulingExplanation{})
+	server.AddEndpointFunc("GET", "/v1/events", frontend.getEventsEp, true).WithResponseContent("text/event-stream", restapi.Event{})
+
+	server.AddEndpointFunc("PUT", "/v1/pool", frontend.createPoolEp, true).WithRequest(restapi.CreatePoolParams{}).WithResponse(restapi.Pool{})
+	server.AddEndpointFunc("GET", "/v1/pool/{id}", frontend.getPoolEp, true).WithResponse(restapi.Pool{})
+	server.AddEndpointFunc("GET", "/v1/pool/{id}/permissions", frontend.getPoolPermissionsEp, true).WithResponse(restapi.PoolPermissions{})
+	server.AddEndpointFunc("GET", "/v1/pool/{id}/quota", frontend.getPoolQuotaEp, true).WithResponse(restapi.PoolQuota{})
+	server.AddEndpointFunc("PUT", "/v1/pool/{id}/quota", frontend.setQuotaEp, true).WithRequest(restapi.QuotaParams{}).WithResponse("")
+	server.AddEndpointFunc("DELETE", "/v1/pool/{id}/quota", frontend.removeQuotaEp, true).WithRequest(restapi.QuotaParams{}).WithResponse("")
+	server.AddEndpointFunc("GET", "/v1/pool/{id}/session-defaults", frontend.getSessionDefaultsEp, true).WithResponse(restapi.SessionTimeouts{})
+	server.AddEndpointFunc("PUT", "/v1/pool/{id}/session-defaults", frontend.setSessionDefaultsEp, true).WithRequest(restapi.SessionTimeouts{}).WithResponse(restapi.SessionTimeouts{})
+
+	server.AddEndpointFunc("DELETE", "/v1/pool/{id}", frontend.deletePoolEp, true).WithResponse("")
+
+	server.AddEndpointFunc("PUT", "/v1/webhook", frontend.createWebhookEp, true).WithRequest(restapi.Webhook{}).WithResponse(restapi.Webhook{})
+	server.AddEndpointFunc("GET", "/v1/webhook/{id}", frontend.getWebhookEp, true).WithResponse(restapi.Webhook{})
+	server.AddEndpointFunc("DELETE", "/v1/webhook/{id}", frontend.deleteWebhookEp, true).WithResponse("")
+	server.AddEndpointFunc("GET", "/v1/webhooks", frontend.getWebhooksEp, true).WithResponse([]restapi.Webhook{})
+
+	server.AddEndpointFunc("GET", "/v1/user/permissions/{id}", frontend.getPermissionsEp, true).WithResponse(restapi.UserPermissions{})
+	server.AddEndpointFunc("DELETE", "/v1/user/permissions", frontend.deletePermissionEp, true).WithRequest(restapi.PermissionParams{}).WithResponse("")
+	server.AddEndpointFunc("PUT", "/v1/user/permissions", frontend.addPermissionEp, true).WithRequest(restapi.PermissionParams{}).WithResponse("")
 }
 
 func (frontend *Frontend) getStatusEp(w http.ResponseWriter, r *http.Request) {
@@ -50,7 +80,7 @@ func (frontend *Frontend) getStatusEp(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 	}
 }
@@ -58,14 +88,21 @@ func (frontend *Frontend) getStatusEp(w http.ResponseWriter, r *http.Request) {
 func (frontend *Frontend) registerAgentEp(w http.ResponseWriter, r *http.Request) {
 	agent, err := pkgnet.ReadRequestBody[restapi.Agent](r)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, agent.PoolId, restapi.PermissionRegisterAgent)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
 	id, err := frontend.registerAgent(agent)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -81,35 +118,67 @@ func (frontend *Frontend) getAgentEp(w http.ResponseWriter, r *http.Request) {
 
 	agent, err := frontend.getAgentById(id)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
-	pkgnet.Respond(w, http.StatusOK, agent)
+	err = frontend.authorize(r, agent.PoolId, poolMember...)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	pkgnet.Respond(w, http.StatusOK, withAllocations(agent))
 }
 
+// getAgentsEp lists a page of the agents matching the query, limited to the
+// pools accessible to the user unless a pool is requested
 func (frontend *Frontend) getAgentsEp(w http.ResponseWriter, r *http.Request) {
-	agents, err := frontend.getAgents("")
+	filter, err := agentFilterFromQuery(r.URL.Query())
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
-	pkgnet.Respond(w, http.StatusOK, agents)
-}
+	page, err := pageFromQuery(r.URL.Query())
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	if filter.PoolId != "" {
+		err = frontend.authorize(r, filter.PoolId, poolMember...)
+	} else {
+		var pools map[string]bool
+		pools, err = frontend.authorizedPools(r, poolMember...)
+		filter.PoolIds = sortedPoolIds(pools)
+	}
+
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
 
-func (frontend *Frontend) getAgentsForPoolEp(w http.ResponseWriter, r *http.Request) {
-	poolID := r.URL.Query().Get("pool_id")
-	agents, err := frontend.getAgents(poolID)
+	agents, next, err := frontend.listAgents(filter, page)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
-	pkgnet.Respond(w, http.StatusOK, agents)
+	for index, agent := range agents {
+		agents[index] = withAllocations(agent)
+	}
+
+	pkgnet.Respond(w, http.StatusOK, restapi.AgentPage{
+		Agents: agents,
+		Next:   next,
+	})
 }
 
 func (frontend *Frontend) updateAgentEp(w http.ResponseWriter, r *http.Request) {
@@ -117,21 +186,35 @@ func (frontend *Frontend) updateAgentEp(w http.ResponseWriter, r *http.Request)
 
 	update, err := pkgnet.ReadRequestBody[restapi.AgentUpdate](r)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
 	if update.Id != id {
 		err = fmt.Errorf("/v1/agent/%s: ids do not match", id)
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusBadRequest, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"id": update.Id}))
 		logger.Error(err)
 		return
 	}
 
-	err = frontend.updateAgent(update)
+	agent, err := frontend.getAgentById(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, agent.PoolId, restapi.PermissionRegisterAgent)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.updateAgent(agent, update)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -139,25 +222,180 @@ func (frontend *Frontend) updateAgentEp(w http.ResponseWriter, r *http.Request)
 	pkgnet.RespondEmpty(w, http.StatusOK)
 }
 
+// setAgentDrainStateEp changes the drain state of the agent, responding with the updated agent
+func (frontend *Frontend) setAgentDrainStateEp(w http.ResponseWriter, r *http.Request, drainState string, deadline *time.Time) {
+	id := mux.Vars(r)["id"]
+
+	agent, err := frontend.getAgentById(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, agent.PoolId, restapi.PermissionRegisterAgent)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	agent, err = frontend.setAgentDrainState(agent, drainState, deadline)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, agent)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func (frontend *Frontend) cordonAgentEp(w http.ResponseWriter, r *http.Request) {
+	frontend.setAgentDrainStateEp(w, r, restapi.AgentCordoned, nil)
+}
+
+func (frontend *Frontend) drainAgentEp(w http.ResponseWriter, r *http.Request) {
+	// The parameters are optional, an agent without a deadline drains indefinitely
+	var drainParams restapi.DrainParams
+	if r.ContentLength != 0 {
+		var err error
+		drainParams, err = pkgnet.ReadRequestBody[restapi.DrainParams](r)
+		if err != nil {
+			err = errors.Join(err, pkgnet.RespondWithError(w, http.StatusBadRequest, err))
+			logger.Error(err)
+			return
+		}
+	}
+
+	deadline := drainParams.Deadline
+	if deadline != nil {
+		utc := deadline.UTC()
+		deadline = &utc
+	}
+
+	frontend.setAgentDrainStateEp(w, r, restapi.AgentDraining, deadline)
+}
+
+func (frontend *Frontend) uncordonAgentEp(w http.ResponseWriter, r *http.Request) {
+	frontend.setAgentDrainStateEp(w, r, restapi.AgentSchedulable, nil)
+}
+
+// setAgentTaintsEp replaces the taints of the agent, the backend cancels the
+// sessions which do not tolerate a NoExecute taint
+func (frontend *Frontend) setAgentTaintsEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	params, err := pkgnet.ReadRequestBody[restapi.TaintsParams](r)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = restapi.ValidateTaints(params.Taints)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": "taints"}))
+		logger.Error(err)
+		return
+	}
+
+	agent, err := frontend.getAgentById(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, agent.PoolId, restapi.PermissionRegisterAgent)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.storage.SetAgentTaints(id, params.Taints)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	agent, err = frontend.getAgentById(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, agent)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
 func (frontend *Frontend) requestSessionEp(w http.ResponseWriter, r *http.Request) {
 	sessionRequirements, err := pkgnet.ReadRequestBody[restapi.SessionRequirements](r)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
 	if sessionRequirements.PoolId == "" {
-		logger.Warning("Creating a session without a pool ID")
-		// TODO: At some point we should force pool IDs to be required
-		// 	err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusBadRequest, "Pool ID is required"))
-		// 	logger.Error(err)
-		// 	return
+		err = errors.New("pool ID is required")
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": "poolId"}))
+		logger.Error(err)
+		return
 	}
 
-	id, err := frontend.requestSession(sessionRequirements)
+	field, err := validateTimeouts(sessionRequirements.SessionTimeouts)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": field}))
+		logger.Error(err)
+		return
+	}
+
+	err = validateMatchExpressions(sessionRequirements.MatchExpressions)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": "matchExpressions"}))
+		logger.Error(err)
+		return
+	}
+
+	err = validatePreferences(sessionRequirements.Preferences)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": "preferences"}))
+		logger.Error(err)
+		return
+	}
+
+	err = validateGpuRequirements(sessionRequirements.Gpus)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": "gpus"}))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, sessionRequirements.PoolId, restapi.PermissionCreateSession)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.validateReservationId(sessionRequirements, userIdFromRequest(r), time.Now())
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, errorStatus(err), err, map[string]string{"field": "reservationId"}))
+		logger.Error(err)
+		return
+	}
+
+	id, err := frontend.requestSession(sessionRequirements, userIdFromRequest(r))
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -171,9 +409,27 @@ func (frontend *Frontend) requestSessionEp(w http.ResponseWriter, r *http.Reques
 func (frontend *Frontend) cancelSessionEp(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
-	err := frontend.cancelSession(id)
+	session, err := frontend.getSessionById(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, session.PoolId, restapi.PermissionCreateSession)
+	if err == nil && session.State == restapi.SessionClosed {
+		err = errors.Join(errConflict, fmt.Errorf("session %s is closed", id))
+	}
+
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.cancelSession(id)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -189,7 +445,14 @@ func (frontend *Frontend) getSessionEp(w http.ResponseWriter, r *http.Request) {
 
 	session, err := frontend.getSessionById(id)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, session.PoolId, restapi.PermissionCreateSession, restapi.PermissionRegisterAgent)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -200,64 +463,119 @@ func (frontend *Frontend) getSessionEp(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (frontend *Frontend) createPoolEp(w http.ResponseWriter, r *http.Request) {
-	poolParams, err := pkgnet.ReadRequestBody[restapi.CreatePoolParams](r)
+// getSessionPlacementEp returns the scores of the agents considered as the
+// session was assigned
+func (frontend *Frontend) getSessionPlacementEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	session, err := frontend.getSessionById(id)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
-	pool, err := frontend.createPool(poolParams.Name)
+
+	err = frontend.authorize(r, session.PoolId, restapi.PermissionCreateSession, restapi.PermissionRegisterAgent)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	placement, err := frontend.storage.GetSessionPlacement(id)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
-	val := r.Context().Value(jwtmiddleware.ContextKey{})
-	if val == nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+	err = pkgnet.Respond(w, http.StatusOK, placement)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// getSessionsEp lists a page of the sessions matching the query, limited to the
+// pools accessible to the user unless a pool is requested
+func (frontend *Frontend) getSessionsEp(w http.ResponseWriter, r *http.Request) {
+	filter, err := sessionFilterFromQuery(r.URL.Query())
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
-	claims, ok := val.(*validator.ValidatedClaims)
 
-	if (!ok) || (claims == nil) {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+	page, err := pageFromQuery(r.URL.Query())
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
-	userId := claims.RegisteredClaims.Subject
+	if filter.PoolId != "" {
+		err = frontend.authorize(r, filter.PoolId, restapi.PermissionCreateSession, restapi.PermissionRegisterAgent)
+	} else {
+		var pools map[string]bool
+		pools, err = frontend.authorizedPools(r, restapi.PermissionCreateSession, restapi.PermissionRegisterAgent)
+		filter.PoolIds = sortedPoolIds(pools)
+	}
 
-	if userId == "" {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
-	// Add all permissions for this user
-	err = frontend.addPermission(pool.Id, userId, restapi.PermissionAdmin)
+	sessions, next, err := frontend.listSessions(filter, page)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
-	err = frontend.addPermission(pool.Id, userId, restapi.PermissionCreateSession)
+	pkgnet.Respond(w, http.StatusOK, restapi.SessionPage{
+		Sessions: sessions,
+		Next:     next,
+	})
+}
+
+func (frontend *Frontend) createPoolEp(w http.ResponseWriter, r *http.Request) {
+	poolParams, err := pkgnet.ReadRequestBody[restapi.CreatePoolParams](r)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	claims := claimsFromRequest(r)
+	if claims != nil && claims.RegisteredClaims.Subject == "" {
+		err = errors.Join(errForbidden, errors.New("token does not specify a subject"))
+		err = errors.Join(err, pkgnet.RespondWithError(w, http.StatusForbidden, err))
 		logger.Error(err)
 		return
 	}
 
-	err = frontend.addPermission(pool.Id, userId, restapi.PermissionRegisterAgent)
+	pool, err := frontend.createPool(poolParams.Name)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
+	// Add all permissions for this user, there is no user when token validation is disabled
+	if claims != nil {
+		userId := claims.RegisteredClaims.Subject
+
+		for _, permission := range []restapi.Permission{restapi.PermissionAdmin, restapi.PermissionCreateSession, restapi.PermissionRegisterAgent} {
+			err = frontend.addPermission(pool.Id, userId, permission)
+			if err != nil {
+				err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+				logger.Error(err)
+				return
+			}
+		}
+	}
+
 	err = pkgnet.Respond(w, http.StatusOK, pool)
 	if err != nil {
 		logger.Error(err)
@@ -268,9 +586,16 @@ func (frontend *Frontend) getPoolEp(w http.ResponseWriter, r *http.Request) {
 
 	id := mux.Vars(r)["id"]
 
+	err := frontend.authorize(r, id, poolMember...)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
 	pool, err := frontend.getPool(id)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -285,9 +610,16 @@ func (frontend *Frontend) getPoolPermissionsEp(w http.ResponseWriter, r *http.Re
 
 	id := mux.Vars(r)["id"]
 
+	err := frontend.authorize(r, id, poolMember...)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
 	permissions, err := frontend.getPoolPermissions(id)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -302,9 +634,16 @@ func (frontend *Frontend) deletePoolEp(w http.ResponseWriter, r *http.Request) {
 
 	id := mux.Vars(r)["id"]
 
-	err := frontend.deletePool(id)
+	err := frontend.authorize(r, id, restapi.PermissionAdmin)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.deletePool(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -319,9 +658,18 @@ func (frontend *Frontend) getPermissionsEp(w http.ResponseWriter, r *http.Reques
 
 	id := mux.Vars(r)["id"]
 
+	// Users may only retrieve their own permissions
+	claims := claimsFromRequest(r)
+	if claims != nil && claims.RegisteredClaims.Subject != id {
+		err := errors.Join(errForbidden, fmt.Errorf("unable to retrieve the permissions of user %s", id))
+		err = errors.Join(err, pkgnet.RespondWithError(w, http.StatusForbidden, err))
+		logger.Error(err)
+		return
+	}
+
 	permissions, err := frontend.getPermissions(id)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -335,14 +683,28 @@ func (frontend *Frontend) getPermissionsEp(w http.ResponseWriter, r *http.Reques
 func (frontend *Frontend) deletePermissionEp(w http.ResponseWriter, r *http.Request) {
 	permissionParams, err := pkgnet.ReadRequestBody[restapi.PermissionParams](r)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	if permissionParams.PoolId == "" {
+		err = errors.New("pool ID is required")
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": "poolId"}))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, permissionParams.PoolId, restapi.PermissionAdmin)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
 	err = frontend.removePermission(permissionParams.PoolId, permissionParams.UserId, permissionParams.Permission)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -356,14 +718,28 @@ func (frontend *Frontend) deletePermissionEp(w http.ResponseWriter, r *http.Requ
 func (frontend *Frontend) addPermissionEp(w http.ResponseWriter, r *http.Request) {
 	permissionParams, err := pkgnet.ReadRequestBody[restapi.PermissionParams](r)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	if permissionParams.PoolId == "" {
+		err = errors.New("pool ID is required")
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": "poolId"}))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, permissionParams.PoolId, restapi.PermissionAdmin)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
 
 	err = frontend.addPermission(permissionParams.PoolId, permissionParams.UserId, permissionParams.Permission)
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 		return
 	}
@@ -373,3 +749,352 @@ func (frontend *Frontend) addPermissionEp(w http.ResponseWriter, r *http.Request
 		logger.Error(err)
 	}
 }
+
+func (frontend *Frontend) getPoolQuotaEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	err := frontend.authorize(r, id, poolMember...)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	quota, err := frontend.getPoolQuota(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, quota)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// validateTimeouts returns the field of the timeouts which is invalid
+func validateTimeouts(timeouts restapi.SessionTimeouts) (string, error) {
+	if timeouts.MaxDuration < 0 {
+		return "maxDuration", errors.New("maximum duration must not be negative")
+	}
+
+	if timeouts.IdleTimeout < 0 {
+		return "idleTimeout", errors.New("idle timeout must not be negative")
+	}
+
+	return "", nil
+}
+
+// validateMatchExpressions returns the first invalid expression
+func validateMatchExpressions(expressions []restapi.SelectorRequirement) error {
+	for _, expression := range expressions {
+		err := expression.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validatePreferences returns the first invalid preference
+func validatePreferences(preferences []restapi.Preference) error {
+	for _, preference := range preferences {
+		err := preference.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateGpuRequirements returns the first invalid GPU requirement
+func validateGpuRequirements(requirements []restapi.GpuRequirements) error {
+	for _, requirement := range requirements {
+		err := requirement.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (frontend *Frontend) getSessionDefaultsEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	err := frontend.authorize(r, id, poolMember...)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	defaults, err := frontend.storage.GetSessionDefaults(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, defaults)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// setSessionDefaultsEp sets the timeouts of the sessions of the pool which do
+// not request their own, zero removes the default
+func (frontend *Frontend) setSessionDefaultsEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	err := frontend.authorize(r, id, restapi.PermissionAdmin)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	defaults, err := pkgnet.ReadRequestBody[restapi.SessionTimeouts](r)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, http.StatusBadRequest, err))
+		logger.Error(err)
+		return
+	}
+
+	field, err := validateTimeouts(defaults)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": field}))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.storage.SetSessionDefaults(id, defaults)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, defaults)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func (frontend *Frontend) setQuotaEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	err := frontend.authorize(r, id, restapi.PermissionAdmin)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	quotaParams, err := pkgnet.ReadRequestBody[restapi.QuotaParams](r)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, http.StatusBadRequest, err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.setQuota(id, quotaParams.UserId, quotaParams.QuotaLimits)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, fmt.Sprintf("Quota for pool %s updated", id))
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func (frontend *Frontend) removeQuotaEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	err := frontend.authorize(r, id, restapi.PermissionAdmin)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	quotaParams, err := pkgnet.ReadRequestBody[restapi.QuotaParams](r)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, http.StatusBadRequest, err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.removeQuota(id, quotaParams.UserId)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, fmt.Sprintf("Quota for pool %s removed", id))
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func validateWebhook(webhook restapi.Webhook) error {
+	webhookUrl, err := url.Parse(webhook.Url)
+	if err != nil {
+		return err
+	}
+
+	if (webhookUrl.Scheme != "http" && webhookUrl.Scheme != "https") || webhookUrl.Host == "" {
+		return fmt.Errorf("webhook url %s must be an absolute http or https url", webhook.Url)
+	}
+
+	for _, eventType := range webhook.Events {
+		known := false
+		for _, knownType := range restapi.EventTypes {
+			known = known || eventType == knownType
+		}
+
+		if !known {
+			return fmt.Errorf("unknown event type %s", eventType)
+		}
+	}
+
+	return nil
+}
+
+// authorizeWebhook ensures the user making the request administers the pool of
+// the webhook. Webhooks receiving the events of every pool are only available
+// when token validation is disabled.
+func (frontend *Frontend) authorizeWebhook(r *http.Request, webhook restapi.Webhook) error {
+	if webhook.PoolId == "" && claimsFromRequest(r) != nil {
+		return errors.Join(errForbidden, errors.New("webhooks must specify a pool ID"))
+	}
+
+	return frontend.authorize(r, webhook.PoolId, restapi.PermissionAdmin)
+}
+
+func (frontend *Frontend) createWebhookEp(w http.ResponseWriter, r *http.Request) {
+	webhook, err := pkgnet.ReadRequestBody[restapi.Webhook](r)
+	if err == nil {
+		err = validateWebhook(webhook)
+	}
+
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, http.StatusBadRequest, err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorizeWebhook(r, webhook)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	webhook, err = frontend.createWebhook(webhook)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	// The secret is never returned
+	webhook.Secret = ""
+
+	err = pkgnet.Respond(w, http.StatusOK, webhook)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func (frontend *Frontend) getWebhookEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	webhook, err := frontend.getWebhookById(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorizeWebhook(r, webhook)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	webhook.Secret = ""
+
+	err = pkgnet.Respond(w, http.StatusOK, webhook)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func (frontend *Frontend) getWebhooksEp(w http.ResponseWriter, r *http.Request) {
+	pools, err := frontend.authorizedPools(r, restapi.PermissionAdmin)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	webhooks, err := frontend.getWebhooks()
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	// Only return the webhooks of the pools administered by the user
+	authorizedWebhooks := make([]restapi.Webhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		if pools == nil || pools[webhook.PoolId] {
+			webhook.Secret = ""
+			authorizedWebhooks = append(authorizedWebhooks, webhook)
+		}
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, authorizedWebhooks)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func (frontend *Frontend) deleteWebhookEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	webhook, err := frontend.getWebhookById(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorizeWebhook(r, webhook)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.deleteWebhook(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, fmt.Sprintf("Webhook %s deleted", id))
+	if err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,409 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/events"
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage/gorm"
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage/memdb"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+func TestRemovedAgentNotFound(t *testing.T) {
+	logger.Configure()
+
+	db, err := memdb.OpenStorage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	frontend := &Frontend{
+		storage: db,
+		events:  events.NewBroker(),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/agent/{id}", frontend.getAgentEp).Methods("GET")
+	router.HandleFunc("/v1/agent/{id}", frontend.updateAgentEp).Methods("PUT")
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := restapi.Client{
+		Client:  server.Client(),
+		Address: strings.TrimPrefix(server.URL, "http://"),
+	}
+
+	id, err := frontend.registerAgent(restapi.Agent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetAgent(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The controller removes agents which have been missing for a while
+	_, err = db.SetAgentsMissingIfNotUpdatedFor(-time.Second)
+	if err == nil {
+		_, err = db.RemoveMissingAgentsIfNotUpdatedFor(-time.Second)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetAgent(id)
+	if !errors.Is(err, restapi.ErrNotFound) {
+		t.Errorf("expected the removed agent to not be found, got %v", err)
+	}
+
+	err = client.UpdateAgent(restapi.AgentUpdate{Id: id, State: restapi.AgentActive})
+	if !errors.Is(err, restapi.ErrNotFound) {
+		t.Errorf("expected updating the removed agent to not be found, got %v", err)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	logger.Configure()
+
+	db, err := memdb.OpenStorage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	frontend := &Frontend{
+		storage: db,
+		events:  events.NewBroker(),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/agent/{id}", frontend.updateAgentEp).Methods("PUT")
+	router.HandleFunc("/v1/request/session", frontend.requestSessionEp).Methods("POST")
+	router.HandleFunc("/v1/session/{id}", frontend.getSessionEp).Methods("GET")
+	router.HandleFunc("/v1/session/{id}", frontend.cancelSessionEp).Methods("DELETE")
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := restapi.Client{
+		Client:  server.Client(),
+		Address: strings.TrimPrefix(server.URL, "http://"),
+	}
+
+	_, err = client.GetSession(uuid.NewString())
+	if !errors.Is(err, restapi.ErrNotFound) {
+		t.Errorf("expected an unknown session to not be found, got %v", err)
+	}
+
+	_, err = client.RequestSession(restapi.SessionRequirements{})
+	if !errors.Is(err, restapi.ErrBadRequest) {
+		t.Errorf("expected a session without a pool to be a bad request, got %v", err)
+	}
+
+	var responseErr *restapi.ResponseError
+	if !errors.As(err, &responseErr) || responseErr.Code != restapi.ErrorCodeInvalidInput || responseErr.Details["field"] != "poolId" {
+		t.Errorf("expected the error to describe the missing pool, got %+v", responseErr)
+	}
+
+	// A malformed body is reported as a bad request rather than a server error
+	response, err := client.PutWithJson(context.Background(), "/v1/agent/unknown", strings.NewReader("{"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, response.StatusCode)
+	}
+
+	sessionId, err := frontend.requestSession(restapi.SessionRequirements{PoolId: "Pool"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.CancelSession(sessionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.CancelSession(sessionId)
+	if !errors.Is(err, restapi.ErrConflict) {
+		t.Errorf("expected canceling a closed session to conflict, got %v", err)
+	}
+
+	if errors.Is(err, restapi.ErrNotFound) {
+		t.Error("expected a conflict to not match ErrNotFound")
+	}
+}
+
+func TestListAgents(t *testing.T) {
+	logger.Configure()
+
+	db, err := memdb.OpenStorage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	frontend := &Frontend{
+		storage: db,
+		events:  events.NewBroker(),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/agents", frontend.getAgentsEp).Methods("GET")
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := restapi.Client{
+		Client:  server.Client(),
+		Address: strings.TrimPrefix(server.URL, "http://"),
+	}
+
+	for index := 0; index < 3; index++ {
+		_, err = frontend.registerAgent(restapi.Agent{
+			State:  restapi.AgentActive,
+			PoolId: "Pool",
+			Labels: map[string]string{"index": fmt.Sprint(index)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := map[string]bool{}
+
+	query := url.Values{"pool_id": {"Pool"}, "limit": {"2"}}
+	for pages := 1; ; pages++ {
+		page, err := client.ListAgents(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, agent := range page.Agents {
+			ids[agent.Id] = true
+		}
+
+		if page.Next == "" {
+			if pages != 2 {
+				t.Errorf("expected 2 pages, got %d", pages)
+			}
+			break
+		}
+
+		query.Set("cursor", page.Next)
+	}
+
+	if len(ids) != 3 {
+		t.Errorf("expected 3 agents, got %d", len(ids))
+	}
+
+	page, err := client.ListAgents(url.Values{"selector": {"index=1"}})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(page.Agents) != 1 || page.Agents[0].Labels["index"] != "1" {
+		t.Errorf("expected the agent labeled index=1, got %+v", page.Agents)
+	}
+
+	for _, query := range []url.Values{
+		{"limit": {"0"}},
+		{"cursor": {"invalid"}},
+		{"state": {"unknown"}},
+		{"selector": {"index"}},
+		{"min_vram": {"-1"}},
+	} {
+		_, err = client.ListAgents(query)
+		if !errors.Is(err, restapi.ErrBadRequest) {
+			t.Errorf("expected %s to be a bad request, got %v", query.Encode(), err)
+		}
+	}
+}
+
+func TestListAgentsWithoutPool(t *testing.T) {
+	logger.Configure()
+
+	db, err := gorm.OpenStorage(context.Background(), "sqlite", "file:agentswithoutpool?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	frontend := &Frontend{
+		storage: db,
+		events:  events.NewBroker(),
+	}
+
+	pool, err := db.CreatePool("Pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.AddPermission(pool.Id, "User", restapi.PermissionCreateSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pooledId, err := db.RegisterAgent(restapi.Agent{State: restapi.AgentActive, PoolId: pool.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.RegisterAgent(restapi.Agent{State: restapi.AgentActive})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The agents without a pool are hidden from tokens limited to their pools
+	w := httptest.NewRecorder()
+	frontend.getAgentsEp(w, requestWithSubject("User"))
+
+	var page restapi.AgentPage
+	err = json.NewDecoder(w.Body).Decode(&page)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(page.Agents) != 1 || page.Agents[0].Id != pooledId {
+		t.Errorf("expected only agent %s of the pool, got %+v", pooledId, page.Agents)
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	logger.Configure()
+
+	db, err := memdb.OpenStorage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	frontend := &Frontend{
+		storage: db,
+		events:  events.NewBroker(),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/sessions", frontend.getSessionsEp).Methods("GET")
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := restapi.Client{
+		Client:  server.Client(),
+		Address: strings.TrimPrefix(server.URL, "http://"),
+	}
+
+	ids := []string{}
+	for index := 0; index < 3; index++ {
+		id, err := frontend.requestSession(restapi.SessionRequirements{PoolId: "Pool", Priority: index % 2}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	// The session of the higher priority is ahead of those requested before it
+	expected := map[string]int{
+		ids[1]: 1,
+		ids[0]: 2,
+		ids[2]: 3,
+	}
+
+	page, err := client.ListSessions(url.Values{"state": {restapi.SessionQueued}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Sessions) != len(expected) {
+		t.Fatalf("expected %d queued sessions, got %d", len(expected), len(page.Sessions))
+	}
+
+	for _, session := range page.Sessions {
+		if session.QueuePosition != expected[session.Id] {
+			t.Errorf("expected session %s to be at position %d, got %d", session.Id, expected[session.Id], session.QueuePosition)
+		}
+	}
+
+	err = frontend.cancelSession(ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = client.ListSessions(url.Values{"state": {restapi.SessionClosed}})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(page.Sessions) != 1 || page.Sessions[0].Id != ids[1] || page.Sessions[0].QueuePosition != 0 {
+		t.Errorf("expected the canceled session to be closed without a queue position, got %+v", page.Sessions)
+	}
+
+	_, err = client.ListSessions(url.Values{"created_after": {"yesterday"}})
+	if !errors.Is(err, restapi.ErrBadRequest) {
+		t.Errorf("expected an invalid time to be a bad request, got %v", err)
+	}
+}
+
+func TestListSessionsWithoutPool(t *testing.T) {
+	logger.Configure()
+
+	db, err := gorm.OpenStorage(context.Background(), "sqlite", "file:sessionswithoutpool?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	frontend := &Frontend{
+		storage: db,
+		events:  events.NewBroker(),
+	}
+
+	pool, err := db.CreatePool("Pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.AddPermission(pool.Id, "User", restapi.PermissionCreateSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pooledId, err := frontend.requestSession(restapi.SessionRequirements{PoolId: pool.Id}, "User")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = frontend.requestSession(restapi.SessionRequirements{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sessions without a pool are hidden from tokens limited to their pools
+	w := httptest.NewRecorder()
+	frontend.getSessionsEp(w, requestWithSubject("User"))
+
+	var page restapi.SessionPage
+	err = json.NewDecoder(w.Body).Decode(&page)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(page.Sessions) != 1 || page.Sessions[0].Id != pooledId {
+		t.Errorf("expected only session %s of the pool, got %+v", pooledId, page.Sessions)
+	}
+}
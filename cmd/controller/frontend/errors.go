@@ -0,0 +1,39 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	pkgnet "github.com/Juice-Labs/Juice-Labs/pkg/net"
+)
+
+var (
+	// The request cannot be applied to the current state of the resource
+	errConflict = errors.New("conflict")
+
+	// A query parameter of the request is malformed
+	errInvalidQuery = errors.New("invalid query")
+)
+
+// errorStatus returns the HTTP status describing the error
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, pkgnet.ErrInvalidBody), errors.Is(err, errInvalidQuery):
+		return http.StatusBadRequest
+
+	case errors.Is(err, errForbidden):
+		return http.StatusForbidden
+
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+
+	case errors.Is(err, errConflict):
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,229 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	pkgnet "github.com/Juice-Labs/Juice-Labs/pkg/net"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// Comments are sent periodically to keep idle streams from being closed by proxies
+const eventsKeepAliveInterval = 15 * time.Second
+
+// publishAgentUpdate publishes the changes made by an update, the agent and
+// sessions hold the state prior to the update
+func (frontend *Frontend) publishAgentUpdate(agent restapi.Agent, update restapi.AgentUpdate, sessions map[string]restapi.Session) {
+	if update.State != "" && update.State != agent.State {
+		frontend.events.Publish(restapi.Event{
+			Type:    restapi.EventAgentState,
+			PoolId:  agent.PoolId,
+			AgentId: agent.Id,
+			State:   update.State,
+		})
+	}
+
+	for sessionId, sessionUpdate := range update.SessionsUpdate {
+		session, found := sessions[sessionId]
+
+		poolId := session.PoolId
+		if !found {
+			poolId = agent.PoolId
+		}
+
+		// Connections are reported when created and again when closed. The
+		// connections known prior to the update are the ones being closed, as
+		// are those the agent reports closed, which may have been created and
+		// closed since its previous update.
+		knownConnections := map[string]bool{}
+		for _, connection := range session.Connections {
+			knownConnections[connection.Id] = true
+		}
+
+		closedConnections := map[string]bool{}
+		for _, connectionId := range sessionUpdate.ClosedConnections {
+			closedConnections[connectionId] = true
+		}
+
+		for _, connection := range sessionUpdate.Connections {
+			connection := connection
+			publish := func(eventType string) {
+				frontend.events.Publish(restapi.Event{
+					Type:       eventType,
+					PoolId:     poolId,
+					AgentId:    agent.Id,
+					SessionId:  sessionId,
+					Connection: &connection,
+				})
+			}
+
+			if !knownConnections[connection.Id] {
+				publish(restapi.EventConnectionOpened)
+			}
+
+			if knownConnections[connection.Id] || closedConnections[connection.Id] {
+				publish(restapi.EventConnectionClosed)
+			}
+		}
+
+		if sessionUpdate.State != "" && sessionUpdate.State != session.State {
+			frontend.events.Publish(restapi.Event{
+				Type:      restapi.EventSessionState,
+				PoolId:    poolId,
+				AgentId:   agent.Id,
+				SessionId: sessionId,
+				State:     sessionUpdate.State,
+			})
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event restapi.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+	return err
+}
+
+// getEventsEp streams the events matching the pool_id, agent_id and session_id
+// query parameters as Server-Sent Events. When filtering by session or agent,
+// the current state of the session or agent is sent first. Only the events of
+// this process are streamed, the sessions assigned, preempted or expired by a
+// backend running in another process are not.
+func (frontend *Frontend) getEventsEp(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := restapi.EventFilter{
+		PoolId:    query.Get("pool_id"),
+		AgentId:   query.Get("agent_id"),
+		SessionId: query.Get("session_id"),
+	}
+
+	pools, err := frontend.authorizedPools(r, poolMember...)
+	if err == nil && filter.PoolId != "" {
+		err = frontend.authorize(r, filter.PoolId, poolMember...)
+	}
+
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	// Subscribe prior to retrieving the current state to avoid missing a change
+	subscription := frontend.events.Subscribe(filter)
+	defer subscription.Close()
+
+	initialEvents := make([]restapi.Event, 0)
+
+	if filter.SessionId != "" {
+		session, err := frontend.getSessionById(filter.SessionId)
+		if err != nil {
+			err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+			logger.Error(err)
+			return
+		}
+
+		err = frontend.authorize(r, session.PoolId, restapi.PermissionCreateSession, restapi.PermissionRegisterAgent)
+		if err != nil {
+			err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+			logger.Error(err)
+			return
+		}
+
+		initialEvents = append(initialEvents, restapi.Event{
+			Type:      restapi.EventSessionState,
+			Time:      time.Now().UTC(),
+			PoolId:    session.PoolId,
+			SessionId: session.Id,
+			State:     session.State,
+		})
+	}
+
+	if filter.AgentId != "" {
+		agent, err := frontend.getAgentById(filter.AgentId)
+		if err != nil {
+			err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+			logger.Error(err)
+			return
+		}
+
+		err = frontend.authorize(r, agent.PoolId, poolMember...)
+		if err != nil {
+			err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+			logger.Error(err)
+			return
+		}
+
+		initialEvents = append(initialEvents, restapi.Event{
+			Type:    restapi.EventAgentState,
+			Time:    time.Now().UTC(),
+			PoolId:  agent.PoolId,
+			AgentId: agent.Id,
+			State:   agent.State,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	controller := http.NewResponseController(w)
+
+	for _, event := range initialEvents {
+		err = errors.Join(err, writeEvent(w, event))
+	}
+
+	err = errors.Join(err, controller.Flush())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// The subscriber fell behind, the client is expected to reconnect
+				return
+			}
+
+			// Only events within the pools accessible to the user are sent, those
+			// without a pool are only sent when token validation is disabled
+			if pools != nil && !pools[event.PoolId] {
+				continue
+			}
+
+			err = writeEvent(w, event)
+		}
+
+		if err == nil {
+			err = controller.Flush()
+		}
+
+		if err != nil {
+			logger.Debugf("event stream closed, %s", err.Error())
+			return
+		}
+	}
+}
@@ -0,0 +1,197 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/events"
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage/gorm"
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage/memdb"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+func TestEvents(t *testing.T) {
+	logger.Configure()
+
+	db, err := memdb.OpenStorage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	frontend := &Frontend{
+		storage: db,
+		events:  events.NewBroker(),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(frontend.getEventsEp))
+	defer server.Close()
+
+	client := restapi.Client{
+		Client:  server.Client(),
+		Address: strings.TrimPrefix(server.URL, "http://"),
+	}
+
+	requirements := restapi.SessionRequirements{
+		PoolId: "Pool",
+		Gpus:   []restapi.GpuRequirements{{VramRequired: 1024}},
+	}
+
+	sessionId, err := frontend.requestSession(requirements, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.WatchEvents(restapi.EventFilter{SessionId: sessionId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	// Sessions requested by others are filtered out
+	_, err = frontend.requestSession(requirements, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = frontend.cancelSession(sessionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expectedState := range []string{restapi.SessionQueued, restapi.SessionClosed} {
+		event, err := stream.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if event.Type != restapi.EventSessionState || event.SessionId != sessionId || event.State != expectedState {
+			t.Errorf("expected session %s to be %s, received %+v", sessionId, expectedState, event)
+		}
+
+		if event.PoolId != requirements.PoolId {
+			t.Errorf("expected pool %s, received %s", requirements.PoolId, event.PoolId)
+		}
+	}
+}
+
+func TestEventsWithoutPool(t *testing.T) {
+	logger.Configure()
+
+	db, err := gorm.OpenStorage(context.Background(), "sqlite", "file:eventswithoutpool?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	frontend := &Frontend{
+		storage: db,
+		events:  events.NewBroker(),
+	}
+
+	pool, err := db.CreatePool("Pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.AddPermission(pool.Id, "User", restapi.PermissionCreateSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		frontend.getEventsEp(w, withSubject(r, "User"))
+	}))
+	defer server.Close()
+
+	client := restapi.Client{
+		Client:  server.Client(),
+		Address: strings.TrimPrefix(server.URL, "http://"),
+	}
+
+	stream, err := client.WatchEvents(restapi.EventFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	// The events without a pool are hidden from tokens limited to their pools
+	_, err = frontend.requestSession(restapi.SessionRequirements{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionId, err := frontend.requestSession(restapi.SessionRequirements{PoolId: pool.Id}, "User")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	} else if event.SessionId != sessionId {
+		t.Errorf("expected the event of session %s within the pool, received %+v", sessionId, event)
+	}
+}
+
+func TestConnectionEvents(t *testing.T) {
+	frontend := &Frontend{
+		events: events.NewBroker(),
+	}
+
+	subscription := frontend.events.Subscribe(restapi.EventFilter{})
+	defer subscription.Close()
+
+	connection := func(id string) restapi.Connection {
+		return restapi.Connection{ConnectionData: restapi.ConnectionData{Id: id}}
+	}
+
+	agent := restapi.Agent{Id: "Agent", PoolId: "Pool"}
+	sessions := map[string]restapi.Session{
+		"Session": {
+			Id:          "Session",
+			PoolId:      "Pool",
+			Connections: []restapi.Connection{connection("Closed")},
+		},
+	}
+
+	// The brief connection was created and closed since the previous update
+	frontend.publishAgentUpdate(agent, restapi.AgentUpdate{
+		Id: agent.Id,
+		SessionsUpdate: map[string]restapi.SessionUpdate{
+			"Session": {
+				Connections: map[string]restapi.Connection{
+					"Closed": connection("Closed"),
+					"Brief":  connection("Brief"),
+					"Opened": connection("Opened"),
+				},
+				ClosedConnections: []string{"Closed", "Brief"},
+			},
+		},
+	}, sessions)
+
+	received := map[string][]string{}
+	for len(subscription.Events()) > 0 {
+		event := <-subscription.Events()
+		received[event.Connection.Id] = append(received[event.Connection.Id], event.Type)
+	}
+
+	expected := map[string][]string{
+		"Closed": {restapi.EventConnectionClosed},
+		"Brief":  {restapi.EventConnectionOpened, restapi.EventConnectionClosed},
+		"Opened": {restapi.EventConnectionOpened},
+	}
+
+	for id, types := range expected {
+		if strings.Join(received[id], ",") != strings.Join(types, ",") {
+			t.Errorf("expected connection %s to report %v, received %v", id, types, received[id])
+		}
+	}
+}
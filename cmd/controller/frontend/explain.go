@@ -0,0 +1,98 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	pkgnet "github.com/Juice-Labs/Juice-Labs/pkg/net"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// validateExplainParams returns the field of the parameters which is invalid
+func validateExplainParams(params restapi.ExplainParams) (string, error) {
+	if (params.SessionId == "") == (params.Requirements == nil) {
+		return "sessionId", errors.New("expected either a session ID or requirements")
+	}
+
+	if params.Requirements != nil && params.Requirements.PoolId == "" {
+		return "requirements.poolId", errors.New("pool ID is required")
+	}
+
+	return "", nil
+}
+
+// sessionToExplain returns the queued session, or the session the user would
+// request with the requirements, once the user is authorized to explain it
+func (frontend *Frontend) sessionToExplain(r *http.Request, params restapi.ExplainParams) (storage.QueuedSession, error) {
+	if params.Requirements != nil {
+		err := frontend.authorize(r, params.Requirements.PoolId, restapi.PermissionCreateSession)
+		if err != nil {
+			return storage.QueuedSession{}, err
+		}
+
+		return storage.QueuedSession{
+			UserId:       userIdFromRequest(r),
+			Requirements: *params.Requirements,
+		}, nil
+	}
+
+	session, err := frontend.getSessionById(params.SessionId)
+	if err != nil {
+		return storage.QueuedSession{}, err
+	}
+
+	err = frontend.authorize(r, session.PoolId, restapi.PermissionCreateSession, restapi.PermissionRegisterAgent)
+	if err != nil {
+		return storage.QueuedSession{}, err
+	}
+
+	if session.State != restapi.SessionQueued {
+		return storage.QueuedSession{}, errors.Join(errConflict, fmt.Errorf("session %s is %s, only queued sessions are explained", session.Id, session.State))
+	}
+
+	return frontend.storage.GetQueuedSessionById(session.Id)
+}
+
+// explainEp reports why every agent of the pool of a session can or cannot
+// host it, along with the agent it would be assigned to
+func (frontend *Frontend) explainEp(w http.ResponseWriter, r *http.Request) {
+	params, err := pkgnet.ReadRequestBody[restapi.ExplainParams](r)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	field, err := validateExplainParams(params)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": field}))
+		logger.Error(err)
+		return
+	}
+
+	session, err := frontend.sessionToExplain(r, params)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	explanation, err := frontend.scheduler.Explain(session, time.Now())
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, explanation)
+	if err != nil {
+		logger.Error(err)
+	}
+}
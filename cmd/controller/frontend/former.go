@@ -11,9 +11,11 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
 	"github.com/Juice-Labs/Juice-Labs/cmd/internal/build"
 	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
 	pkgnet "github.com/Juice-Labs/Juice-Labs/pkg/net"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
 )
 
 // Pulled from former Node version
@@ -59,7 +61,7 @@ type StatusFormer struct {
 }
 
 func (frontend *Frontend) getStatusFormerEp(w http.ResponseWriter, r *http.Request) {
-	agents, err := frontend.getAgents("")
+	agents, err := frontend.getAgents(storage.AgentFilter{State: restapi.AgentActive})
 	if err == nil {
 		hosts := make([]AgentData, len(agents))
 		for index, agent := range agents {
@@ -123,7 +125,7 @@ func (frontend *Frontend) getStatusFormerEp(w http.ResponseWriter, r *http.Reque
 	}
 
 	if err != nil {
-		err = errors.Join(err, pkgnet.RespondWithString(w, http.StatusInternalServerError, err.Error()))
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
 		logger.Error(err)
 	}
 }
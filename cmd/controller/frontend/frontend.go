@@ -4,15 +4,14 @@
 package frontend
 
 import (
-	"errors"
 	"flag"
-	"net/http"
 	"os"
-	"sync"
 	"time"
 
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/backend"
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/events"
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
-	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/gpu"
 	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
 	"github.com/Juice-Labs/Juice-Labs/pkg/server"
 	"github.com/Juice-Labs/Juice-Labs/pkg/task"
@@ -20,7 +19,7 @@ import (
 
 var (
 	overrideHostname = flag.String("override-hostname", "", "")
-	webhook          = flag.String("webhook-url", "", "")
+	webhook          = flag.String("webhook-url", "", "Posts the session state changes to the URL, further webhooks are managed through /v1/webhook")
 )
 
 type Frontend struct {
@@ -28,13 +27,16 @@ type Frontend struct {
 
 	hostname string
 
-	webhookClient   restapi.Client
-	webhookMessages chan restapi.WebhookMessage
+	webhooks *webhookDispatcher
 
 	storage storage.Storage
+	events  *events.Broker
+
+	// Explains the scheduling of sessions, the backend may run in another process
+	scheduler *backend.Backend
 }
 
-func NewFrontend(server *server.Server, storage storage.Storage) (*Frontend, error) {
+func NewFrontend(server *server.Server, storage storage.Storage, events *events.Broker) (*Frontend, error) {
 	hostname := *overrideHostname
 	if hostname == "" {
 		hostname_, err := os.Hostname()
@@ -45,19 +47,20 @@ func NewFrontend(server *server.Server, storage storage.Storage) (*Frontend, err
 		hostname = hostname_
 	}
 
+	scheduler, err := backend.NewBackend(storage, events)
+	if err != nil {
+		return nil, err
+	}
+
 	frontend := &Frontend{
 		startTime: time.Now(),
 		hostname:  hostname,
 		storage:   storage,
+		events:    events,
+		scheduler: scheduler,
 	}
 
-	if *webhook != "" {
-		frontend.webhookClient = restapi.Client{
-			Client:  &http.Client{},
-			Address: *webhook,
-		}
-		frontend.webhookMessages = make(chan restapi.WebhookMessage, 32)
-	}
+	frontend.webhooks = newWebhookDispatcher(storage, events)
 
 	frontend.initializeEndpoints(server)
 
@@ -65,123 +68,176 @@ func NewFrontend(server *server.Server, storage storage.Storage) (*Frontend, err
 }
 
 func (frontend *Frontend) Run(group task.Group) error {
-	if frontend.webhookMessages != nil {
-		var messages []restapi.WebhookMessage
-
-		messagesCond := sync.NewCond(&sync.Mutex{})
-
-		group.GoFn("Webhook Copying", func(group task.Group) error {
-			for {
-				select {
-				case <-group.Ctx().Done():
-					messagesCond.Signal()
-					return nil
-
-				case msg := <-frontend.webhookMessages:
-					messagesCond.L.Lock()
-					messages = append(messages, msg)
-					messagesCond.L.Unlock()
-					messagesCond.Signal()
-				}
-			}
-		})
+	return frontend.webhooks.Run(group)
+}
 
-		group.GoFn("Webhook Calling", func(g task.Group) error {
-			for {
-				for len(messages) > 0 {
-					select {
-					case <-group.Ctx().Done():
-						return nil
-
-					default:
-						messagesCond.L.Lock()
-						msg := messages[0]
-						messages = messages[1:]
-						messagesCond.L.Unlock()
-
-						body, err := restapi.JsonReaderFromObject(msg)
-						if err == nil {
-							response, err_ := frontend.webhookClient.PostWithJson(group.Ctx(), *webhook, body)
-							if response != nil {
-								err = errors.Join(err_, response.Body.Close())
-							}
-						}
-
-						if err != nil {
-							logger.Error(err)
-						}
-					}
-				}
-
-				messagesCond.L.Lock()
-				for len(messages) == 0 {
-					select {
-					case <-group.Ctx().Done():
-						return nil
-
-					default:
-					}
-
-					messagesCond.Wait()
-				}
-				messagesCond.L.Unlock()
-			}
+func (frontend *Frontend) registerAgent(agent restapi.Agent) (string, error) {
+	agent.State = restapi.AgentActive
+	id, err := frontend.storage.RegisterAgent(agent)
+	if err == nil {
+		frontend.events.Publish(restapi.Event{
+			Type:    restapi.EventAgentRegistered,
+			PoolId:  agent.PoolId,
+			AgentId: id,
+			State:   agent.State,
 		})
 	}
 
-	return nil
+	return id, err
 }
 
-func (frontend *Frontend) registerAgent(agent restapi.Agent) (string, error) {
-	agent.State = restapi.AgentActive
-	return frontend.storage.RegisterAgent(agent)
+func (frontend *Frontend) listAgents(filter storage.AgentFilter, page storage.Page) ([]restapi.Agent, string, error) {
+	return frontend.storage.ListAgents(filter, page)
 }
 
-func (frontend *Frontend) getAgents(poolId string) ([]restapi.Agent, error) {
-	iterator, err := frontend.storage.GetAgents(poolId)
-	if err != nil {
-		return nil, err
+// getAgents returns every agent matching the filter
+func (frontend *Frontend) getAgents(filter storage.AgentFilter) ([]restapi.Agent, error) {
+	agents := make([]restapi.Agent, 0)
+
+	page := storage.Page{Limit: storage.MaxPageLimit}
+	for {
+		pageAgents, next, err := frontend.listAgents(filter, page)
+		if err != nil {
+			return nil, err
+		}
+
+		agents = append(agents, pageAgents...)
+
+		if next == "" {
+			return agents, nil
+		}
+
+		page.Cursor = next
 	}
+}
 
-	agents := make([]restapi.Agent, 0)
-	for iterator.Next() {
-		agents = append(agents, iterator.Value())
+// withAllocations reports the compute share and the number of sessions
+// allocated on each GPU of the agent
+func withAllocations(agent restapi.Agent) restapi.Agent {
+	gpuSet := gpu.NewGpuSet(agent.Gpus)
+	for _, session := range agent.Sessions {
+		if len(session.Gpus) > 0 {
+			gpuSet.Select(session.Gpus)
+		}
 	}
 
-	return agents, nil
+	agent.Gpus = gpuSet.GetGpus()
+	return agent
 }
 
 func (frontend *Frontend) getAgentById(id string) (restapi.Agent, error) {
 	return frontend.storage.GetAgentById(id)
 }
 
-func (frontend *Frontend) updateAgent(update restapi.AgentUpdate) error {
-	err := frontend.storage.UpdateAgent(update)
-	if err == nil && len(update.SessionsUpdate) > 0 {
-		if frontend.webhookMessages != nil {
-			for sessionId, session := range update.SessionsUpdate {
-				frontend.webhookMessages <- restapi.WebhookMessage{
-					Agent:   update.Id,
-					Session: sessionId,
-					State:   session.State,
-				}
+// updateAgent applies the update to the agent, which holds the state of the agent prior to the update
+func (frontend *Frontend) updateAgent(agent restapi.Agent, update restapi.AgentUpdate) error {
+	// The sessions prior to the update are required to determine which events to publish
+	var sessions map[string]restapi.Session
+	if frontend.events.HasSubscribers() {
+		sessions = map[string]restapi.Session{}
+		for sessionId := range update.SessionsUpdate {
+			session, err := frontend.storage.GetSessionById(sessionId)
+			if err == nil {
+				sessions[sessionId] = session
 			}
 		}
 	}
 
+	err := frontend.storage.UpdateAgent(update)
+	if err == nil && sessions != nil {
+		frontend.publishAgentUpdate(agent, update, sessions)
+	}
+
 	return err
 }
 
-func (frontend *Frontend) requestSession(sessionRequirements restapi.SessionRequirements) (string, error) {
-	return frontend.storage.RequestSession(sessionRequirements)
+// setAgentDrainState changes the drain state of the agent, returns the updated agent
+func (frontend *Frontend) setAgentDrainState(agent restapi.Agent, drainState string, deadline *time.Time) (restapi.Agent, error) {
+	err := frontend.storage.SetAgentDrainState(agent.Id, drainState, deadline)
+	if err != nil {
+		return restapi.Agent{}, err
+	}
+
+	if drainState != agent.DrainState {
+		frontend.events.Publish(restapi.Event{
+			Type:    restapi.EventAgentDrainState,
+			PoolId:  agent.PoolId,
+			AgentId: agent.Id,
+			State:   drainState,
+		})
+	}
+
+	return frontend.storage.GetAgentById(agent.Id)
+}
+
+func (frontend *Frontend) requestSession(sessionRequirements restapi.SessionRequirements, userId string) (string, error) {
+	id, err := frontend.storage.RequestSession(sessionRequirements, userId)
+	if err == nil {
+		frontend.events.Publish(restapi.Event{
+			Type:      restapi.EventSessionState,
+			PoolId:    sessionRequirements.PoolId,
+			SessionId: id,
+			State:     restapi.SessionQueued,
+		})
+	}
+
+	return id, err
 }
 
 func (frontend *Frontend) getSessionById(id string) (restapi.Session, error) {
 	return frontend.storage.GetSessionById(id)
 }
 
+// listSessions returns a page of the sessions matching the filter, the queued
+// sessions listed are given their position within the queue
+func (frontend *Frontend) listSessions(filter storage.SessionFilter, page storage.Page) ([]restapi.ListedSession, string, error) {
+	sessions, next, err := frontend.storage.ListSessions(filter, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	queued := map[string]int{}
+	for index, session := range sessions {
+		if session.State == restapi.SessionQueued {
+			queued[session.Id] = index
+		}
+	}
+
+	if len(queued) == 0 {
+		return sessions, next, nil
+	}
+
+	iterator, err := frontend.storage.GetQueuedSessionsIterator()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for position := 1; len(queued) > 0 && iterator.Next(); position++ {
+		id := iterator.Value().Id
+		if index, found := queued[id]; found {
+			sessions[index].QueuePosition = position
+			delete(queued, id)
+		}
+	}
+
+	return sessions, next, nil
+}
+
 func (frontend *Frontend) cancelSession(id string) error {
-	return frontend.storage.CancelSession(id)
+	err := frontend.storage.CancelSession(id)
+	if err == nil && frontend.events.HasSubscribers() {
+		session, err_ := frontend.storage.GetSessionById(id)
+		if err_ == nil {
+			frontend.events.Publish(restapi.Event{
+				Type:      restapi.EventSessionState,
+				PoolId:    session.PoolId,
+				SessionId: id,
+				State:     session.State,
+			})
+		}
+	}
+
+	return err
 }
 
 func (frontend *Frontend) deletePool(id string) error {
@@ -210,3 +266,41 @@ func (frontend *Frontend) removePermission(poolId string, userId string, permiss
 func (frontend *Frontend) getPermissions(userId string) (restapi.UserPermissions, error) {
 	return frontend.storage.GetPermissions(userId)
 }
+
+func (frontend *Frontend) getPoolQuota(poolId string) (restapi.PoolQuota, error) {
+	return frontend.storage.GetPoolQuota(poolId)
+}
+
+func (frontend *Frontend) setQuota(poolId string, userId string, limits restapi.QuotaLimits) error {
+	return frontend.storage.SetQuota(poolId, userId, limits)
+}
+
+func (frontend *Frontend) removeQuota(poolId string, userId string) error {
+	return frontend.storage.RemoveQuota(poolId, userId)
+}
+
+func (frontend *Frontend) createWebhook(webhook restapi.Webhook) (restapi.Webhook, error) {
+	webhook, err := frontend.storage.CreateWebhook(webhook)
+	if err == nil {
+		err = frontend.webhooks.refresh()
+	}
+
+	return webhook, err
+}
+
+func (frontend *Frontend) getWebhookById(id string) (restapi.Webhook, error) {
+	return frontend.storage.GetWebhookById(id)
+}
+
+func (frontend *Frontend) getWebhooks() ([]restapi.Webhook, error) {
+	return frontend.storage.GetWebhooks()
+}
+
+func (frontend *Frontend) deleteWebhook(id string) error {
+	err := frontend.storage.DeleteWebhook(id)
+	if err == nil {
+		err = frontend.webhooks.refresh()
+	}
+
+	return err
+}
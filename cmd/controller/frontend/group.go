@@ -0,0 +1,192 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	pkgnet "github.com/Juice-Labs/Juice-Labs/pkg/net"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// The most members a single group may request
+const maxGroupMembers = 256
+
+// validateGroup returns the field of the requirements which is invalid
+func validateGroup(requirements restapi.SessionGroupRequirements) (string, error) {
+	if requirements.Members < 1 {
+		return "members", errors.New("group must request at least one member")
+	}
+
+	if requirements.Members > maxGroupMembers {
+		return "members", fmt.Errorf("group must not request more than %d members", maxGroupMembers)
+	}
+
+	if requirements.Session.PoolId == "" {
+		return "session.poolId", errors.New("pool ID is required")
+	}
+
+	if len(requirements.Session.Gpus) == 0 {
+		return "session.gpus", errors.New("members must request at least one GPU")
+	}
+
+	err := validateGpuRequirements(requirements.Session.Gpus)
+	if err != nil {
+		return "session.gpus", err
+	}
+
+	field, err := validateTimeouts(requirements.Session.SessionTimeouts)
+	if err != nil {
+		return "session." + field, err
+	}
+
+	err = validateMatchExpressions(requirements.Session.MatchExpressions)
+	if err != nil {
+		return "session.matchExpressions", err
+	}
+
+	err = validatePreferences(requirements.Session.Preferences)
+	if err != nil {
+		return "session.preferences", err
+	}
+
+	return "", nil
+}
+
+func (frontend *Frontend) requestSessionGroup(requirements restapi.SessionGroupRequirements, userId string) (string, error) {
+	id, err := frontend.storage.RequestSessionGroup(requirements, userId)
+	if err == nil && frontend.events.HasSubscribers() {
+		group, err_ := frontend.storage.GetSessionGroup(id)
+		if err_ == nil {
+			for _, session := range group.Sessions {
+				frontend.events.Publish(restapi.Event{
+					Type:      restapi.EventSessionState,
+					PoolId:    group.PoolId,
+					SessionId: session.Id,
+					State:     session.State,
+				})
+			}
+		}
+	}
+
+	return id, err
+}
+
+// cancelSessionGroup cancels the members of the group which are neither being
+// canceled nor closed
+func (frontend *Frontend) cancelSessionGroup(group restapi.SessionGroup) error {
+	var err error
+	for _, session := range group.Sessions {
+		if session.State != restapi.SessionCanceling && session.State != restapi.SessionClosed {
+			err = errors.Join(err, frontend.cancelSession(session.Id))
+		}
+	}
+
+	return err
+}
+
+func (frontend *Frontend) requestSessionGroupEp(w http.ResponseWriter, r *http.Request) {
+	requirements, err := pkgnet.ReadRequestBody[restapi.SessionGroupRequirements](r)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	field, err := validateGroup(requirements)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": field}))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, requirements.Session.PoolId, restapi.PermissionCreateSession)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.validateReservationId(requirements.Session, userIdFromRequest(r), time.Now())
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, errorStatus(err), err, map[string]string{"field": "session.reservationId"}))
+		logger.Error(err)
+		return
+	}
+
+	id, err := frontend.requestSessionGroup(requirements, userIdFromRequest(r))
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.RespondWithString(w, http.StatusOK, id)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func (frontend *Frontend) getSessionGroupEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	group, err := frontend.storage.GetSessionGroup(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, group.PoolId, restapi.PermissionCreateSession, restapi.PermissionRegisterAgent)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, group)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func (frontend *Frontend) cancelSessionGroupEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	group, err := frontend.storage.GetSessionGroup(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, group.PoolId, restapi.PermissionCreateSession)
+	if err == nil && group.State == restapi.SessionClosed {
+		err = errors.Join(errConflict, fmt.Errorf("group %s is closed", id))
+	}
+
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.cancelSessionGroup(group)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, fmt.Sprintf("Group %s cancelled", id))
+	if err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,59 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"testing"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+func TestValidateGroup(t *testing.T) {
+	valid := restapi.SessionGroupRequirements{
+		Members: 2,
+		Session: restapi.SessionRequirements{
+			PoolId: "pool",
+			Gpus:   []restapi.GpuRequirements{{VramRequired: 1024}},
+		},
+	}
+
+	field, err := validateGroup(valid)
+	if err != nil {
+		t.Errorf("expected the group to be valid, got %s, %v", field, err)
+	}
+
+	for expected, modify := range map[string]func(*restapi.SessionGroupRequirements){
+		"members":             func(r *restapi.SessionGroupRequirements) { r.Members = 0 },
+		"session.poolId":      func(r *restapi.SessionGroupRequirements) { r.Session.PoolId = "" },
+		"session.gpus":        func(r *restapi.SessionGroupRequirements) { r.Session.Gpus = nil },
+		"session.maxDuration": func(r *restapi.SessionGroupRequirements) { r.Session.MaxDuration = -1 },
+		"session.matchExpressions": func(r *restapi.SessionGroupRequirements) {
+			r.Session.MatchExpressions = []restapi.SelectorRequirement{{Key: "rack", Operator: "Near"}}
+		},
+		"session.preferences": func(r *restapi.SessionGroupRequirements) {
+			r.Session.Preferences = []restapi.Preference{{Type: restapi.PreferLowUtilization, Weight: 0}}
+		},
+	} {
+		requirements := valid
+		modify(&requirements)
+
+		field, err = validateGroup(requirements)
+		if err == nil || field != expected {
+			t.Errorf("expected %s to be invalid, got %s, %v", expected, field, err)
+		}
+	}
+
+	invalidGpus := valid
+	invalidGpus.Session.Gpus = []restapi.GpuRequirements{{Exclude: []restapi.GpuExclusion{{}}}}
+	field, _ = validateGroup(invalidGpus)
+	if field != "session.gpus" {
+		t.Errorf("expected an empty GPU exclusion to be invalid, got %s", field)
+	}
+
+	valid.Members = maxGroupMembers + 1
+	field, _ = validateGroup(valid)
+	if field != "members" {
+		t.Errorf("expected more than %d members to be invalid, got %s", maxGroupMembers, field)
+	}
+}
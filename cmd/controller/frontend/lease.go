@@ -0,0 +1,111 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	pkgnet "github.com/Juice-Labs/Juice-Labs/pkg/net"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+var (
+	sessionLeaseTtl    = flag.Duration("session-lease-ttl", 30*time.Second, "The time until the lease of a session expires when the client does not request one")
+	maxSessionLeaseTtl = flag.Duration("max-session-lease-ttl", 10*time.Minute, "The longest lease a client may request for a session")
+)
+
+// leaseTtl returns the time until a lease renewed with the params expires
+func leaseTtl(params restapi.LeaseParams) (time.Duration, error) {
+	if params.Ttl < 0 {
+		return 0, errors.New("ttl must not be negative")
+	}
+
+	if params.Ttl == 0 {
+		return *sessionLeaseTtl, nil
+	}
+
+	ttl := time.Duration(params.Ttl) * time.Second
+	if ttl > *maxSessionLeaseTtl {
+		return 0, fmt.Errorf("ttl must not exceed %d seconds", int64(maxSessionLeaseTtl.Seconds()))
+	}
+
+	return ttl, nil
+}
+
+// renewSessionLease extends the lease of a session which has yet to be
+// canceled or closed
+func (frontend *Frontend) renewSessionLease(session restapi.Session, ttl time.Duration) (restapi.SessionLease, error) {
+	if session.State == restapi.SessionCanceling || session.State == restapi.SessionClosed {
+		return restapi.SessionLease{}, errors.Join(errConflict, fmt.Errorf("session %s is %s", session.Id, session.State))
+	}
+
+	expires := time.Now().Add(ttl).UTC()
+
+	err := frontend.storage.RenewSessionLease(session.Id, expires)
+	if err != nil {
+		return restapi.SessionLease{}, err
+	}
+
+	return restapi.SessionLease{
+		SessionId: session.Id,
+		Ttl:       int64(ttl.Seconds()),
+		ExpiresAt: expires,
+	}, nil
+}
+
+// heartbeatSessionEp renews the lease of the session, the backend cancels the
+// sessions whose lease has expired
+func (frontend *Frontend) heartbeatSessionEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	session, err := frontend.getSessionById(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, session.PoolId, restapi.PermissionCreateSession)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	var params restapi.LeaseParams
+	if r.ContentLength != 0 {
+		params, err = pkgnet.ReadRequestBody[restapi.LeaseParams](r)
+		if err != nil {
+			err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+			logger.Error(err)
+			return
+		}
+	}
+
+	ttl, err := leaseTtl(params)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": "ttl"}))
+		logger.Error(err)
+		return
+	}
+
+	lease, err := frontend.renewSessionLease(session, ttl)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, lease)
+	if err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,27 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"testing"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/server"
+	"github.com/Juice-Labs/Juice-Labs/pkg/server/servertest"
+)
+
+// TestClientMatchesOpenApi calls every method of restapi.Client and checks the
+// request made is described by the OpenAPI document of the controller
+func TestClientMatchesOpenApi(t *testing.T) {
+	controller, err := server.NewServer("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frontend := &Frontend{}
+	frontend.initializeEndpoints(controller)
+
+	servertest.CheckClient(t, controller.OpenApi(), func(method string) bool {
+		return true
+	})
+}
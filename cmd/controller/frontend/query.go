@@ -0,0 +1,174 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// The query parameters selecting a page of a list endpoint
+var pageQueryParameters = []string{"limit", "cursor"}
+
+// The query parameters filtering the agents listed
+var agentQueryParameters = []string{"pool_id", "state", "selector", "gpu", "min_vram"}
+
+// The query parameters filtering the sessions listed
+var sessionQueryParameters = []string{"pool_id", "agent_id", "state", "version", "created_after", "created_before"}
+
+func invalidQueryParameter(name string, err error) error {
+	return errors.Join(errInvalidQuery, fmt.Errorf("query parameter %s is invalid, %w", name, err))
+}
+
+// pageFromQuery returns the page selected by the limit and cursor parameters,
+// the cursor is the id of the last object of the previous page
+func pageFromQuery(query url.Values) (storage.Page, error) {
+	page := storage.Page{
+		Cursor: query.Get("cursor"),
+		Limit:  storage.DefaultPageLimit,
+	}
+
+	if page.Cursor != "" {
+		_, err := uuid.Parse(page.Cursor)
+		if err != nil {
+			return storage.Page{}, invalidQueryParameter("cursor", err)
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err == nil && (limit < 1 || limit > storage.MaxPageLimit) {
+			err = fmt.Errorf("expected a value between 1 and %d", storage.MaxPageLimit)
+		}
+
+		if err != nil {
+			return storage.Page{}, invalidQueryParameter("limit", err)
+		}
+
+		page.Limit = limit
+	}
+
+	return page, nil
+}
+
+// parseSelector parses a label selector of the form key1=value1,key2=value2
+func parseSelector(selector string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, requirement := range strings.Split(selector, ",") {
+		key, value, found := strings.Cut(requirement, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %s", requirement)
+		}
+
+		labels[key] = strings.TrimSpace(value)
+	}
+
+	return labels, nil
+}
+
+// agentFilterFromQuery returns the filter described by the query parameters,
+// only active agents are listed unless another state is requested
+func agentFilterFromQuery(query url.Values) (storage.AgentFilter, error) {
+	filter := storage.AgentFilter{
+		State:   restapi.AgentActive,
+		PoolId:  query.Get("pool_id"),
+		GpuName: query.Get("gpu"),
+	}
+
+	if state := query.Get("state"); state != "" {
+		switch state {
+		case restapi.AgentActive, restapi.AgentDisabled, restapi.AgentMissing, restapi.AgentClosed:
+			filter.State = state
+		default:
+			return storage.AgentFilter{}, invalidQueryParameter("state", fmt.Errorf("unknown agent state %s", state))
+		}
+	}
+
+	if selector := query.Get("selector"); selector != "" {
+		labels, err := parseSelector(selector)
+		if err != nil {
+			return storage.AgentFilter{}, invalidQueryParameter("selector", err)
+		}
+
+		filter.Selector = labels
+	}
+
+	if value := query.Get("min_vram"); value != "" {
+		vram, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return storage.AgentFilter{}, invalidQueryParameter("min_vram", err)
+		}
+
+		filter.MinVramAvailable = vram
+	}
+
+	return filter, nil
+}
+
+// sessionFilterFromQuery returns the filter described by the query parameters,
+// the creation times are formatted as RFC 3339
+func sessionFilterFromQuery(query url.Values) (storage.SessionFilter, error) {
+	filter := storage.SessionFilter{
+		PoolId:  query.Get("pool_id"),
+		AgentId: query.Get("agent_id"),
+		Version: query.Get("version"),
+	}
+
+	if filter.AgentId != "" {
+		_, err := uuid.Parse(filter.AgentId)
+		if err != nil {
+			return storage.SessionFilter{}, invalidQueryParameter("agent_id", err)
+		}
+	}
+
+	if state := query.Get("state"); state != "" {
+		switch state {
+		case restapi.SessionQueued, restapi.SessionAssigned, restapi.SessionActive, restapi.SessionCanceling, restapi.SessionClosed:
+			filter.State = state
+		default:
+			return storage.SessionFilter{}, invalidQueryParameter("state", fmt.Errorf("unknown session state %s", state))
+		}
+	}
+
+	for name, created := range map[string]*time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		if value := query.Get(name); value != "" {
+			var err error
+			*created, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return storage.SessionFilter{}, invalidQueryParameter(name, err)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// sortedPoolIds returns the ids of the pools, nil if the pools are nil
+func sortedPoolIds(pools map[string]bool) []string {
+	if pools == nil {
+		return nil
+	}
+
+	poolIds := make([]string, 0, len(pools))
+	for poolId := range pools {
+		poolIds = append(poolIds, poolId)
+	}
+	sort.Strings(poolIds)
+
+	return poolIds
+}
@@ -0,0 +1,291 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	pkgnet "github.com/Juice-Labs/Juice-Labs/pkg/net"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// The query parameters selecting the reservations listed
+var reservationQueryParameters = []string{"pool_id", "from", "to"}
+
+// validateReservation returns the field of the reservation which is invalid
+func validateReservation(reservation restapi.Reservation, now time.Time) (string, error) {
+	if reservation.PoolId == "" {
+		return "poolId", errors.New("pool ID is required")
+	}
+
+	if len(reservation.Gpus) == 0 {
+		return "gpus", errors.New("reservation must request at least one GPU")
+	}
+
+	err := validateGpuRequirements(reservation.Gpus)
+	if err != nil {
+		return "gpus", err
+	}
+
+	if reservation.Start.IsZero() {
+		return "start", errors.New("start is required")
+	}
+
+	if !reservation.Start.Before(reservation.End) {
+		return "end", errors.New("end must be after start")
+	}
+
+	if !reservation.End.After(now) {
+		return "end", errors.New("end must be in the future")
+	}
+
+	return "", nil
+}
+
+// reservationFilterFromQuery returns the filter described by the query
+// parameters, reservations which have ended are excluded unless requested
+func reservationFilterFromQuery(query url.Values, now time.Time) (storage.ReservationFilter, error) {
+	filter := storage.ReservationFilter{
+		PoolId: query.Get("pool_id"),
+		From:   now.UTC(),
+	}
+
+	for name, value := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if query.Get(name) != "" {
+			parsed, err := time.Parse(time.RFC3339, query.Get(name))
+			if err != nil {
+				return storage.ReservationFilter{}, invalidQueryParameter(name, err)
+			}
+
+			*value = parsed.UTC()
+		}
+	}
+
+	if !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return storage.ReservationFilter{}, invalidQueryParameter("from", errors.New("expected a time before to"))
+	}
+
+	return filter, nil
+}
+
+// checkReservationCapacity ensures the GPUs of the reservations overlapping the
+// window of the reservation, along with its own, do not exceed the GPUs of the
+// active agents of the pool
+func (frontend *Frontend) checkReservationCapacity(reservation restapi.Reservation) error {
+	agents, err := frontend.getAgents(storage.AgentFilter{
+		State:  restapi.AgentActive,
+		PoolId: reservation.PoolId,
+	})
+	if err != nil {
+		return err
+	}
+
+	capacity := 0
+	for _, agent := range agents {
+		capacity += len(agent.Gpus)
+	}
+
+	overlapping, err := frontend.storage.GetReservations(storage.ReservationFilter{
+		PoolId: reservation.PoolId,
+		From:   reservation.Start,
+		To:     reservation.End,
+	})
+	if err != nil {
+		return err
+	}
+
+	reserved := len(reservation.Gpus)
+	for _, other := range overlapping {
+		reserved += len(other.Gpus)
+	}
+
+	if reserved > capacity {
+		return errors.Join(errConflict, fmt.Errorf("pool %s has %d GPUs, %d would be reserved between %s and %s",
+			reservation.PoolId, capacity, reserved, reservation.Start.Format(time.RFC3339), reservation.End.Format(time.RFC3339)))
+	}
+
+	return nil
+}
+
+// validateReservationId ensures the session requirements refer to a reservation
+// of their pool, owned by the user, which has yet to end
+func (frontend *Frontend) validateReservationId(requirements restapi.SessionRequirements, userId string, now time.Time) error {
+	if requirements.ReservationId == "" {
+		return nil
+	}
+
+	reservation, err := frontend.storage.GetReservationById(requirements.ReservationId)
+	if errors.Is(err, storage.ErrNotFound) {
+		return errors.Join(pkgnet.ErrInvalidBody, fmt.Errorf("reservation %s does not exist", requirements.ReservationId))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if reservation.PoolId != requirements.PoolId {
+		return errors.Join(pkgnet.ErrInvalidBody, fmt.Errorf("reservation %s belongs to another pool", reservation.Id))
+	}
+
+	if !reservation.End.After(now) {
+		return errors.Join(pkgnet.ErrInvalidBody, fmt.Errorf("reservation %s has ended", reservation.Id))
+	}
+
+	if reservation.UserId != "" && reservation.UserId != userId {
+		return errors.Join(errForbidden, fmt.Errorf("reservation %s belongs to another user", reservation.Id))
+	}
+
+	return nil
+}
+
+func (frontend *Frontend) createReservationEp(w http.ResponseWriter, r *http.Request) {
+	reservation, err := pkgnet.ReadRequestBody[restapi.Reservation](r)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	field, err := validateReservation(reservation, time.Now())
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithErrorDetails(w, http.StatusBadRequest, err, map[string]string{"field": field}))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, reservation.PoolId, restapi.PermissionCreateSession)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	reservation.UserId = userIdFromRequest(r)
+	reservation.Start = reservation.Start.UTC()
+	reservation.End = reservation.End.UTC()
+
+	err = frontend.checkReservationCapacity(reservation)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	reservation, err = frontend.storage.CreateReservation(reservation)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, reservation)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// getReservationsEp lists the reservations of the pools the user is a member
+// of, ordered by their start
+func (frontend *Frontend) getReservationsEp(w http.ResponseWriter, r *http.Request) {
+	filter, err := reservationFilterFromQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	if filter.PoolId != "" {
+		err = frontend.authorize(r, filter.PoolId, poolMember...)
+	} else {
+		var pools map[string]bool
+		pools, err = frontend.authorizedPools(r, poolMember...)
+		filter.PoolIds = sortedPoolIds(pools)
+	}
+
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	reservations, err := frontend.storage.GetReservations(filter)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, reservations)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func (frontend *Frontend) getReservationEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	reservation, err := frontend.storage.GetReservationById(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.authorize(r, reservation.PoolId, poolMember...)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, reservation)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// deleteReservationEp deletes a reservation, only its owner or an admin of its
+// pool may delete it
+func (frontend *Frontend) deleteReservationEp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	reservation, err := frontend.storage.GetReservationById(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	if reservation.UserId != "" && reservation.UserId == userIdFromRequest(r) {
+		err = frontend.authorize(r, reservation.PoolId, restapi.PermissionCreateSession)
+	} else {
+		err = frontend.authorize(r, reservation.PoolId, restapi.PermissionAdmin)
+	}
+
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = frontend.storage.DeleteReservation(id)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	err = pkgnet.Respond(w, http.StatusOK, fmt.Sprintf("Reservation %s deleted", id))
+	if err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,46 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+func TestValidateReservation(t *testing.T) {
+	now := time.Now()
+
+	valid := restapi.Reservation{
+		PoolId: "pool",
+		Gpus:   []restapi.GpuRequirements{{VramRequired: 1024}},
+		Start:  now.Add(time.Hour),
+		End:    now.Add(2 * time.Hour),
+	}
+
+	field, err := validateReservation(valid, now)
+	if err != nil {
+		t.Errorf("expected the reservation to be valid, got %s, %v", field, err)
+	}
+
+	for _, test := range []struct {
+		field  string
+		modify func(*restapi.Reservation)
+	}{
+		{"poolId", func(r *restapi.Reservation) { r.PoolId = "" }},
+		{"gpus", func(r *restapi.Reservation) { r.Gpus = nil }},
+		{"start", func(r *restapi.Reservation) { r.Start = time.Time{} }},
+		{"end", func(r *restapi.Reservation) { r.End = r.Start }},
+		{"end", func(r *restapi.Reservation) { r.Start, r.End = now.Add(-2*time.Hour), now.Add(-time.Hour) }},
+	} {
+		reservation := valid
+		test.modify(&reservation)
+
+		field, err = validateReservation(reservation, now)
+		if err == nil || field != test.field {
+			t.Errorf("expected %s to be invalid, got %s, %v", test.field, field, err)
+		}
+	}
+}
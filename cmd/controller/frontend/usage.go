@@ -0,0 +1,324 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	pkgnet "github.com/Juice-Labs/Juice-Labs/pkg/net"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// The period reported when the query does not specify the start of the report
+const defaultUsagePeriod = 30 * 24 * time.Hour
+
+const bytesPerGb = 1024 * 1024 * 1024
+
+// The query parameters selecting the usage reported
+var usageQueryParameters = []string{"from", "to", "pool_id", "user_id", "group_by", "format"}
+
+// usageFromQuery returns the filter and groups described by the query
+// parameters, the report ends now and covers the default period unless
+// requested otherwise
+func usageFromQuery(query url.Values, now time.Time) (storage.UsageFilter, []string, error) {
+	filter := storage.UsageFilter{
+		PoolId: query.Get("pool_id"),
+		UserId: query.Get("user_id"),
+		To:     now.UTC(),
+	}
+
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return storage.UsageFilter{}, nil, invalidQueryParameter("to", err)
+		}
+
+		filter.To = to.UTC()
+	}
+
+	filter.From = filter.To.Add(-defaultUsagePeriod)
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return storage.UsageFilter{}, nil, invalidQueryParameter("from", err)
+		}
+
+		filter.From = from.UTC()
+	}
+
+	if !filter.From.Before(filter.To) {
+		return storage.UsageFilter{}, nil, invalidQueryParameter("from", errors.New("expected a time before to"))
+	}
+
+	groupBy := []string{}
+	if value := query.Get("group_by"); value != "" {
+		for _, group := range strings.Split(value, ",") {
+			group = strings.TrimSpace(group)
+			switch group {
+			case restapi.UsageGroupPool, restapi.UsageGroupUser, restapi.UsageGroupGpu, restapi.UsageGroupDay:
+				groupBy = append(groupBy, group)
+			default:
+				return storage.UsageFilter{}, nil, invalidQueryParameter("group_by", fmt.Errorf("unknown group %s", group))
+			}
+		}
+	}
+
+	switch format := query.Get("format"); format {
+	case "", "json", "csv":
+	default:
+		return storage.UsageFilter{}, nil, invalidQueryParameter("format", fmt.Errorf("unknown format %s", format))
+	}
+
+	return filter, groupBy, nil
+}
+
+// aggregateUsage sums the GPUs and VRAM reserved by the sessions between their
+// assignment and closing, within the range of time, by the groups. Sessions
+// which were never assigned did not reserve anything and are not reported.
+func aggregateUsage(records []restapi.UsageRecord, from time.Time, to time.Time, groupBy []string) []restapi.UsageEntry {
+	groups := map[string]bool{}
+	for _, group := range groupBy {
+		groups[group] = true
+	}
+
+	entries := map[restapi.UsageEntry]*restapi.UsageEntry{}
+	sessions := map[restapi.UsageEntry]map[string]bool{}
+
+	for _, record := range records {
+		if record.AssignedAt == nil {
+			continue
+		}
+
+		start := *record.AssignedAt
+		if start.Before(from) {
+			start = from
+		}
+
+		end := record.ClosedAt
+		if end.After(to) {
+			end = to
+		}
+
+		// Sessions without GPUs are still counted
+		gpus := record.Gpus
+		if len(gpus) == 0 {
+			gpus = []restapi.UsageGpu{{}}
+		}
+
+		for start.Before(end) {
+			periodEnd := end
+			if groups[restapi.UsageGroupDay] {
+				nextDay := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, time.UTC)
+				if nextDay.Before(periodEnd) {
+					periodEnd = nextDay
+				}
+			}
+
+			hours := periodEnd.Sub(start).Hours()
+
+			for _, gpu := range gpus {
+				var key restapi.UsageEntry
+				if groups[restapi.UsageGroupPool] {
+					key.PoolId = record.PoolId
+				}
+				if groups[restapi.UsageGroupUser] {
+					key.UserId = record.UserId
+				}
+				if groups[restapi.UsageGroupGpu] {
+					key.GpuName = gpu.Name
+				}
+				if groups[restapi.UsageGroupDay] {
+					key.Day = start.Format(time.DateOnly)
+				}
+
+				entry, found := entries[key]
+				if !found {
+					entry = &restapi.UsageEntry{}
+					*entry = key
+					entries[key] = entry
+					sessions[key] = map[string]bool{}
+				}
+
+				if !sessions[key][record.SessionId] {
+					sessions[key][record.SessionId] = true
+					entry.Sessions++
+				}
+
+				if len(record.Gpus) > 0 {
+					entry.GpuHours += hours
+				}
+				entry.VramGbHours += hours * float64(gpu.VramRequired) / bytesPerGb
+			}
+
+			start = periodEnd
+		}
+	}
+
+	result := make([]restapi.UsageEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, *entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.PoolId != b.PoolId {
+			return a.PoolId < b.PoolId
+		}
+		if a.UserId != b.UserId {
+			return a.UserId < b.UserId
+		}
+		return a.GpuName < b.GpuName
+	})
+
+	return result
+}
+
+// writeUsageCsv writes the entries of the report as CSV with a column for each
+// group followed by the totals
+func writeUsageCsv(w http.ResponseWriter, report restapi.UsageReport) error {
+	w.Header().Add("Content-Type", "text/csv")
+	w.Header().Add("Content-Disposition", "attachment; filename=usage.csv")
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+
+	header := append([]string{}, report.GroupBy...)
+	header = append(header, "sessions", "gpu_hours", "vram_gb_hours")
+	err := writer.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range report.Entries {
+		row := make([]string, 0, len(header))
+		for _, group := range report.GroupBy {
+			switch group {
+			case restapi.UsageGroupPool:
+				row = append(row, entry.PoolId)
+			case restapi.UsageGroupUser:
+				row = append(row, entry.UserId)
+			case restapi.UsageGroupGpu:
+				row = append(row, entry.GpuName)
+			case restapi.UsageGroupDay:
+				row = append(row, entry.Day)
+			}
+		}
+
+		row = append(row,
+			strconv.Itoa(entry.Sessions),
+			strconv.FormatFloat(entry.GpuHours, 'f', 4, 64),
+			strconv.FormatFloat(entry.VramGbHours, 'f', 4, 64))
+
+		err = writer.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (frontend *Frontend) getUsageReport(filter storage.UsageFilter, groupBy []string) (restapi.UsageReport, error) {
+	records, err := frontend.storage.GetUsageRecords(filter)
+	if err != nil {
+		return restapi.UsageReport{}, err
+	}
+
+	return restapi.UsageReport{
+		From:    filter.From,
+		To:      filter.To,
+		GroupBy: groupBy,
+		Entries: aggregateUsage(records, filter.From, filter.To, groupBy),
+	}, nil
+}
+
+// getUsageEp reports the usage of the pools administered by the user, as CSV
+// when requested by the format parameter
+func (frontend *Frontend) getUsageEp(w http.ResponseWriter, r *http.Request) {
+	filter, groupBy, err := usageFromQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	if filter.PoolId != "" {
+		err = frontend.authorize(r, filter.PoolId, restapi.PermissionAdmin)
+	} else {
+		var pools map[string]bool
+		pools, err = frontend.authorizedPools(r, restapi.PermissionAdmin)
+		filter.PoolIds = sortedPoolIds(pools)
+	}
+
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	report, err := frontend.getUsageReport(filter, groupBy)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		err = writeUsageCsv(w, report)
+	} else {
+		err = pkgnet.Respond(w, http.StatusOK, report)
+	}
+
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// getUsageRecordsEp lists the usage records of the sessions of the pools
+// administered by the user, ordered by the time they closed
+func (frontend *Frontend) getUsageRecordsEp(w http.ResponseWriter, r *http.Request) {
+	filter, _, err := usageFromQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	if filter.PoolId != "" {
+		err = frontend.authorize(r, filter.PoolId, restapi.PermissionAdmin)
+	} else {
+		var pools map[string]bool
+		pools, err = frontend.authorizedPools(r, restapi.PermissionAdmin)
+		filter.PoolIds = sortedPoolIds(pools)
+	}
+
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	records, err := frontend.storage.GetUsageRecords(filter)
+	if err != nil {
+		err = errors.Join(err, pkgnet.RespondWithError(w, errorStatus(err), err))
+		logger.Error(err)
+		return
+	}
+
+	pkgnet.Respond(w, http.StatusOK, records)
+}
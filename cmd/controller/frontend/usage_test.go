@@ -0,0 +1,116 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+func usageRecord(id string, poolId string, assigned time.Time, closed time.Time, gpus ...string) restapi.UsageRecord {
+	record := restapi.UsageRecord{
+		SessionId:  id,
+		PoolId:     poolId,
+		UserId:     "user",
+		QueuedAt:   assigned,
+		AssignedAt: &assigned,
+		ClosedAt:   closed,
+	}
+
+	for index, name := range gpus {
+		record.Gpus = append(record.Gpus, restapi.UsageGpu{
+			SessionGpu: restapi.SessionGpu{Index: index, VramRequired: 2 * bytesPerGb},
+			Name:       name,
+		})
+	}
+
+	return record
+}
+
+func TestAggregateUsage(t *testing.T) {
+	day := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	records := []restapi.UsageRecord{
+		// Spans midnight, reserving two GPUs for 4 hours
+		usageRecord("a", "pool1", day.Add(22*time.Hour), day.Add(26*time.Hour), "A100", "A100"),
+		usageRecord("b", "pool2", day.Add(time.Hour), day.Add(2*time.Hour), "T4"),
+		// Never assigned
+		{SessionId: "c", PoolId: "pool1", QueuedAt: day, ClosedAt: day.Add(time.Hour)},
+	}
+
+	from := day
+	to := day.Add(48 * time.Hour)
+
+	entries := aggregateUsage(records, from, to, nil)
+	expected := []restapi.UsageEntry{{Sessions: 2, GpuHours: 9, VramGbHours: 18}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+
+	entries = aggregateUsage(records, from, to, []string{restapi.UsageGroupDay, restapi.UsageGroupGpu})
+	expected = []restapi.UsageEntry{
+		{GpuName: "A100", Day: "2023-06-01", Sessions: 1, GpuHours: 4, VramGbHours: 8},
+		{GpuName: "T4", Day: "2023-06-01", Sessions: 1, GpuHours: 1, VramGbHours: 2},
+		{GpuName: "A100", Day: "2023-06-02", Sessions: 1, GpuHours: 4, VramGbHours: 8},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+
+	// Clipped to the range of the report
+	entries = aggregateUsage(records, day.Add(25*time.Hour), to, []string{restapi.UsageGroupPool})
+	expected = []restapi.UsageEntry{{PoolId: "pool1", Sessions: 1, GpuHours: 2, VramGbHours: 4}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+
+	recorder := httptest.NewRecorder()
+	err := writeUsageCsv(recorder, restapi.UsageReport{
+		GroupBy: []string{restapi.UsageGroupPool},
+		Entries: entries,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csv := "pool,sessions,gpu_hours,vram_gb_hours\npool1,1,2.0000,4.0000\n"
+	if recorder.Body.String() != csv {
+		t.Errorf("expected %q, got %q", csv, recorder.Body.String())
+	}
+}
+
+func TestUsageFromQuery(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	filter, groupBy, err := usageFromQuery(url.Values{"group_by": {"pool,day"}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !filter.To.Equal(now) || !filter.From.Equal(now.Add(-defaultUsagePeriod)) {
+		t.Errorf("expected the default period ending now, got %s to %s", filter.From, filter.To)
+	}
+
+	if strings.Join(groupBy, ",") != "pool,day" {
+		t.Errorf("expected to group by pool and day, got %v", groupBy)
+	}
+
+	for _, query := range []url.Values{
+		{"group_by": {"host"}},
+		{"from": {"yesterday"}},
+		{"from": {"2023-06-02T00:00:00Z"}},
+		{"format": {"xml"}},
+	} {
+		_, _, err = usageFromQuery(query, now)
+		if err == nil || errorStatus(err) != 400 {
+			t.Errorf("expected %v to be an invalid query, got %v", query, err)
+		}
+	}
+}
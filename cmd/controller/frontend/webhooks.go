@@ -0,0 +1,375 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/events"
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+	"github.com/Juice-Labs/Juice-Labs/pkg/task"
+	"github.com/Juice-Labs/Juice-Labs/pkg/utilities"
+)
+
+var (
+	webhookSecret         = flag.String("webhook-secret", "", "The secret used to sign the messages sent to --webhook-url")
+	webhookMaxAttempts    = flag.Int("webhook-max-attempts", 8, "The number of attempts made to deliver a webhook message before it is dead-lettered")
+	webhookDeadLetterFile = flag.String("webhook-dead-letter-file", "", "Appends the webhook messages which could not be delivered to the file, logged as errors if not specified")
+)
+
+const (
+	// The number of messages queued for a webhook before further messages are dead-lettered
+	webhookQueueSize = 1024
+
+	webhookInitialBackoff  = 1 * time.Second
+	webhookMaxBackoff      = 1 * time.Minute
+	webhookTimeout         = 10 * time.Second
+	webhookRefreshInterval = 30 * time.Second
+
+	// The id of the webhook configured by --webhook-url
+	staticWebhookId = "webhook-url"
+)
+
+type deadLetter struct {
+	Webhook  string                 `json:"webhook"`
+	Url      string                 `json:"url"`
+	Attempts int                    `json:"attempts"`
+	Error    string                 `json:"error"`
+	Message  restapi.WebhookMessage `json:"message"`
+}
+
+type webhookWorker struct {
+	webhook  restapi.Webhook
+	messages chan restapi.WebhookMessage
+	cancel   context.CancelFunc
+}
+
+// webhookDispatcher delivers the events of the controller to the webhooks.
+// Each webhook has a queue of messages delivered in order by its own worker,
+// failed deliveries are retried with an exponential backoff. As with /v1/events,
+// only the events of this process are delivered.
+type webhookDispatcher struct {
+	storage storage.Storage
+	events  *events.Broker
+	client  *http.Client
+
+	maxAttempts    int
+	initialBackoff time.Duration
+	deadLetterFile string
+	deadLetterLock sync.Mutex
+
+	mutex   sync.Mutex
+	group   task.Group
+	workers map[string]*webhookWorker
+
+	// Configured by --webhook-url rather than through the API
+	staticWebhook *restapi.Webhook
+}
+
+func newWebhookDispatcher(storage storage.Storage, events *events.Broker) *webhookDispatcher {
+	dispatcher := &webhookDispatcher{
+		storage:        storage,
+		events:         events,
+		client:         &http.Client{},
+		maxAttempts:    *webhookMaxAttempts,
+		initialBackoff: webhookInitialBackoff,
+		deadLetterFile: *webhookDeadLetterFile,
+		workers:        map[string]*webhookWorker{},
+	}
+
+	if *webhook != "" {
+		// Maintains the messages sent prior to webhooks being managed through the API
+		dispatcher.staticWebhook = &restapi.Webhook{
+			Id:     staticWebhookId,
+			Url:    *webhook,
+			Secret: *webhookSecret,
+			Events: []string{restapi.EventSessionState},
+		}
+	}
+
+	return dispatcher
+}
+
+func (dispatcher *webhookDispatcher) Run(group task.Group) error {
+	dispatcher.mutex.Lock()
+	dispatcher.group = group
+	dispatcher.mutex.Unlock()
+
+	err := dispatcher.refresh()
+	if err != nil {
+		logger.Errorf("unable to retrieve webhooks, %s", err.Error())
+	}
+
+	group.GoFn("Webhook Dispatch", func(group task.Group) error {
+		subscription := dispatcher.events.Subscribe(restapi.EventFilter{})
+		defer func() {
+			subscription.Close()
+		}()
+
+		ticker := time.NewTicker(webhookRefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-group.Ctx().Done():
+				return nil
+
+			case <-ticker.C:
+				// Webhooks may have been changed by another frontend
+				err := dispatcher.refresh()
+				if err != nil {
+					logger.Errorf("unable to retrieve webhooks, %s", err.Error())
+				}
+
+			case event, ok := <-subscription.Events():
+				if !ok {
+					logger.Error("webhook dispatch fell behind, events have been lost")
+					subscription = dispatcher.events.Subscribe(restapi.EventFilter{})
+					continue
+				}
+
+				dispatcher.dispatch(event)
+			}
+		}
+	})
+
+	return nil
+}
+
+// refresh starts a worker for each webhook in storage and stops the workers of removed webhooks
+func (dispatcher *webhookDispatcher) refresh() error {
+	webhooks, err := dispatcher.storage.GetWebhooks()
+	if err != nil {
+		return err
+	}
+
+	if dispatcher.staticWebhook != nil {
+		webhooks = append(webhooks, *dispatcher.staticWebhook)
+	}
+
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+
+	if dispatcher.group == nil {
+		return nil
+	}
+
+	current := map[string]bool{}
+	for _, webhook := range webhooks {
+		current[webhook.Id] = true
+
+		if _, found := dispatcher.workers[webhook.Id]; !found {
+			dispatcher.startWorker(webhook)
+		}
+	}
+
+	for id, worker := range dispatcher.workers {
+		if !current[id] {
+			worker.cancel()
+			delete(dispatcher.workers, id)
+		}
+	}
+
+	return nil
+}
+
+func (dispatcher *webhookDispatcher) startWorker(webhook restapi.Webhook) {
+	ctx, cancel := context.WithCancel(dispatcher.group.Ctx())
+
+	worker := &webhookWorker{
+		webhook:  webhook,
+		messages: make(chan restapi.WebhookMessage, webhookQueueSize),
+		cancel:   cancel,
+	}
+
+	dispatcher.workers[webhook.Id] = worker
+
+	dispatcher.group.GoFn(fmt.Sprintf("Webhook %s", webhook.Id), func(group task.Group) error {
+		for {
+			select {
+			case <-ctx.Done():
+				// Messages still queued when the controller stops are dead-lettered,
+				// those of a removed webhook are dropped
+				if group.Ctx().Err() != nil {
+					for len(worker.messages) > 0 {
+						dispatcher.deadLetter(webhook, <-worker.messages, 0, errors.New("controller stopped"))
+					}
+				}
+
+				return nil
+
+			case message := <-worker.messages:
+				dispatcher.deliver(ctx, webhook, message)
+			}
+		}
+	})
+}
+
+func webhookMessageFromEvent(event restapi.Event) restapi.WebhookMessage {
+	return restapi.WebhookMessage{
+		Id:         uuid.NewString(),
+		Event:      event.Type,
+		Time:       event.Time,
+		Pool:       event.PoolId,
+		Agent:      event.AgentId,
+		Session:    event.SessionId,
+		State:      event.State,
+		Connection: event.Connection,
+	}
+}
+
+// dispatch queues a message for each webhook subscribed to the event, the
+// messages of the webhooks whose queue is full are dead-lettered
+func (dispatcher *webhookDispatcher) dispatch(event restapi.Event) {
+	var message *restapi.WebhookMessage
+	var full []restapi.Webhook
+
+	dispatcher.mutex.Lock()
+	for _, worker := range dispatcher.workers {
+		if !worker.webhook.Matches(event) {
+			continue
+		}
+
+		if message == nil {
+			message_ := webhookMessageFromEvent(event)
+			message = &message_
+		}
+
+		select {
+		case worker.messages <- *message:
+
+		default:
+			full = append(full, worker.webhook)
+		}
+	}
+
+	dispatcher.mutex.Unlock()
+
+	// Dead-lettering writes to disk, done without blocking the other webhooks
+	for _, webhook := range full {
+		dispatcher.deadLetter(webhook, *message, 0, errors.New("queue is full"))
+	}
+}
+
+// deliver posts the message to the webhook, retrying with a randomized exponential
+// backoff until it is accepted, it is rejected, or the maximum attempts have been made
+func (dispatcher *webhookDispatcher) deliver(ctx context.Context, webhook restapi.Webhook, message restapi.WebhookMessage) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		dispatcher.deadLetter(webhook, message, 0, err)
+		return
+	}
+
+	backoff := utilities.NewBackoff(dispatcher.initialBackoff, webhookMaxBackoff)
+	for attempt := 1; ; attempt++ {
+		retry, err := dispatcher.send(ctx, webhook, message, body)
+		if err == nil {
+			return
+		}
+
+		if !retry || attempt >= dispatcher.maxAttempts {
+			dispatcher.deadLetter(webhook, message, attempt, err)
+			return
+		}
+
+		delay := backoff.Next()
+		logger.Debugf("webhook %s failed to receive message %s, retrying in %s, %s", webhook.Id, message.Id, delay, err.Error())
+
+		select {
+		case <-ctx.Done():
+			dispatcher.deadLetter(webhook, message, attempt, errors.Join(err, ctx.Err()))
+			return
+
+		case <-time.After(delay):
+		}
+	}
+}
+
+// send makes a single attempt to deliver the message, returns whether a failed attempt should be retried
+func (dispatcher *webhookDispatcher) send(ctx context.Context, webhook restapi.Webhook, message restapi.WebhookMessage, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(restapi.WebhookMessageIdHeader, message.Id)
+	request.Header.Set(restapi.WebhookEventHeader, message.Event)
+	request.Header.Set(restapi.WebhookTimestampHeader, timestamp)
+	if webhook.Secret != "" {
+		request.Header.Set(restapi.WebhookSignatureHeader, restapi.SignWebhook(webhook.Secret, timestamp, body))
+	}
+
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := response.StatusCode == http.StatusRequestTimeout ||
+		response.StatusCode == http.StatusTooManyRequests ||
+		response.StatusCode >= 500
+
+	return retry, fmt.Errorf("webhook responded with status %d", response.StatusCode)
+}
+
+// deadLetter records a message which could not be delivered to the webhook
+func (dispatcher *webhookDispatcher) deadLetter(webhook restapi.Webhook, message restapi.WebhookMessage, attempts int, cause error) {
+	letter, err := json.Marshal(deadLetter{
+		Webhook:  webhook.Id,
+		Url:      webhook.Url,
+		Attempts: attempts,
+		Error:    cause.Error(),
+		Message:  message,
+	})
+
+	if err == nil && dispatcher.deadLetterFile != "" {
+		dispatcher.deadLetterLock.Lock()
+		defer dispatcher.deadLetterLock.Unlock()
+
+		var file *os.File
+		file, err = os.OpenFile(dispatcher.deadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = file.Write(append(letter, '\n'))
+			err = errors.Join(err, file.Close())
+		}
+
+		if err == nil {
+			logger.Errorf("webhook %s failed to receive message %s, %s", webhook.Id, message.Id, cause.Error())
+			return
+		}
+	}
+
+	if err != nil {
+		logger.Errorf("unable to write dead-letter, %s", err.Error())
+	}
+
+	logger.Errorf("webhook %s failed to receive message, %s", webhook.Id, string(letter))
+}
@@ -0,0 +1,196 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/events"
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage/memdb"
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+	"github.com/Juice-Labs/Juice-Labs/pkg/task"
+)
+
+func startDispatcher(t *testing.T, webhooks ...restapi.Webhook) (*events.Broker, *webhookDispatcher, func()) {
+	logger.Configure()
+
+	db, err := memdb.OpenStorage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, webhook := range webhooks {
+		_, err = db.CreateWebhook(webhook)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	broker := events.NewBroker()
+
+	dispatcher := newWebhookDispatcher(db, broker)
+	dispatcher.maxAttempts = 3
+	dispatcher.initialBackoff = 10 * time.Millisecond
+	dispatcher.deadLetterFile = filepath.Join(t.TempDir(), "dead-letters.jsonl")
+
+	taskManager := task.NewTaskManager(context.Background())
+	err = dispatcher.Run(taskManager)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the dispatcher to subscribe to the events
+	for !broker.HasSubscribers() {
+		time.Sleep(time.Millisecond)
+	}
+
+	return broker, dispatcher, func() {
+		taskManager.Cancel()
+		taskManager.Wait()
+		db.Close()
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	var attempts atomic.Int32
+	messages := make(chan restapi.WebhookMessage, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if !restapi.VerifyWebhook("Secret", r.Header.Get(restapi.WebhookTimestampHeader), body, r.Header.Get(restapi.WebhookSignatureHeader)) {
+			t.Error("expected a valid signature")
+		}
+
+		// Fail the first attempt to ensure it is retried
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var message restapi.WebhookMessage
+		if err := json.Unmarshal(body, &message); err != nil {
+			t.Error(err)
+		}
+
+		messages <- message
+	}))
+	defer server.Close()
+
+	broker, _, stop := startDispatcher(t, restapi.Webhook{
+		Url:    server.URL,
+		Secret: "Secret",
+		PoolId: "Pool",
+		Events: []string{restapi.EventConnectionClosed},
+	})
+	defer stop()
+
+	// Neither matches the filters of the webhook
+	broker.Publish(restapi.Event{Type: restapi.EventConnectionClosed, PoolId: "Other"})
+	broker.Publish(restapi.Event{Type: restapi.EventSessionState, PoolId: "Pool"})
+
+	broker.Publish(restapi.Event{
+		Type:      restapi.EventConnectionClosed,
+		PoolId:    "Pool",
+		AgentId:   "Agent",
+		SessionId: "Session",
+		Connection: &restapi.Connection{
+			ConnectionData: restapi.ConnectionData{Id: "Connection"},
+			ExitCode:       3,
+		},
+	})
+
+	select {
+	case message := <-messages:
+		if message.Event != restapi.EventConnectionClosed || message.Pool != "Pool" || message.Session != "Session" {
+			t.Errorf("unexpected message %+v", message)
+		}
+
+		if message.Connection == nil || message.Connection.ExitCode != 3 {
+			t.Error("expected the message to include the exit code of the connection")
+		}
+
+		if message.Time.IsZero() || message.Id == "" {
+			t.Error("expected the message to include an id and time")
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the webhook")
+	}
+
+	if attempts.Load() != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	var attempts atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	broker, dispatcher, stop := startDispatcher(t, restapi.Webhook{
+		Url: server.URL,
+	})
+	defer stop()
+
+	broker.Publish(restapi.Event{Type: restapi.EventAgentRegistered, AgentId: "Agent"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(dispatcher.deadLetterFile)
+		if err == nil && len(data) > 0 {
+			var letter deadLetter
+			err = json.Unmarshal([]byte(strings.TrimSpace(string(data))), &letter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if letter.Attempts != 3 || letter.Message.Agent != "Agent" || letter.Url != server.URL {
+				t.Errorf("unexpected dead-letter %+v", letter)
+			}
+
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the dead-letter")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if attempts.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	signature := restapi.SignWebhook("Secret", "1700000000", []byte("{}"))
+	if !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("expected a sha256 signature, got %s", signature)
+	}
+
+	if restapi.VerifyWebhook("Other", "1700000000", []byte("{}"), signature) {
+		t.Error("expected the signature to depend on the secret")
+	}
+
+	if restapi.VerifyWebhook("Secret", "1700000001", []byte("{}"), signature) {
+		t.Error("expected the signature to depend on the timestamp")
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/backend"
+	"github.com/Juice-Labs/Juice-Labs/cmd/controller/events"
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/frontend"
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/prometheus"
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
@@ -145,12 +146,15 @@ func main() {
 				*enableBackend = true
 			}
 
+			// Events are only shared between the frontend and backend when both run within this process
+			broker := events.NewBroker()
+
 			mainServer, err = server.NewServer(*address, tlsConfig)
 			if err == nil {
 				if *enableFrontend {
 					logger.Infof("Starting frontend on %s", *address)
 
-					frontend, err_ := frontend.NewFrontend(mainServer, storage)
+					frontend, err_ := frontend.NewFrontend(mainServer, storage, broker)
 					err = err_
 					if err == nil {
 						group.Go("Frontend", frontend)
@@ -162,7 +166,11 @@ func main() {
 				if *enableBackend {
 					logger.Infof("Starting backend on %s", *address)
 
-					group.Go("Backend", backend.NewBackend(storage))
+					scheduler, err_ := backend.NewBackend(storage, broker)
+					err = err_
+					if err == nil {
+						group.Go("Backend", scheduler)
+					}
 				}
 			}
 
@@ -42,7 +42,12 @@ func restAgentFromAgent(dbAgent models.Agent) (restapi.Agent, error) {
 		Labels:   make(map[string]string),
 		Taints:   make(map[string]string),
 		Sessions: []restapi.Session{},
-		PoolId:   dbAgent.PoolID.String(),
+
+		DrainState:    dbAgent.DrainState,
+		DrainDeadline: dbAgent.DrainDeadline,
+	}
+	if dbAgent.PoolID != uuid.Nil {
+		agent.PoolId = dbAgent.PoolID.String()
 	}
 
 	for _, taint := range dbAgent.Taints {
@@ -59,10 +64,16 @@ func restAgentFromAgent(dbAgent models.Agent) (restapi.Agent, error) {
 
 	for _, dbSession := range dbAgent.Sessions {
 		session := restapi.Session{
-			Id:      dbSession.UUID.String(),
-			State:   dbSession.State.String(),
-			Address: dbSession.Address,
-			Version: dbSession.Version,
+			Id:       dbSession.UUID.String(),
+			State:    dbSession.State.String(),
+			Address:  dbSession.Address,
+			Version:  dbSession.Version,
+			UserId:   dbSession.UserID,
+			Priority: dbSession.Priority,
+			Reason:   dbSession.Reason,
+		}
+		if dbSession.PoolID.Valid {
+			session.PoolId = dbSession.PoolID.UUID.String()
 		}
 
 		if err := json.Unmarshal(dbSession.GPUs, &session.Gpus); err != nil {
@@ -88,17 +99,26 @@ func restAgentFromAgent(dbAgent models.Agent) (restapi.Agent, error) {
 
 func restSessionFromSession(dbSession models.Session) (restapi.Session, error) {
 	session := restapi.Session{
-		Id:      dbSession.UUID.String(),
-		State:   dbSession.State.String(),
-		Address: dbSession.Address,
-		Version: dbSession.Version,
+		Id:       dbSession.UUID.String(),
+		State:    dbSession.State.String(),
+		Address:  dbSession.Address,
+		Version:  dbSession.Version,
+		UserId:   dbSession.UserID,
+		Priority: dbSession.Priority,
+		Reason:   dbSession.Reason,
 	}
 	if dbSession.PoolID.Valid {
 		session.PoolId = dbSession.PoolID.UUID.String()
 	}
+	if dbSession.GroupID.Valid {
+		session.GroupId = dbSession.GroupID.UUID.String()
+	}
 
-	if err := json.Unmarshal(dbSession.GPUs, &session.Gpus); err != nil {
-		return restapi.Session{}, nil
+	// Queued sessions have yet to be assigned GPUs
+	if len(dbSession.GPUs) > 0 {
+		if err := json.Unmarshal(dbSession.GPUs, &session.Gpus); err != nil {
+			return restapi.Session{}, err
+		}
 	}
 
 	for _, dbConnection := range dbSession.Connections {
@@ -114,6 +134,42 @@ func restSessionFromSession(dbSession models.Session) (restapi.Session, error) {
 	return session, nil
 }
 
+func restWebhookFromWebhook(dbWebhook models.Webhook) (restapi.Webhook, error) {
+	webhook := restapi.Webhook{
+		Id:     dbWebhook.ID.String(),
+		Url:    dbWebhook.Url,
+		Secret: dbWebhook.Secret,
+		Events: []string{},
+	}
+	if dbWebhook.PoolID.Valid {
+		webhook.PoolId = dbWebhook.PoolID.UUID.String()
+	}
+
+	if len(dbWebhook.Events) > 0 {
+		if err := json.Unmarshal(dbWebhook.Events, &webhook.Events); err != nil {
+			return restapi.Webhook{}, err
+		}
+	}
+
+	return webhook, nil
+}
+
+func restReservationFromReservation(dbReservation models.Reservation) (restapi.Reservation, error) {
+	reservation := restapi.Reservation{
+		Id:     dbReservation.ID.String(),
+		PoolId: dbReservation.PoolID.String(),
+		UserId: dbReservation.UserID,
+		Start:  dbReservation.StartAt,
+		End:    dbReservation.EndAt,
+	}
+
+	if err := json.Unmarshal(dbReservation.Gpus, &reservation.Gpus); err != nil {
+		return restapi.Reservation{}, err
+	}
+
+	return reservation, nil
+}
+
 func restPoolFromPool(dbPool models.Pool) restapi.Pool {
 	pool := restapi.Pool{
 		Id:   dbPool.ID.String(),
@@ -180,6 +236,12 @@ func OpenStorage(ctx context.Context, driver string, dsn string) (storage.Storag
 		&models.Agent{},
 		&models.Permission{},
 		&models.Pool{},
+		&models.Quota{},
+		&models.Webhook{},
+		&models.Usage{},
+		&models.SessionDefaults{},
+		&models.SessionGroup{},
+		&models.Reservation{},
 	)
 
 	if err != nil {
@@ -195,8 +257,149 @@ func (g *gormDriver) Close() error {
 	return nil
 }
 
+// Flattens the GPUs of every active agent into rows of (name, vram, vram_used, utilization, power_draw).
+// The JSON functions differ between the dialects so the subquery is selected based on the dialect in use.
+func (g *gormDriver) selectActiveGpus() string {
+	switch g.db.Dialector.Name() {
+	case "postgres":
+		return `SELECT gpu->>'name' AS name,
+				COALESCE((gpu->>'vram')::bigint, 0) AS vram,
+				COALESCE((gpu->'metrics'->>'vramUsed')::bigint, 0) AS vram_used,
+				COALESCE((gpu->'metrics'->>'utilizationGpu')::bigint, 0) AS utilization,
+				COALESCE((gpu->'metrics'->>'powerDraw')::bigint, 0) AS power_draw
+			FROM agents, jsonb_array_elements(agents.gpus) AS gpu
+			WHERE agents.state = @agentState AND agents.deleted_at IS NULL`
+	default:
+		return `SELECT json_extract(gpu.value, '$.name') AS name,
+				COALESCE(json_extract(gpu.value, '$.vram'), 0) AS vram,
+				COALESCE(json_extract(gpu.value, '$.metrics.vramUsed'), 0) AS vram_used,
+				COALESCE(json_extract(gpu.value, '$.metrics.utilizationGpu'), 0) AS utilization,
+				COALESCE(json_extract(gpu.value, '$.metrics.powerDraw'), 0) AS power_draw
+			FROM agents, json_each(agents.gpus) AS gpu
+			WHERE agents.state = @agentState AND agents.deleted_at IS NULL`
+	}
+}
+
+type stateCountRow struct {
+	State int
+	Count int
+}
+
+type gpuAggregateRow struct {
+	Name        string
+	Gpus        int
+	Vram        uint64
+	VramUsed    uint64
+	Utilization uint64
+	PowerDraw   uint64
+}
+
+type vramAvailableRow struct {
+	Name  string
+	Gb    int
+	Count int
+}
+
 func (g *gormDriver) AggregateData() (storage.AggregatedData, error) {
-	panic("not implemented") // TODO: Implement
+	data := storage.AggregatedData{
+		AgentsByStatus:           map[string]int{},
+		SessionsByStatus:         map[string]int{},
+		GpusByGpuName:            map[string]int{},
+		VramByGpuName:            map[string]uint64{},
+		VramUsedByGpuName:        map[string]uint64{},
+		VramGBAvailableByGpuName: map[string]storage.Percentile[int]{},
+		UtilizationByGpuName:     map[string]float64{},
+		PowerDrawByGpuName:       map[string]float64{},
+	}
+
+	var agentRows []stateCountRow
+	result := g.db.Model(&models.Agent{}).Select("state, COUNT(*) AS count").Group("state").Scan(&agentRows)
+	if result.Error != nil {
+		return storage.AggregatedData{}, mapError(result.Error)
+	}
+
+	for _, row := range agentRows {
+		data.Agents += row.Count
+		data.AgentsByStatus[models.AgentState(row.State).String()] += row.Count
+	}
+
+	var sessionRows []stateCountRow
+	result = g.db.Model(&models.Session{}).Select("state, COUNT(*) AS count").Group("state").Scan(&sessionRows)
+	if result.Error != nil {
+		return storage.AggregatedData{}, mapError(result.Error)
+	}
+
+	for _, row := range sessionRows {
+		data.Sessions += row.Count
+		data.SessionsByStatus[models.SessionState(row.State).String()] += row.Count
+	}
+
+	gpus := g.selectActiveGpus()
+	agentState := sql.Named("agentState", models.AgentStateActive)
+
+	var gpuRows []gpuAggregateRow
+	result = g.db.Raw(`SELECT name, COUNT(*) AS gpus,
+			CAST(SUM(vram) AS BIGINT) AS vram,
+			CAST(SUM(vram_used) AS BIGINT) AS vram_used,
+			CAST(SUM(utilization) AS BIGINT) AS utilization,
+			CAST(SUM(power_draw) AS BIGINT) AS power_draw
+		FROM (`+gpus+`) AS gpus
+		GROUP BY name`, agentState).Scan(&gpuRows)
+	if result.Error != nil {
+		return storage.AggregatedData{}, mapError(result.Error)
+	}
+
+	var utilization uint64
+	var powerDraw uint64
+
+	for _, row := range gpuRows {
+		data.Gpus += row.Gpus
+		data.GpusByGpuName[row.Name] = row.Gpus
+		data.Vram += row.Vram
+		data.VramByGpuName[row.Name] = row.Vram
+		data.VramUsed += row.VramUsed
+		data.VramUsedByGpuName[row.Name] = row.VramUsed
+
+		utilization += row.Utilization
+		powerDraw += row.PowerDraw
+		data.PowerDrawByGpuName[row.Name] = float64(row.PowerDraw) / 1000.0
+	}
+
+	data.PowerDraw = float64(powerDraw) / 1000.0
+
+	if data.Gpus > 0 {
+		data.Utilization = float64(utilization) / float64(data.Gpus)
+		for _, row := range gpuRows {
+			data.UtilizationByGpuName[row.Name] = float64(row.Utilization) / float64(data.Gpus)
+		}
+
+		var vramRows []vramAvailableRow
+		result = g.db.Raw(`SELECT name, (vram - vram_used) / 1073741824 AS gb, COUNT(*) AS count
+			FROM (`+gpus+`) AS gpus
+			GROUP BY name, (vram - vram_used) / 1073741824`, agentState).Scan(&vramRows)
+		if result.Error != nil {
+			return storage.AggregatedData{}, mapError(result.Error)
+		}
+
+		vramGBAvailable := map[int]int{}
+		vramGBAvailableByGpuName := map[string]map[int]int{}
+		for _, row := range vramRows {
+			vramGBAvailable[row.Gb] += row.Count
+
+			if _, ok := vramGBAvailableByGpuName[row.Name]; !ok {
+				vramGBAvailableByGpuName[row.Name] = map[int]int{}
+			}
+
+			vramGBAvailableByGpuName[row.Name][row.Gb] += row.Count
+		}
+
+		data.VramGBAvailable = storage.CalculatePercentiles(vramGBAvailable, data.Gpus)
+		for key, gbAvailable := range vramGBAvailableByGpuName {
+			data.VramGBAvailableByGpuName[key] = storage.CalculatePercentiles(gbAvailable, data.GpusByGpuName[key])
+		}
+	}
+
+	return data, nil
 }
 
 func (g *gormDriver) RegisterAgent(agent restapi.Agent) (string, error) {
@@ -225,6 +428,7 @@ func (g *gormDriver) RegisterAgent(agent restapi.Agent) (string, error) {
 		Gpus:          gpus,
 		VramAvailable: storage.TotalVram(agent.Gpus),
 		PoolID:        uuid.FromStringOrNil(agent.PoolId),
+		DrainState:    restapi.AgentSchedulable,
 
 		Labels: labels,
 		Taints: taints,
@@ -297,6 +501,7 @@ func (g *gormDriver) UpdateAgent(update restapi.AgentUpdate) error {
 			}
 
 			state := models.SessionStateFromString(sessionUpdate.State)
+			closing := state == models.SessionStateClosed && dbSession.State != models.SessionStateClosed
 			if state != dbSession.State {
 				if dbSession.State == models.SessionStateClosed {
 					dbAgent.VramAvailable += dbSession.VramRequired
@@ -304,6 +509,11 @@ func (g *gormDriver) UpdateAgent(update restapi.AgentUpdate) error {
 				dbSession.State = state
 			}
 
+			if state == models.SessionStateActive && dbSession.ActiveAt == nil {
+				now := time.Now()
+				dbSession.ActiveAt = &now
+			}
+
 			for _, connectionUpdate := range sessionUpdate.Connections {
 				var dbConnection models.Connection
 				tx.Where(models.Connection{UUID: uuid.FromStringOrNil(connectionUpdate.Id)}).
@@ -319,9 +529,27 @@ func (g *gormDriver) UpdateAgent(update restapi.AgentUpdate) error {
 			}
 
 			tx.Updates(dbSession)
+
+			// Cleared once the session has active connections, which Updates skips
+			tx.Model(&dbSession).Update("idle_since", sessionUpdate.IdleSince)
+
+			if closing {
+				err = recordUsage(tx, dbSession, dbAgent.UUID.String(), gpus, time.Now())
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if dbAgent.State == models.AgentStateClosed {
+			err = recordUsageOfAgents(tx, []models.Agent{dbAgent}, time.Now())
+			if err != nil {
+				return err
+			}
 		}
 
-		tx.Updates(dbAgent)
+		// The drain state is only changed through SetAgentDrainState
+		tx.Omit("DrainState", "DrainDeadline").Updates(dbAgent)
 
 		return nil
 	})
@@ -329,47 +557,97 @@ func (g *gormDriver) UpdateAgent(update restapi.AgentUpdate) error {
 	return mapError(err)
 }
 
-func (g *gormDriver) RequestSession(sessionRequirements restapi.SessionRequirements) (string, error) {
+func (g *gormDriver) SetAgentDrainState(id string, drainState string, deadline *time.Time) error {
+	result := g.db.Model(&models.Agent{}).
+		Where("uuid = ?", uuid.FromStringOrNil(id)).
+		Updates(map[string]interface{}{
+			"drain_state":    drainState,
+			"drain_deadline": deadline,
+		})
+	if result.Error != nil {
+		return mapError(result.Error)
+	}
 
-	var dbSession *models.Session
-	err := g.db.Transaction(func(tx *gorm.DB) error {
-		requirements, err := json.Marshal(sessionRequirements)
+	if result.RowsAffected == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (g *gormDriver) SetAgentTaints(id string, taints map[string]string) error {
+	keyValues := []models.KeyValue{}
+	for k, v := range taints {
+		keyValues = append(keyValues, models.KeyValue{Key: k, Value: v})
+	}
+
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		var dbAgent models.Agent
+		err := tx.Where("uuid = ?", uuid.FromStringOrNil(id)).First(&dbAgent).Error
 		if err != nil {
-			return err
+			return mapError(err)
 		}
 
-		labels := []models.KeyValue{}
-		for k, v := range sessionRequirements.MatchLabels {
-			labels = append(labels, models.KeyValue{Key: k, Value: v})
-		}
+		return tx.Model(&dbAgent).Association("Taints").Replace(keyValues)
+	})
+}
 
-		tolerates := []models.KeyValue{}
-		for k, v := range sessionRequirements.Tolerates {
-			tolerates = append(tolerates, models.KeyValue{Key: k, Value: v})
-		}
+// newQueuedSession returns a queued session with the requirements, groupId is
+// invalid unless the session is a member of a group
+func newQueuedSession(sessionRequirements restapi.SessionRequirements, userId string, groupId uuid.NullUUID) (*models.Session, error) {
+	requirements, err := json.Marshal(sessionRequirements)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := []models.KeyValue{}
+	for k, v := range sessionRequirements.MatchLabels {
+		labels = append(labels, models.KeyValue{Key: k, Value: v})
+	}
+
+	tolerates := []models.KeyValue{}
+	for k, v := range sessionRequirements.Tolerates {
+		tolerates = append(tolerates, models.KeyValue{Key: k, Value: v})
+	}
 
-		dbSession = &models.Session{
-			UUID:         uuid.NewV4(),
-			Agent:        nil,
-			Version:      sessionRequirements.Version,
-			State:        models.SessionStateQueued,
-			Requirements: requirements,
-			VramRequired: storage.TotalVramRequired(sessionRequirements),
+	dbSession := &models.Session{
+		UUID:         uuid.NewV4(),
+		Agent:        nil,
+		Version:      sessionRequirements.Version,
+		State:        models.SessionStateQueued,
+		UserID:       userId,
+		Priority:     sessionRequirements.Priority,
+		Requirements: requirements,
+		VramRequired: storage.TotalVramRequired(sessionRequirements),
+		GroupID:      groupId,
+
+		Labels:    labels,
+		Tolerates: tolerates,
+	}
 
-			Labels:    labels,
-			Tolerates: tolerates,
+	if sessionRequirements.PoolId != "" {
+		dbSession.PoolID = uuid.NullUUID{
+			UUID:  uuid.FromStringOrNil(sessionRequirements.PoolId),
+			Valid: true,
 		}
+	} else {
+		dbSession.PoolID = uuid.NullUUID{
+			UUID:  uuid.Nil,
+			Valid: false,
+		}
+	}
 
-		if sessionRequirements.PoolId != "" {
-			dbSession.PoolID = uuid.NullUUID{
-				UUID:  uuid.FromStringOrNil(sessionRequirements.PoolId),
-				Valid: true,
-			}
-		} else {
-			dbSession.PoolID = uuid.NullUUID{
-				UUID:  uuid.Nil,
-				Valid: false,
-			}
+	return dbSession, nil
+}
+
+func (g *gormDriver) RequestSession(sessionRequirements restapi.SessionRequirements, userId string) (string, error) {
+
+	var dbSession *models.Session
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		dbSession, err = newQueuedSession(sessionRequirements, userId, uuid.NullUUID{})
+		if err != nil {
+			return err
 		}
 
 		tx.Create(dbSession)
@@ -384,41 +662,150 @@ func (g *gormDriver) RequestSession(sessionRequirements restapi.SessionRequireme
 	return "", mapError(err)
 }
 
-func (g *gormDriver) AssignSession(sessionId string, agentId string, gpus []restapi.SessionGpu) error {
-	err := g.db.Transaction(func(tx *gorm.DB) error {
+func (g *gormDriver) RequestSessionGroup(requirements restapi.SessionGroupRequirements, userId string) (string, error) {
+	dbGroup := models.SessionGroup{
+		UUID:      uuid.NewV4(),
+		UserID:    userId,
+		SameLabel: requirements.Topology.SameLabel,
+	}
 
-		gpusData, err := json.Marshal(gpus)
-		if err != nil {
-			return err
+	if requirements.Session.PoolId != "" {
+		dbGroup.PoolID = uuid.NullUUID{
+			UUID:  uuid.FromStringOrNil(requirements.Session.PoolId),
+			Valid: true,
 		}
+	}
 
-		dbAgent := models.Agent{
-			UUID: uuid.FromStringOrNil(agentId),
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Create(&dbGroup)
+		if result.Error != nil {
+			return result.Error
 		}
 
-		dbSession := models.Session{
-			UUID: uuid.FromStringOrNil(sessionId),
-		}
+		for member := 0; member < requirements.Members; member++ {
+			dbSession, err := newQueuedSession(requirements.Session, userId, uuid.NullUUID{UUID: dbGroup.UUID, Valid: true})
+			if err != nil {
+				return err
+			}
 
-		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&dbAgent, "UUID").First(&dbAgent)
-		if result.Error != nil {
-			return result.Error
+			result = tx.Create(dbSession)
+			if result.Error != nil {
+				return result.Error
+			}
 		}
 
-		result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&dbSession, "UUID").First(&dbSession)
-		if result.Error != nil {
-			return result.Error
+		return nil
+	})
+	if err != nil {
+		return "", mapError(err)
+	}
+
+	return dbGroup.UUID.String(), nil
+}
+
+func (g *gormDriver) GetSessionGroup(id string) (restapi.SessionGroup, error) {
+	dbGroup := models.SessionGroup{
+		UUID: uuid.FromStringOrNil(id),
+	}
+
+	result := g.db.Where(&dbGroup, "UUID").First(&dbGroup)
+	if result.Error != nil {
+		return restapi.SessionGroup{}, mapError(result.Error)
+	}
+
+	var dbSessions []models.Session
+	result = g.db.Preload("Connections").
+		Where("group_id = ?", dbGroup.UUID).
+		Order("uuid ASC").
+		Find(&dbSessions)
+	if result.Error != nil {
+		return restapi.SessionGroup{}, mapError(result.Error)
+	}
+
+	group := restapi.SessionGroup{
+		Id:     dbGroup.UUID.String(),
+		UserId: dbGroup.UserID,
+		Topology: restapi.GroupTopology{
+			SameLabel: dbGroup.SameLabel,
+		},
+		Sessions: make([]restapi.Session, 0, len(dbSessions)),
+	}
+	if dbGroup.PoolID.Valid {
+		group.PoolId = dbGroup.PoolID.UUID.String()
+	}
+
+	for _, dbSession := range dbSessions {
+		session, err := restSessionFromSession(dbSession)
+		if err != nil {
+			return restapi.SessionGroup{}, err
 		}
 
-		dbSession.GPUs = gpusData
-		dbSession.Agent = &dbAgent
-		// TODO why?
-		dbSession.Address = dbAgent.Address
-		dbSession.State = models.SessionStateAssigned
-		dbAgent.VramAvailable -= dbSession.VramRequired
+		group.Sessions = append(group.Sessions, session)
+	}
 
-		tx.Updates(&dbSession)
-		tx.Updates(&dbAgent)
+	group.State = storage.SessionGroupState(group.Sessions)
+	return group, nil
+}
+
+// assignSession assigns the session to the agent within the transaction
+func assignSession(tx *gorm.DB, assignment storage.SessionAssignment) error {
+	gpusData, err := json.Marshal(assignment.Gpus)
+	if err != nil {
+		return err
+	}
+
+	dbAgent := models.Agent{
+		UUID: uuid.FromStringOrNil(assignment.AgentId),
+	}
+
+	dbSession := models.Session{
+		UUID: uuid.FromStringOrNil(assignment.SessionId),
+	}
+
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&dbAgent, "UUID").First(&dbAgent)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&dbSession, "UUID").First(&dbSession)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	dbSession.GPUs = gpusData
+	dbSession.Agent = &dbAgent
+	// TODO why?
+	dbSession.Address = dbAgent.Address
+	dbSession.State = models.SessionStateAssigned
+	dbAgent.VramAvailable -= dbSession.VramRequired
+
+	now := time.Now()
+	dbSession.AssignedAt = &now
+
+	tx.Updates(&dbSession)
+	// Updates skips zero values so the reason must be cleared explicitly
+	tx.Model(&dbSession).Update("reason", "")
+	tx.Updates(&dbAgent)
+
+	return nil
+}
+
+func (g *gormDriver) AssignSession(sessionId string, agentId string, gpus []restapi.SessionGpu) error {
+	return g.AssignSessions([]storage.SessionAssignment{{
+		SessionId: sessionId,
+		AgentId:   agentId,
+		Gpus:      gpus,
+	}})
+}
+
+func (g *gormDriver) AssignSessions(assignments []storage.SessionAssignment) error {
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		for _, assignment := range assignments {
+			err := assignSession(tx, assignment)
+			if err != nil {
+				return err
+			}
+		}
 
 		return nil
 	})
@@ -445,12 +832,108 @@ func (g *gormDriver) CancelSession(sessionId string) error {
 
 		tx.Updates(&dbSession)
 
+		// Sessions which were not assigned are closed immediately
+		if dbSession.State == models.SessionStateClosed {
+			return recordUsage(tx, dbSession, "", nil, time.Now())
+		}
+
 		return nil
 	})
 
 	return mapError(err)
 }
 
+func (g *gormDriver) SetSessionReason(sessionId string, reason string) error {
+	result := g.db.Model(&models.Session{}).
+		Where("uuid = ?", uuid.FromStringOrNil(sessionId)).
+		Update("reason", reason)
+	if result.Error != nil {
+		return mapError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (g *gormDriver) SetSessionPlacement(placement restapi.SessionPlacement) error {
+	data, err := json.Marshal(placement)
+	if err != nil {
+		return err
+	}
+
+	result := g.db.Model(&models.Session{}).
+		Where("uuid = ?", uuid.FromStringOrNil(placement.SessionId)).
+		Update("placement", data)
+	if result.Error != nil {
+		return mapError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (g *gormDriver) GetSessionPlacement(sessionId string) (restapi.SessionPlacement, error) {
+	var session models.Session
+	result := g.db.Select("placement").
+		Where("uuid = ?", uuid.FromStringOrNil(sessionId)).
+		First(&session)
+	if result.Error != nil {
+		return restapi.SessionPlacement{}, mapError(result.Error)
+	}
+
+	if len(session.Placement) == 0 {
+		return restapi.SessionPlacement{}, storage.ErrNotFound
+	}
+
+	var placement restapi.SessionPlacement
+	err := json.Unmarshal(session.Placement, &placement)
+	return placement, err
+}
+
+func (g *gormDriver) RenewSessionLease(id string, expires time.Time) error {
+	result := g.db.Model(&models.Session{}).
+		Where("uuid = ?", uuid.FromStringOrNil(id)).
+		Update("lease_expires_at", expires)
+	if result.Error != nil {
+		return mapError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (g *gormDriver) GetSessionsWithExpiredLease(now time.Time) ([]restapi.Session, error) {
+	var dbSessions []models.Session
+	result := g.db.Preload("Agent").
+		Where("state IN ?", []models.SessionState{models.SessionStateQueued, models.SessionStateAssigned, models.SessionStateActive}).
+		Where("lease_expires_at < ?", now).
+		Find(&dbSessions)
+	if result.Error != nil {
+		return nil, mapError(result.Error)
+	}
+
+	sessions := make([]restapi.Session, 0, len(dbSessions))
+	for _, dbSession := range dbSessions {
+		session, err := restSessionFromSession(dbSession)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
 func (g *gormDriver) GetSessionById(id string) (restapi.Session, error) {
 	dbSession := models.Session{
 		UUID: uuid.FromStringOrNil(id),
@@ -476,7 +959,12 @@ func (g *gormDriver) GetQueuedSessionById(id string) (storage.QueuedSession, err
 	}
 
 	queuedSession := storage.QueuedSession{
-		Id: dbSession.UUID.String(),
+		Id:     dbSession.UUID.String(),
+		UserId: dbSession.UserID,
+		Reason: dbSession.Reason,
+	}
+	if dbSession.GroupID.Valid {
+		queuedSession.GroupId = dbSession.GroupID.UUID.String()
 	}
 
 	err := json.Unmarshal(dbSession.Requirements, &queuedSession.Requirements)
@@ -487,111 +975,494 @@ func (g *gormDriver) GetQueuedSessionById(id string) (storage.QueuedSession, err
 	return queuedSession, nil
 }
 
-func (g *gormDriver) GetAgents(poolId string) (storage.Iterator[restapi.Agent], error) {
-	// TODO pagination should be passed in through storage interface
-	var dbAgents []models.Agent
-	query := g.db.Model(&models.Agent{}).
-		Preload("Labels").Preload("Taints").
-		Where("state = ?", models.AgentStateActive).
-		Limit(20)
+// queryIterator retrieves the results of a query a page at a time, the query
+// must be ordered for the pages to be consistent
+type queryIterator[M any, T any] struct {
+	query   func() *gorm.DB
+	convert func(M) (T, error)
+
+	offset   int
+	iterator *storage.DefaultIterator[T]
+}
 
-	if poolId != "" {
-		query = query.Where("pool_id = ?", poolId)
+func newQueryIterator[M any, T any](query func() *gorm.DB, convert func(M) (T, error)) (storage.Iterator[T], error) {
+	iterator := &queryIterator[M, T]{
+		query:   query,
+		convert: convert,
 	}
 
-	result := query.Find(&dbAgents)
+	objects, err := iterator.retrieve()
+	if err != nil {
+		return nil, err
+	}
+
+	iterator.iterator = storage.NewDefaultIterator[T](objects)
+	return iterator, nil
+}
 
+func (iterator *queryIterator[M, T]) retrieve() ([]T, error) {
+	var dbObjects []M
+	result := iterator.query().
+		Offset(iterator.offset).
+		Limit(storage.DefaultPageLimit).
+		Find(&dbObjects)
 	if result.Error != nil {
 		return nil, mapError(result.Error)
 	}
 
-	agents := []restapi.Agent{}
-	for _, dbAgent := range dbAgents {
-		agent, err := restAgentFromAgent(dbAgent)
+	iterator.offset += len(dbObjects)
 
+	objects := make([]T, 0, len(dbObjects))
+	for _, dbObject := range dbObjects {
+		object, err := iterator.convert(dbObject)
 		if err != nil {
 			logger.Warning(err)
 		} else {
-			agents = append(agents, agent)
+			objects = append(objects, object)
 		}
 	}
 
-	return storage.NewDefaultIterator[restapi.Agent](agents), nil
+	return objects, nil
 }
 
-func (g *gormDriver) GetAvailableAgentsMatching(totalAvailableVramAtLeast uint64) (storage.Iterator[restapi.Agent], error) {
-	// TODO pagination should be passed in through storage interface
+func (iterator *queryIterator[M, T]) Next() bool {
+	for !iterator.iterator.Next() {
+		objects, err := iterator.retrieve()
+		if err != nil {
+			logger.Debugf("unable to retrieve rows, %s", err.Error())
+			return false
+		}
+
+		if len(objects) == 0 {
+			return false
+		}
+
+		iterator.iterator = storage.NewDefaultIterator[T](objects)
+	}
+
+	return true
+}
+
+func (iterator *queryIterator[M, T]) Value() T {
+	return iterator.iterator.Value()
+}
+
+func (g *gormDriver) ListAgents(filter storage.AgentFilter, page storage.Page) ([]restapi.Agent, string, error) {
+	size := page.Size()
+
+	// One more agent than the page holds is retrieved to determine whether another page follows
+	query := g.db.Model(&models.Agent{}).
+		Preload("Labels").Preload("Taints").Preload("Sessions", "state NOT IN (?)", models.SessionStateClosed).
+		Order("uuid ASC").
+		Limit(size + 1)
+
+	if filter.State != "" {
+		query = query.Where("state = ?", models.AgentStateFromString(filter.State))
+	}
+
+	if filter.PoolId != "" {
+		query = query.Where("pool_id = ?", uuid.FromStringOrNil(filter.PoolId))
+	}
+
+	if filter.PoolIds != nil {
+		poolIds := make([]uuid.UUID, 0, len(filter.PoolIds))
+		for _, poolId := range filter.PoolIds {
+			poolIds = append(poolIds, uuid.FromStringOrNil(poolId))
+		}
+
+		query = query.Where("pool_id IN ?", poolIds)
+	}
+
+	for key, value := range filter.Selector {
+		query = query.Where(`EXISTS (
+			SELECT 1 FROM agent_labels JOIN key_values ON key_values.id = agent_labels.key_value_id
+			WHERE agent_labels.agent_id = agents.id AND key_values.key = ? AND key_values.value = ?)`, key, value)
+	}
+
+	if filter.GpuName != "" {
+		switch g.db.Dialector.Name() {
+		case "sqlite":
+			query = query.Where("EXISTS (SELECT 1 FROM json_each(agents.gpus) WHERE json_extract(json_each.value, '$.name') = ?)", filter.GpuName)
+		default:
+			gpus, err := json.Marshal([]map[string]string{{"name": filter.GpuName}})
+			if err != nil {
+				return nil, "", err
+			}
+
+			query = query.Where("gpus @> ?::jsonb", string(gpus))
+		}
+	}
+
+	if filter.MinVramAvailable > 0 {
+		query = query.Where("vram_available >= ?", filter.MinVramAvailable)
+	}
+
+	if page.Cursor != "" {
+		query = query.Where("uuid > ?", uuid.FromStringOrNil(page.Cursor))
+	}
+
+	var dbAgents []models.Agent
+	result := query.Find(&dbAgents)
+	if result.Error != nil {
+		return nil, "", mapError(result.Error)
+	}
+
+	next := ""
+	if len(dbAgents) > size {
+		dbAgents = dbAgents[:size]
+		next = dbAgents[size-1].UUID.String()
+	}
+
+	agents := make([]restapi.Agent, 0, len(dbAgents))
+	for _, dbAgent := range dbAgents {
+		agent, err := restAgentFromAgent(dbAgent)
+		if err != nil {
+			return nil, "", err
+		}
+
+		agents = append(agents, agent)
+	}
+
+	return agents, next, nil
+}
+
+func (g *gormDriver) ListSessions(filter storage.SessionFilter, page storage.Page) ([]restapi.ListedSession, string, error) {
+	size := page.Size()
+
+	// One more session than the page holds is retrieved to determine whether another page follows
+	query := g.db.Model(&models.Session{}).
+		Preload("Agent").
+		Order("uuid ASC").
+		Limit(size + 1)
+
+	if filter.State != "" {
+		query = query.Where("state = ?", models.SessionStateFromString(filter.State))
+	}
+
+	if filter.PoolId != "" {
+		query = query.Where("pool_id = ?", uuid.FromStringOrNil(filter.PoolId))
+	}
+
+	if filter.AgentId != "" {
+		query = query.Where("agent_id IN (SELECT id FROM agents WHERE uuid = ?)", uuid.FromStringOrNil(filter.AgentId))
+	}
+
+	if filter.Version != "" {
+		query = query.Where("version = ?", filter.Version)
+	}
+
+	if filter.PoolIds != nil {
+		poolIds := make([]uuid.UUID, 0, len(filter.PoolIds))
+		for _, poolId := range filter.PoolIds {
+			poolIds = append(poolIds, uuid.FromStringOrNil(poolId))
+		}
+
+		query = query.Where("pool_id IN ?", poolIds)
+	}
+
+	if !filter.CreatedAfter.IsZero() {
+		query = query.Where("created_at >= ?", filter.CreatedAfter)
+	}
+
+	if !filter.CreatedBefore.IsZero() {
+		query = query.Where("created_at < ?", filter.CreatedBefore)
+	}
+
+	if page.Cursor != "" {
+		query = query.Where("uuid > ?", uuid.FromStringOrNil(page.Cursor))
+	}
+
+	var dbSessions []models.Session
+	result := query.Find(&dbSessions)
+	if result.Error != nil {
+		return nil, "", mapError(result.Error)
+	}
+
+	next := ""
+	if len(dbSessions) > size {
+		dbSessions = dbSessions[:size]
+		next = dbSessions[size-1].UUID.String()
+	}
+
+	sessions := make([]restapi.ListedSession, 0, len(dbSessions))
+	for _, dbSession := range dbSessions {
+		session, err := restSessionFromSession(dbSession)
+		if err != nil {
+			return nil, "", err
+		}
+
+		listedSession := restapi.ListedSession{
+			Session: session,
+			Created: dbSession.CreatedAt,
+		}
+
+		if dbSession.Agent != nil {
+			listedSession.AgentId = dbSession.Agent.UUID.String()
+		}
+
+		sessions = append(sessions, listedSession)
+	}
+
+	return sessions, next, nil
+}
+
+func (g *gormDriver) GetAvailableAgentsMatching(totalAvailableVramAtLeast uint64) (storage.Iterator[restapi.Agent], error) {
+	return newQueryIterator(func() *gorm.DB {
+		return g.db.Model(&models.Agent{}).
+			Preload("Labels").Preload("Taints").
+			Where("state = ?", models.AgentStateActive).
+			Where("vram_available >= ?", totalAvailableVramAtLeast).
+			Order("id ASC")
+	}, restAgentFromAgent)
+}
+
+func (g *gormDriver) GetDrainingAgents() ([]restapi.Agent, error) {
 	var dbAgents []models.Agent
 	result := g.db.Model(&models.Agent{}).
-		Preload("Labels").Preload("Taints").
+		Preload("Labels").Preload("Taints").Preload("Sessions", "state NOT IN (?)", models.SessionStateClosed).
 		Where("state = ?", models.AgentStateActive).
-		Where("vram_available >= ?", totalAvailableVramAtLeast).
-		Limit(20).
+		Where("drain_state = ?", restapi.AgentDraining).
 		Find(&dbAgents)
-
 	if result.Error != nil {
 		return nil, mapError(result.Error)
 	}
 
-	agents := []restapi.Agent{}
+	agents := make([]restapi.Agent, 0, len(dbAgents))
 	for _, dbAgent := range dbAgents {
 		agent, err := restAgentFromAgent(dbAgent)
 		if err != nil {
-			logger.Warning(err)
+			return nil, err
+		}
+
+		agents = append(agents, agent)
+	}
+
+	return agents, nil
+}
+
+func (g *gormDriver) GetQueuedSessionsIterator() (storage.Iterator[storage.QueuedSession], error) {
+	return newQueryIterator(func() *gorm.DB {
+		return g.db.Model(&models.Session{}).
+			Where("state = ?", models.SessionStateQueued).
+			Order("priority DESC").
+			Order("id ASC")
+	}, func(dbSession models.Session) (storage.QueuedSession, error) {
+		queuedSession := storage.QueuedSession{
+			Id:     dbSession.UUID.String(),
+			UserId: dbSession.UserID,
+			Reason: dbSession.Reason,
+		}
+		if dbSession.GroupID.Valid {
+			queuedSession.GroupId = dbSession.GroupID.UUID.String()
+		}
+
+		err := json.Unmarshal(dbSession.Requirements, &queuedSession.Requirements)
+		return queuedSession, err
+	})
+}
+
+// Moves the agents in a state which have not been updated for the duration to
+// another state, removing them if requested. Returns the agents which were moved.
+func (g *gormDriver) moveAgentsNotUpdatedFor(duration time.Duration, from models.AgentState, to models.AgentState, remove bool) ([]restapi.Agent, error) {
+	agents := make([]restapi.Agent, 0)
+
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		var dbAgents []models.Agent
+		result := tx.
+			Where("state = ?", from).
+			Where("updated_at <= ?", time.Now().Add(-duration)).
+			Find(&dbAgents)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if len(dbAgents) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(dbAgents))
+		for index, dbAgent := range dbAgents {
+			ids[index] = dbAgent.ID
+		}
+
+		if remove {
+			err := recordUsageOfAgents(tx, dbAgents, time.Now())
+			if err != nil {
+				return err
+			}
+
+			// Soft-deletes agent
+			result = tx.Delete(&models.Agent{}, ids)
 		} else {
+			result = tx.Model(&models.Agent{}).Where("id IN ?", ids).Updates(models.Agent{State: to})
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for _, dbAgent := range dbAgents {
+			dbAgent.State = to
+
+			agent, err := restAgentFromAgent(dbAgent)
+			if err != nil {
+				return err
+			}
+
 			agents = append(agents, agent)
 		}
+
+		return nil
+	})
+
+	return agents, mapError(err)
+}
+
+// recordUsage adds the usage record of the session closing at the time, unless
+// the session has already been recorded
+func recordUsage(tx *gorm.DB, dbSession models.Session, agentId string, agentGpus []restapi.Gpu, closed time.Time) error {
+	result := tx.Where("session_id = ?", dbSession.ID).Find(&dbSession.Connections)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	session, err := restSessionFromSession(dbSession)
+	if err != nil {
+		return err
+	}
+
+	record := storage.NewUsageRecord(session, agentId, agentGpus, dbSession.CreatedAt, dbSession.AssignedAt, dbSession.ActiveAt, closed)
+
+	gpus, err := json.Marshal(record.Gpus)
+	if err != nil {
+		return err
+	}
+
+	connections, err := json.Marshal(record.Connections)
+	if err != nil {
+		return err
+	}
+
+	usage := models.Usage{
+		SessionID:   dbSession.UUID,
+		PoolID:      dbSession.PoolID,
+		UserID:      record.UserId,
+		Gpus:        gpus,
+		Vram:        record.Vram,
+		Connections: connections,
+		QueuedAt:    record.QueuedAt,
+		AssignedAt:  record.AssignedAt,
+		ActiveAt:    record.ActiveAt,
+		ClosedAt:    record.ClosedAt,
 	}
 
-	return storage.NewDefaultIterator[restapi.Agent](agents), nil
+	if agentId != "" {
+		usage.AgentID = uuid.NullUUID{UUID: uuid.FromStringOrNil(agentId), Valid: true}
+	}
 
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage).Error
 }
 
-func (g *gormDriver) GetQueuedSessionsIterator() (storage.Iterator[storage.QueuedSession], error) {
-	// TODO pagination should be passed in through storage interface
-	var dbSessions []models.Session
-	result := g.db.Model(&models.Session{}).
-		Where("state = ?", models.SessionStateQueued).
-		Limit(20).
-		Find(&dbSessions)
+// recordUsageOfAgents records the usage of the open sessions of agents being removed
+func recordUsageOfAgents(tx *gorm.DB, dbAgents []models.Agent, closed time.Time) error {
+	for _, dbAgent := range dbAgents {
+		var gpus []restapi.Gpu
+		err := json.Unmarshal(dbAgent.Gpus, &gpus)
+		if err != nil {
+			return err
+		}
+
+		var dbSessions []models.Session
+		result := tx.Where("agent_id = ? AND state != ?", dbAgent.ID, models.SessionStateClosed).Find(&dbSessions)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for _, dbSession := range dbSessions {
+			err = recordUsage(tx, dbSession, dbAgent.UUID.String(), gpus, closed)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (g *gormDriver) GetUsageRecords(filter storage.UsageFilter) ([]restapi.UsageRecord, error) {
+	query := g.db.Model(&models.Usage{}).Order("closed_at ASC")
+
+	if filter.PoolId != "" {
+		query = query.Where("pool_id = ?", uuid.FromStringOrNil(filter.PoolId))
+	}
+
+	if filter.UserId != "" {
+		query = query.Where("user_id = ?", filter.UserId)
+	}
+
+	if filter.PoolIds != nil {
+		poolIds := make([]uuid.UUID, 0, len(filter.PoolIds))
+		for _, poolId := range filter.PoolIds {
+			poolIds = append(poolIds, uuid.FromStringOrNil(poolId))
+		}
+
+		query = query.Where("pool_id IN ?", poolIds)
+	}
+
+	if !filter.From.IsZero() {
+		query = query.Where("closed_at >= ?", filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		query = query.Where("queued_at < ?", filter.To)
+	}
+
+	var dbUsage []models.Usage
+	result := query.Find(&dbUsage)
 	if result.Error != nil {
 		return nil, mapError(result.Error)
 	}
 
-	queuedSessions := []storage.QueuedSession{}
-	for _, dbSession := range dbSessions {
-		queuedSession := storage.QueuedSession{
-			Id: dbSession.UUID.String(),
+	records := make([]restapi.UsageRecord, 0, len(dbUsage))
+	for _, usage := range dbUsage {
+		record := restapi.UsageRecord{
+			SessionId:  usage.SessionID.String(),
+			UserId:     usage.UserID,
+			Vram:       usage.Vram,
+			QueuedAt:   usage.QueuedAt,
+			AssignedAt: usage.AssignedAt,
+			ActiveAt:   usage.ActiveAt,
+			ClosedAt:   usage.ClosedAt,
 		}
 
-		if err := json.Unmarshal(dbSession.Requirements, &queuedSession.Requirements); err != nil {
-			logger.Error(err)
-			continue
+		if usage.PoolID.Valid {
+			record.PoolId = usage.PoolID.UUID.String()
 		}
 
-		queuedSessions = append(queuedSessions, queuedSession)
-	}
+		if usage.AgentID.Valid {
+			record.AgentId = usage.AgentID.UUID.String()
+		}
 
-	return storage.NewDefaultIterator[storage.QueuedSession](queuedSessions), nil
+		err := json.Unmarshal(usage.Gpus, &record.Gpus)
+		if err == nil {
+			err = json.Unmarshal(usage.Connections, &record.Connections)
+		}
 
-}
+		if err != nil {
+			return nil, err
+		}
 
-func (g *gormDriver) SetAgentsMissingIfNotUpdatedFor(duration time.Duration) error {
+		records = append(records, record)
+	}
 
-	result := g.db.Model(&models.Agent{}).
-		Where("state = ?", models.AgentStateActive).
-		Where("updated_at <= ?", time.Now().Add(-duration)).
-		Updates(models.Agent{State: models.AgentStateMissing})
-	return mapError(result.Error)
+	return records, nil
 }
 
-func (g *gormDriver) RemoveMissingAgentsIfNotUpdatedFor(duration time.Duration) error {
-	// Soft-deletes agent
-	result := g.db.
-		Where("state = ?", models.AgentStateMissing).
-		Where("updated_at <= ?", time.Now().Add(-duration)).
-		Delete(&models.Agent{})
-	return mapError(result.Error)
+func (g *gormDriver) SetAgentsMissingIfNotUpdatedFor(duration time.Duration) ([]restapi.Agent, error) {
+	return g.moveAgentsNotUpdatedFor(duration, models.AgentStateActive, models.AgentStateMissing, false)
+}
+
+func (g *gormDriver) RemoveMissingAgentsIfNotUpdatedFor(duration time.Duration) ([]restapi.Agent, error) {
+	return g.moveAgentsNotUpdatedFor(duration, models.AgentStateMissing, models.AgentStateClosed, true)
 }
 
 func (g *gormDriver) DeletePool(id string) error {
@@ -657,13 +1528,13 @@ func (g *gormDriver) GetPermissions(userId string) (restapi.UserPermissions, err
 	// Raw SQL because GORM doesn't support multiple counts and complex subqueries
 	rows, err := g.db.Raw(`
 		SELECT permissions.pool_id, permissions.permission, pools.pool_name, COUNT(DISTINCT sessions.id) AS session_count, COUNT(DISTINCT agents.id) AS agent_count, 
-			(SELECT COUNT(DISTINCT p.user_id) FROM permissions p WHERE p.pool_id = permissions.pool_id AND deleted_at IS NULL) as user_count
+			(SELECT COUNT(DISTINCT p.user_id) FROM permissions p WHERE p.pool_id = permissions.pool_id AND p.deleted_at IS NULL) as user_count
 	
 		FROM permissions 
 			JOIN pools ON pools.id = permissions.pool_id
 			LEFT JOIN agents ON agents.pool_id = pools.id AND agents.state = @agentState
 			LEFT JOIN sessions ON sessions.agent_id = agents.id AND sessions.state = @sessionState
-		WHERE user_id = @userId AND permissions.deleted_at IS NULL
+		WHERE permissions.user_id = @userId AND permissions.deleted_at IS NULL
 		GROUP BY permissions.pool_id, permissions.permission, pools.pool_name`,
 		sql.Named("userId", userId), sql.Named("sessionState", models.SessionStateActive), sql.Named("agentState", models.AgentStateActive)).Rows()
 
@@ -725,3 +1596,311 @@ func (g *gormDriver) GetPoolPermissions(id string) (restapi.PoolPermissions, err
 	return permissions, nil
 
 }
+
+func (g *gormDriver) SetQuota(poolId string, userId string, limits restapi.QuotaLimits) error {
+	dbQuota := models.Quota{
+		PoolID:      uuid.FromStringOrNil(poolId),
+		UserID:      userId,
+		MaxSessions: limits.MaxSessions,
+		MaxVram:     limits.MaxVram,
+		MaxGpus:     limits.MaxGpus,
+	}
+
+	result := g.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "pool_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_sessions", "max_vram", "max_gpus", "updated_at"}),
+	}).Create(&dbQuota)
+
+	return mapError(result.Error)
+}
+
+func (g *gormDriver) RemoveQuota(poolId string, userId string) error {
+	result := g.db.Where("pool_id = ?", poolId).Where("user_id = ?", userId).Delete(&models.Quota{})
+
+	return mapError(result.Error)
+}
+
+func (g *gormDriver) SetSessionDefaults(poolId string, defaults restapi.SessionTimeouts) error {
+	dbDefaults := models.SessionDefaults{
+		PoolID:      uuid.FromStringOrNil(poolId),
+		MaxDuration: defaults.MaxDuration,
+		IdleTimeout: defaults.IdleTimeout,
+	}
+
+	result := g.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "pool_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_duration", "idle_timeout", "updated_at"}),
+	}).Create(&dbDefaults)
+
+	return mapError(result.Error)
+}
+
+func (g *gormDriver) GetSessionDefaults(poolId string) (restapi.SessionTimeouts, error) {
+	var dbDefaults []models.SessionDefaults
+	result := g.db.Where("pool_id = ?", uuid.FromStringOrNil(poolId)).Limit(1).Find(&dbDefaults)
+	if result.Error != nil || len(dbDefaults) == 0 {
+		return restapi.SessionTimeouts{}, mapError(result.Error)
+	}
+
+	return restapi.SessionTimeouts{
+		MaxDuration: dbDefaults[0].MaxDuration,
+		IdleTimeout: dbDefaults[0].IdleTimeout,
+	}, nil
+}
+
+func (g *gormDriver) GetOpenSessions() ([]storage.OpenSession, error) {
+	var dbSessions []models.Session
+	result := g.db.Preload("Agent").
+		Where("state IN ?", []models.SessionState{models.SessionStateAssigned, models.SessionStateActive}).
+		Find(&dbSessions)
+	if result.Error != nil {
+		return nil, mapError(result.Error)
+	}
+
+	sessions := make([]storage.OpenSession, 0, len(dbSessions))
+	for _, dbSession := range dbSessions {
+		session, err := restSessionFromSession(dbSession)
+		if err != nil {
+			return nil, err
+		}
+
+		openSession := storage.OpenSession{
+			Session:   session,
+			Assigned:  dbSession.CreatedAt,
+			IdleSince: dbSession.IdleSince,
+		}
+
+		if dbSession.AssignedAt != nil {
+			openSession.Assigned = *dbSession.AssignedAt
+		}
+
+		if dbSession.Agent != nil {
+			openSession.AgentId = dbSession.Agent.UUID.String()
+		}
+
+		err = json.Unmarshal(dbSession.Requirements, &openSession.Requirements)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, openSession)
+	}
+
+	return sessions, nil
+}
+
+func (g *gormDriver) GetPoolQuota(poolId string) (restapi.PoolQuota, error) {
+	var dbQuotas []models.Quota
+	result := g.db.Where("pool_id = ?", poolId).Find(&dbQuotas)
+	if result.Error != nil {
+		return restapi.PoolQuota{}, mapError(result.Error)
+	}
+
+	quota := restapi.PoolQuota{
+		PoolId: poolId,
+		Users:  map[string]restapi.QuotaLimits{},
+	}
+
+	for _, dbQuota := range dbQuotas {
+		limits := restapi.QuotaLimits{
+			MaxSessions: dbQuota.MaxSessions,
+			MaxVram:     dbQuota.MaxVram,
+			MaxGpus:     dbQuota.MaxGpus,
+		}
+
+		if dbQuota.UserID == "" {
+			quota.Pool = limits
+		} else {
+			quota.Users[dbQuota.UserID] = limits
+		}
+	}
+
+	return quota, nil
+}
+
+func (g *gormDriver) GetQuotaUsage(poolId string, userId string) (storage.QuotaUsage, error) {
+	query := g.db.Model(&models.Session{}).
+		Where("pool_id = ?", poolId).
+		Where("state IN ?", []models.SessionState{models.SessionStateAssigned, models.SessionStateActive, models.SessionStateCanceling})
+
+	if userId != "" {
+		query = query.Where("user_id = ?", userId)
+	}
+
+	var dbSessions []models.Session
+	result := query.Find(&dbSessions)
+	if result.Error != nil {
+		return storage.QuotaUsage{}, mapError(result.Error)
+	}
+
+	var usage storage.QuotaUsage
+	for _, dbSession := range dbSessions {
+		var gpus []restapi.SessionGpu
+		if err := json.Unmarshal(dbSession.GPUs, &gpus); err != nil {
+			return storage.QuotaUsage{}, err
+		}
+
+		usage.Sessions++
+		usage.Vram += dbSession.VramRequired
+		usage.Gpus += len(gpus)
+	}
+
+	return usage, nil
+}
+
+func (g *gormDriver) CreateReservation(reservation restapi.Reservation) (restapi.Reservation, error) {
+	gpus, err := json.Marshal(reservation.Gpus)
+	if err != nil {
+		return restapi.Reservation{}, err
+	}
+
+	dbReservation := models.Reservation{
+		PoolID:  uuid.FromStringOrNil(reservation.PoolId),
+		UserID:  reservation.UserId,
+		Gpus:    gpus,
+		StartAt: reservation.Start.UTC(),
+		EndAt:   reservation.End.UTC(),
+	}
+
+	result := g.db.Create(&dbReservation)
+	if result.Error != nil {
+		return restapi.Reservation{}, mapError(result.Error)
+	}
+
+	return restReservationFromReservation(dbReservation)
+}
+
+func (g *gormDriver) GetReservationById(id string) (restapi.Reservation, error) {
+	var dbReservation models.Reservation
+	result := g.db.Where("id = ?", uuid.FromStringOrNil(id)).First(&dbReservation)
+	if result.Error != nil {
+		return restapi.Reservation{}, mapError(result.Error)
+	}
+
+	return restReservationFromReservation(dbReservation)
+}
+
+func (g *gormDriver) GetReservations(filter storage.ReservationFilter) ([]restapi.Reservation, error) {
+	query := g.db.Model(&models.Reservation{})
+
+	if filter.PoolId != "" {
+		query = query.Where("pool_id = ?", uuid.FromStringOrNil(filter.PoolId))
+	}
+
+	if filter.PoolIds != nil {
+		poolIds := make([]uuid.UUID, 0, len(filter.PoolIds))
+		for _, poolId := range filter.PoolIds {
+			poolIds = append(poolIds, uuid.FromStringOrNil(poolId))
+		}
+
+		query = query.Where("pool_id IN ?", poolIds)
+	}
+
+	if !filter.From.IsZero() {
+		query = query.Where("end_at > ?", filter.From.UTC())
+	}
+
+	if !filter.To.IsZero() {
+		query = query.Where("start_at < ?", filter.To.UTC())
+	}
+
+	var dbReservations []models.Reservation
+	result := query.Order("start_at ASC").Find(&dbReservations)
+	if result.Error != nil {
+		return nil, mapError(result.Error)
+	}
+
+	reservations := make([]restapi.Reservation, 0, len(dbReservations))
+	for _, dbReservation := range dbReservations {
+		reservation, err := restReservationFromReservation(dbReservation)
+		if err != nil {
+			return nil, err
+		}
+
+		reservations = append(reservations, reservation)
+	}
+
+	return reservations, nil
+}
+
+func (g *gormDriver) DeleteReservation(id string) error {
+	result := g.db.Where("id = ?", uuid.FromStringOrNil(id)).Delete(&models.Reservation{})
+	if result.Error != nil {
+		return mapError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (g *gormDriver) CreateWebhook(webhook restapi.Webhook) (restapi.Webhook, error) {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return restapi.Webhook{}, err
+	}
+
+	dbWebhook := models.Webhook{
+		Url:    webhook.Url,
+		Secret: webhook.Secret,
+		Events: events,
+	}
+	if webhook.PoolId != "" {
+		dbWebhook.PoolID = uuid.NullUUID{
+			UUID:  uuid.FromStringOrNil(webhook.PoolId),
+			Valid: true,
+		}
+	}
+
+	result := g.db.Create(&dbWebhook)
+	if result.Error != nil {
+		return restapi.Webhook{}, mapError(result.Error)
+	}
+
+	return restWebhookFromWebhook(dbWebhook)
+}
+
+func (g *gormDriver) GetWebhookById(id string) (restapi.Webhook, error) {
+	var dbWebhook models.Webhook
+	result := g.db.Where("id = ?", uuid.FromStringOrNil(id)).First(&dbWebhook)
+	if result.Error != nil {
+		return restapi.Webhook{}, mapError(result.Error)
+	}
+
+	return restWebhookFromWebhook(dbWebhook)
+}
+
+func (g *gormDriver) GetWebhooks() ([]restapi.Webhook, error) {
+	var dbWebhooks []models.Webhook
+	result := g.db.Find(&dbWebhooks)
+	if result.Error != nil {
+		return nil, mapError(result.Error)
+	}
+
+	webhooks := make([]restapi.Webhook, 0, len(dbWebhooks))
+	for _, dbWebhook := range dbWebhooks {
+		webhook, err := restWebhookFromWebhook(dbWebhook)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, nil
+}
+
+func (g *gormDriver) DeleteWebhook(id string) error {
+	result := g.db.Where("id = ?", uuid.FromStringOrNil(id)).Delete(&models.Webhook{})
+	if result.Error != nil {
+		return mapError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
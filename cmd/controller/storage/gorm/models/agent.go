@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 	"gorm.io/datatypes"
@@ -69,6 +70,8 @@ type Agent struct {
 	Version       string
 	Gpus          datatypes.JSON
 	VramAvailable uint64
+	DrainState    string `gorm:"default:schedulable;index"`
+	DrainDeadline *time.Time
 
 	Labels   []KeyValue `gorm:"many2many:agent_labels;constraint:OnDelete:CASCADE;"`
 	Taints   []KeyValue `gorm:"many2many:agent_taints;constraint:OnDelete:CASCADE;"`
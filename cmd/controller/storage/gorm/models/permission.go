@@ -44,7 +44,7 @@ func PermissionTypeFromString(value string) PermissionType {
 }
 
 type Permission struct {
-	ID         uuid.UUID      `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	ID         uuid.UUID      `gorm:"type:uuid;primaryKey"`
 	UserID     string         `gorm:"type:text;not null;"`
 	PoolID     uuid.UUID      `gorm:"type:uuid;not null;"`
 	Pool       Pool           `gorm:"constraint:OnDelete:CASCADE;"`
@@ -54,3 +54,10 @@ type Permission struct {
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
+
+func (permission *Permission) BeforeCreate(tx *gorm.DB) error {
+	if permission.ID == uuid.Nil {
+		permission.ID = uuid.NewV4()
+	}
+	return nil
+}
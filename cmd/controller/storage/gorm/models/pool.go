@@ -8,7 +8,7 @@ import (
 )
 
 type Pool struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	ID        uuid.UUID `gorm:"type:uuid;primary_key"`
 	PoolName  string    `gorm:"type:varchar(255);not null"`
 	MaxAgents int       `gorm:"default:0"`
 
@@ -20,3 +20,10 @@ type Pool struct {
 	Sessions    []Session
 	Agents      []Agent
 }
+
+func (pool *Pool) BeforeCreate(tx *gorm.DB) error {
+	if pool.ID == uuid.Nil {
+		pool.ID = uuid.NewV4()
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type Quota struct {
+	ID     uint      `gorm:"primaryKey"`
+	PoolID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_quotas_pool_user"`
+	Pool   Pool      `gorm:"constraint:OnDelete:CASCADE;"`
+	// Empty for the quota of the pool as a whole
+	UserID string `gorm:"type:text;not null;default:'';uniqueIndex:idx_quotas_pool_user"`
+
+	MaxSessions int    `gorm:"default:0"`
+	MaxVram     uint64 `gorm:"default:0"`
+	MaxGpus     int    `gorm:"default:0"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
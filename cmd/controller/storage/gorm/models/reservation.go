@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// GPUs of a pool reserved for a window of time
+type Reservation struct {
+	ID     uuid.UUID `gorm:"type:uuid;primary_key"`
+	PoolID uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserID string    `gorm:"type:text"`
+	Gpus   datatypes.JSON
+
+	StartAt time.Time
+	EndAt   time.Time `gorm:"index"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (reservation *Reservation) BeforeCreate(tx *gorm.DB) error {
+	if reservation.ID == uuid.Nil {
+		reservation.ID = uuid.NewV4()
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 	"gorm.io/datatypes"
@@ -67,10 +68,29 @@ type Session struct {
 	Address      string
 	Version      string
 	Persistent   bool
+	Priority     int    `gorm:"default:0;index"`
+	UserID       string `gorm:"type:text;index"`
+	Reason       string
 	GPUs         datatypes.JSON
 	VramRequired uint64
 	Requirements datatypes.JSON
 
+	// Nil until the session is assigned to an agent and becomes active
+	AssignedAt *time.Time
+	ActiveAt   *time.Time
+
+	// Nil while the session has active connections
+	IdleSince *time.Time
+
+	// Nil until the client renews the lease of the session
+	LeaseExpiresAt *time.Time `gorm:"index"`
+
+	// Nil until the session is assigned to an agent
+	Placement datatypes.JSON
+
+	// Invalid unless the session is a member of a group
+	GroupID uuid.NullUUID `gorm:"type:uuid;index"`
+
 	Connections []Connection
 
 	Labels    []KeyValue `gorm:"many2many:session_labels;constraint:OnDelete:CASCADE;"`
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// The timeouts applied to the sessions of a pool not requesting their own
+type SessionDefaults struct {
+	PoolID uuid.UUID `gorm:"type:uuid;primary_key"`
+	Pool   Pool      `gorm:"constraint:OnDelete:CASCADE;"`
+
+	MaxDuration int64 `gorm:"default:0"`
+	IdleTimeout int64 `gorm:"default:0"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+// A group of sessions scheduled together, either every member of the group is
+// assigned or none are
+type SessionGroup struct {
+	gorm.Model
+
+	UUID   uuid.UUID     `gorm:"type:uuid;notnull;unique"`
+	PoolID uuid.NullUUID `gorm:"type:uuid;"`
+	UserID string        `gorm:"type:text"`
+
+	// The label whose value must be the same on every agent hosting a member
+	SameLabel string
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/datatypes"
+)
+
+// The immutable record of a closed session, kept once the session, agent and
+// pool it refers to have been removed
+type Usage struct {
+	SessionID uuid.UUID     `gorm:"type:uuid;primary_key"`
+	PoolID    uuid.NullUUID `gorm:"type:uuid;index"`
+	UserID    string        `gorm:"type:text"`
+	AgentID   uuid.NullUUID `gorm:"type:uuid"`
+
+	Gpus        datatypes.JSON
+	Vram        uint64
+	Connections datatypes.JSON
+
+	QueuedAt   time.Time
+	AssignedAt *time.Time
+	ActiveAt   *time.Time
+	ClosedAt   time.Time `gorm:"index"`
+}
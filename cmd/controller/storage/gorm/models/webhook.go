@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type Webhook struct {
+	ID     uuid.UUID `gorm:"type:uuid;primary_key"`
+	Url    string    `gorm:"type:text;not null"`
+	Secret string    `gorm:"type:text"`
+	Events datatypes.JSON
+
+	// Null for the events of every pool
+	PoolID uuid.NullUUID `gorm:"type:uuid;"`
+	Pool   Pool          `gorm:"constraint:OnDelete:CASCADE;"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (webhook *Webhook) BeforeCreate(tx *gorm.DB) error {
+	if webhook.ID == uuid.Nil {
+		webhook.ID = uuid.NewV4()
+	}
+	return nil
+}
@@ -32,7 +32,39 @@ type Session struct {
 	Requirements restapi.SessionRequirements
 	VramRequired uint64
 
+	Created     int64
+	Assigned    int64 // Zero until the session is assigned
+	Activated   int64 // Zero until the session is active
+	IdleSince   int64 // Zero while the session has active connections
+	LeaseExpiry int64 // Zero until the client renews the lease of the session
 	LastUpdated int64
+
+	Placement *restapi.SessionPlacement // Nil until the session is assigned
+}
+
+type SessionGroup struct {
+	Id       string
+	PoolId   string
+	UserId   string
+	Topology restapi.GroupTopology
+}
+
+type SessionDefaults struct {
+	PoolId string
+
+	restapi.SessionTimeouts
+}
+
+type Quota struct {
+	Key    string
+	PoolId string
+	UserId string
+
+	restapi.QuotaLimits
+}
+
+func quotaKey(poolId string, userId string) string {
+	return poolId + "/" + userId
 }
 
 type storageDriver struct {
@@ -81,6 +113,77 @@ func OpenStorage(ctx context.Context) (storage.Storage, error) {
 						Unique:  false,
 						Indexer: &memdb.IntFieldIndex{Field: "LastUpdated"},
 					},
+					"group": {
+						Name:         "group",
+						Unique:       false,
+						AllowMissing: true,
+						Indexer:      &memdb.StringFieldIndex{Field: "GroupId"},
+					},
+				},
+			},
+			"session_groups": {
+				Name: "session_groups",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.UUIDFieldIndex{Field: "Id"},
+					},
+				},
+			},
+			"quotas": {
+				Name: "quotas",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "Key"},
+					},
+					"pool": {
+						Name:    "pool",
+						Unique:  false,
+						Indexer: &memdb.StringFieldIndex{Field: "PoolId"},
+					},
+				},
+			},
+			"session_defaults": {
+				Name: "session_defaults",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "PoolId"},
+					},
+				},
+			},
+			"usage": {
+				Name: "usage",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.UUIDFieldIndex{Field: "SessionId"},
+					},
+				},
+			},
+			"reservations": {
+				Name: "reservations",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.UUIDFieldIndex{Field: "Id"},
+					},
+				},
+			},
+			"webhooks": {
+				Name: "webhooks",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.UUIDFieldIndex{Field: "Id"},
+					},
 				},
 			},
 		},
@@ -97,6 +200,49 @@ func OpenStorage(ctx context.Context) (storage.Storage, error) {
 	}, nil
 }
 
+func timeFromUnixNano(nanoseconds int64) *time.Time {
+	if nanoseconds == 0 {
+		return nil
+	}
+
+	t := time.Unix(0, nanoseconds)
+	return &t
+}
+
+// recordUsage adds the usage record of the session closing at the time, unless
+// the session has already been recorded
+func recordUsage(txn *memdb.Txn, session Session, agentGpus []restapi.Gpu, closed time.Time) error {
+	obj, err := txn.First("usage", "id", session.Id)
+	if err != nil || obj != nil {
+		return err
+	}
+
+	return txn.Insert("usage", storage.NewUsageRecord(session.Session, session.AgentId, agentGpus,
+		time.Unix(0, session.Created), timeFromUnixNano(session.Assigned), timeFromUnixNano(session.Activated), closed))
+}
+
+// recordUsageOfAgent records the usage of the open sessions of an agent being removed
+func recordUsageOfAgent(txn *memdb.Txn, agent Agent, closed time.Time) error {
+	for _, sessionId := range agent.SessionIds {
+		obj, err := txn.First("sessions", "id", sessionId)
+		if err != nil {
+			return err
+		}
+
+		if obj != nil {
+			session := utilities.Require[Session](obj)
+			if session.State != restapi.SessionClosed {
+				err = recordUsage(txn, session, agent.Gpus, closed)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func (driver *storageDriver) Close() error {
 	return nil
 }
@@ -166,79 +312,20 @@ func (driver *storageDriver) AggregateData() (storage.AggregatedData, error) {
 	}
 
 	if data.Gpus > 0 {
-		calculatePercentiles := func(counts map[int]int, total int) storage.Percentile[int] {
-			sortedKeys := []int{}
-			for key := range counts {
-				sortedKeys = append(sortedKeys, key)
-			}
-			sort.Ints(sortedKeys)
-
-			indexP90 := int(float64(total) * 0.90)
-			indexP75 := int(float64(total) * 0.75)
-			indexP50 := int(float64(total) * 0.50)
-			indexP25 := int(float64(total) * 0.25)
-			indexP10 := int(float64(total) * 0.10)
-
-			percentile := storage.Percentile[int]{
-				P100: sortedKeys[len(sortedKeys)-1],
-			}
-
-			index := 0
-			keysIndex := 0
-			key := 0
-
-			for keysIndex < len(sortedKeys) && index < indexP10 {
-				key = sortedKeys[keysIndex]
-				index += counts[key]
-				keysIndex++
-			}
-			percentile.P10 = key
-
-			for keysIndex < len(sortedKeys) && index < indexP25 {
-				key = sortedKeys[keysIndex]
-				index += counts[key]
-				keysIndex++
-			}
-			percentile.P25 = key
-
-			for keysIndex < len(sortedKeys) && index < indexP50 {
-				key = sortedKeys[keysIndex]
-				index += counts[key]
-				keysIndex++
-			}
-			percentile.P50 = key
-
-			for keysIndex < len(sortedKeys) && index < indexP75 {
-				key = sortedKeys[keysIndex]
-				index += counts[key]
-				keysIndex++
-			}
-			percentile.P75 = key
-
-			for keysIndex < len(sortedKeys) && index < indexP90 {
-				key = sortedKeys[keysIndex]
-				index += counts[key]
-				keysIndex++
-			}
-			percentile.P90 = key
-
-			return percentile
-		}
-
-		data.VramGBAvailable = calculatePercentiles(vramGBAvailable, data.Gpus)
+		data.VramGBAvailable = storage.CalculatePercentiles(vramGBAvailable, data.Gpus)
 		for key, gbAvailable := range vramGBAvailableByGpuName {
-			data.VramGBAvailableByGpuName[key] = calculatePercentiles(gbAvailable, data.GpusByGpuName[key])
+			data.VramGBAvailableByGpuName[key] = storage.CalculatePercentiles(gbAvailable, data.GpusByGpuName[key])
 		}
 
 		data.Utilization = float64(utilization) / float64(data.Gpus)
 		for key, value := range utilizationByGpuName {
 			data.UtilizationByGpuName[key] = float64(value) / float64(data.Gpus)
 		}
+	}
 
-		data.PowerDraw = float64(powerDraw) / float64(data.Gpus) / 1000.0
-		for key, value := range powerDrawByGpuName {
-			data.PowerDrawByGpuName[key] = float64(value) / float64(data.Gpus) / 1000.0
-		}
+	data.PowerDraw = float64(powerDraw) / 1000.0
+	for key, value := range powerDrawByGpuName {
+		data.PowerDrawByGpuName[key] = float64(value) / 1000.0
 	}
 
 	return data, nil
@@ -252,6 +339,8 @@ func (driver *storageDriver) RegisterAgent(apiAgent restapi.Agent) (string, erro
 	}
 
 	agent.Id = uuid.NewString()
+	agent.DrainState = restapi.AgentSchedulable
+	agent.DrainDeadline = nil
 
 	txn := driver.db.Txn(true)
 	err := txn.Insert("agents", agent)
@@ -281,7 +370,8 @@ func (driver *storageDriver) GetAgentById(id string) (restapi.Agent, error) {
 }
 
 func (driver *storageDriver) UpdateAgent(update restapi.AgentUpdate) error {
-	now := time.Now().Unix()
+	nowTime := time.Now()
+	now := nowTime.Unix()
 
 	txn := driver.db.Txn(true)
 
@@ -321,8 +411,27 @@ func (driver *storageDriver) UpdateAgent(update restapi.AgentUpdate) error {
 				session.State = sessionUpdate.State
 				session.LastUpdated = now
 
+				if session.State == restapi.SessionActive && session.Activated == 0 {
+					session.Activated = nowTime.UnixNano()
+				}
+
+				if len(sessionUpdate.Connections) > 0 {
+					session.Connections = mergeConnections(session.Connections, sessionUpdate.Connections)
+				}
+
+				session.IdleSince = 0
+				if sessionUpdate.IdleSince != nil {
+					session.IdleSince = sessionUpdate.IdleSince.UnixNano()
+				}
+
 				if session.State == restapi.SessionClosed {
 					agent.VramAvailable += session.VramRequired
+
+					err = recordUsage(txn, session, agent.Gpus, nowTime)
+					if err != nil {
+						txn.Abort()
+						return err
+					}
 				} else {
 					sessionIds = append(sessionIds, sessionId)
 					sessions = append(sessions, session.Session)
@@ -352,6 +461,12 @@ func (driver *storageDriver) UpdateAgent(update restapi.AgentUpdate) error {
 			return err
 		}
 	} else {
+		err = recordUsageOfAgent(txn, agent, nowTime)
+		if err != nil {
+			txn.Abort()
+			return err
+		}
+
 		sessionIds := make([]interface{}, len(agent.SessionIds))
 		for index, id := range agent.SessionIds {
 			sessionIds[index] = id
@@ -374,64 +489,48 @@ func (driver *storageDriver) UpdateAgent(update restapi.AgentUpdate) error {
 	return nil
 }
 
-func (driver *storageDriver) RequestSession(requirements restapi.SessionRequirements) (string, error) {
-	session := Session{
-		Session: restapi.Session{
-			Id:      uuid.NewString(),
-			Version: requirements.Version,
-			State:   restapi.SessionQueued,
-		},
-		Requirements: requirements,
-		VramRequired: storage.TotalVramRequired(requirements),
-		LastUpdated:  time.Now().Unix(),
+func (driver *storageDriver) SetAgentDrainState(id string, drainState string, deadline *time.Time) error {
+	txn := driver.db.Txn(true)
+
+	obj, err := txn.First("agents", "id", id)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	if obj == nil {
+		txn.Abort()
+		return storage.ErrNotFound
 	}
 
-	txn := driver.db.Txn(true)
+	agent := utilities.Require[Agent](obj)
+	agent.DrainState = drainState
+	agent.DrainDeadline = deadline
 
-	err := txn.Insert("sessions", session)
+	err = txn.Insert("agents", agent)
 	if err != nil {
 		txn.Abort()
-		return "", err
+		return err
 	}
 
 	txn.Commit()
-	return session.Id, nil
+	return nil
 }
 
-func (driver *storageDriver) AssignSession(sessionId string, agentId string, gpus []restapi.SessionGpu) error {
-	now := time.Now().Unix()
-
+func (driver *storageDriver) SetAgentTaints(id string, taints map[string]string) error {
 	txn := driver.db.Txn(true)
 
-	obj, err := txn.First("agents", "id", agentId)
-	if err != nil {
-		return err
-	}
-	agent := utilities.Require[Agent](obj)
-
-	obj, err = txn.First("sessions", "id", sessionId)
+	obj, err := txn.First("agents", "id", id)
 	if err != nil {
 		txn.Abort()
 		return err
 	}
-	session := utilities.Require[Session](obj)
-	session.State = restapi.SessionAssigned
-	// session.ExitStatus = restapi.ExitStatusUnknown
-	session.AgentId = agentId
-	session.Address = agent.Address
-	session.Gpus = gpus
-	session.LastUpdated = now
-
-	err = txn.Insert("sessions", session)
-	if err != nil {
+	if obj == nil {
 		txn.Abort()
-		return err
+		return storage.ErrNotFound
 	}
 
-	agent.Sessions = append(agent.Sessions, session.Session)
-	agent.SessionIds = append(agent.SessionIds, sessionId)
-	agent.VramAvailable -= session.VramRequired
-	agent.LastUpdated = now
+	agent := utilities.Require[Agent](obj)
+	agent.Taints = taints
 
 	err = txn.Insert("agents", agent)
 	if err != nil {
@@ -443,102 +542,637 @@ func (driver *storageDriver) AssignSession(sessionId string, agentId string, gpu
 	return nil
 }
 
-func (driver *storageDriver) CancelSession(sessionId string) error {
+func newQueuedSession(requirements restapi.SessionRequirements, userId string, groupId string, now time.Time) Session {
+	return Session{
+		Session: restapi.Session{
+			Id:       uuid.NewString(),
+			Version:  requirements.Version,
+			State:    restapi.SessionQueued,
+			PoolId:   requirements.PoolId,
+			UserId:   userId,
+			Priority: requirements.Priority,
+			GroupId:  groupId,
+		},
+		Requirements: requirements,
+		VramRequired: storage.TotalVramRequired(requirements),
+		Created:      now.UnixNano(),
+		LastUpdated:  now.Unix(),
+	}
+}
+
+func (driver *storageDriver) RequestSession(requirements restapi.SessionRequirements, userId string) (string, error) {
+	session := newQueuedSession(requirements, userId, "", time.Now())
+
 	txn := driver.db.Txn(true)
 
-	obj, err := txn.First("sessions", "id", sessionId)
+	err := txn.Insert("sessions", session)
 	if err != nil {
 		txn.Abort()
-		return err
-	}
-	session := utilities.Require[Session](obj)
-	if session.AgentId == "" {
-		session.State = restapi.SessionClosed
-		// session.ExitStatus = restapi.ExitStatusCanceled
-	} else {
-		session.State = restapi.SessionCanceling
+		return "", err
 	}
 
 	txn.Commit()
-	return nil
+	return session.Id, nil
 }
 
-func (driver *storageDriver) GetSessionById(id string) (restapi.Session, error) {
-	txn := driver.db.Txn(false)
-	defer txn.Abort()
+func (driver *storageDriver) RequestSessionGroup(requirements restapi.SessionGroupRequirements, userId string) (string, error) {
+	now := time.Now()
 
-	obj, err := txn.First("sessions", "id", id)
+	group := SessionGroup{
+		Id:       uuid.NewString(),
+		PoolId:   requirements.Session.PoolId,
+		UserId:   userId,
+		Topology: requirements.Topology,
+	}
+
+	txn := driver.db.Txn(true)
+
+	err := txn.Insert("session_groups", group)
 	if err != nil {
-		return restapi.Session{}, err
+		txn.Abort()
+		return "", err
 	}
 
-	if obj == nil {
-		return restapi.Session{}, storage.ErrNotFound
+	for member := 0; member < requirements.Members; member++ {
+		err = txn.Insert("sessions", newQueuedSession(requirements.Session, userId, group.Id, now))
+		if err != nil {
+			txn.Abort()
+			return "", err
+		}
 	}
 
-	return utilities.Require[Session](obj).Session, nil
+	txn.Commit()
+	return group.Id, nil
 }
 
-func (driver *storageDriver) GetQueuedSessionById(id string) (storage.QueuedSession, error) {
+func (driver *storageDriver) GetSessionGroup(id string) (restapi.SessionGroup, error) {
 	txn := driver.db.Txn(false)
 	defer txn.Abort()
 
-	obj, err := txn.First("sessions", "id", id)
+	obj, err := txn.First("session_groups", "id", id)
 	if err != nil {
-		return storage.QueuedSession{}, err
+		return restapi.SessionGroup{}, err
 	}
 
 	if obj == nil {
-		return storage.QueuedSession{}, storage.ErrNotFound
+		return restapi.SessionGroup{}, storage.ErrNotFound
 	}
 
-	session := utilities.Require[Session](obj)
-
-	return storage.QueuedSession{
-		Id:           session.Id,
-		Requirements: session.Requirements,
-	}, nil
-}
-
-func (driver *storageDriver) GetAgents(poolId string) (storage.Iterator[restapi.Agent], error) {
-	txn := driver.db.Txn(false)
-	defer txn.Abort()
+	group := utilities.Require[SessionGroup](obj)
 
-	iterator, err := txn.Get("agents", "id")
+	iterator, err := txn.Get("sessions", "group", id)
 	if err != nil {
-		return nil, err
+		return restapi.SessionGroup{}, err
 	}
 
-	var agents []restapi.Agent
+	sessions := make([]restapi.Session, 0)
 	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
-		agent := utilities.Require[Agent](obj)
-		if agent.State == restapi.AgentActive {
-			agents = append(agents, agent.Agent)
-		}
+		sessions = append(sessions, utilities.Require[Session](obj).Session)
 	}
 
-	return storage.NewDefaultIterator(agents), nil
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Id < sessions[j].Id
+	})
+
+	return restapi.SessionGroup{
+		Id:       group.Id,
+		State:    storage.SessionGroupState(sessions),
+		PoolId:   group.PoolId,
+		UserId:   group.UserId,
+		Topology: group.Topology,
+		Sessions: sessions,
+	}, nil
 }
 
-func (driver *storageDriver) GetAvailableAgentsMatching(totalAvailableVramAtLeast uint64) (storage.Iterator[restapi.Agent], error) {
-	txn := driver.db.Txn(false)
-	defer txn.Abort()
+// assignSession assigns the session to the agent within the transaction
+func assignSession(txn *memdb.Txn, assignment storage.SessionAssignment, nowTime time.Time) error {
+	now := nowTime.Unix()
 
-	iterator, err := txn.Get("agents", "state", restapi.AgentActive)
+	obj, err := txn.First("agents", "id", assignment.AgentId)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if obj == nil {
+		return storage.ErrNotFound
 	}
+	agent := utilities.Require[Agent](obj)
 
-	var agents []restapi.Agent
-	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
-		agent := utilities.Require[Agent](obj)
+	obj, err = txn.First("sessions", "id", assignment.SessionId)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return storage.ErrNotFound
+	}
+	session := utilities.Require[Session](obj)
+	session.State = restapi.SessionAssigned
+	// session.ExitStatus = restapi.ExitStatusUnknown
+	session.AgentId = assignment.AgentId
+	session.Address = agent.Address
+	session.Gpus = assignment.Gpus
+	session.Reason = ""
+	session.Assigned = nowTime.UnixNano()
+	session.LastUpdated = now
 
-		if agent.VramAvailable >= totalAvailableVramAtLeast {
-			agents = append(agents, agent.Agent)
-		}
+	err = txn.Insert("sessions", session)
+	if err != nil {
+		return err
 	}
 
-	return storage.NewDefaultIterator(agents), nil
+	agent.Sessions = append(agent.Sessions, session.Session)
+	agent.SessionIds = append(agent.SessionIds, assignment.SessionId)
+	agent.VramAvailable -= session.VramRequired
+	agent.LastUpdated = now
+
+	return txn.Insert("agents", agent)
+}
+
+func (driver *storageDriver) AssignSession(sessionId string, agentId string, gpus []restapi.SessionGpu) error {
+	return driver.AssignSessions([]storage.SessionAssignment{{
+		SessionId: sessionId,
+		AgentId:   agentId,
+		Gpus:      gpus,
+	}})
+}
+
+func (driver *storageDriver) AssignSessions(assignments []storage.SessionAssignment) error {
+	now := time.Now()
+
+	txn := driver.db.Txn(true)
+
+	for _, assignment := range assignments {
+		err := assignSession(txn, assignment, now)
+		if err != nil {
+			txn.Abort()
+			return err
+		}
+	}
+
+	txn.Commit()
+	return nil
+}
+
+func (driver *storageDriver) CancelSession(sessionId string) error {
+	txn := driver.db.Txn(true)
+
+	obj, err := txn.First("sessions", "id", sessionId)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	if obj == nil {
+		txn.Abort()
+		return storage.ErrNotFound
+	}
+
+	session := utilities.Require[Session](obj)
+	if session.AgentId == "" {
+		session.State = restapi.SessionClosed
+		// session.ExitStatus = restapi.ExitStatusCanceled
+
+		err = recordUsage(txn, session, nil, time.Now())
+		if err != nil {
+			txn.Abort()
+			return err
+		}
+	} else {
+		session.State = restapi.SessionCanceling
+
+		// The agent keeps a copy of the session which must reflect the new state
+		obj, err = txn.First("agents", "id", session.AgentId)
+		if err != nil {
+			txn.Abort()
+			return err
+		}
+
+		if obj != nil {
+			agent := utilities.Require[Agent](obj)
+
+			sessions := make([]restapi.Session, len(agent.Sessions))
+			copy(sessions, agent.Sessions)
+			for index := range sessions {
+				if sessions[index].Id == sessionId {
+					sessions[index].State = restapi.SessionCanceling
+				}
+			}
+			agent.Sessions = sessions
+
+			err = txn.Insert("agents", agent)
+			if err != nil {
+				txn.Abort()
+				return err
+			}
+		}
+	}
+
+	session.LastUpdated = time.Now().Unix()
+
+	err = txn.Insert("sessions", session)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+
+	txn.Commit()
+	return nil
+}
+
+func (driver *storageDriver) SetSessionReason(sessionId string, reason string) error {
+	txn := driver.db.Txn(true)
+
+	obj, err := txn.First("sessions", "id", sessionId)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	if obj == nil {
+		txn.Abort()
+		return storage.ErrNotFound
+	}
+
+	session := utilities.Require[Session](obj)
+	session.Reason = reason
+
+	err = txn.Insert("sessions", session)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+
+	txn.Commit()
+	return nil
+}
+
+func (driver *storageDriver) SetSessionPlacement(placement restapi.SessionPlacement) error {
+	txn := driver.db.Txn(true)
+
+	obj, err := txn.First("sessions", "id", placement.SessionId)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	if obj == nil {
+		txn.Abort()
+		return storage.ErrNotFound
+	}
+
+	session := utilities.Require[Session](obj)
+	session.Placement = &placement
+
+	err = txn.Insert("sessions", session)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+
+	txn.Commit()
+	return nil
+}
+
+func (driver *storageDriver) GetSessionPlacement(sessionId string) (restapi.SessionPlacement, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	obj, err := txn.First("sessions", "id", sessionId)
+	if err != nil {
+		return restapi.SessionPlacement{}, err
+	}
+
+	if obj == nil {
+		return restapi.SessionPlacement{}, storage.ErrNotFound
+	}
+
+	placement := utilities.Require[Session](obj).Placement
+	if placement == nil {
+		return restapi.SessionPlacement{}, storage.ErrNotFound
+	}
+
+	return *placement, nil
+}
+
+func (driver *storageDriver) GetSessionById(id string) (restapi.Session, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	obj, err := txn.First("sessions", "id", id)
+	if err != nil {
+		return restapi.Session{}, err
+	}
+
+	if obj == nil {
+		return restapi.Session{}, storage.ErrNotFound
+	}
+
+	return utilities.Require[Session](obj).Session, nil
+}
+
+func (driver *storageDriver) RenewSessionLease(id string, expires time.Time) error {
+	txn := driver.db.Txn(true)
+
+	obj, err := txn.First("sessions", "id", id)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	if obj == nil {
+		txn.Abort()
+		return storage.ErrNotFound
+	}
+
+	session := utilities.Require[Session](obj)
+	session.LeaseExpiry = expires.UnixNano()
+
+	err = txn.Insert("sessions", session)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+
+	txn.Commit()
+	return nil
+}
+
+func (driver *storageDriver) GetSessionsWithExpiredLease(now time.Time) ([]restapi.Session, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	sessions := make([]restapi.Session, 0)
+	for _, state := range []string{restapi.SessionQueued, restapi.SessionAssigned, restapi.SessionActive} {
+		iterator, err := txn.Get("sessions", "state", state)
+		if err != nil {
+			return nil, err
+		}
+
+		for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
+			session := utilities.Require[Session](obj)
+			if session.LeaseExpiry != 0 && session.LeaseExpiry < now.UnixNano() {
+				sessions = append(sessions, session.Session)
+			}
+		}
+	}
+
+	return sessions, nil
+}
+
+func (driver *storageDriver) GetQueuedSessionById(id string) (storage.QueuedSession, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	obj, err := txn.First("sessions", "id", id)
+	if err != nil {
+		return storage.QueuedSession{}, err
+	}
+
+	if obj == nil {
+		return storage.QueuedSession{}, storage.ErrNotFound
+	}
+
+	session := utilities.Require[Session](obj)
+
+	return storage.QueuedSession{
+		Id:           session.Id,
+		UserId:       session.UserId,
+		Reason:       session.Reason,
+		GroupId:      session.GroupId,
+		Requirements: session.Requirements,
+	}, nil
+}
+
+func matchesAgentFilter(agent Agent, filter storage.AgentFilter) bool {
+	if filter.State != "" && agent.State != filter.State {
+		return false
+	}
+
+	if filter.PoolId != "" && agent.PoolId != filter.PoolId {
+		return false
+	}
+
+	if filter.PoolIds != nil {
+		found := false
+		for _, poolId := range filter.PoolIds {
+			if agent.PoolId == poolId {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	for key, value := range filter.Selector {
+		label, found := agent.Labels[key]
+		if !found || label != value {
+			return false
+		}
+	}
+
+	if filter.GpuName != "" {
+		found := false
+		for _, gpu := range agent.Gpus {
+			if gpu.Name == filter.GpuName {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return agent.VramAvailable >= filter.MinVramAvailable
+}
+
+func (driver *storageDriver) ListAgents(filter storage.AgentFilter, page storage.Page) ([]restapi.Agent, string, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	var iterator memdb.ResultIterator
+	var err error
+	if page.Cursor != "" {
+		iterator, err = txn.LowerBound("agents", "id", page.Cursor)
+	} else {
+		iterator, err = txn.Get("agents", "id")
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	size := page.Size()
+
+	agents := make([]restapi.Agent, 0)
+	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
+		agent := utilities.Require[Agent](obj)
+		if agent.Id == page.Cursor || !matchesAgentFilter(agent, filter) {
+			continue
+		}
+
+		if len(agents) == size {
+			return agents, agents[size-1].Id, nil
+		}
+
+		agents = append(agents, agent.Agent)
+	}
+
+	return agents, "", nil
+}
+
+func matchesSessionFilter(session Session, filter storage.SessionFilter) bool {
+	if filter.State != "" && session.State != filter.State {
+		return false
+	}
+
+	if filter.PoolId != "" && session.PoolId != filter.PoolId {
+		return false
+	}
+
+	if filter.AgentId != "" && session.AgentId != filter.AgentId {
+		return false
+	}
+
+	if filter.Version != "" && session.Version != filter.Version {
+		return false
+	}
+
+	if filter.PoolIds != nil {
+		found := false
+		for _, poolId := range filter.PoolIds {
+			if session.PoolId == poolId {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if !filter.CreatedAfter.IsZero() && session.Created < filter.CreatedAfter.UnixNano() {
+		return false
+	}
+
+	return filter.CreatedBefore.IsZero() || session.Created < filter.CreatedBefore.UnixNano()
+}
+
+func (driver *storageDriver) ListSessions(filter storage.SessionFilter, page storage.Page) ([]restapi.ListedSession, string, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	var iterator memdb.ResultIterator
+	var err error
+	if page.Cursor != "" {
+		iterator, err = txn.LowerBound("sessions", "id", page.Cursor)
+	} else {
+		iterator, err = txn.Get("sessions", "id")
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	size := page.Size()
+
+	sessions := make([]restapi.ListedSession, 0)
+	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
+		session := utilities.Require[Session](obj)
+		if session.Id == page.Cursor || !matchesSessionFilter(session, filter) {
+			continue
+		}
+
+		if len(sessions) == size {
+			return sessions, sessions[size-1].Id, nil
+		}
+
+		sessions = append(sessions, restapi.ListedSession{
+			Session: session.Session,
+			AgentId: session.AgentId,
+			Created: time.Unix(0, session.Created).UTC(),
+		})
+	}
+
+	return sessions, "", nil
+}
+
+// mergeConnections returns the connections with the updates applied
+func mergeConnections(connections []restapi.Connection, updates map[string]restapi.Connection) []restapi.Connection {
+	merged := make([]restapi.Connection, 0, len(connections)+len(updates))
+
+	updated := map[string]bool{}
+	for _, connection := range connections {
+		if update, found := updates[connection.Id]; found {
+			update.Id = connection.Id
+			updated[connection.Id] = true
+			connection = update
+		}
+
+		merged = append(merged, connection)
+	}
+
+	added := make([]string, 0, len(updates))
+	for id := range updates {
+		if !updated[id] {
+			added = append(added, id)
+		}
+	}
+	sort.Strings(added)
+
+	for _, id := range added {
+		connection := updates[id]
+		connection.Id = id
+		merged = append(merged, connection)
+	}
+
+	return merged
+}
+
+func (driver *storageDriver) GetUsageRecords(filter storage.UsageFilter) ([]restapi.UsageRecord, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	iterator, err := txn.Get("usage", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]restapi.UsageRecord, 0)
+	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
+		record := utilities.Require[restapi.UsageRecord](obj)
+		if storage.MatchesUsageFilter(record, filter) {
+			records = append(records, record)
+		}
+	}
+
+	// Ordered by the time the sessions closed
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].ClosedAt.Before(records[j].ClosedAt)
+	})
+
+	return records, nil
+}
+
+func (driver *storageDriver) GetAvailableAgentsMatching(totalAvailableVramAtLeast uint64) (storage.Iterator[restapi.Agent], error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	iterator, err := txn.Get("agents", "state", restapi.AgentActive)
+	if err != nil {
+		return nil, err
+	}
+
+	var agents []restapi.Agent
+	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
+		agent := utilities.Require[Agent](obj)
+
+		if agent.VramAvailable >= totalAvailableVramAtLeast {
+			agents = append(agents, agent.Agent)
+		}
+	}
+
+	return storage.NewDefaultIterator(agents), nil
 }
 
 func (driver *storageDriver) GetQueuedSessionsIterator() (storage.Iterator[storage.QueuedSession], error) {
@@ -550,11 +1184,26 @@ func (driver *storageDriver) GetQueuedSessionsIterator() (storage.Iterator[stora
 		return nil, err
 	}
 
-	var sessions []storage.QueuedSession
+	var queued []Session
 	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
-		session := utilities.Require[Session](obj)
+		queued = append(queued, utilities.Require[Session](obj))
+	}
+
+	// Higher priorities first, otherwise in the order the sessions were requested
+	sort.SliceStable(queued, func(i, j int) bool {
+		if queued[i].Priority != queued[j].Priority {
+			return queued[i].Priority > queued[j].Priority
+		}
+		return queued[i].Created < queued[j].Created
+	})
+
+	sessions := make([]storage.QueuedSession, 0, len(queued))
+	for _, session := range queued {
 		sessions = append(sessions, storage.QueuedSession{
 			Id:           session.Id,
+			UserId:       session.UserId,
+			Reason:       session.Reason,
+			GroupId:      session.GroupId,
 			Requirements: session.Requirements,
 		})
 	}
@@ -562,7 +1211,27 @@ func (driver *storageDriver) GetQueuedSessionsIterator() (storage.Iterator[stora
 	return storage.NewDefaultIterator(sessions), nil
 }
 
-func (driver *storageDriver) SetAgentsMissingIfNotUpdatedFor(duration time.Duration) error {
+func (driver *storageDriver) GetDrainingAgents() ([]restapi.Agent, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	iterator, err := txn.Get("agents", "state", restapi.AgentActive)
+	if err != nil {
+		return nil, err
+	}
+
+	agents := make([]restapi.Agent, 0)
+	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
+		agent := utilities.Require[Agent](obj)
+		if agent.DrainState == restapi.AgentDraining {
+			agents = append(agents, agent.Agent)
+		}
+	}
+
+	return agents, nil
+}
+
+func (driver *storageDriver) SetAgentsMissingIfNotUpdatedFor(duration time.Duration) ([]restapi.Agent, error) {
 	nowTime := time.Now()
 	now := nowTime.Unix()
 	since := nowTime.Add(-duration).Unix()
@@ -572,9 +1241,10 @@ func (driver *storageDriver) SetAgentsMissingIfNotUpdatedFor(duration time.Durat
 	iterator, err := txn.ReverseLowerBound("agents", "last_updated", since)
 	if err != nil {
 		txn.Abort()
-		return err
+		return nil, err
 	}
 
+	agents := make([]restapi.Agent, 0)
 	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
 		agent := utilities.Require[Agent](obj)
 		if agent.State == restapi.AgentActive {
@@ -584,31 +1254,44 @@ func (driver *storageDriver) SetAgentsMissingIfNotUpdatedFor(duration time.Durat
 			err = txn.Insert("agents", agent)
 			if err != nil {
 				txn.Abort()
-				return err
+				return nil, err
 			}
+
+			agents = append(agents, agent.Agent)
 		}
 	}
 
 	txn.Commit()
-	return nil
+	return agents, nil
 }
 
-func (driver *storageDriver) RemoveMissingAgentsIfNotUpdatedFor(duration time.Duration) error {
-	since := time.Now().Add(-duration).Unix()
+func (driver *storageDriver) RemoveMissingAgentsIfNotUpdatedFor(duration time.Duration) ([]restapi.Agent, error) {
+	now := time.Now()
+	since := now.Add(-duration).Unix()
 
 	txn := driver.db.Txn(true)
 
 	iterator, err := txn.ReverseLowerBound("agents", "last_updated", since)
 	if err != nil {
 		txn.Abort()
-		return err
+		return nil, err
 	}
 
+	agents := make([]restapi.Agent, 0)
 	agentIds := make([]interface{}, 0)
 	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
 		agent := utilities.Require[Agent](obj)
 		if agent.State == restapi.AgentMissing {
+			err = recordUsageOfAgent(txn, agent, now)
+			if err != nil {
+				txn.Abort()
+				return nil, err
+			}
+
 			agentIds = append(agentIds, agent.Id)
+
+			agent.State = restapi.AgentClosed
+			agents = append(agents, agent.Agent)
 		}
 	}
 
@@ -616,7 +1299,7 @@ func (driver *storageDriver) RemoveMissingAgentsIfNotUpdatedFor(duration time.Du
 		_, err = txn.DeleteAll("agents", "id", agentIds...)
 		if err != nil {
 			txn.Abort()
-			return err
+			return nil, err
 		}
 
 		txn.Commit()
@@ -624,7 +1307,7 @@ func (driver *storageDriver) RemoveMissingAgentsIfNotUpdatedFor(duration time.Du
 		txn.Abort()
 	}
 
-	return nil
+	return agents, nil
 }
 
 func (driver *storageDriver) DeletePool(id string) error {
@@ -662,3 +1345,275 @@ func (driver *storageDriver) GetPoolPermissions(id string) (restapi.PoolPermissi
 	// TODO
 	return restapi.PoolPermissions{}, nil
 }
+
+func (driver *storageDriver) SetQuota(poolId string, userId string, limits restapi.QuotaLimits) error {
+	txn := driver.db.Txn(true)
+
+	err := txn.Insert("quotas", Quota{
+		Key:         quotaKey(poolId, userId),
+		PoolId:      poolId,
+		UserId:      userId,
+		QuotaLimits: limits,
+	})
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+
+	txn.Commit()
+	return nil
+}
+
+func (driver *storageDriver) RemoveQuota(poolId string, userId string) error {
+	txn := driver.db.Txn(true)
+
+	_, err := txn.DeleteAll("quotas", "id", quotaKey(poolId, userId))
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+
+	txn.Commit()
+	return nil
+}
+
+func (driver *storageDriver) GetPoolQuota(poolId string) (restapi.PoolQuota, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	iterator, err := txn.Get("quotas", "pool", poolId)
+	if err != nil {
+		return restapi.PoolQuota{}, err
+	}
+
+	quota := restapi.PoolQuota{
+		PoolId: poolId,
+		Users:  map[string]restapi.QuotaLimits{},
+	}
+
+	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
+		poolQuota := utilities.Require[Quota](obj)
+		if poolQuota.UserId == "" {
+			quota.Pool = poolQuota.QuotaLimits
+		} else {
+			quota.Users[poolQuota.UserId] = poolQuota.QuotaLimits
+		}
+	}
+
+	return quota, nil
+}
+
+func (driver *storageDriver) SetSessionDefaults(poolId string, defaults restapi.SessionTimeouts) error {
+	txn := driver.db.Txn(true)
+
+	err := txn.Insert("session_defaults", SessionDefaults{
+		PoolId:          poolId,
+		SessionTimeouts: defaults,
+	})
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+
+	txn.Commit()
+	return nil
+}
+
+func (driver *storageDriver) GetSessionDefaults(poolId string) (restapi.SessionTimeouts, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	obj, err := txn.First("session_defaults", "id", poolId)
+	if err != nil || obj == nil {
+		return restapi.SessionTimeouts{}, err
+	}
+
+	return utilities.Require[SessionDefaults](obj).SessionTimeouts, nil
+}
+
+func (driver *storageDriver) GetOpenSessions() ([]storage.OpenSession, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	sessions := make([]storage.OpenSession, 0)
+	for _, state := range []string{restapi.SessionAssigned, restapi.SessionActive} {
+		iterator, err := txn.Get("sessions", "state", state)
+		if err != nil {
+			return nil, err
+		}
+
+		for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
+			session := utilities.Require[Session](obj)
+			sessions = append(sessions, storage.OpenSession{
+				Session:      session.Session,
+				AgentId:      session.AgentId,
+				Requirements: session.Requirements,
+				Assigned:     time.Unix(0, session.Assigned),
+				IdleSince:    timeFromUnixNano(session.IdleSince),
+			})
+		}
+	}
+
+	return sessions, nil
+}
+
+func (driver *storageDriver) GetQuotaUsage(poolId string, userId string) (storage.QuotaUsage, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	var usage storage.QuotaUsage
+	for _, state := range []string{restapi.SessionAssigned, restapi.SessionActive, restapi.SessionCanceling} {
+		iterator, err := txn.Get("sessions", "state", state)
+		if err != nil {
+			return storage.QuotaUsage{}, err
+		}
+
+		for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
+			session := utilities.Require[Session](obj)
+			if session.PoolId != poolId || (userId != "" && session.UserId != userId) {
+				continue
+			}
+
+			usage.Sessions++
+			usage.Vram += session.VramRequired
+			usage.Gpus += len(session.Gpus)
+		}
+	}
+
+	return usage, nil
+}
+
+func (driver *storageDriver) CreateReservation(reservation restapi.Reservation) (restapi.Reservation, error) {
+	reservation.Id = uuid.NewString()
+
+	txn := driver.db.Txn(true)
+
+	err := txn.Insert("reservations", reservation)
+	if err != nil {
+		txn.Abort()
+		return restapi.Reservation{}, err
+	}
+
+	txn.Commit()
+	return reservation, nil
+}
+
+func (driver *storageDriver) GetReservationById(id string) (restapi.Reservation, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	obj, err := txn.First("reservations", "id", id)
+	if err != nil {
+		return restapi.Reservation{}, err
+	}
+	if obj == nil {
+		return restapi.Reservation{}, storage.ErrNotFound
+	}
+
+	return utilities.Require[restapi.Reservation](obj), nil
+}
+
+func (driver *storageDriver) GetReservations(filter storage.ReservationFilter) ([]restapi.Reservation, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	iterator, err := txn.Get("reservations", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	reservations := make([]restapi.Reservation, 0)
+	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
+		reservation := utilities.Require[restapi.Reservation](obj)
+		if storage.MatchesReservationFilter(reservation, filter) {
+			reservations = append(reservations, reservation)
+		}
+	}
+
+	sort.SliceStable(reservations, func(i, j int) bool {
+		return reservations[i].Start.Before(reservations[j].Start)
+	})
+
+	return reservations, nil
+}
+
+func (driver *storageDriver) DeleteReservation(id string) error {
+	txn := driver.db.Txn(true)
+
+	count, err := txn.DeleteAll("reservations", "id", id)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	if count == 0 {
+		txn.Abort()
+		return storage.ErrNotFound
+	}
+
+	txn.Commit()
+	return nil
+}
+
+func (driver *storageDriver) CreateWebhook(webhook restapi.Webhook) (restapi.Webhook, error) {
+	webhook.Id = uuid.NewString()
+
+	txn := driver.db.Txn(true)
+
+	err := txn.Insert("webhooks", webhook)
+	if err != nil {
+		txn.Abort()
+		return restapi.Webhook{}, err
+	}
+
+	txn.Commit()
+	return webhook, nil
+}
+
+func (driver *storageDriver) GetWebhookById(id string) (restapi.Webhook, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	obj, err := txn.First("webhooks", "id", id)
+	if err != nil {
+		return restapi.Webhook{}, err
+	}
+	if obj == nil {
+		return restapi.Webhook{}, storage.ErrNotFound
+	}
+
+	return utilities.Require[restapi.Webhook](obj), nil
+}
+
+func (driver *storageDriver) GetWebhooks() ([]restapi.Webhook, error) {
+	txn := driver.db.Txn(false)
+	defer txn.Abort()
+
+	iterator, err := txn.Get("webhooks", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]restapi.Webhook, 0)
+	for obj := iterator.Next(); obj != nil; obj = iterator.Next() {
+		webhooks = append(webhooks, utilities.Require[restapi.Webhook](obj))
+	}
+
+	return webhooks, nil
+}
+
+func (driver *storageDriver) DeleteWebhook(id string) error {
+	txn := driver.db.Txn(true)
+
+	count, err := txn.DeleteAll("webhooks", "id", id)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	if count == 0 {
+		txn.Abort()
+		return storage.ErrNotFound
+	}
+
+	txn.Commit()
+	return nil
+}
@@ -9,7 +9,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"sort"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -109,7 +109,7 @@ func (iterator *tableIterator[T]) Value() T {
 }
 
 const (
-	selectAgents = `SELECT id, state, hostname, address, version, pool_id, gpus, 
+	selectAgents = `SELECT id, state, hostname, address, version, pool_id, drain_state, drain_deadline, gpus, 
 			( SELECT ARRAY (
 				SELECT ( SELECT row(key, value) FROM key_values WHERE id = agent_labels.key_value_id ) FROM agent_labels WHERE agent_id = agents.id
 			) ) labels, 
@@ -117,14 +117,16 @@ const (
 				SELECT ( SELECT row(key, value) FROM key_values WHERE id = agent_taints.key_value_id ) FROM agent_taints WHERE agent_id = agents.id
 			) ) taints, 
 			( SELECT ARRAY (
-				SELECT row(id, state, address, version, pool_id, gpus) FROM sessions tab WHERE tab.agent_id = agents.id AND tab.state != 'closed'
+				SELECT row(id, state, address, version, pool_id, user_id, priority, reason, gpus, group_id) FROM sessions tab WHERE tab.agent_id = agents.id AND tab.state != 'closed'
 			) ) sessions
 		FROM agents`
-	selectSessions       = "SELECT id, state, address, version, pool_id, gpus FROM sessions"
-	selectQueuedSessions = "SELECT id, requirements FROM sessions WHERE state = 'queued'"
+	selectSessions       = "SELECT id, state, address, version, pool_id, user_id, priority, reason, gpus, group_id FROM sessions"
+	selectQueuedSessions = "SELECT id, user_id, reason, group_id, requirements FROM sessions WHERE state = 'queued'"
+	selectListedSessions = "SELECT id, state, address, version, pool_id, user_id, priority, reason, gpus, group_id, agent_id, created_at FROM sessions"
 
-	orderBy     = " ORDER BY created_at ASC"
-	offsetLimit = " OFFSET $1 LIMIT "
+	orderBy         = " ORDER BY created_at ASC"
+	orderByPriority = " ORDER BY priority DESC, created_at ASC"
+	offsetLimit     = " OFFSET $1 LIMIT "
 )
 
 func selectAgentsWhere(where string) string {
@@ -142,6 +144,7 @@ func selectAgentsIteratorWhere(where string, limit int) string {
 func unmarshalAgent(row sqlRow) (restapi.Agent, error) {
 	var gpus []byte
 	var labels, taints, sessions pq.ByteaArray
+	var drainDeadline sql.NullTime
 
 	agent := restapi.Agent{
 		Labels:   map[string]string{},
@@ -149,7 +152,7 @@ func unmarshalAgent(row sqlRow) (restapi.Agent, error) {
 		Sessions: make([]restapi.Session, 0),
 	}
 
-	err := row.Scan(&agent.Id, &agent.State, &agent.Hostname, &agent.Address, &agent.Version, &agent.PoolId, &gpus, &labels, &taints, &sessions)
+	err := row.Scan(&agent.Id, &agent.State, &agent.Hostname, &agent.Address, &agent.Version, &agent.PoolId, &agent.DrainState, &drainDeadline, &gpus, &labels, &taints, &sessions)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			err = storage.ErrNotFound
@@ -158,6 +161,10 @@ func unmarshalAgent(row sqlRow) (restapi.Agent, error) {
 		return restapi.Agent{}, err
 	}
 
+	if drainDeadline.Valid {
+		agent.DrainDeadline = &drainDeadline.Time
+	}
+
 	err = json.Unmarshal(gpus, &agent.Gpus)
 	if err != nil {
 		return restapi.Agent{}, err
@@ -204,9 +211,9 @@ func unmarshalSession(row sqlRow) (restapi.Session, error) {
 	var address []byte
 	var gpus []byte
 
-	var poolId sql.NullString
+	var poolId, userId, reason, groupId sql.NullString
 
-	err := row.Scan(&session.Id, &session.State, &address, &session.Version, &poolId, &gpus)
+	err := row.Scan(&session.Id, &session.State, &address, &session.Version, &poolId, &userId, &session.Priority, &reason, &gpus, &groupId)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -217,6 +224,9 @@ func unmarshalSession(row sqlRow) (restapi.Session, error) {
 	}
 
 	session.PoolId = poolId.String
+	session.UserId = userId.String
+	session.Reason = reason.String
+	session.GroupId = groupId.String
 
 	if address == nil {
 		session.Address = ""
@@ -236,23 +246,54 @@ func unmarshalSession(row sqlRow) (restapi.Session, error) {
 	return session, nil
 }
 
+// rowWithColumns scans the columns following those scanned from the row
+type rowWithColumns struct {
+	row     sqlRow
+	columns []any
+}
+
+func (row rowWithColumns) Scan(dest ...any) error {
+	return row.row.Scan(append(dest, row.columns...)...)
+}
+
+func unmarshalListedSession(row sqlRow) (restapi.ListedSession, error) {
+	var agentId sql.NullString
+	var created sql.NullTime
+
+	session, err := unmarshalSession(rowWithColumns{row, []any{&agentId, &created}})
+	if err != nil {
+		return restapi.ListedSession{}, err
+	}
+
+	return restapi.ListedSession{
+		Session: session,
+		AgentId: agentId.String,
+		Created: created.Time,
+	}, nil
+}
+
 func selectQueuedSessionsWhere(where string) string {
 	return fmt.Sprint(selectQueuedSessions, " AND ", where, orderBy)
 }
 
 func selectQueuedSessionsIteratorWhere(where string, limit int) string {
-	return fmt.Sprint(selectQueuedSessions, " AND ", where, orderBy, offsetLimit, limit)
+	return fmt.Sprint(selectQueuedSessions, " AND ", where, orderByPriority, offsetLimit, limit)
 }
 
 func unmarshalQueuedSession(row sqlRow) (storage.QueuedSession, error) {
 	session := storage.QueuedSession{}
 
+	var userId, reason, groupId sql.NullString
 	var requirements string
-	err := row.Scan(&session.Id, &requirements)
+	err := row.Scan(&session.Id, &userId, &reason, &groupId, &requirements)
 	if err != nil {
 		return storage.QueuedSession{}, err
 	}
 
+	session.UserId = userId.String
+	session.Reason = reason.String
+	session.GroupId = groupId.String
+
 	err = json.Unmarshal([]byte(requirements), &session.Requirements)
 	if err != nil {
 		return storage.QueuedSession{}, err
@@ -384,71 +425,9 @@ func (driver *storageDriver) AggregateData() (storage.AggregatedData, error) {
 			data.UtilizationByGpuName[key] = float64(value) / float64(data.Gpus)
 		}
 
-		calculatePercentiles := func(counts map[int]int, total int) storage.Percentile[int] {
-			if len(counts) > 0 {
-				sortedKeys := []int{}
-				for key := range counts {
-					sortedKeys = append(sortedKeys, key)
-				}
-				sort.Ints(sortedKeys)
-
-				indexP90 := int(float64(total) * 0.90)
-				indexP75 := int(float64(total) * 0.75)
-				indexP50 := int(float64(total) * 0.50)
-				indexP25 := int(float64(total) * 0.25)
-				indexP10 := int(float64(total) * 0.10)
-
-				percentile := storage.Percentile[int]{
-					P100: sortedKeys[len(sortedKeys)-1],
-				}
-
-				index := 0
-				keysIndex := 0
-				key := sortedKeys[keysIndex]
-				for keysIndex < len(sortedKeys) && index < indexP10 {
-					key = sortedKeys[keysIndex]
-					index += counts[key]
-					keysIndex++
-				}
-				percentile.P10 = key
-
-				for keysIndex < len(sortedKeys) && index < indexP25 {
-					key = sortedKeys[keysIndex]
-					index += counts[key]
-					keysIndex++
-				}
-				percentile.P25 = key
-
-				for keysIndex < len(sortedKeys) && index < indexP50 {
-					key = sortedKeys[keysIndex]
-					index += counts[key]
-					keysIndex++
-				}
-				percentile.P50 = key
-
-				for keysIndex < len(sortedKeys) && index < indexP75 {
-					key = sortedKeys[keysIndex]
-					index += counts[key]
-					keysIndex++
-				}
-				percentile.P75 = key
-
-				for keysIndex < len(sortedKeys) && index < indexP90 {
-					key = sortedKeys[keysIndex]
-					index += counts[key]
-					keysIndex++
-				}
-				percentile.P90 = key
-
-				return percentile
-			}
-
-			return storage.Percentile[int]{}
-		}
-
-		data.VramGBAvailable = calculatePercentiles(vramGBAvailable, data.Gpus)
+		data.VramGBAvailable = storage.CalculatePercentiles(vramGBAvailable, data.Gpus)
 		for key, gbAvailable := range vramGBAvailableByGpuName {
-			data.VramGBAvailableByGpuName[key] = calculatePercentiles(gbAvailable, data.GpusByGpuName[key])
+			data.VramGBAvailableByGpuName[key] = storage.CalculatePercentiles(gbAvailable, data.GpusByGpuName[key])
 		}
 	}
 
@@ -498,14 +477,23 @@ func (driver *storageDriver) RegisterAgent(agent restapi.Agent) (string, error)
 		}
 	}
 
-	for key, value := range agent.Taints {
-		_, err = tx.ExecContext(driver.ctx, "INSERT INTO key_values ("+
+	err = driver.insertAgentTaints(tx, id, agent.Taints)
+	if err != nil {
+		return "", errors.Join(err, tx.Rollback())
+	}
+
+	return id, tx.Commit()
+}
+
+func (driver *storageDriver) insertAgentTaints(tx *sql.Tx, id string, taints map[string]string) error {
+	for key, value := range taints {
+		_, err := tx.ExecContext(driver.ctx, "INSERT INTO key_values ("+
 			"key, value"+
 			") VALUES ("+
 			"$1, $2"+
 			") ON CONFLICT DO NOTHING", key, value)
 		if err != nil {
-			return "", errors.Join(err, tx.Rollback())
+			return err
 		}
 
 		_, err = tx.ExecContext(driver.ctx, "INSERT INTO agent_taints ("+
@@ -514,11 +502,11 @@ func (driver *storageDriver) RegisterAgent(agent restapi.Agent) (string, error)
 			"$1, (SELECT id FROM key_values WHERE key = $2 AND value = $3)"+
 			")", id, key, value)
 		if err != nil {
-			return "", errors.Join(err, tx.Rollback())
+			return err
 		}
 	}
 
-	return id, tx.Commit()
+	return nil
 }
 
 func (driver *storageDriver) GetAgentById(id string) (restapi.Agent, error) {
@@ -554,7 +542,15 @@ func (driver *storageDriver) UpdateAgent(update restapi.AgentUpdate) error {
 
 	for id, sessionUpdate := range update.SessionsUpdate {
 
-		_, err = tx.ExecContext(driver.ctx, "UPDATE sessions SET state = $1 WHERE id = $2", sessionUpdate.State, id)
+		var idleSince sql.NullTime
+		if sessionUpdate.IdleSince != nil {
+			idleSince = sql.NullTime{Time: sessionUpdate.IdleSince.UTC(), Valid: true}
+		}
+
+		_, err = tx.ExecContext(driver.ctx, `UPDATE sessions SET state = $1,
+			active_at = CASE WHEN $3 THEN COALESCE(active_at, now()) ELSE active_at END,
+			idle_since = $4
+			WHERE id = $2`, sessionUpdate.State, id, sessionUpdate.State == restapi.SessionActive, idleSince)
 		if err != nil {
 			return errors.Join(err, tx.Rollback())
 		}
@@ -570,6 +566,20 @@ func (driver *storageDriver) UpdateAgent(update restapi.AgentUpdate) error {
 				return errors.Join(err, tx.Rollback())
 			}
 		}
+
+		if sessionUpdate.State == restapi.SessionClosed {
+			err = driver.recordUsage(tx, "s.id = $1", id)
+			if err != nil {
+				return errors.Join(err, tx.Rollback())
+			}
+		}
+	}
+
+	if update.State == restapi.AgentClosed {
+		err = driver.recordUsage(tx, "s.agent_id = $1 AND s.state != 'closed'", update.Id)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
 	}
 
 	if update.State != "" {
@@ -585,6 +595,53 @@ func (driver *storageDriver) UpdateAgent(update restapi.AgentUpdate) error {
 	return tx.Commit()
 }
 
+func (driver *storageDriver) SetAgentDrainState(id string, drainState string, deadline *time.Time) error {
+	result, err := driver.db.ExecContext(driver.ctx, "UPDATE agents SET drain_state = $1, drain_deadline = $2 WHERE id = $3", drainState, deadline, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (driver *storageDriver) SetAgentTaints(id string, taints map[string]string) error {
+	tx, err := driver.db.BeginTx(driver.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// The agent is locked while its taints are replaced
+	var found int
+	err = tx.QueryRowContext(driver.ctx, "SELECT 1 FROM agents WHERE id = $1 FOR UPDATE", id).Scan(&found)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = storage.ErrNotFound
+		}
+
+		return errors.Join(err, tx.Rollback())
+	}
+
+	_, err = tx.ExecContext(driver.ctx, "DELETE FROM agent_taints WHERE agent_id = $1", id)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	err = driver.insertAgentTaints(tx, id, taints)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
 func NewNullString(s string) sql.NullString {
 	if len(s) == 0 {
 		return sql.NullString{}
@@ -595,27 +652,24 @@ func NewNullString(s string) sql.NullString {
 	}
 }
 
-func (driver *storageDriver) RequestSession(sessionRequirements restapi.SessionRequirements) (string, error) {
+// insertSession queues a session within the transaction, groupId is empty
+// unless the session is a member of a group
+func (driver *storageDriver) insertSession(tx *sql.Tx, sessionRequirements restapi.SessionRequirements, userId string, groupId string) (string, error) {
 	requirements, err := json.Marshal(sessionRequirements)
 	if err != nil {
 		return "", err
 	}
 
-	tx, err := driver.db.BeginTx(driver.ctx, nil)
-	if err != nil {
-		return "", errors.Join(err, tx.Rollback())
-	}
-
 	var id string
 	err = tx.QueryRowContext(driver.ctx, "INSERT INTO sessions ("+
-		"state, version, pool_id, requirements, vram_required, updated_at"+
+		"state, version, pool_id, user_id, requirements, vram_required, priority, group_id, updated_at"+
 		") VALUES ("+
-		"$1, $2, $3, $4, $5, $6, now()"+
+		"$1, $2, $3, $4, $5, $6, $7, $8, now()"+
 		") RETURNING id",
-		restapi.SessionQueued, sessionRequirements.Version, NewNullString(sessionRequirements.PoolId),
-		requirements, storage.TotalVramRequired(sessionRequirements)).Scan(&id)
+		restapi.SessionQueued, sessionRequirements.Version, NewNullString(sessionRequirements.PoolId), NewNullString(userId),
+		requirements, storage.TotalVramRequired(sessionRequirements), sessionRequirements.Priority, NewNullString(groupId)).Scan(&id)
 	if err != nil {
-		return "", errors.Join(err, tx.Rollback())
+		return "", err
 	}
 
 	for key, value := range sessionRequirements.MatchLabels {
@@ -625,7 +679,7 @@ func (driver *storageDriver) RequestSession(sessionRequirements restapi.SessionR
 			"$1, $2"+
 			") ON CONFLICT DO NOTHING", key, value)
 		if err != nil {
-			return "", errors.Join(err, tx.Rollback())
+			return "", err
 		}
 
 		_, err = tx.ExecContext(driver.ctx, "INSERT INTO session_match_labels ("+
@@ -634,7 +688,7 @@ func (driver *storageDriver) RequestSession(sessionRequirements restapi.SessionR
 			"$1, (SELECT id FROM key_values WHERE key = $2 AND value = $3)"+
 			")", id, key, value)
 		if err != nil {
-			return "", errors.Join(err, tx.Rollback())
+			return "", err
 		}
 	}
 
@@ -645,7 +699,7 @@ func (driver *storageDriver) RequestSession(sessionRequirements restapi.SessionR
 			"$1, $2"+
 			") ON CONFLICT DO NOTHING", key, value)
 		if err != nil {
-			return "", errors.Join(err, tx.Rollback())
+			return "", err
 		}
 
 		_, err = tx.ExecContext(driver.ctx, "INSERT INTO session_tolerates ("+
@@ -653,6 +707,43 @@ func (driver *storageDriver) RequestSession(sessionRequirements restapi.SessionR
 			") VALUES ("+
 			"$1, (SELECT id FROM key_values WHERE key = $2 AND value = $3)"+
 			")", id, key, value)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return id, nil
+}
+
+func (driver *storageDriver) RequestSession(sessionRequirements restapi.SessionRequirements, userId string) (string, error) {
+	tx, err := driver.db.BeginTx(driver.ctx, nil)
+	if err != nil {
+		return "", errors.Join(err, tx.Rollback())
+	}
+
+	id, err := driver.insertSession(tx, sessionRequirements, userId, "")
+	if err != nil {
+		return "", errors.Join(err, tx.Rollback())
+	}
+
+	return id, tx.Commit()
+}
+
+func (driver *storageDriver) RequestSessionGroup(requirements restapi.SessionGroupRequirements, userId string) (string, error) {
+	tx, err := driver.db.BeginTx(driver.ctx, nil)
+	if err != nil {
+		return "", errors.Join(err, tx.Rollback())
+	}
+
+	var id string
+	err = tx.QueryRowContext(driver.ctx, "INSERT INTO session_groups (pool_id, user_id, same_label) VALUES ($1, $2, $3) RETURNING id",
+		NewNullString(requirements.Session.PoolId), NewNullString(userId), NewNullString(requirements.Topology.SameLabel)).Scan(&id)
+	if err != nil {
+		return "", errors.Join(err, tx.Rollback())
+	}
+
+	for member := 0; member < requirements.Members; member++ {
+		_, err = driver.insertSession(tx, requirements.Session, userId, id)
 		if err != nil {
 			return "", errors.Join(err, tx.Rollback())
 		}
@@ -661,42 +752,130 @@ func (driver *storageDriver) RequestSession(sessionRequirements restapi.SessionR
 	return id, tx.Commit()
 }
 
-func (driver *storageDriver) AssignSession(sessionId string, agentId string, gpus []restapi.SessionGpu) error {
-	gpusData, err := json.Marshal(gpus)
+func (driver *storageDriver) GetSessionGroup(id string) (restapi.SessionGroup, error) {
+	group := restapi.SessionGroup{
+		Sessions: make([]restapi.Session, 0),
+	}
+
+	var poolId, userId, sameLabel sql.NullString
+	err := driver.db.QueryRowContext(driver.ctx, "SELECT id, pool_id, user_id, same_label FROM session_groups WHERE id = $1", id).
+		Scan(&group.Id, &poolId, &userId, &sameLabel)
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			err = storage.ErrNotFound
+		}
+
+		return restapi.SessionGroup{}, err
 	}
 
-	tx, err := driver.db.BeginTx(driver.ctx, nil)
+	group.PoolId = poolId.String
+	group.UserId = userId.String
+	group.Topology.SameLabel = sameLabel.String
+
+	rows, err := driver.db.QueryContext(driver.ctx, fmt.Sprint(selectSessions, " WHERE group_id = $1 ORDER BY id"), id)
 	if err != nil {
-		return errors.Join(err, tx.Rollback())
+		return restapi.SessionGroup{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		session, err := unmarshalSession(rows)
+		if err != nil {
+			return restapi.SessionGroup{}, err
+		}
+
+		group.Sessions = append(group.Sessions, session)
+	}
+
+	group.State = storage.SessionGroupState(group.Sessions)
+	return group, rows.Err()
+}
+
+// assignSession assigns the session to the agent within the transaction
+func (driver *storageDriver) assignSession(tx *sql.Tx, assignment storage.SessionAssignment) error {
+	gpusData, err := json.Marshal(assignment.Gpus)
+	if err != nil {
+		return err
 	}
 
 	_, err = tx.ExecContext(driver.ctx, `UPDATE agents SET vram_available = vram_available - (
 			SELECT vram_required FROM sessions WHERE id = $1
-		), updated_at = now() WHERE id = $2`, sessionId, agentId)
+		), updated_at = now() WHERE id = $2`, assignment.SessionId, assignment.AgentId)
 	if err != nil {
-		return errors.Join(err, tx.Rollback())
+		return err
 	}
 
 	_, err = tx.ExecContext(driver.ctx, `UPDATE sessions SET agent_id = $1, state = $2, address = (
 			SELECT address FROM agents WHERE id = $1
-		), gpus = $3, updated_at = now() WHERE id = $4`, agentId, restapi.SessionAssigned, gpusData, sessionId)
+		), gpus = $3, reason = NULL, assigned_at = now(), updated_at = now() WHERE id = $4`,
+		assignment.AgentId, restapi.SessionAssigned, gpusData, assignment.SessionId)
+	return err
+}
+
+func (driver *storageDriver) AssignSession(sessionId string, agentId string, gpus []restapi.SessionGpu) error {
+	return driver.AssignSessions([]storage.SessionAssignment{{
+		SessionId: sessionId,
+		AgentId:   agentId,
+		Gpus:      gpus,
+	}})
+}
+
+func (driver *storageDriver) AssignSessions(assignments []storage.SessionAssignment) error {
+	tx, err := driver.db.BeginTx(driver.ctx, nil)
 	if err != nil {
 		return errors.Join(err, tx.Rollback())
 	}
 
+	for _, assignment := range assignments {
+		err = driver.assignSession(tx, assignment)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+
 	return tx.Commit()
 }
 
 func (driver *storageDriver) CancelSession(sessionId string) error {
-	_, err := driver.db.ExecContext(driver.ctx, `UPDATE sessions s SET
+	tx, err := driver.db.BeginTx(driver.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(driver.ctx, `UPDATE sessions s SET
 		state = CASE WHEN s.agent_id IS NULL
 					THEN 'closed'::session_state
 					ELSE 'canceling'::session_state
 				END
 		WHERE s.id = $1`, sessionId)
-	return err
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	// Sessions which were not assigned are closed immediately
+	err = driver.recordUsage(tx, "s.id = $1 AND s.state = 'closed'", sessionId)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+func (driver *storageDriver) SetSessionReason(sessionId string, reason string) error {
+	result, err := driver.db.ExecContext(driver.ctx, "UPDATE sessions SET reason = $1 WHERE id = $2", NewNullString(reason), sessionId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
 }
 
 func (driver *storageDriver) GetSessionById(id string) (restapi.Session, error) {
@@ -721,109 +900,567 @@ func (driver *storageDriver) GetSessionById(id string) (restapi.Session, error)
 
 }
 
-func (driver *storageDriver) GetQueuedSessionById(id string) (storage.QueuedSession, error) {
-	return unmarshalQueuedSession(driver.db.QueryRowContext(driver.ctx, selectQueuedSessionsWhere("id = $1"), id))
-}
-
-func (driver *storageDriver) GetAgents(poolId string) (storage.Iterator[restapi.Agent], error) {
-	var statement *sql.Stmt
-	var err error
-
-	if poolId != "" {
-		statement, err = driver.db.PrepareContext(driver.ctx, selectAgentsIteratorWhere(fmt.Sprintf("pool_id = '%s' AND state = 'active'", poolId), 20))
-	} else {
-		statement, err = driver.db.PrepareContext(driver.ctx, selectAgentsIteratorWhere("state = 'active'", 20))
-	}
-
+func (driver *storageDriver) SetSessionPlacement(placement restapi.SessionPlacement) error {
+	data, err := json.Marshal(placement)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return newIterator(driver.ctx, statement, unmarshalAgent)
-}
-
-func (driver *storageDriver) GetAvailableAgentsMatching(totalAvailableVramAtLeast uint64) (storage.Iterator[restapi.Agent], error) {
-	statement, err := driver.db.PrepareContext(driver.ctx, selectAgentsIteratorWhere(
-		fmt.Sprint("state = 'active' AND vram_available >= ", totalAvailableVramAtLeast), 20))
+	result, err := driver.db.ExecContext(driver.ctx, "UPDATE sessions SET placement = $1 WHERE id = $2", data, placement.SessionId)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return newIterator(driver.ctx, statement, unmarshalAgent)
-}
-
-func (driver *storageDriver) GetQueuedSessionsIterator() (storage.Iterator[storage.QueuedSession], error) {
-	statement, err := driver.db.PrepareContext(driver.ctx, selectQueuedSessionsIteratorWhere("state = 'queued'", 20))
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if rowsAffected == 0 {
+		return storage.ErrNotFound
 	}
 
-	return newIterator(driver.ctx, statement, unmarshalQueuedSession)
-}
-
-func (driver *storageDriver) SetAgentsMissingIfNotUpdatedFor(duration time.Duration) error {
-	_, err := driver.db.ExecContext(driver.ctx, "UPDATE agents SET state = 'missing', updated_at = now() WHERE state = 'active' AND updated_at <= now()-make_interval(secs=>$1)", duration.Seconds())
-	return err
-}
-
-func (driver *storageDriver) RemoveMissingAgentsIfNotUpdatedFor(duration time.Duration) error {
-	_, err := driver.db.ExecContext(driver.ctx, "DELETE FROM agents WHERE state = 'missing' AND updated_at <= now()-make_interval(secs=>$1)", duration.Seconds())
-	return err
-}
-
-func (driver *storageDriver) DeletePool(id string) error {
-	_, err := driver.db.ExecContext(driver.ctx, "DELETE FROM pools WHERE id = $1", id)
-	return err
+	return nil
 }
 
-func (driver *storageDriver) GetPool(id string) (restapi.Pool, error) {
-	row := driver.db.QueryRowContext(driver.ctx, "SELECT id, pool_name FROM pools WHERE id = $1", id)
-	var pool restapi.Pool
-	err := row.Scan(&pool.Id, &pool.Name)
+func (driver *storageDriver) GetSessionPlacement(sessionId string) (restapi.SessionPlacement, error) {
+	var data sql.NullString
+	err := driver.db.QueryRowContext(driver.ctx, "SELECT placement FROM sessions WHERE id = $1", sessionId).Scan(&data)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			err = storage.ErrNotFound
 		}
-		return restapi.Pool{}, err
-	}
-	return pool, nil
-}
 
-func (driver *storageDriver) CreatePool(name string) (restapi.Pool, error) {
-	tx, err := driver.db.BeginTx(driver.ctx, nil)
-	if err != nil {
-		return restapi.Pool{}, err
+		return restapi.SessionPlacement{}, err
 	}
 
-	var pool restapi.Pool
-	err = tx.QueryRowContext(driver.ctx, "INSERT INTO pools (pool_name) VALUES ($1) RETURNING id", name).Scan(&pool.Id)
-	if err != nil {
-		return restapi.Pool{}, errors.Join(err, tx.Rollback())
+	if !data.Valid {
+		return restapi.SessionPlacement{}, storage.ErrNotFound
 	}
 
-	pool.Name = name
-	err = tx.Commit()
-	if err != nil {
-		return restapi.Pool{}, err
-	}
-	return pool, nil
+	var placement restapi.SessionPlacement
+	err = json.Unmarshal([]byte(data.String), &placement)
+	return placement, err
 }
 
-func (driver *storageDriver) AddPermission(poolId string, userId string, permission restapi.Permission) error {
-	tx, err := driver.db.BeginTx(driver.ctx, nil)
+func (driver *storageDriver) RenewSessionLease(id string, expires time.Time) error {
+	result, err := driver.db.ExecContext(driver.ctx, "UPDATE sessions SET lease_expires_at = $1 WHERE id = $2", expires.UTC(), id)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.ExecContext(driver.ctx, "INSERT INTO permissions (user_id, pool_id, permission) VALUES ($1, $2, $3)", userId, poolId, permission)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return errors.Join(err, tx.Rollback())
+		return err
+	}
+	if rowsAffected == 0 {
+		return storage.ErrNotFound
 	}
 
-	return tx.Commit()
+	return nil
 }
 
-func (driver *storageDriver) RemovePermission(poolId string, userId string, permission restapi.Permission) error {
+func (driver *storageDriver) GetSessionsWithExpiredLease(now time.Time) ([]restapi.Session, error) {
+	rows, err := driver.db.QueryContext(driver.ctx,
+		selectSessionsWhere("state IN ('queued', 'assigned', 'active') AND lease_expires_at < $1"), now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]restapi.Session, 0)
+	for rows.Next() {
+		session, err := unmarshalSession(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (driver *storageDriver) GetQueuedSessionById(id string) (storage.QueuedSession, error) {
+	return unmarshalQueuedSession(driver.db.QueryRowContext(driver.ctx, selectQueuedSessionsWhere("id = $1"), id))
+}
+
+// agentFilterWhere returns the condition selecting the agents matching the
+// filter past the cursor along with its arguments
+func agentFilterWhere(filter storage.AgentFilter, cursor string) (string, []any, error) {
+	conditions := []string{}
+	args := []any{}
+
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprint("$", len(args))
+	}
+
+	if filter.State != "" {
+		conditions = append(conditions, "state = "+arg(filter.State))
+	}
+
+	if filter.PoolId != "" {
+		conditions = append(conditions, "pool_id = "+arg(filter.PoolId))
+	}
+
+	if filter.PoolIds != nil {
+		conditions = append(conditions, fmt.Sprint("pool_id = ANY(", arg(pq.Array(filter.PoolIds)), "::uuid[])"))
+	}
+
+	for key, value := range filter.Selector {
+		conditions = append(conditions, fmt.Sprint(`EXISTS (
+			SELECT 1 FROM agent_labels JOIN key_values ON key_values.id = agent_labels.key_value_id
+			WHERE agent_labels.agent_id = agents.id AND key_values.key = `, arg(key), " AND key_values.value = ", arg(value), ")"))
+	}
+
+	if filter.GpuName != "" {
+		gpus, err := json.Marshal([]map[string]string{{"name": filter.GpuName}})
+		if err != nil {
+			return "", nil, err
+		}
+
+		conditions = append(conditions, fmt.Sprint("gpus @> ", arg(string(gpus)), "::jsonb"))
+	}
+
+	if filter.MinVramAvailable > 0 {
+		conditions = append(conditions, "vram_available >= "+arg(filter.MinVramAvailable))
+	}
+
+	if cursor != "" {
+		conditions = append(conditions, "id > "+arg(cursor))
+	}
+
+	if len(conditions) == 0 {
+		return "TRUE", args, nil
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+func (driver *storageDriver) ListAgents(filter storage.AgentFilter, page storage.Page) ([]restapi.Agent, string, error) {
+	where, args, err := agentFilterWhere(filter, page.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	size := page.Size()
+
+	// One more agent than the page holds is selected to determine whether another page follows
+	rows, err := driver.db.QueryContext(driver.ctx, fmt.Sprint(selectAgents, " WHERE ", where, " ORDER BY id ASC LIMIT ", size+1), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	agents := make([]restapi.Agent, 0)
+	for rows.Next() {
+		agent, err := unmarshalAgent(rows)
+		if err != nil {
+			return nil, "", err
+		}
+
+		agents = append(agents, agent)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(agents) > size {
+		return agents[:size], agents[size-1].Id, nil
+	}
+
+	return agents, "", nil
+}
+
+// sessionFilterWhere returns the condition selecting the sessions matching the
+// filter past the cursor along with its arguments
+func sessionFilterWhere(filter storage.SessionFilter, cursor string) (string, []any) {
+	conditions := []string{}
+	args := []any{}
+
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprint("$", len(args))
+	}
+
+	if filter.State != "" {
+		conditions = append(conditions, "state = "+arg(filter.State))
+	}
+
+	if filter.PoolId != "" {
+		conditions = append(conditions, "pool_id = "+arg(filter.PoolId))
+	}
+
+	if filter.AgentId != "" {
+		conditions = append(conditions, "agent_id = "+arg(filter.AgentId))
+	}
+
+	if filter.Version != "" {
+		conditions = append(conditions, "version = "+arg(filter.Version))
+	}
+
+	if filter.PoolIds != nil {
+		conditions = append(conditions, fmt.Sprint("pool_id = ANY(", arg(pq.Array(filter.PoolIds)), "::uuid[])"))
+	}
+
+	if !filter.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(filter.CreatedAfter))
+	}
+
+	if !filter.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(filter.CreatedBefore))
+	}
+
+	if cursor != "" {
+		conditions = append(conditions, "id > "+arg(cursor))
+	}
+
+	if len(conditions) == 0 {
+		return "TRUE", args
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+func (driver *storageDriver) ListSessions(filter storage.SessionFilter, page storage.Page) ([]restapi.ListedSession, string, error) {
+	where, args := sessionFilterWhere(filter, page.Cursor)
+
+	size := page.Size()
+
+	// One more session than the page holds is selected to determine whether another page follows
+	rows, err := driver.db.QueryContext(driver.ctx, fmt.Sprint(selectListedSessions, " WHERE ", where, " ORDER BY id ASC LIMIT ", size+1), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	sessions := make([]restapi.ListedSession, 0)
+	for rows.Next() {
+		session, err := unmarshalListedSession(rows)
+		if err != nil {
+			return nil, "", err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(sessions) > size {
+		return sessions[:size], sessions[size-1].Id, nil
+	}
+
+	return sessions, "", nil
+}
+
+func (driver *storageDriver) GetAvailableAgentsMatching(totalAvailableVramAtLeast uint64) (storage.Iterator[restapi.Agent], error) {
+	statement, err := driver.db.PrepareContext(driver.ctx, selectAgentsIteratorWhere(
+		fmt.Sprint("state = 'active' AND vram_available >= ", totalAvailableVramAtLeast), 20))
+	if err != nil {
+		return nil, err
+	}
+
+	return newIterator(driver.ctx, statement, unmarshalAgent)
+}
+
+func (driver *storageDriver) GetQueuedSessionsIterator() (storage.Iterator[storage.QueuedSession], error) {
+	statement, err := driver.db.PrepareContext(driver.ctx, selectQueuedSessionsIteratorWhere("state = 'queued'", 20))
+	if err != nil {
+		return nil, err
+	}
+
+	return newIterator(driver.ctx, statement, unmarshalQueuedSession)
+}
+
+// Returns the agents from the rows of id and pool_id, only the Id, PoolId and State are populated
+func (driver *storageDriver) GetDrainingAgents() ([]restapi.Agent, error) {
+	rows, err := driver.db.QueryContext(driver.ctx, selectAgentsWhere("state = 'active' AND drain_state = 'draining'"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	agents := make([]restapi.Agent, 0)
+	for rows.Next() {
+		agent, err := unmarshalAgent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		agents = append(agents, agent)
+	}
+
+	return agents, rows.Err()
+}
+
+func agentsFromRows(rows *sql.Rows, state string) ([]restapi.Agent, error) {
+	defer rows.Close()
+
+	agents := make([]restapi.Agent, 0)
+	for rows.Next() {
+		var poolId sql.NullString
+		agent := restapi.Agent{
+			State: state,
+		}
+
+		err := rows.Scan(&agent.Id, &poolId)
+		if err != nil {
+			return nil, err
+		}
+
+		agent.PoolId = poolId.String
+		agents = append(agents, agent)
+	}
+
+	return agents, rows.Err()
+}
+
+func (driver *storageDriver) SetAgentsMissingIfNotUpdatedFor(duration time.Duration) ([]restapi.Agent, error) {
+	rows, err := driver.db.QueryContext(driver.ctx, "UPDATE agents SET state = 'missing', updated_at = now() WHERE state = 'active' AND updated_at <= now()-make_interval(secs=>$1) RETURNING id, pool_id", duration.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	return agentsFromRows(rows, restapi.AgentMissing)
+}
+
+func (driver *storageDriver) RemoveMissingAgentsIfNotUpdatedFor(duration time.Duration) ([]restapi.Agent, error) {
+	tx, err := driver.db.BeginTx(driver.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sessions of the agents are removed along with them
+	err = driver.recordUsage(tx, `s.state != 'closed' AND s.agent_id IN (
+			SELECT id FROM agents WHERE state = 'missing' AND updated_at <= now()-make_interval(secs=>$1)
+		)`, duration.Seconds())
+	if err != nil {
+		return nil, errors.Join(err, tx.Rollback())
+	}
+
+	rows, err := tx.QueryContext(driver.ctx, "DELETE FROM agents WHERE state = 'missing' AND updated_at <= now()-make_interval(secs=>$1) RETURNING id, pool_id", duration.Seconds())
+	if err != nil {
+		return nil, errors.Join(err, tx.Rollback())
+	}
+
+	agents, err := agentsFromRows(rows, restapi.AgentClosed)
+	if err != nil {
+		return nil, errors.Join(err, tx.Rollback())
+	}
+
+	return agents, tx.Commit()
+}
+
+// recordUsage adds the usage records of the sessions matching the condition,
+// the sessions already recorded are left unchanged
+func (driver *storageDriver) recordUsage(tx *sql.Tx, where string, args ...any) error {
+	rows, err := tx.QueryContext(driver.ctx, `SELECT s.id, s.state, s.address, s.version, s.pool_id, s.user_id, s.priority, s.reason, s.gpus, s.group_id,
+			s.agent_id, COALESCE(a.gpus, '[]'), s.created_at, s.assigned_at, s.active_at, now()::timestamp,
+			COALESCE((
+				SELECT json_agg(json_build_object('id', c.id, 'pid', c.pid::text, 'processName', c.process_name, 'exitCode', COALESCE(c.exit_code, 0)))
+				FROM connections c WHERE c.session_id = s.id
+			), '[]')
+		FROM sessions s LEFT JOIN agents a ON a.id = s.agent_id WHERE `+where, args...)
+	if err != nil {
+		return err
+	}
+
+	records := make([]restapi.UsageRecord, 0)
+	for rows.Next() {
+		var agentId sql.NullString
+		var agentGpus, connections []byte
+		var queued, closed time.Time
+		var assigned, active sql.NullTime
+
+		session, err := unmarshalSession(rowWithColumns{rows, []any{&agentId, &agentGpus, &queued, &assigned, &active, &closed, &connections}})
+		if err != nil {
+			return errors.Join(err, rows.Close())
+		}
+
+		var gpus []restapi.Gpu
+		err = json.Unmarshal(agentGpus, &gpus)
+		if err == nil {
+			err = json.Unmarshal(connections, &session.Connections)
+		}
+
+		if err != nil {
+			return errors.Join(err, rows.Close())
+		}
+
+		var assignedAt, activeAt *time.Time
+		if assigned.Valid {
+			assignedAt = &assigned.Time
+		}
+		if active.Valid {
+			activeAt = &active.Time
+		}
+
+		records = append(records, storage.NewUsageRecord(session, agentId.String, gpus, queued, assignedAt, activeAt, closed))
+	}
+
+	err = errors.Join(rows.Err(), rows.Close())
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		gpus, err := json.Marshal(record.Gpus)
+		if err != nil {
+			return err
+		}
+
+		connections, err := json.Marshal(record.Connections)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(driver.ctx, `INSERT INTO usage (
+			session_id, pool_id, user_id, agent_id, gpus, vram, connections, queued_at, assigned_at, active_at, closed_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+		) ON CONFLICT (session_id) DO NOTHING`,
+			record.SessionId, NewNullString(record.PoolId), NewNullString(record.UserId), NewNullString(record.AgentId),
+			gpus, record.Vram, connections, record.QueuedAt, record.AssignedAt, record.ActiveAt, record.ClosedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (driver *storageDriver) GetUsageRecords(filter storage.UsageFilter) ([]restapi.UsageRecord, error) {
+	conditions := []string{"TRUE"}
+	args := []any{}
+
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprint("$", len(args))
+	}
+
+	if filter.PoolId != "" {
+		conditions = append(conditions, "pool_id = "+arg(filter.PoolId))
+	}
+
+	if filter.UserId != "" {
+		conditions = append(conditions, "user_id = "+arg(filter.UserId))
+	}
+
+	if filter.PoolIds != nil {
+		conditions = append(conditions, fmt.Sprint("pool_id = ANY(", arg(pq.Array(filter.PoolIds)), "::uuid[])"))
+	}
+
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "closed_at >= "+arg(filter.From))
+	}
+
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "queued_at < "+arg(filter.To))
+	}
+
+	rows, err := driver.db.QueryContext(driver.ctx, `SELECT
+			session_id, pool_id, user_id, agent_id, gpus, vram, connections, queued_at, assigned_at, active_at, closed_at
+		FROM usage WHERE `+strings.Join(conditions, " AND ")+" ORDER BY closed_at ASC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]restapi.UsageRecord, 0)
+	for rows.Next() {
+		var record restapi.UsageRecord
+		var poolId, userId, agentId sql.NullString
+		var gpus, connections []byte
+		var assigned, active sql.NullTime
+
+		err = rows.Scan(&record.SessionId, &poolId, &userId, &agentId, &gpus, &record.Vram, &connections,
+			&record.QueuedAt, &assigned, &active, &record.ClosedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		record.PoolId = poolId.String
+		record.UserId = userId.String
+		record.AgentId = agentId.String
+
+		if assigned.Valid {
+			record.AssignedAt = &assigned.Time
+		}
+		if active.Valid {
+			record.ActiveAt = &active.Time
+		}
+
+		err = json.Unmarshal(gpus, &record.Gpus)
+		if err == nil {
+			err = json.Unmarshal(connections, &record.Connections)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+func (driver *storageDriver) DeletePool(id string) error {
+	_, err := driver.db.ExecContext(driver.ctx, "DELETE FROM pools WHERE id = $1", id)
+	return err
+}
+
+func (driver *storageDriver) GetPool(id string) (restapi.Pool, error) {
+	row := driver.db.QueryRowContext(driver.ctx, "SELECT id, pool_name FROM pools WHERE id = $1", id)
+	var pool restapi.Pool
+	err := row.Scan(&pool.Id, &pool.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = storage.ErrNotFound
+		}
+		return restapi.Pool{}, err
+	}
+	return pool, nil
+}
+
+func (driver *storageDriver) CreatePool(name string) (restapi.Pool, error) {
+	tx, err := driver.db.BeginTx(driver.ctx, nil)
+	if err != nil {
+		return restapi.Pool{}, err
+	}
+
+	var pool restapi.Pool
+	err = tx.QueryRowContext(driver.ctx, "INSERT INTO pools (pool_name) VALUES ($1) RETURNING id", name).Scan(&pool.Id)
+	if err != nil {
+		return restapi.Pool{}, errors.Join(err, tx.Rollback())
+	}
+
+	pool.Name = name
+	err = tx.Commit()
+	if err != nil {
+		return restapi.Pool{}, err
+	}
+	return pool, nil
+}
+
+func (driver *storageDriver) AddPermission(poolId string, userId string, permission restapi.Permission) error {
+	tx, err := driver.db.BeginTx(driver.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(driver.ctx, "INSERT INTO permissions (user_id, pool_id, permission) VALUES ($1, $2, $3)", userId, poolId, permission)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+func (driver *storageDriver) RemovePermission(poolId string, userId string, permission restapi.Permission) error {
 	tx, err := driver.db.BeginTx(driver.ctx, nil)
 	if err != nil {
 		return err
@@ -934,3 +1571,307 @@ func (driver *storageDriver) GetPoolPermissions(poolId string) (restapi.PoolPerm
 	return result, nil
 
 }
+
+func (driver *storageDriver) SetQuota(poolId string, userId string, limits restapi.QuotaLimits) error {
+	_, err := driver.db.ExecContext(driver.ctx, `
+	INSERT INTO quotas (pool_id, user_id, max_sessions, max_vram, max_gpus)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (pool_id, user_id)
+	DO UPDATE SET max_sessions = $3, max_vram = $4, max_gpus = $5`,
+		poolId, userId, limits.MaxSessions, limits.MaxVram, limits.MaxGpus)
+	return err
+}
+
+func (driver *storageDriver) RemoveQuota(poolId string, userId string) error {
+	_, err := driver.db.ExecContext(driver.ctx, "DELETE FROM quotas WHERE pool_id = $1 AND user_id = $2", poolId, userId)
+	return err
+}
+
+func (driver *storageDriver) GetPoolQuota(poolId string) (restapi.PoolQuota, error) {
+	rows, err := driver.db.QueryContext(driver.ctx, "SELECT user_id, max_sessions, max_vram, max_gpus FROM quotas WHERE pool_id = $1", poolId)
+	if err != nil {
+		return restapi.PoolQuota{}, err
+	}
+	defer rows.Close()
+
+	quota := restapi.PoolQuota{
+		PoolId: poolId,
+		Users:  map[string]restapi.QuotaLimits{},
+	}
+
+	for rows.Next() {
+		var userId string
+		var limits restapi.QuotaLimits
+		err := rows.Scan(&userId, &limits.MaxSessions, &limits.MaxVram, &limits.MaxGpus)
+		if err != nil {
+			return restapi.PoolQuota{}, err
+		}
+
+		if userId == "" {
+			quota.Pool = limits
+		} else {
+			quota.Users[userId] = limits
+		}
+	}
+
+	return quota, nil
+}
+
+func (driver *storageDriver) SetSessionDefaults(poolId string, defaults restapi.SessionTimeouts) error {
+	_, err := driver.db.ExecContext(driver.ctx, `
+	INSERT INTO session_defaults (pool_id, max_duration, idle_timeout)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (pool_id)
+	DO UPDATE SET max_duration = $2, idle_timeout = $3`,
+		poolId, defaults.MaxDuration, defaults.IdleTimeout)
+	return err
+}
+
+func (driver *storageDriver) GetSessionDefaults(poolId string) (restapi.SessionTimeouts, error) {
+	var defaults restapi.SessionTimeouts
+	err := driver.db.QueryRowContext(driver.ctx, "SELECT max_duration, idle_timeout FROM session_defaults WHERE pool_id = $1", poolId).
+		Scan(&defaults.MaxDuration, &defaults.IdleTimeout)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+
+	return defaults, err
+}
+
+func (driver *storageDriver) GetOpenSessions() ([]storage.OpenSession, error) {
+	rows, err := driver.db.QueryContext(driver.ctx, `SELECT s.id, s.state, s.address, s.version, s.pool_id, s.user_id, s.priority, s.reason, s.gpus, s.group_id,
+			s.agent_id, s.requirements, COALESCE(s.assigned_at, s.created_at), s.idle_since
+		FROM sessions s WHERE s.state IN ('assigned', 'active')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]storage.OpenSession, 0)
+	for rows.Next() {
+		var openSession storage.OpenSession
+		var agentId sql.NullString
+		var requirements []byte
+		var idleSince sql.NullTime
+
+		openSession.Session, err = unmarshalSession(rowWithColumns{rows, []any{&agentId, &requirements, &openSession.Assigned, &idleSince}})
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(requirements, &openSession.Requirements)
+		if err != nil {
+			return nil, err
+		}
+
+		openSession.AgentId = agentId.String
+		if idleSince.Valid {
+			openSession.IdleSince = &idleSince.Time
+		}
+
+		sessions = append(sessions, openSession)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (driver *storageDriver) GetQuotaUsage(poolId string, userId string) (storage.QuotaUsage, error) {
+	query := `SELECT COUNT(*), COALESCE(SUM(vram_required), 0), COALESCE(SUM(jsonb_array_length(gpus)), 0)
+		FROM sessions WHERE pool_id = $1 AND state IN ('assigned', 'active', 'canceling')`
+	args := []any{poolId}
+
+	if userId != "" {
+		query += " AND user_id = $2"
+		args = append(args, userId)
+	}
+
+	var usage storage.QuotaUsage
+	err := driver.db.QueryRowContext(driver.ctx, query, args...).Scan(&usage.Sessions, &usage.Vram, &usage.Gpus)
+	if err != nil {
+		return storage.QuotaUsage{}, err
+	}
+
+	return usage, nil
+}
+
+func unmarshalReservation(row sqlRow) (restapi.Reservation, error) {
+	var reservation restapi.Reservation
+	var userId sql.NullString
+	var gpus []byte
+
+	err := row.Scan(&reservation.Id, &reservation.PoolId, &userId, &gpus, &reservation.Start, &reservation.End)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = storage.ErrNotFound
+		}
+
+		return restapi.Reservation{}, err
+	}
+
+	reservation.UserId = userId.String
+
+	err = json.Unmarshal(gpus, &reservation.Gpus)
+	if err != nil {
+		return restapi.Reservation{}, err
+	}
+
+	return reservation, nil
+}
+
+func (driver *storageDriver) CreateReservation(reservation restapi.Reservation) (restapi.Reservation, error) {
+	gpus, err := json.Marshal(reservation.Gpus)
+	if err != nil {
+		return restapi.Reservation{}, err
+	}
+
+	reservation.Start = reservation.Start.UTC()
+	reservation.End = reservation.End.UTC()
+
+	err = driver.db.QueryRowContext(driver.ctx, "INSERT INTO reservations (pool_id, user_id, gpus, start_at, end_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		reservation.PoolId, NewNullString(reservation.UserId), gpus, reservation.Start, reservation.End).Scan(&reservation.Id)
+	if err != nil {
+		return restapi.Reservation{}, err
+	}
+
+	return reservation, nil
+}
+
+func (driver *storageDriver) GetReservationById(id string) (restapi.Reservation, error) {
+	return unmarshalReservation(driver.db.QueryRowContext(driver.ctx,
+		"SELECT id, pool_id, user_id, gpus, start_at, end_at FROM reservations WHERE id = $1", id))
+}
+
+func (driver *storageDriver) GetReservations(filter storage.ReservationFilter) ([]restapi.Reservation, error) {
+	conditions := []string{"TRUE"}
+	args := []any{}
+
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprint("$", len(args))
+	}
+
+	if filter.PoolId != "" {
+		conditions = append(conditions, "pool_id = "+arg(filter.PoolId))
+	}
+
+	if filter.PoolIds != nil {
+		conditions = append(conditions, fmt.Sprint("pool_id = ANY(", arg(pq.Array(filter.PoolIds)), "::uuid[])"))
+	}
+
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "end_at > "+arg(filter.From.UTC()))
+	}
+
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "start_at < "+arg(filter.To.UTC()))
+	}
+
+	rows, err := driver.db.QueryContext(driver.ctx, `SELECT id, pool_id, user_id, gpus, start_at, end_at
+		FROM reservations WHERE `+strings.Join(conditions, " AND ")+" ORDER BY start_at ASC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := make([]restapi.Reservation, 0)
+	for rows.Next() {
+		reservation, err := unmarshalReservation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		reservations = append(reservations, reservation)
+	}
+
+	return reservations, rows.Err()
+}
+
+func (driver *storageDriver) DeleteReservation(id string) error {
+	result, err := driver.db.ExecContext(driver.ctx, "DELETE FROM reservations WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err == nil && count == 0 {
+		err = storage.ErrNotFound
+	}
+
+	return err
+}
+
+func unmarshalWebhook(row sqlRow) (restapi.Webhook, error) {
+	var webhook restapi.Webhook
+	var poolId sql.NullString
+
+	err := row.Scan(&webhook.Id, &webhook.Url, &webhook.Secret, &poolId, pq.Array(&webhook.Events))
+	if err != nil {
+		return restapi.Webhook{}, err
+	}
+
+	webhook.PoolId = poolId.String
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+
+	return webhook, nil
+}
+
+func (driver *storageDriver) CreateWebhook(webhook restapi.Webhook) (restapi.Webhook, error) {
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+
+	err := driver.db.QueryRowContext(driver.ctx, "INSERT INTO webhooks (url, secret, pool_id, events) VALUES ($1, $2, $3, $4) RETURNING id",
+		webhook.Url, webhook.Secret, NewNullString(webhook.PoolId), pq.Array(webhook.Events)).Scan(&webhook.Id)
+	if err != nil {
+		return restapi.Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+func (driver *storageDriver) GetWebhookById(id string) (restapi.Webhook, error) {
+	row := driver.db.QueryRowContext(driver.ctx, "SELECT id, url, secret, pool_id, events FROM webhooks WHERE id = $1", id)
+
+	webhook, err := unmarshalWebhook(row)
+	if err == sql.ErrNoRows {
+		err = storage.ErrNotFound
+	}
+
+	return webhook, err
+}
+
+func (driver *storageDriver) GetWebhooks() ([]restapi.Webhook, error) {
+	rows, err := driver.db.QueryContext(driver.ctx, "SELECT id, url, secret, pool_id, events FROM webhooks ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]restapi.Webhook, 0)
+	for rows.Next() {
+		webhook, err := unmarshalWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (driver *storageDriver) DeleteWebhook(id string) error {
+	result, err := driver.db.ExecContext(driver.ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err == nil && count == 0 {
+		err = storage.ErrNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,6 @@
+-- The time the lease held by the client of a session expires, NULL until the
+-- client first renews the lease
+ALTER TABLE sessions
+ADD COLUMN lease_expires_at timestamp;
+
+create index on sessions (lease_expires_at) WHERE lease_expires_at IS NOT NULL;
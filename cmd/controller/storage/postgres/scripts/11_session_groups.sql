@@ -0,0 +1,16 @@
+-- Groups of sessions scheduled together, either every member of a group is
+-- assigned or none are
+CREATE TABLE session_groups (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    pool_id uuid,
+    user_id text,
+    same_label text,
+    created_at timestamp DEFAULT now(),
+    FOREIGN KEY (pool_id) REFERENCES pools(id) ON DELETE CASCADE
+);
+
+-- The group a session is a member of, NULL for sessions requested alone
+ALTER TABLE sessions
+ADD COLUMN group_id uuid REFERENCES session_groups(id) ON DELETE CASCADE;
+
+create index on sessions (group_id) WHERE group_id IS NOT NULL;
@@ -0,0 +1,13 @@
+-- GPUs of a pool reserved for a window of time
+CREATE TABLE reservations (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    pool_id uuid NOT NULL,
+    user_id text,
+    gpus jsonb NOT NULL,
+    start_at timestamp NOT NULL,
+    end_at timestamp NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now(),
+    FOREIGN KEY (pool_id) REFERENCES pools(id) ON DELETE CASCADE
+);
+
+create index on reservations (pool_id, end_at);
@@ -0,0 +1,4 @@
+-- The agents scored when a session was assigned, NULL until the session is
+-- assigned
+ALTER TABLE sessions
+ADD COLUMN placement jsonb;
@@ -0,0 +1,5 @@
+-- Sessions with a higher priority are scheduled first
+ALTER TABLE sessions
+ADD COLUMN priority INT NOT NULL DEFAULT 0;
+
+create index on sessions (state, priority, created_at);
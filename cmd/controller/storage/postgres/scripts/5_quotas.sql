@@ -0,0 +1,16 @@
+-- Limits on the resources consumed by the sessions of a pool, or of a user within a pool
+CREATE TABLE quotas (
+    pool_id uuid NOT NULL,
+    user_id text NOT NULL DEFAULT '',
+    max_sessions int NOT NULL DEFAULT 0,
+    max_vram bigint NOT NULL DEFAULT 0,
+    max_gpus int NOT NULL DEFAULT 0,
+    PRIMARY KEY (pool_id, user_id),
+    FOREIGN KEY (pool_id) REFERENCES pools(id) ON DELETE CASCADE
+);
+
+ALTER TABLE sessions
+ADD COLUMN user_id text,
+ADD COLUMN reason text;
+
+create index on sessions (pool_id, user_id, state);
@@ -0,0 +1,10 @@
+-- Subscriptions to the events of the controller, a null pool_id receives the events of every pool
+CREATE TABLE webhooks (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    url text NOT NULL,
+    secret text NOT NULL DEFAULT '',
+    pool_id uuid,
+    events text[] NOT NULL DEFAULT '{}',
+    created_at timestamp NOT NULL DEFAULT now(),
+    FOREIGN KEY (pool_id) REFERENCES pools(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+-- Cordoned, draining and drained agents are not assigned new sessions
+ALTER TABLE agents
+ADD COLUMN drain_state text NOT NULL DEFAULT 'schedulable',
+ADD COLUMN drain_deadline timestamp;
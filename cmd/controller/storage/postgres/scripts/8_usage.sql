@@ -0,0 +1,23 @@
+-- The times sessions were assigned to an agent and became active
+ALTER TABLE sessions
+ADD COLUMN assigned_at timestamp,
+ADD COLUMN active_at timestamp;
+
+-- The immutable records of closed sessions, kept once the sessions, agents and
+-- pools they refer to have been removed
+CREATE TABLE usage (
+    session_id uuid PRIMARY KEY,
+    pool_id uuid,
+    user_id text,
+    agent_id uuid,
+    gpus jsonb NOT NULL,
+    vram bigint NOT NULL,
+    connections jsonb NOT NULL,
+    queued_at timestamp NOT NULL,
+    assigned_at timestamp,
+    active_at timestamp,
+    closed_at timestamp NOT NULL
+);
+
+create index on usage (closed_at);
+create index on usage (pool_id, closed_at);
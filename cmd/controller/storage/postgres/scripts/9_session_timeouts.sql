@@ -0,0 +1,12 @@
+-- The time a session became idle as reported by its agent, NULL while the
+-- session has active connections
+ALTER TABLE sessions
+ADD COLUMN idle_since timestamp;
+
+-- The timeouts applied to the sessions of a pool not requesting their own
+CREATE TABLE session_defaults (
+    pool_id uuid PRIMARY KEY,
+    max_duration bigint NOT NULL DEFAULT 0,
+    idle_timeout bigint NOT NULL DEFAULT 0,
+    FOREIGN KEY (pool_id) REFERENCES pools(id) ON DELETE CASCADE
+);
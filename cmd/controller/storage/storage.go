@@ -5,6 +5,7 @@ package storage
 
 import (
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
@@ -40,9 +41,118 @@ type AggregatedData struct {
 
 type QueuedSession struct {
 	Id           string
+	UserId       string
+	Reason       string
+	GroupId      string // Empty unless the session is a member of a group
 	Requirements restapi.SessionRequirements
 }
 
+// The agent and GPUs chosen for a queued session
+type SessionAssignment struct {
+	SessionId string
+	AgentId   string
+	Gpus      []restapi.SessionGpu
+}
+
+// The resources consumed by the sessions assigned to agents
+type QuotaUsage struct {
+	Sessions int
+	Vram     uint64
+	Gpus     int
+}
+
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+// Selects the agents listed, the zero value of a field matches every agent
+type AgentFilter struct {
+	State  string
+	PoolId string
+
+	// Restricts the agents to those within one of the pools, the agents without
+	// a pool are excluded, nil matches every agent
+	PoolIds []string
+
+	Selector         map[string]string // Labels the agent must have
+	GpuName          string            // The name of one of the GPUs of the agent
+	MinVramAvailable uint64
+}
+
+// Selects the sessions listed, the zero value of a field matches every session
+type SessionFilter struct {
+	State   string
+	PoolId  string
+	AgentId string
+	Version string
+
+	// Restricts the sessions to those within one of the pools, the sessions
+	// without a pool are excluded, nil matches every session
+	PoolIds []string
+
+	// The range of the times the sessions were requested at, inclusive of the
+	// start and exclusive of the end
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// A session assigned to an agent along with the times its timeouts are measured from
+type OpenSession struct {
+	restapi.Session
+
+	AgentId      string
+	Requirements restapi.SessionRequirements
+
+	Assigned  time.Time
+	IdleSince *time.Time // Nil while the session has active connections
+}
+
+// Selects the usage records of the sessions open within the range of time, the
+// zero value of a field matches every record
+type UsageFilter struct {
+	PoolId string
+	UserId string
+
+	// Restricts the records to those of the sessions within one of the pools,
+	// the sessions without a pool are excluded, nil matches every session
+	PoolIds []string
+
+	From time.Time // Excludes the sessions closed before
+	To   time.Time // Excludes the sessions queued at or after
+}
+
+// Selects the reservations whose window overlaps the range of time, the zero
+// value of a field matches every reservation
+type ReservationFilter struct {
+	PoolId string
+
+	// Restricts the reservations to those within one of the pools, nil matches
+	// every pool
+	PoolIds []string
+
+	From time.Time // Excludes the reservations ending at or before
+	To   time.Time // Excludes the reservations starting at or after
+}
+
+// A page of objects ordered by id, the cursor is the id of the last object of
+// the previous page and empty for the first page
+type Page struct {
+	Cursor string
+	Limit  int
+}
+
+// Size returns the number of objects within the page
+func (page Page) Size() int {
+	if page.Limit <= 0 {
+		return DefaultPageLimit
+	} else if page.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+
+	return page.Limit
+}
+
 type Iterator[T any] interface {
 	Next() bool
 	Value() T
@@ -82,19 +192,41 @@ type Storage interface {
 	RegisterAgent(agent restapi.Agent) (string, error)
 	GetAgentById(id string) (restapi.Agent, error)
 	UpdateAgent(update restapi.AgentUpdate) error
+	SetAgentDrainState(id string, drainState string, deadline *time.Time) error
+	// Replaces every taint of the agent
+	SetAgentTaints(id string, taints map[string]string) error
 
-	RequestSession(requirements restapi.SessionRequirements) (string, error)
+	RequestSession(requirements restapi.SessionRequirements, userId string) (string, error)
 	AssignSession(sessionId string, agentId string, gpus []restapi.SessionGpu) error
+	// Assigns every session or none of them
+	AssignSessions(assignments []SessionAssignment) error
 	CancelSession(sessionId string) error
+	SetSessionReason(sessionId string, reason string) error
+	// Records the agents scored as the session was assigned
+	SetSessionPlacement(placement restapi.SessionPlacement) error
+	// Returns ErrNotFound until the placement of the session is recorded
+	GetSessionPlacement(sessionId string) (restapi.SessionPlacement, error)
 	GetSessionById(id string) (restapi.Session, error)
 	GetQueuedSessionById(id string) (QueuedSession, error) // For Testing
 
-	GetAgents(poolId string) (Iterator[restapi.Agent], error)
+	// Queues the members of the group, each with the session requirements of the group
+	RequestSessionGroup(requirements restapi.SessionGroupRequirements, userId string) (string, error)
+	// Returns the group along with its members ordered by id
+	GetSessionGroup(id string) (restapi.SessionGroup, error)
+
+	// Returns a page of the agents matching the filter along with the cursor of
+	// the next page, the cursor is empty once the last page has been returned
+	ListAgents(filter AgentFilter, page Page) ([]restapi.Agent, string, error)
+	// Returns a page of the sessions matching the filter along with the cursor of
+	// the next page, the connections of the sessions are not populated
+	ListSessions(filter SessionFilter, page Page) ([]restapi.ListedSession, string, error)
 	GetAvailableAgentsMatching(totalAvailableVramAtLeast uint64) (Iterator[restapi.Agent], error)
 	GetQueuedSessionsIterator() (Iterator[QueuedSession], error)
+	GetDrainingAgents() ([]restapi.Agent, error) // Active agents being drained along with their open sessions
 
-	SetAgentsMissingIfNotUpdatedFor(duration time.Duration) error
-	RemoveMissingAgentsIfNotUpdatedFor(duration time.Duration) error
+	// Return the agents whose state changed, only the Id, PoolId and State are guaranteed to be populated
+	SetAgentsMissingIfNotUpdatedFor(duration time.Duration) ([]restapi.Agent, error)
+	RemoveMissingAgentsIfNotUpdatedFor(duration time.Duration) ([]restapi.Agent, error)
 
 	CreatePool(name string) (restapi.Pool, error)
 	GetPool(id string) (restapi.Pool, error)
@@ -103,12 +235,65 @@ type Storage interface {
 	RemovePermission(poolId string, userId string, permission restapi.Permission) error
 	AddPermission(poolId string, userId string, permission restapi.Permission) error
 	GetPermissions(userId string) (restapi.UserPermissions, error)
+
+	SetQuota(poolId string, userId string, limits restapi.QuotaLimits) error
+	RemoveQuota(poolId string, userId string) error
+	GetPoolQuota(poolId string) (restapi.PoolQuota, error)
+	GetQuotaUsage(poolId string, userId string) (QuotaUsage, error) // An empty userId returns the usage of the pool
+
+	SetSessionDefaults(poolId string, defaults restapi.SessionTimeouts) error
+	GetSessionDefaults(poolId string) (restapi.SessionTimeouts, error) // The defaults are zero until set
+
+	// Returns the assigned and active sessions, excluding those being canceled
+	GetOpenSessions() ([]OpenSession, error)
+
+	// Extends the lease held by the client of the session until the time
+	RenewSessionLease(id string, expires time.Time) error
+	// Returns the sessions neither canceled nor closed whose lease expired before the time
+	GetSessionsWithExpiredLease(now time.Time) ([]restapi.Session, error)
+
+	CreateReservation(reservation restapi.Reservation) (restapi.Reservation, error)
+	GetReservationById(id string) (restapi.Reservation, error)
+	// Returns the reservations matching the filter ordered by their start
+	GetReservations(filter ReservationFilter) ([]restapi.Reservation, error)
+	DeleteReservation(id string) error
+
+	// The usage record of a session is added as it is closed and never modified
+	GetUsageRecords(filter UsageFilter) ([]restapi.UsageRecord, error)
+
+	CreateWebhook(webhook restapi.Webhook) (restapi.Webhook, error)
+	GetWebhookById(id string) (restapi.Webhook, error)
+	GetWebhooks() ([]restapi.Webhook, error)
+	DeleteWebhook(id string) error
 }
 
 var (
 	ErrNotFound = errors.New("object not found")
 )
 
+// SessionGroupState returns the state of a group from the states of its
+// members. A group is queued while any member is queued, canceling once a
+// member is being canceled or has closed, and active once every member is.
+func SessionGroupState(sessions []restapi.Session) string {
+	counts := map[string]int{}
+	for _, session := range sessions {
+		counts[session.State]++
+	}
+
+	switch {
+	case counts[restapi.SessionClosed] == len(sessions):
+		return restapi.SessionClosed
+	case counts[restapi.SessionCanceling] > 0 || counts[restapi.SessionClosed] > 0:
+		return restapi.SessionCanceling
+	case counts[restapi.SessionQueued] > 0:
+		return restapi.SessionQueued
+	case counts[restapi.SessionActive] == len(sessions):
+		return restapi.SessionActive
+	}
+
+	return restapi.SessionAssigned
+}
+
 func TotalVram(gpus []restapi.Gpu) uint64 {
 	var vram uint64
 	for _, gpu := range gpus {
@@ -126,3 +311,147 @@ func TotalVramRequired(requirements restapi.SessionRequirements) uint64 {
 
 	return vramRequired
 }
+
+// NewUsageRecord returns the usage record of the session closing at the time,
+// the names of the GPUs reserved are taken from the GPUs of the agent
+func NewUsageRecord(session restapi.Session, agentId string, agentGpus []restapi.Gpu, queued time.Time, assigned *time.Time, active *time.Time, closed time.Time) restapi.UsageRecord {
+	record := restapi.UsageRecord{
+		SessionId:   session.Id,
+		PoolId:      session.PoolId,
+		UserId:      session.UserId,
+		AgentId:     agentId,
+		Gpus:        make([]restapi.UsageGpu, 0, len(session.Gpus)),
+		Connections: session.Connections,
+		QueuedAt:    queued.UTC(),
+		ClosedAt:    closed.UTC(),
+	}
+
+	if record.Connections == nil {
+		record.Connections = []restapi.Connection{}
+	}
+
+	if assigned != nil {
+		assignedAt := assigned.UTC()
+		record.AssignedAt = &assignedAt
+	}
+
+	if active != nil {
+		activeAt := active.UTC()
+		record.ActiveAt = &activeAt
+	}
+
+	// The index of a GPU is reported by the agent, it is not its position
+	names := make(map[int]string, len(agentGpus))
+	for _, gpu := range agentGpus {
+		names[gpu.Index] = gpu.Name
+	}
+
+	for _, gpu := range session.Gpus {
+		usageGpu := restapi.UsageGpu{
+			SessionGpu: gpu,
+			Name:       names[gpu.Index],
+		}
+
+		record.Gpus = append(record.Gpus, usageGpu)
+		record.Vram += gpu.VramRequired
+	}
+
+	return record
+}
+
+// MatchesUsageFilter returns whether the record is selected by the filter
+func MatchesUsageFilter(record restapi.UsageRecord, filter UsageFilter) bool {
+	if filter.PoolId != "" && record.PoolId != filter.PoolId {
+		return false
+	}
+
+	if filter.UserId != "" && record.UserId != filter.UserId {
+		return false
+	}
+
+	if filter.PoolIds != nil {
+		found := false
+		for _, poolId := range filter.PoolIds {
+			if record.PoolId == poolId {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if !filter.From.IsZero() && record.ClosedAt.Before(filter.From) {
+		return false
+	}
+
+	return filter.To.IsZero() || record.QueuedAt.Before(filter.To)
+}
+
+// MatchesReservationFilter returns whether the reservation is selected by the filter
+func MatchesReservationFilter(reservation restapi.Reservation, filter ReservationFilter) bool {
+	if filter.PoolId != "" && reservation.PoolId != filter.PoolId {
+		return false
+	}
+
+	if filter.PoolIds != nil {
+		found := false
+		for _, poolId := range filter.PoolIds {
+			if reservation.PoolId == poolId {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if !filter.From.IsZero() && !reservation.End.After(filter.From) {
+		return false
+	}
+
+	return filter.To.IsZero() || reservation.Start.Before(filter.To)
+}
+
+// Computes the percentiles using the Nearest-Rank Method from a set of value counts
+func CalculatePercentiles(counts map[int]int, total int) Percentile[int] {
+	if len(counts) == 0 {
+		return Percentile[int]{}
+	}
+
+	sortedKeys := []int{}
+	for key := range counts {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Ints(sortedKeys)
+
+	percentile := Percentile[int]{
+		P100: sortedKeys[len(sortedKeys)-1],
+	}
+
+	index := 0
+	keysIndex := 0
+	key := 0
+
+	advance := func(rank float64) int {
+		limit := int(float64(total) * rank)
+		for keysIndex < len(sortedKeys) && index < limit {
+			key = sortedKeys[keysIndex]
+			index += counts[key]
+			keysIndex++
+		}
+		return key
+	}
+
+	percentile.P10 = advance(0.10)
+	percentile.P25 = advance(0.25)
+	percentile.P50 = advance(0.50)
+	percentile.P75 = advance(0.75)
+	percentile.P90 = advance(0.90)
+
+	return percentile
+}
@@ -10,9 +10,12 @@ import (
 	"fmt"
 	"math/rand"
 	"reflect"
+	"sort"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage"
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage/gorm"
 	"github.com/Juice-Labs/Juice-Labs/cmd/controller/storage/memdb"
@@ -81,9 +84,10 @@ func defaultAgent(gpuVram uint64) restapi.Agent {
 			"Key1": "Value1",
 			"Key2": "Value2",
 		},
-		Taints:   map[string]string{},
-		Sessions: make([]restapi.Session, 0),
-		PoolId:   "TestPool",
+		Taints:     map[string]string{},
+		Sessions:   make([]restapi.Session, 0),
+		DrainState: restapi.AgentSchedulable,
+		PoolId:     "TestPool",
 	}
 }
 
@@ -102,13 +106,14 @@ func defaultSessionRequirements(gpuVram uint64) restapi.SessionRequirements {
 
 func createAgent() restapi.Agent {
 	agent := restapi.Agent{
-		State:    restapi.AgentActive,
-		Hostname: "Test",
-		Address:  "127.0.0.1:43210",
-		Version:  "Test",
-		Labels:   map[string]string{},
-		Taints:   map[string]string{},
-		Sessions: make([]restapi.Session, 0),
+		State:      restapi.AgentActive,
+		Hostname:   "Test",
+		Address:    "127.0.0.1:43210",
+		Version:    "Test",
+		Labels:     map[string]string{},
+		Taints:     map[string]string{},
+		Sessions:   make([]restapi.Session, 0),
+		DrainState: restapi.AgentSchedulable,
 	}
 
 	agent.Gpus = make([]restapi.Gpu, rand.Intn(7)+1)
@@ -203,7 +208,7 @@ func registerAgent(t *testing.T, db storage.Storage, agent restapi.Agent) restap
 }
 
 func queueSession(t *testing.T, db storage.Storage, requirements restapi.SessionRequirements) string {
-	sessionId, err := db.RequestSession(requirements)
+	sessionId, err := db.RequestSession(requirements, "")
 	if err != nil {
 		t.Log(err)
 		t.FailNow()
@@ -447,3 +452,1459 @@ func TestGetQueuedSessionsIterator(t *testing.T) {
 		run(t, db)
 	})
 }
+
+func TestAggregateData(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		// Use a unique GPU name so agents from other tests do not affect the results
+		gpuName := uuid.NewString()
+
+		vrams := []uint64{24, 8, 16}
+		for index, vram := range vrams {
+			agent := defaultAgent(vram * 1024 * 1024 * 1024)
+			agent.Gpus[0].Name = gpuName
+
+			id, err := db.RegisterAgent(agent)
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+
+			var vramUsed uint64
+			if index == 0 {
+				vramUsed = 4 * 1024 * 1024 * 1024
+			}
+
+			err = db.UpdateAgent(restapi.AgentUpdate{
+				Id:    id,
+				State: restapi.AgentActive,
+				Gpus: []restapi.GpuMetrics{
+					{
+						VramUsed:       vramUsed,
+						UtilizationGpu: 50,
+						PowerDraw:      100000,
+					},
+				},
+			})
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+		}
+
+		data, err := db.AggregateData()
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		if data.Agents < len(vrams) || data.AgentsByStatus[restapi.AgentActive] < len(vrams) {
+			t.Errorf("expected at least %d active agents, found %d", len(vrams), data.AgentsByStatus[restapi.AgentActive])
+		}
+
+		compare(t, len(vrams), data.GpusByGpuName[gpuName], nil)
+		compare(t, uint64(48*1024*1024*1024), data.VramByGpuName[gpuName], nil)
+		compare(t, uint64(4*1024*1024*1024), data.VramUsedByGpuName[gpuName], nil)
+
+		percentile := data.VramGBAvailableByGpuName[gpuName]
+		compare(t, 20, percentile.P100, nil)
+		compare(t, 16, percentile.P90, nil)
+		compare(t, 16, percentile.P75, nil)
+		compare(t, 8, percentile.P50, nil)
+		compare(t, 0, percentile.P25, nil)
+		compare(t, 0, percentile.P10, nil)
+
+		// The power draw is the total of the GPUs in watts
+		compare(t, 300.0, data.PowerDrawByGpuName[gpuName], nil)
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestQuotas(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		poolId := uuid.NewString()
+
+		poolLimits := restapi.QuotaLimits{
+			MaxSessions: 4,
+			MaxVram:     32 * 1024 * 1024 * 1024,
+		}
+
+		userLimits := restapi.QuotaLimits{
+			MaxGpus: 1,
+		}
+
+		err := db.SetQuota(poolId, "", restapi.QuotaLimits{MaxSessions: 2})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		// Setting the quota again replaces the limits
+		err = db.SetQuota(poolId, "", poolLimits)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		err = db.SetQuota(poolId, "User", userLimits)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		quota, err := db.GetPoolQuota(poolId)
+		compare(t, restapi.PoolQuota{
+			PoolId: poolId,
+			Pool:   poolLimits,
+			Users: map[string]restapi.QuotaLimits{
+				"User": userLimits,
+			},
+		}, quota, err)
+
+		agent := defaultAgent(24 * 1024 * 1024 * 1024)
+		agent.Id, err = db.RegisterAgent(agent)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		requirements := defaultSessionRequirements(4 * 1024 * 1024 * 1024)
+		requirements.PoolId = poolId
+
+		sessionId, err := db.RequestSession(requirements, "User")
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		err = db.SetSessionReason(sessionId, "Reason")
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		checkQueuedSession(t, db, storage.QueuedSession{
+			Id:           sessionId,
+			UserId:       "User",
+			Reason:       "Reason",
+			Requirements: requirements,
+		})
+
+		err = db.AssignSession(sessionId, agent.Id, []restapi.SessionGpu{
+			{
+				Index:        agent.Gpus[0].Index,
+				VramRequired: requirements.Gpus[0].VramRequired,
+			},
+		})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		session, err := db.GetSessionById(sessionId)
+		if err != nil {
+			t.Error(err)
+		} else if session.UserId != "User" || session.Reason != "" {
+			t.Errorf("expected the session to belong to User without a reason, got '%s' and '%s'", session.UserId, session.Reason)
+		}
+
+		usage, err := db.GetQuotaUsage(poolId, "")
+		compare(t, storage.QuotaUsage{Sessions: 1, Vram: 4 * 1024 * 1024 * 1024, Gpus: 1}, usage, err)
+
+		usage, err = db.GetQuotaUsage(poolId, "User")
+		compare(t, storage.QuotaUsage{Sessions: 1, Vram: 4 * 1024 * 1024 * 1024, Gpus: 1}, usage, err)
+
+		usage, err = db.GetQuotaUsage(poolId, "Other")
+		compare(t, storage.QuotaUsage{}, usage, err)
+
+		err = db.RemoveQuota(poolId, "User")
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		quota, err = db.GetPoolQuota(poolId)
+		compare(t, restapi.PoolQuota{
+			PoolId: poolId,
+			Pool:   poolLimits,
+			Users:  map[string]restapi.QuotaLimits{},
+		}, quota, err)
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		poolWebhook, err := db.CreateWebhook(restapi.Webhook{
+			Url:    "https://example.com/pool",
+			Secret: "Secret",
+			PoolId: uuid.NewString(),
+			Events: []string{restapi.EventSessionState, restapi.EventConnectionClosed},
+		})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		if poolWebhook.Id == "" {
+			t.Error("expected the webhook to be assigned an id")
+		}
+
+		allWebhook, err := db.CreateWebhook(restapi.Webhook{
+			Url:    "https://example.com/all",
+			Events: []string{},
+		})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		webhook, err := db.GetWebhookById(poolWebhook.Id)
+		compare(t, poolWebhook, webhook, err)
+
+		webhook, err = db.GetWebhookById(allWebhook.Id)
+		compare(t, allWebhook, webhook, err)
+
+		webhooks, err := db.GetWebhooks()
+		if err != nil {
+			t.Error(err)
+		} else if len(webhooks) != 2 {
+			t.Errorf("expected 2 webhooks, got %d", len(webhooks))
+		}
+
+		err = db.DeleteWebhook(poolWebhook.Id)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		_, err = db.GetWebhookById(poolWebhook.Id)
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected the deleted webhook to not be found, got %v", err)
+		}
+
+		err = db.DeleteWebhook(poolWebhook.Id)
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected deleting a deleted webhook to not be found, got %v", err)
+		}
+
+		err = db.DeleteWebhook(allWebhook.Id)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestDrainState(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		agent := defaultAgent(24 * 1024 * 1024 * 1024)
+		agent.PoolId = uuid.NewString()
+		agent = registerAgent(t, db, agent)
+
+		deadline := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+		err := db.SetAgentDrainState(agent.Id, restapi.AgentDraining, &deadline)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		drainingAgent, err := db.GetAgentById(agent.Id)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		if drainingAgent.DrainState != restapi.AgentDraining {
+			t.Errorf("expected the agent to be draining, drain state = %s", drainingAgent.DrainState)
+		}
+
+		if drainingAgent.DrainDeadline == nil || !drainingAgent.DrainDeadline.Equal(deadline) {
+			t.Errorf("expected the drain deadline to be %s, got %v", deadline, drainingAgent.DrainDeadline)
+		}
+
+		agents, err := db.GetDrainingAgents()
+		if err != nil {
+			t.Error(err)
+		} else if len(agents) != 1 || agents[0].Id != agent.Id {
+			t.Errorf("expected the agent to be draining, got %d agents", len(agents))
+		}
+
+		err = db.SetAgentDrainState(agent.Id, restapi.AgentSchedulable, nil)
+		if err != nil {
+			t.Error(err)
+		}
+
+		checkAgent(t, db, agent)
+
+		agents, err = db.GetDrainingAgents()
+		if err != nil {
+			t.Error(err)
+		} else if len(agents) != 0 {
+			t.Errorf("expected no draining agents, got %d", len(agents))
+		}
+
+		err = db.SetAgentDrainState(uuid.NewString(), restapi.AgentCordoned, nil)
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected cordoning an unknown agent to not be found, got %v", err)
+		}
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestListAgents(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+
+	// Returns the ids of the agents listed, following the cursors through every page
+	listIds := func(t *testing.T, db storage.Storage, filter storage.AgentFilter, limit int) []string {
+		ids := []string{}
+
+		page := storage.Page{Limit: limit}
+		for {
+			agents, next, err := db.ListAgents(filter, page)
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+
+			if len(agents) > page.Size() {
+				t.Errorf("expected at most %d agents, got %d", page.Size(), len(agents))
+			}
+
+			for _, agent := range agents {
+				ids = append(ids, agent.Id)
+			}
+
+			if next == "" {
+				return ids
+			}
+
+			page.Cursor = next
+		}
+	}
+
+	run := func(t *testing.T, db storage.Storage) {
+		poolId := uuid.NewString()
+
+		register := func(gpuName string, vram uint64, zone string) string {
+			agent := defaultAgent(vram)
+			agent.PoolId = poolId
+			agent.Gpus[0].Name = gpuName
+			agent.Labels["zone"] = zone
+			return registerAgent(t, db, agent).Id
+		}
+
+		large := register("A100", 80*gb, "a")
+		small := register("T4", 16*gb, "b")
+		medium := register("A100", 40*gb, "a")
+		register("Test", 24*gb, "b")
+		register("Test", 24*gb, "c")
+
+		all := listIds(t, db, storage.AgentFilter{PoolId: poolId}, 0)
+		if len(all) != 5 {
+			t.Fatalf("expected 5 agents within the pool, got %d", len(all))
+		}
+
+		for index := 1; index < len(all); index++ {
+			if all[index-1] >= all[index] {
+				t.Errorf("expected the agents to be ordered by id, %s listed before %s", all[index-1], all[index])
+			}
+		}
+
+		paged := listIds(t, db, storage.AgentFilter{PoolId: poolId}, 2)
+		if !reflect.DeepEqual(all, paged) {
+			t.Errorf("expected the pages to list %v, got %v", all, paged)
+		}
+
+		sorted := func(ids ...string) []string {
+			sort.Strings(ids)
+			return ids
+		}
+
+		filtered := listIds(t, db, storage.AgentFilter{PoolId: poolId, Selector: map[string]string{"zone": "a", "Key1": "Value1"}}, 1)
+		if !reflect.DeepEqual(filtered, sorted(large, medium)) {
+			t.Errorf("expected the label selector to match %v, got %v", sorted(large, medium), filtered)
+		}
+
+		filtered = listIds(t, db, storage.AgentFilter{PoolId: poolId, GpuName: "T4"}, 0)
+		if !reflect.DeepEqual(filtered, []string{small}) {
+			t.Errorf("expected the GPU name to match %s, got %v", small, filtered)
+		}
+
+		filtered = listIds(t, db, storage.AgentFilter{PoolId: poolId, MinVramAvailable: 32 * gb}, 0)
+		if !reflect.DeepEqual(filtered, sorted(large, medium)) {
+			t.Errorf("expected the VRAM available to match %v, got %v", sorted(large, medium), filtered)
+		}
+
+		filtered = listIds(t, db, storage.AgentFilter{PoolId: poolId, State: restapi.AgentMissing}, 0)
+		if len(filtered) != 0 {
+			t.Errorf("expected no missing agents, got %v", filtered)
+		}
+
+		// Agents outside of the pools are not listed
+		filtered = listIds(t, db, storage.AgentFilter{PoolIds: []string{uuid.NewString()}}, 0)
+		for _, id := range filtered {
+			for _, agentId := range all {
+				if id == agentId {
+					t.Errorf("expected agent %s to be excluded with its pool", id)
+				}
+			}
+		}
+
+		// Agents without a pool are not listed within any pool
+		agent := defaultAgent(24 * gb)
+		agent.PoolId = ""
+		noPoolId := registerAgent(t, db, agent).Id
+
+		filtered = listIds(t, db, storage.AgentFilter{PoolIds: []string{poolId}}, 0)
+		if !reflect.DeepEqual(filtered, all) {
+			t.Errorf("expected the agents of the pool %v, excluding agent %s without a pool, got %v", all, noPoolId, filtered)
+		}
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestListSessions(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		poolId := uuid.NewString()
+
+		agent := defaultAgent(24 * 1024 * 1024 * 1024)
+		agent.PoolId = poolId
+		agent = registerAgent(t, db, agent)
+
+		start := time.Now().Add(-time.Minute)
+
+		ids := []string{}
+		for _, version := range []string{"1", "1", "2"} {
+			requirements := defaultSessionRequirements(1024 * 1024 * 1024)
+			requirements.PoolId = poolId
+			requirements.Version = version
+			ids = append(ids, queueSession(t, db, requirements))
+		}
+
+		err := db.AssignSession(ids[0], agent.Id, []restapi.SessionGpu{{Index: 0, VramRequired: 1024 * 1024 * 1024}})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		list := func(filter storage.SessionFilter, limit int) []restapi.ListedSession {
+			filter.PoolId = poolId
+
+			sessions := []restapi.ListedSession{}
+
+			page := storage.Page{Limit: limit}
+			for {
+				pageSessions, next, err := db.ListSessions(filter, page)
+				if err != nil {
+					t.Log(err)
+					t.FailNow()
+				}
+
+				sessions = append(sessions, pageSessions...)
+
+				if next == "" {
+					return sessions
+				}
+
+				page.Cursor = next
+			}
+		}
+
+		listIds := func(filter storage.SessionFilter) []string {
+			ids := []string{}
+			for _, session := range list(filter, 0) {
+				ids = append(ids, session.Id)
+			}
+			return ids
+		}
+
+		sorted := func(ids ...string) []string {
+			sort.Strings(ids)
+			return ids
+		}
+
+		sessions := list(storage.SessionFilter{}, 2)
+		if len(sessions) != 3 {
+			t.Fatalf("expected 3 sessions within the pool, got %d", len(sessions))
+		}
+
+		for _, session := range sessions {
+			if session.Created.Before(start) {
+				t.Errorf("expected session %s to be created after %s, got %s", session.Id, start, session.Created)
+			}
+
+			if session.Id == ids[0] && session.AgentId != agent.Id {
+				t.Errorf("expected session %s to be assigned to %s, got %s", session.Id, agent.Id, session.AgentId)
+			}
+		}
+
+		filtered := listIds(storage.SessionFilter{State: restapi.SessionQueued})
+		if !reflect.DeepEqual(filtered, sorted(ids[1], ids[2])) {
+			t.Errorf("expected the queued sessions to be %v, got %v", sorted(ids[1], ids[2]), filtered)
+		}
+
+		filtered = listIds(storage.SessionFilter{AgentId: agent.Id})
+		if !reflect.DeepEqual(filtered, []string{ids[0]}) {
+			t.Errorf("expected the sessions of the agent to be %v, got %v", ids[:1], filtered)
+		}
+
+		filtered = listIds(storage.SessionFilter{Version: "1"})
+		if !reflect.DeepEqual(filtered, sorted(ids[0], ids[1])) {
+			t.Errorf("expected the sessions of version 1 to be %v, got %v", sorted(ids[0], ids[1]), filtered)
+		}
+
+		filtered = listIds(storage.SessionFilter{CreatedAfter: start, CreatedBefore: time.Now().Add(time.Minute)})
+		if len(filtered) != 3 {
+			t.Errorf("expected 3 sessions created within the range, got %d", len(filtered))
+		}
+
+		filtered = listIds(storage.SessionFilter{CreatedBefore: start})
+		if len(filtered) != 0 {
+			t.Errorf("expected no sessions created before %s, got %v", start, filtered)
+		}
+
+		// Sessions without a pool are not listed within any pool
+		requirements := defaultSessionRequirements(1024 * 1024 * 1024)
+		requirements.PoolId = ""
+		noPoolId := queueSession(t, db, requirements)
+
+		pooled, _, err := db.ListSessions(storage.SessionFilter{PoolIds: []string{poolId}}, storage.Page{Limit: storage.MaxPageLimit})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		filtered = []string{}
+		for _, session := range pooled {
+			filtered = append(filtered, session.Id)
+		}
+
+		if !reflect.DeepEqual(filtered, sorted(ids...)) {
+			t.Errorf("expected the sessions of the pool %v, excluding session %s without a pool, got %v", sorted(ids...), noPoolId, filtered)
+		}
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestUsageRecords(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		poolId := uuid.NewString()
+		vram := uint64(1024 * 1024 * 1024)
+
+		// The index of a GPU is not its position among the GPUs of the agent
+		agent := defaultAgent(24 * vram)
+		agent.PoolId = poolId
+		agent.Gpus[0].Index = 2
+		agent = registerAgent(t, db, agent)
+
+		start := time.Now().Add(-time.Minute)
+
+		requirements := defaultSessionRequirements(vram)
+		requirements.PoolId = poolId
+
+		ids := []string{}
+		for index := 0; index < 3; index++ {
+			id, err := db.RequestSession(requirements, "user")
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+			ids = append(ids, id)
+		}
+
+		for _, id := range []string{ids[0], ids[2]} {
+			err := db.AssignSession(id, agent.Id, []restapi.SessionGpu{{Index: 2, VramRequired: vram}})
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+		}
+
+		connection := restapi.Connection{
+			ConnectionData: restapi.ConnectionData{
+				Id:          uuid.NewString(),
+				Pid:         "1234",
+				ProcessName: "process",
+			},
+		}
+
+		err := db.UpdateAgent(restapi.AgentUpdate{
+			Id:    agent.Id,
+			State: agent.State,
+			SessionsUpdate: map[string]restapi.SessionUpdate{
+				ids[0]: {
+					State:       restapi.SessionActive,
+					Connections: map[string]restapi.Connection{connection.Id: connection},
+				},
+			},
+		})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		connection.ExitCode = 1
+		err = db.UpdateAgent(restapi.AgentUpdate{
+			Id:    agent.Id,
+			State: agent.State,
+			SessionsUpdate: map[string]restapi.SessionUpdate{
+				ids[0]: {
+					State:       restapi.SessionClosed,
+					Connections: map[string]restapi.Connection{connection.Id: connection},
+				},
+			},
+		})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		// Closed while queued
+		err = db.CancelSession(ids[1])
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		requirements.PoolId = ""
+		noPoolId := queueSession(t, db, requirements)
+
+		err = db.CancelSession(noPoolId)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		// Closed along with the agent
+		err = db.UpdateAgent(restapi.AgentUpdate{
+			Id:    agent.Id,
+			State: restapi.AgentClosed,
+		})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		records, err := db.GetUsageRecords(storage.UsageFilter{PoolId: poolId})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		if len(records) != 3 {
+			t.Fatalf("expected 3 usage records, got %d", len(records))
+		}
+
+		byId := map[string]restapi.UsageRecord{}
+		for _, record := range records {
+			byId[record.SessionId] = record
+
+			if record.PoolId != poolId || record.UserId != "user" {
+				t.Errorf("expected session %s of user within %s, got %s of %s", record.SessionId, poolId, record.PoolId, record.UserId)
+			}
+
+			if record.QueuedAt.Before(start) || record.ClosedAt.Before(record.QueuedAt) {
+				t.Errorf("expected session %s to be queued after %s and closed after being queued, got %s and %s", record.SessionId, start, record.QueuedAt, record.ClosedAt)
+			}
+		}
+
+		closed := byId[ids[0]]
+		if closed.AssignedAt == nil || closed.ActiveAt == nil || closed.AgentId != agent.Id {
+			t.Errorf("expected session %s to have been assigned to %s and active, got %+v", ids[0], agent.Id, closed)
+		}
+
+		if len(closed.Gpus) != 1 || closed.Gpus[0].Name != "Test" || closed.Vram != vram {
+			t.Errorf("expected session %s to reserve %d of GPU Test, got %+v", ids[0], vram, closed.Gpus)
+		}
+
+		compare(t, []restapi.Connection{connection}, closed.Connections, nil)
+
+		canceled := byId[ids[1]]
+		if canceled.AssignedAt != nil || canceled.AgentId != "" || len(canceled.Gpus) != 0 {
+			t.Errorf("expected session %s to have never been assigned, got %+v", ids[1], canceled)
+		}
+
+		if byId[ids[2]].AssignedAt == nil || byId[ids[2]].ActiveAt != nil {
+			t.Errorf("expected session %s to have been assigned but never active, got %+v", ids[2], byId[ids[2]])
+		}
+
+		records, err = db.GetUsageRecords(storage.UsageFilter{PoolId: poolId, From: time.Now().Add(time.Minute)})
+		if err == nil && len(records) != 0 {
+			err = fmt.Errorf("expected no sessions closed after now, got %d", len(records))
+		}
+
+		if err == nil {
+			records, err = db.GetUsageRecords(storage.UsageFilter{PoolId: poolId, To: start})
+			if err == nil && len(records) != 0 {
+				err = fmt.Errorf("expected no sessions queued before %s, got %d", start, len(records))
+			}
+		}
+
+		if err == nil {
+			records, err = db.GetUsageRecords(storage.UsageFilter{PoolIds: []string{uuid.NewString()}})
+			for _, record := range records {
+				if record.PoolId == poolId {
+					err = fmt.Errorf("expected the sessions of %s to be excluded", poolId)
+				}
+			}
+		}
+
+		if err == nil {
+			records, err = db.GetUsageRecords(storage.UsageFilter{PoolIds: []string{poolId}})
+			for _, record := range records {
+				if record.SessionId == noPoolId {
+					err = fmt.Errorf("expected session %s without a pool to be excluded", noPoolId)
+				}
+			}
+
+			if err == nil && len(records) != 3 {
+				err = fmt.Errorf("expected 3 usage records within %s, got %d", poolId, len(records))
+			}
+		}
+
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestOpenSessions(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		poolId := uuid.NewString()
+		vram := uint64(1024 * 1024 * 1024)
+
+		defaults, err := db.GetSessionDefaults(poolId)
+		compare(t, restapi.SessionTimeouts{}, defaults, err)
+
+		for _, expected := range []restapi.SessionTimeouts{{MaxDuration: 60, IdleTimeout: 30}, {IdleTimeout: 10}} {
+			err = db.SetSessionDefaults(poolId, expected)
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+
+			defaults, err = db.GetSessionDefaults(poolId)
+			compare(t, expected, defaults, err)
+		}
+
+		agent := defaultAgent(24 * vram)
+		agent.PoolId = poolId
+		agent = registerAgent(t, db, agent)
+
+		requirements := defaultSessionRequirements(vram)
+		requirements.PoolId = poolId
+		requirements.MaxDuration = 120
+
+		sessionId := queueSession(t, db, requirements)
+
+		findSession := func() *storage.OpenSession {
+			sessions, err := db.GetOpenSessions()
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+
+			for _, session := range sessions {
+				if session.Id == sessionId {
+					return &session
+				}
+			}
+
+			return nil
+		}
+
+		if findSession() != nil {
+			t.Errorf("expected queued session %s not to be open", sessionId)
+		}
+
+		start := time.Now().Add(-time.Minute)
+
+		err = db.AssignSession(sessionId, agent.Id, []restapi.SessionGpu{{Index: 0, VramRequired: vram}})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		session := findSession()
+		if session == nil {
+			t.Fatalf("expected assigned session %s to be open", sessionId)
+		}
+
+		if session.AgentId != agent.Id || session.Requirements.MaxDuration != 120 || session.Assigned.Before(start) || session.IdleSince != nil {
+			t.Errorf("expected session %s assigned to %s after %s with a maximum duration, got %+v", sessionId, agent.Id, start, session)
+		}
+
+		idleSince := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+		updateIdle := func(idleSince *time.Time) {
+			err = db.UpdateAgent(restapi.AgentUpdate{
+				Id:    agent.Id,
+				State: agent.State,
+				SessionsUpdate: map[string]restapi.SessionUpdate{
+					sessionId: {
+						State:     restapi.SessionActive,
+						IdleSince: idleSince,
+					},
+				},
+			})
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+		}
+
+		updateIdle(&idleSince)
+
+		session = findSession()
+		if session == nil || session.IdleSince == nil || !session.IdleSince.Equal(idleSince) {
+			t.Errorf("expected session %s to be idle since %s, got %+v", sessionId, idleSince, session)
+		}
+
+		updateIdle(nil)
+
+		session = findSession()
+		if session == nil || session.IdleSince != nil {
+			t.Errorf("expected session %s to no longer be idle, got %+v", sessionId, session)
+		}
+
+		err = db.CancelSession(sessionId)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		if findSession() != nil {
+			t.Errorf("expected canceled session %s not to be open", sessionId)
+		}
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestSessionLeases(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		poolId := uuid.NewString()
+		vram := uint64(1024 * 1024 * 1024)
+
+		err := db.RenewSessionLease(uuid.NewString(), time.Now())
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected renewing the lease of an unknown session to be not found, got %v", err)
+		}
+
+		requirements := defaultSessionRequirements(vram)
+		requirements.PoolId = poolId
+
+		leasedId := queueSession(t, db, requirements)
+		unleasedId := queueSession(t, db, requirements)
+
+		expiredIds := func(now time.Time) map[string]bool {
+			sessions, err := db.GetSessionsWithExpiredLease(now)
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+
+			ids := map[string]bool{}
+			for _, session := range sessions {
+				ids[session.Id] = true
+			}
+
+			return ids
+		}
+
+		expires := time.Now().Add(time.Minute).UTC()
+		err = db.RenewSessionLease(leasedId, expires)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		if expired := expiredIds(time.Now()); expired[leasedId] || expired[unleasedId] {
+			t.Errorf("expected no lease to have expired, got %v", expired)
+		}
+
+		// Sessions without a lease never expire
+		if expired := expiredIds(expires.Add(time.Second)); !expired[leasedId] || expired[unleasedId] {
+			t.Errorf("expected the lease of session %s to have expired, got %v", leasedId, expired)
+		}
+
+		err = db.CancelSession(leasedId)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		if expired := expiredIds(expires.Add(time.Second)); expired[leasedId] {
+			t.Errorf("expected canceled session %s not to be reported, got %v", leasedId, expired)
+		}
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestSessionGroups(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		poolId := uuid.NewString()
+		vram := uint64(1024 * 1024 * 1024)
+
+		_, err := db.GetSessionGroup(uuid.NewString())
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected an unknown group to be not found, got %v", err)
+		}
+
+		agent := defaultAgent(24 * vram)
+		agent.PoolId = poolId
+		agent = registerAgent(t, db, agent)
+
+		requirements := defaultSessionRequirements(vram)
+		requirements.PoolId = poolId
+
+		groupId, err := db.RequestSessionGroup(restapi.SessionGroupRequirements{
+			Members:  2,
+			Topology: restapi.GroupTopology{SameLabel: "rack"},
+			Session:  requirements,
+		}, "user")
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		group, err := db.GetSessionGroup(groupId)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		if group.Id != groupId || group.State != restapi.SessionQueued || group.PoolId != poolId || group.UserId != "user" ||
+			group.Topology.SameLabel != "rack" || len(group.Sessions) != 2 {
+			t.Fatalf("expected a queued group of 2 members, got %+v", group)
+		}
+
+		assignments := []storage.SessionAssignment{}
+		for index, session := range group.Sessions {
+			if session.GroupId != groupId || session.State != restapi.SessionQueued {
+				t.Errorf("expected queued member of group %s, got %+v", groupId, session)
+			}
+
+			queued, err := db.GetQueuedSessionById(session.Id)
+			if err != nil || queued.GroupId != groupId {
+				t.Errorf("expected queued session %s to be a member of group %s, got %+v, %v", session.Id, groupId, queued, err)
+			}
+
+			assignments = append(assignments, storage.SessionAssignment{
+				SessionId: session.Id,
+				AgentId:   agent.Id,
+				Gpus:      []restapi.SessionGpu{{Index: 0, VramRequired: vram}},
+			})
+
+			if index == 0 && session.Id > group.Sessions[1].Id {
+				t.Errorf("expected the members ordered by id, got %s before %s", session.Id, group.Sessions[1].Id)
+			}
+		}
+
+		err = db.AssignSessions(assignments)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		group, err = db.GetSessionGroup(groupId)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		if group.State != restapi.SessionAssigned {
+			t.Errorf("expected group %s to be assigned, state = %s", groupId, group.State)
+		}
+
+		for _, session := range group.Sessions {
+			if session.State != restapi.SessionAssigned || session.Address != agent.Address {
+				t.Errorf("expected member %s to be assigned to %s, got %+v", session.Id, agent.Id, session)
+			}
+		}
+
+		err = db.CancelSession(group.Sessions[0].Id)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		group, err = db.GetSessionGroup(groupId)
+		compare(t, restapi.SessionCanceling, group.State, err)
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestReservations(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		poolId := uuid.NewString()
+		otherPoolId := uuid.NewString()
+		now := time.Now().UTC().Truncate(time.Second)
+
+		_, err := db.GetReservationById(uuid.NewString())
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected an unknown reservation to be not found, got %v", err)
+		}
+
+		create := func(poolId string, start time.Time, end time.Time) restapi.Reservation {
+			t.Helper()
+
+			reservation, err := db.CreateReservation(restapi.Reservation{
+				PoolId: poolId,
+				UserId: "owner",
+				Gpus:   defaultSessionRequirements(1024 * 1024 * 1024).Gpus,
+				Start:  start,
+				End:    end,
+			})
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+
+			return reservation
+		}
+
+		later := create(poolId, now.Add(time.Hour), now.Add(2*time.Hour))
+		current := create(poolId, now, now.Add(time.Hour))
+		other := create(otherPoolId, now, now.Add(time.Hour))
+
+		reservation, err := db.GetReservationById(later.Id)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		if reservation.PoolId != poolId || reservation.UserId != "owner" || len(reservation.Gpus) != 1 ||
+			!reservation.Start.Equal(later.Start) || !reservation.End.Equal(later.End) {
+			t.Errorf("expected %+v, got %+v", later, reservation)
+		}
+
+		checkIds := func(filter storage.ReservationFilter, expected ...string) {
+			t.Helper()
+
+			reservations, err := db.GetReservations(filter)
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+
+			ids := make([]string, 0, len(reservations))
+			for _, reservation := range reservations {
+				ids = append(ids, reservation.Id)
+			}
+
+			if !reflect.DeepEqual(ids, expected) {
+				t.Errorf("expected reservations %v, got %v", expected, ids)
+			}
+		}
+
+		// Reservations are ordered by their start
+		checkIds(storage.ReservationFilter{PoolId: poolId}, current.Id, later.Id)
+		checkIds(storage.ReservationFilter{PoolIds: []string{otherPoolId}}, other.Id)
+
+		// The window of the current reservation ends as the later one starts
+		checkIds(storage.ReservationFilter{PoolId: poolId, From: now.Add(time.Hour)}, later.Id)
+		checkIds(storage.ReservationFilter{PoolId: poolId, To: now.Add(time.Hour)}, current.Id)
+
+		err = db.DeleteReservation(later.Id)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		_, err = db.GetReservationById(later.Id)
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected a deleted reservation to be not found, got %v", err)
+		}
+
+		err = db.DeleteReservation(later.Id)
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected deleting a deleted reservation to be not found, got %v", err)
+		}
+
+		checkIds(storage.ReservationFilter{PoolId: poolId}, current.Id)
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestAgentTaints(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		agent := defaultAgent(24 * 1024 * 1024 * 1024)
+		agent.PoolId = uuid.NewString()
+		agent.Taints = map[string]string{"spot": "true"}
+		agent = registerAgent(t, db, agent)
+
+		agent.Taints = map[string]string{"maint": "yes:NoExecute", "team": "ml:PreferNoSchedule"}
+		err := db.SetAgentTaints(agent.Id, agent.Taints)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		checkAgent(t, db, agent)
+
+		agent.Taints = map[string]string{}
+		err = db.SetAgentTaints(agent.Id, agent.Taints)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		checkAgent(t, db, agent)
+
+		err = db.SetAgentTaints(uuid.NewString(), map[string]string{"spot": "true"})
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected tainting an unknown agent to not be found, got %v", err)
+		}
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
+
+func TestSessionPlacement(t *testing.T) {
+	run := func(t *testing.T, db storage.Storage) {
+		vram := uint64(1024 * 1024 * 1024)
+
+		err := db.SetSessionPlacement(restapi.SessionPlacement{SessionId: uuid.NewString()})
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected recording the placement of an unknown session to be not found, got %v", err)
+		}
+
+		requirements := defaultSessionRequirements(vram)
+		requirements.PoolId = uuid.NewString()
+		sessionId := queueSession(t, db, requirements)
+
+		_, err = db.GetSessionPlacement(sessionId)
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected the placement of a queued session to be not found, got %v", err)
+		}
+
+		preference := restapi.Preference{Type: restapi.PreferLabel, Weight: 10, Key: "zone"}
+		placement := restapi.SessionPlacement{
+			SessionId:  sessionId,
+			AgentId:    uuid.NewString(),
+			Placement:  "best-fit",
+			AssignedAt: time.Now().UTC().Truncate(time.Second),
+			Candidates: []restapi.AgentScore{
+				{
+					Score:         10,
+					VramAvailable: vram,
+					Components:    []restapi.ScoreComponent{{Preference: preference, Score: 10}},
+				},
+				{
+					Avoided:    true,
+					Components: []restapi.ScoreComponent{{Preference: preference}},
+				},
+			},
+		}
+		placement.Candidates[0].AgentId = placement.AgentId
+		placement.Candidates[1].AgentId = uuid.NewString()
+
+		err = db.SetSessionPlacement(placement)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		against, err := db.GetSessionPlacement(sessionId)
+		compare(t, placement, against, err)
+	}
+
+	t.Run("gorm sqlite", func(t *testing.T) {
+		db := openGorm(t, "sqlite")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("gorm postgres", func(t *testing.T) {
+		db := openGorm(t, "postgres")
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("memdb", func(t *testing.T) {
+		db := openMemdb(t)
+		defer db.Close()
+		run(t, db)
+	})
+
+	t.Run("postgresql", func(t *testing.T) {
+		db := openPostgres(t)
+		defer db.Close()
+		run(t, db)
+	})
+}
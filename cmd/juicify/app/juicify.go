@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,6 +31,7 @@ type Configuration struct {
 var (
 	address     = flag.String("address", "", "The IP address or hostname and port of the server to connect to")
 	accessToken = flag.String("access-token", "", "The access token to use when connecting to the controller")
+	poolId      = flag.String("pool-id", "", "The ID of the pool to request the session from, overrides the poolId of juice.cfg")
 
 	test           = flag.Bool("test", false, "Deprecated: Use --test-connection instead")
 	testConnection = flag.Bool("test-connection", false, "Tests the reachability of the controller or server(s)")
@@ -38,6 +40,16 @@ var (
 	onQueueTimeout    = flag.String("on-queue-timeout", "fail", "When a queue timeout happens, [fail, continue]")
 	onConnectionError = flag.String("on-connection-error", "fail", "When a connection error happens, [fail, continue]")
 
+	gpuNames            = flag.String("gpu-name", "", "Comma separated patterns one of which the name or model of each GPU must match, e.g. '*RTX 4090'")
+	gpuVendorId         = flag.String("gpu-vendor-id", "", "The PCI vendor ID each GPU must have, e.g. 0x10de")
+	gpuDeviceIds        = flag.String("gpu-device-ids", "", "Comma separated PCI device IDs one of which each GPU must have")
+	minDriverVersion    = flag.String("min-driver-version", "", "The lowest driver version each GPU must have, e.g. 535.104")
+	excludeGpuNames     = flag.String("exclude-gpu-name", "", "Comma separated patterns of the names or models of GPUs never to use")
+	excludeGpuVendorIds = flag.String("exclude-gpu-vendor-id", "", "Comma separated PCI vendor IDs of GPUs never to use")
+	computeShare        = flag.Uint("compute-share", 0, "The percentage of the compute of each GPU reserved for the session, 0 to reserve none")
+
+	leaseTtl = flag.Uint("lease-ttl", 30, "Number of seconds the controller keeps the session without hearing from juicify, 0 to not hold a lease")
+
 	juicePath = flag.String("juice-path", "", "Path to the juice executables if different than current executable path")
 
 	errInvalidSessionState  = errors.New("session state is invalid")
@@ -58,6 +70,138 @@ func validateConfiguration(config *Configuration) error {
 	return nil
 }
 
+func splitList(value string) []string {
+	var values []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			values = append(values, entry)
+		}
+	}
+
+	return values
+}
+
+// parseIds parses a comma separated list of decimal or 0x prefixed hexadecimal
+// PCI IDs
+func parseIds(name string, value string) ([]uint32, error) {
+	var ids []uint32
+	for _, entry := range splitList(value) {
+		id, err := strconv.ParseUint(entry, 0, 32)
+		if err != nil {
+			return nil, errors.Newf("--%s has an invalid ID '%s'", name, entry).Wrap(err)
+		}
+
+		ids = append(ids, uint32(id))
+	}
+
+	return ids, nil
+}
+
+// applyGpuFlags restricts the kind and compute share of every GPU requested to
+// those given on the command line, overriding the requirements of juice.cfg
+func applyGpuFlags(config *Configuration) error {
+	vendorIds, err := parseIds("gpu-vendor-id", *gpuVendorId)
+	if err != nil {
+		return err
+	}
+	if len(vendorIds) > 1 {
+		return errors.New("--gpu-vendor-id expects a single ID")
+	}
+
+	deviceIds, err := parseIds("gpu-device-ids", *gpuDeviceIds)
+	if err != nil {
+		return err
+	}
+
+	excludedVendorIds, err := parseIds("exclude-gpu-vendor-id", *excludeGpuVendorIds)
+	if err != nil {
+		return err
+	}
+
+	var exclusions []restapi.GpuExclusion
+	if names := splitList(*excludeGpuNames); len(names) > 0 {
+		exclusions = append(exclusions, restapi.GpuExclusion{Names: names})
+	}
+	for _, vendorId := range excludedVendorIds {
+		exclusions = append(exclusions, restapi.GpuExclusion{VendorId: vendorId})
+	}
+
+	for index := range config.Requirements.Gpus {
+		gpu := &config.Requirements.Gpus[index]
+
+		if names := splitList(*gpuNames); len(names) > 0 {
+			gpu.Names = names
+		}
+
+		if len(vendorIds) > 0 {
+			gpu.VendorId = vendorIds[0]
+		}
+
+		if len(deviceIds) > 0 {
+			gpu.DeviceIds = deviceIds
+		}
+
+		if *minDriverVersion != "" {
+			gpu.MinDriverVersion = *minDriverVersion
+		}
+
+		if *computeShare != 0 {
+			gpu.ComputeShare = int(*computeShare)
+		}
+
+		gpu.Exclude = append(gpu.Exclude, exclusions...)
+
+		err = gpu.Validate()
+		if err != nil {
+			return errInvalidConfiguration.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// watchSession streams the events of the session, the channel is nil if the
+// server does not provide events and is closed if the stream ends
+func watchSession(group task.Group, api restapi.Client, id string) (<-chan restapi.Event, func()) {
+	stream, err := api.WatchEventsWithContext(group.Ctx(), restapi.EventFilter{
+		SessionId: id,
+	})
+	if err != nil {
+		if !errors.Is(err, restapi.ErrEventsUnsupported) {
+			logger.Debugf("unable to watch session %s, %s", id, err.Error())
+		}
+
+		return nil, func() {}
+	}
+
+	events := make(chan restapi.Event)
+	done := make(chan struct{})
+
+	group.GoFn("Session Events", func(group task.Group) error {
+		defer close(events)
+
+		for {
+			event, err := stream.Next()
+			if err != nil {
+				return nil
+			}
+
+			select {
+			case <-done:
+				return nil
+
+			case events <- event:
+			}
+		}
+	})
+
+	return events, func() {
+		close(done)
+		stream.Close()
+	}
+}
+
 func waitForSession(group task.Group, api restapi.Client, id string) (restapi.Session, error) {
 	session, err := api.GetSessionWithContext(group.Ctx(), id)
 	if err != nil {
@@ -89,6 +233,22 @@ func waitForSession(group task.Group, api restapi.Client, id string) (restapi.Se
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
 
+		// Wait on the state changes of the session, falling back to polling
+		// when the server does not provide events
+		events, closeEvents := watchSession(group, api, id)
+		defer closeEvents()
+
+		var tickerChannel <-chan time.Time
+		if events == nil {
+			tickerChannel = ticker.C
+		} else {
+			// The state may have changed before the stream was opened
+			session, err = api.GetSessionWithContext(group.Ctx(), id)
+			if err != nil {
+				return restapi.Session{}, err
+			}
+		}
+
 		for session.State != restapi.SessionActive {
 			if session.State == restapi.SessionCanceling || session.State == restapi.SessionClosed {
 				return restapi.Session{}, errors.Newf("session state is %s", session.State).Wrap(errInvalidSessionState)
@@ -101,7 +261,18 @@ func waitForSession(group task.Group, api restapi.Client, id string) (restapi.Se
 			case <-timeoutChannel:
 				err = errQueueTimeout
 
-			case <-ticker.C:
+			case event, ok := <-events:
+				if !ok {
+					logger.Debugf("session %s events ended, polling instead", id)
+					events = nil
+					tickerChannel = ticker.C
+				} else if event.State == session.State {
+					continue
+				}
+
+				session, err = api.GetSessionWithContext(group.Ctx(), id)
+
+			case <-tickerChannel:
 				session, err = api.GetSessionWithContext(group.Ctx(), id)
 			}
 
@@ -116,6 +287,44 @@ func waitForSession(group task.Group, api restapi.Client, id string) (restapi.Se
 	return session, nil
 }
 
+// renewLease renews the lease of the session in the background until the group
+// is done. Renewal stops once the session is closed or if the server does not
+// provide leases.
+func renewLease(group task.Group, api restapi.Client, id string) {
+	if *leaseTtl == 0 {
+		return
+	}
+
+	group.GoFn("Session Lease", func(g task.Group) error {
+		params := restapi.LeaseParams{
+			Ttl: int64(*leaseTtl),
+		}
+
+		// Renewed well ahead of expiring to tolerate a failed attempt
+		ticker := time.NewTicker(time.Duration(*leaseTtl) * time.Second / 3)
+		defer ticker.Stop()
+
+		for {
+			_, err := api.RenewSessionLeaseWithContext(group.Ctx(), id, params)
+			if err != nil {
+				if errors.Is(err, restapi.ErrNotFound) || errors.Is(err, restapi.ErrConflict) {
+					logger.Debugf("no longer renewing the lease of session %s, %s", id, err.Error())
+					return nil
+				}
+
+				logger.Warningf("unable to renew the lease of session %s, %s", id, err.Error())
+			}
+
+			select {
+			case <-group.Ctx().Done():
+				return nil
+
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
 func requestSession(group task.Group, api *restapi.Client, config *Configuration) error {
 	logger.Infof("Connecting to %s", config.Servers[0])
 
@@ -124,6 +333,10 @@ func requestSession(group task.Group, api *restapi.Client, config *Configuration
 		return err
 	}
 
+	// The lease is held with the controller, the address is replaced by the
+	// address of the agent once the session is ready
+	renewLease(group, *api, id)
+
 	session, err := waitForSession(group, *api, id)
 	if err != nil {
 		if !errors.Is(err, errInvalidSessionState) {
@@ -241,11 +454,20 @@ func Run(group task.Group) error {
 		config.AccessToken = *accessToken
 	}
 
+	if *poolId != "" {
+		config.Requirements.PoolId = *poolId
+	}
+
 	err = validateConfiguration(&config)
 	if err != nil {
 		return err
 	}
 
+	err = applyGpuFlags(&config)
+	if err != nil {
+		return err
+	}
+
 	api := restapi.Client{
 		Client:      &http.Client{},
 		Address:     config.Servers[0],
@@ -6,6 +6,7 @@ require (
 	github.com/NVIDIA/go-nvml v0.12.0-1
 	github.com/google/uuid v1.3.1
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.5.0
 	github.com/lib/pq v1.10.9
 	github.com/prometheus/client_golang v1.16.0
 	golang.org/x/sys v0.12.0
@@ -74,3 +74,7 @@ func Unwrap(err error) error {
 func Is(err error, target error) bool {
 	return errors.Is(err, target)
 }
+
+func As(err error, target any) bool {
+	return errors.As(err, target)
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
 	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
@@ -15,17 +16,22 @@ import (
 type Gpu struct {
 	restapi.Gpu
 
-	vramAvailable uint64
+	vramAvailable    uint64
+	computeAvailable int // The percentage of the compute not yet selected
+	sessions         int // The number of selections sharing the GPU
 }
 
 type GpuSet struct {
 	gpus []*Gpu
+
+	strategy PlacementStrategy
 }
 
 type SelectedGpu struct {
 	gpu *Gpu
 
 	vramRequired uint64
+	computeShare int
 }
 
 type SelectedGpuSet struct {
@@ -34,13 +40,18 @@ type SelectedGpuSet struct {
 	released bool
 }
 
+func newGpu(apiGpu restapi.Gpu) *Gpu {
+	return &Gpu{
+		Gpu:              apiGpu,
+		vramAvailable:    apiGpu.Vram,
+		computeAvailable: restapi.MaxComputeShare,
+	}
+}
+
 func NewGpuSet(apiGpus []restapi.Gpu) *GpuSet {
 	gpus := make([]*Gpu, 0)
 	for _, gpu := range apiGpus {
-		gpus = append(gpus, &Gpu{
-			Gpu:           gpu,
-			vramAvailable: gpu.Vram,
-		})
+		gpus = append(gpus, newGpu(gpu))
 	}
 
 	return &GpuSet{
@@ -61,10 +72,7 @@ func NewGpuSetFromJson(data []byte) (*GpuSet, error) {
 
 	gpus := make([]*Gpu, 0)
 	for _, apiGpu := range apiGpus {
-		gpus = append(gpus, &Gpu{
-			Gpu:           apiGpu,
-			vramAvailable: apiGpu.Vram,
-		})
+		gpus = append(gpus, newGpu(apiGpu))
 	}
 
 	return &GpuSet{
@@ -76,6 +84,32 @@ func (gpuSet *GpuSet) Count() int {
 	return len(gpuSet.gpus)
 }
 
+func (gpuSet *GpuSet) SetPlacementStrategy(strategy PlacementStrategy) {
+	gpuSet.strategy = strategy
+}
+
+func (gpuSet *GpuSet) PlacementStrategy() PlacementStrategy {
+	return gpuSet.strategy
+}
+
+// SetMaxSessions limits the number of sessions sharing each GPU, zero removes
+// the limit
+func (gpuSet *GpuSet) SetMaxSessions(maxSessions int) {
+	for _, gpu := range gpuSet.gpus {
+		gpu.MaxSessions = maxSessions
+	}
+}
+
+// VramAvailable returns the total VRAM not yet selected across all of the GPUs
+func (gpuSet *GpuSet) VramAvailable() uint64 {
+	var vramAvailable uint64
+	for _, gpu := range gpuSet.gpus {
+		vramAvailable += gpu.vramAvailable
+	}
+
+	return vramAvailable
+}
+
 func (gpuSet *SelectedGpuSet) Count() int {
 	return len(gpuSet.gpus)
 }
@@ -84,6 +118,8 @@ func (gpuSet *GpuSet) GetGpus() []restapi.Gpu {
 	publicGpus := make([]restapi.Gpu, len(gpuSet.gpus))
 	for index, gpu := range gpuSet.gpus {
 		publicGpus[index] = gpu.Gpu
+		publicGpus[index].ComputeShareAllocated = restapi.MaxComputeShare - gpu.computeAvailable
+		publicGpus[index].SessionsAllocated = gpu.sessions
 	}
 
 	return publicGpus
@@ -95,6 +131,7 @@ func (gpuSet *SelectedGpuSet) GetGpus() []restapi.SessionGpu {
 		publicGpus[index] = restapi.SessionGpu{
 			Index:        gpu.gpu.Index,
 			VramRequired: gpu.vramRequired,
+			ComputeShare: gpu.computeShare,
 		}
 	}
 
@@ -134,47 +171,69 @@ func (gpuSet *GpuSet) Find(requirements []restapi.GpuRequirements) (*SelectedGpu
 		logger.Panic("GpuSet.Find: expected at least one GPU requirement")
 	}
 
-	// Currently, this algorithm will choose the first GPU that matches both VRAM and the PCIBus, if specified.
-	// This algorithm does not allow GPUs to be reused though there is no reason why the GPUs could not be reused,
-	// though not preferrable if other GPUs are available.
+	// Each requirement is matched to a distinct GPU, chosen by the placement strategy from the GPUs that
+	// satisfy the VRAM, the compute share, the PCIBus and the kind of GPU, if specified, and are shared by
+	// fewer sessions than their limit. GPUs are visited in index order so the
+	// choice is deterministic. Requirements pinned to a PCIBus are placed first, then those restricting the
+	// kind of GPU, followed by the remaining requirements from largest to smallest so the large requests are
+	// not starved by the small ones.
 
-	// TODO: Better matching algorithm. Reuse of the same GPU can be done but should be the last option
+	// TODO: Reuse of the same GPU can be done but should be the last option
 
-	availableGpus := map[int]*Gpu{}
-	for index, gpu := range gpuSet.gpus {
-		availableGpus[index] = gpu
+	order := make([]int, len(requirements))
+	for index := range order {
+		order[index] = index
 	}
 
-	selectedGpus := make([]SelectedGpu, 0)
-	for _, requirement := range requirements {
-		for index, potentialGpu := range availableGpus {
-			if requirement.VramRequired != 0 && potentialGpu.vramAvailable < requirement.VramRequired {
+	sort.SliceStable(order, func(i, j int) bool {
+		lhs, rhs := requirements[order[i]], requirements[order[j]]
+		if (lhs.PciBus != "") != (rhs.PciBus != "") {
+			return lhs.PciBus != ""
+		}
+
+		if constrained(lhs) != constrained(rhs) {
+			return constrained(lhs)
+		}
+
+		return lhs.VramRequired > rhs.VramRequired
+	})
+
+	used := make([]bool, len(gpuSet.gpus))
+	selectedGpus := make([]SelectedGpu, len(requirements))
+	for _, requirementIndex := range order {
+		requirement := requirements[requirementIndex]
+
+		chosen := -1
+		for index, potentialGpu := range gpuSet.gpus {
+			if used[index] {
 				continue
 			}
 
-			if requirement.PciBus != "" {
-				potential := NewPCIAddressFromString(potentialGpu.PciBus)
-				required := NewPCIAddressFromString(requirement.PciBus)
-				if potential != required {
-					continue
-				}
+			if potentialGpu.mismatch(requirement) != matched {
+				continue
 			}
 
-			selectedGpus = append(selectedGpus, SelectedGpu{
-				gpu:          potentialGpu,
-				vramRequired: requirement.VramRequired,
-			})
+			if chosen == -1 || gpuSet.strategy.Prefers(potentialGpu.vramAvailable, gpuSet.gpus[chosen].vramAvailable) {
+				chosen = index
+			}
+		}
 
-			delete(availableGpus, index)
+		if chosen == -1 {
+			return nil, errors.New("unable to find a matching set of GPUs")
 		}
-	}
 
-	if len(selectedGpus) < len(requirements) {
-		return nil, errors.New("unable to find a matching set of GPUs")
+		used[chosen] = true
+		selectedGpus[requirementIndex] = SelectedGpu{
+			gpu:          gpuSet.gpus[chosen],
+			vramRequired: requirement.VramRequired,
+			computeShare: requirement.ComputeShare,
+		}
 	}
 
 	for _, gpu := range selectedGpus {
 		gpu.gpu.vramAvailable -= gpu.vramRequired
+		gpu.gpu.computeAvailable -= gpu.computeShare
+		gpu.gpu.sessions++
 	}
 
 	return &SelectedGpuSet{
@@ -183,6 +242,29 @@ func (gpuSet *GpuSet) Find(requirements []restapi.GpuRequirements) (*SelectedGpu
 	}, nil
 }
 
+// Explain returns why each GPU cannot satisfy each requirement, requirements
+// which some GPU satisfies are omitted. Every requirement may be satisfied yet
+// Find still fail when the requirements outnumber the GPUs satisfying them.
+func (gpuSet *GpuSet) Explain(requirements []restapi.GpuRequirements) []string {
+	reasons := make([]string, 0)
+	for requirementIndex, requirement := range requirements {
+		var mismatches []string
+		for _, potentialGpu := range gpuSet.gpus {
+			reason := potentialGpu.mismatch(requirement)
+			if reason == matched {
+				mismatches = nil
+				break
+			}
+
+			mismatches = append(mismatches, fmt.Sprintf("GPU %d %s for requirement %d", potentialGpu.Index, potentialGpu.describe(reason, requirement), requirementIndex))
+		}
+
+		reasons = append(reasons, mismatches...)
+	}
+
+	return reasons
+}
+
 func (gpuSet *GpuSet) Select(chosenGpus []restapi.SessionGpu) (*SelectedGpuSet, error) {
 	if len(chosenGpus) == 0 {
 		logger.Panic("GpuSet.Select: expected at least one chosen GPU")
@@ -194,8 +276,11 @@ func (gpuSet *GpuSet) Select(chosenGpus []restapi.SessionGpu) (*SelectedGpuSet,
 		selectedGpus = append(selectedGpus, SelectedGpu{
 			gpu:          gpu,
 			vramRequired: chosenGpu.VramRequired,
+			computeShare: chosenGpu.ComputeShare,
 		})
 		gpu.vramAvailable -= chosenGpu.VramRequired
+		gpu.computeAvailable -= chosenGpu.ComputeShare
+		gpu.sessions++
 	}
 
 	return &SelectedGpuSet{
@@ -211,6 +296,8 @@ func (gpuSet *SelectedGpuSet) Release() {
 
 	for _, gpu := range gpuSet.gpus {
 		gpu.gpu.vramAvailable += gpu.vramRequired
+		gpu.gpu.computeAvailable += gpu.computeShare
+		gpu.gpu.sessions--
 	}
 
 	gpuSet.released = true
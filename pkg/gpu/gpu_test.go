@@ -0,0 +1,289 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package gpu
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+const gigabyte = 1024 * 1024 * 1024
+
+func createGpuSet(strategy PlacementStrategy, vram ...uint64) *GpuSet {
+	gpus := make([]restapi.Gpu, len(vram))
+	for index := range gpus {
+		gpus[index] = restapi.Gpu{
+			Index: index,
+			Name:  "Test",
+			Vram:  vram[index],
+		}
+	}
+
+	gpuSet := NewGpuSet(gpus)
+	gpuSet.SetPlacementStrategy(strategy)
+	return gpuSet
+}
+
+func requirements(vram ...uint64) []restapi.GpuRequirements {
+	requirements := make([]restapi.GpuRequirements, len(vram))
+	for index := range requirements {
+		requirements[index] = restapi.GpuRequirements{
+			VramRequired: vram[index],
+		}
+	}
+
+	return requirements
+}
+
+func indices(gpuSet *SelectedGpuSet) []int {
+	indices := make([]int, 0)
+	for _, gpu := range gpuSet.GetGpus() {
+		indices = append(indices, gpu.Index)
+	}
+
+	return indices
+}
+
+func TestParsePlacementStrategy(t *testing.T) {
+	tests := map[string]PlacementStrategy{
+		"first-fit":  FirstFit,
+		"Best-Fit":   BestFit,
+		" worst-fit": WorstFit,
+		"spread":     WorstFit,
+	}
+
+	for value, expected := range tests {
+		strategy, err := ParsePlacementStrategy(value)
+		if err != nil {
+			t.Error(err)
+		} else if strategy != expected {
+			t.Errorf("expected %s for '%s', got %s", expected, value, strategy)
+		}
+	}
+
+	_, err := ParsePlacementStrategy("random")
+	if err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name         string
+		strategy     PlacementStrategy
+		vram         []uint64
+		requirements []restapi.GpuRequirements
+		expected     []int
+	}{
+		{"first-fit", FirstFit, []uint64{24 * gigabyte, 8 * gigabyte, 16 * gigabyte}, requirements(4 * gigabyte), []int{0}},
+		{"best-fit", BestFit, []uint64{24 * gigabyte, 8 * gigabyte, 16 * gigabyte}, requirements(4 * gigabyte), []int{1}},
+		{"worst-fit", WorstFit, []uint64{8 * gigabyte, 24 * gigabyte, 16 * gigabyte}, requirements(4 * gigabyte), []int{1}},
+		{"best-fit skips too small", BestFit, []uint64{24 * gigabyte, 8 * gigabyte, 16 * gigabyte}, requirements(12 * gigabyte), []int{2}},
+		{"best-fit ties", BestFit, []uint64{16 * gigabyte, 8 * gigabyte, 8 * gigabyte}, requirements(4 * gigabyte), []int{1}},
+		{"multiple", BestFit, []uint64{24 * gigabyte, 8 * gigabyte, 16 * gigabyte}, requirements(4*gigabyte, 20*gigabyte), []int{1, 0}},
+		{"largest first", FirstFit, []uint64{8 * gigabyte, 24 * gigabyte}, requirements(4*gigabyte, 16*gigabyte), []int{0, 1}},
+		{"largest first reordered", FirstFit, []uint64{24 * gigabyte, 8 * gigabyte}, requirements(4*gigabyte, 16*gigabyte), []int{1, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Repeat to ensure the choice is deterministic
+			for i := 0; i < 10; i++ {
+				gpuSet := createGpuSet(test.strategy, test.vram...)
+
+				selectedGpus, err := gpuSet.Find(test.requirements)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(indices(selectedGpus), test.expected) {
+					t.Fatalf("expected GPUs %v, got %v", test.expected, indices(selectedGpus))
+				}
+			}
+		})
+	}
+}
+
+func TestFindFailure(t *testing.T) {
+	gpuSet := createGpuSet(BestFit, 8*gigabyte, 8*gigabyte)
+
+	// Each requirement must be placed on a distinct GPU
+	_, err := gpuSet.Find(requirements(4*gigabyte, 4*gigabyte, 4*gigabyte))
+	if err == nil {
+		t.Error("expected more requirements than GPUs to fail")
+	}
+
+	_, err = gpuSet.Find(requirements(16 * gigabyte))
+	if err == nil {
+		t.Error("expected a requirement larger than any GPU to fail")
+	}
+
+	if gpuSet.VramAvailable() != 16*gigabyte {
+		t.Error("expected a failed Find to leave the VRAM available")
+	}
+}
+
+func TestFindFragmentation(t *testing.T) {
+	// With best-fit, small sessions are packed together leaving room for a large session
+	gpuSet := createGpuSet(BestFit, 24*gigabyte, 24*gigabyte)
+
+	for i := 0; i < 4; i++ {
+		_, err := gpuSet.Find(requirements(4 * gigabyte))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	selectedGpus, err := gpuSet.Find(requirements(24 * gigabyte))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(indices(selectedGpus), []int{1}) {
+		t.Errorf("expected the large session on GPU 1, got %v", indices(selectedGpus))
+	}
+
+	selectedGpus.Release()
+	if gpuSet.VramAvailable() != 32*gigabyte {
+		t.Errorf("expected 32GB available after release, got %d", gpuSet.VramAvailable())
+	}
+}
+
+func TestFindKind(t *testing.T) {
+	gpus := []restapi.Gpu{
+		{Index: 0, Name: "Intel(R) UHD Graphics 770", VendorId: 0x8086, DeviceId: 0x4680, Driver: "31.0.101.4502", Vram: 2 * gigabyte},
+		{Index: 1, Name: "NVIDIA GeForce RTX 3090", VendorId: 0x10de, DeviceId: 0x2204, Driver: "535.104.05", Vram: 24 * gigabyte},
+		{Index: 2, Name: "NVIDIA GeForce RTX 4090", VendorId: 0x10de, DeviceId: 0x2684, Driver: "545.23.06", Vram: 24 * gigabyte},
+	}
+
+	tests := []struct {
+		name         string
+		requirements []restapi.GpuRequirements
+		expected     []int
+	}{
+		{"name pattern", []restapi.GpuRequirements{{Names: []string{"*rtx 4090"}}}, []int{2}},
+		{"vendor", []restapi.GpuRequirements{{VendorId: 0x10de}}, []int{1}},
+		{"device ids", []restapi.GpuRequirements{{DeviceIds: []uint32{0x2684, 0x2685}}}, []int{2}},
+		{"minimum driver", []restapi.GpuRequirements{{VendorId: 0x10de, MinDriverVersion: "545"}}, []int{2}},
+		{"exclusion", []restapi.GpuRequirements{{Exclude: []restapi.GpuExclusion{{VendorId: 0x8086}}}}, []int{1}},
+		{"exclusion of every field", []restapi.GpuRequirements{{Exclude: []restapi.GpuExclusion{{Names: []string{"*3090"}, VendorId: 0x8086}}}}, []int{0}},
+		{"constrained first", []restapi.GpuRequirements{{}, {VendorId: 0x8086}}, []int{1, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gpuSet := NewGpuSet(gpus)
+
+			selectedGpus, err := gpuSet.Find(test.requirements)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(indices(selectedGpus), test.expected) {
+				t.Fatalf("expected GPUs %v, got %v", test.expected, indices(selectedGpus))
+			}
+		})
+	}
+
+	_, err := NewGpuSet(gpus).Find([]restapi.GpuRequirements{{VendorId: 0x1002}})
+	if err == nil {
+		t.Error("expected a requirement no GPU satisfies to fail")
+	}
+
+	_, err = NewGpuSet(gpus).Find([]restapi.GpuRequirements{{MinDriverVersion: "546.1"}})
+	if err == nil {
+		t.Error("expected a driver newer than every GPU to fail")
+	}
+}
+
+func TestValidateGpuRequirements(t *testing.T) {
+	for _, test := range []struct {
+		requirements restapi.GpuRequirements
+		valid        bool
+	}{
+		{restapi.GpuRequirements{Names: []string{"*RTX 40[0-9]0*"}, MinDriverVersion: "535.104"}, true},
+		{restapi.GpuRequirements{Names: []string{"[RTX"}}, false},
+		{restapi.GpuRequirements{MinDriverVersion: "r535"}, false},
+		{restapi.GpuRequirements{Exclude: []restapi.GpuExclusion{{VendorId: 0x8086}}}, true},
+		{restapi.GpuRequirements{Exclude: []restapi.GpuExclusion{{}}}, false},
+		{restapi.GpuRequirements{ComputeShare: restapi.MaxComputeShare}, true},
+		{restapi.GpuRequirements{ComputeShare: restapi.MaxComputeShare + 1}, false},
+	} {
+		if err := test.requirements.Validate(); (err == nil) != test.valid {
+			t.Errorf("expected %+v to be valid %v, got %v", test.requirements, test.valid, err)
+		}
+	}
+}
+
+func TestFindComputeShare(t *testing.T) {
+	gpuSet := createGpuSet(FirstFit, 24*gigabyte, 24*gigabyte)
+
+	share := func(computeShare int) []restapi.GpuRequirements {
+		return []restapi.GpuRequirements{{VramRequired: gigabyte, ComputeShare: computeShare}}
+	}
+
+	first, err := gpuSet.Find(share(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first GPU has VRAM left but not enough compute
+	second, err := gpuSet.Find(share(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(indices(second), []int{1}) {
+		t.Errorf("expected the GPU with enough compute left, got %v", indices(second))
+	}
+
+	if gpus := second.GetGpus(); gpus[0].ComputeShare != 50 {
+		t.Errorf("expected the selected GPU to hold the compute share, got %d", gpus[0].ComputeShare)
+	}
+
+	_, err = gpuSet.Find(share(60))
+	if err == nil {
+		t.Error("expected a compute share larger than any GPU has left to fail")
+	}
+
+	gpus := gpuSet.GetGpus()
+	if gpus[0].ComputeShareAllocated != 60 || gpus[1].ComputeShareAllocated != 50 || gpus[0].SessionsAllocated != 1 {
+		t.Errorf("expected the allocated shares to be reported, got %+v", gpus)
+	}
+
+	first.Release()
+
+	// Sessions without a compute share are only limited by the number of
+	// sessions sharing a GPU
+	gpuSet.SetMaxSessions(2)
+
+	for _, expected := range [][]int{{0}, {0}, {1}} {
+		selectedGpus, err := gpuSet.Find(share(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(indices(selectedGpus), expected) {
+			t.Errorf("expected GPUs %v, got %v", expected, indices(selectedGpus))
+		}
+	}
+
+	_, err = gpuSet.Find(share(0))
+	if err == nil {
+		t.Error("expected every GPU shared by the most sessions to fail")
+	}
+
+	// Selecting the GPUs of existing sessions accounts for their shares
+	restored := createGpuSet(FirstFit, 24*gigabyte, 24*gigabyte)
+	_, err = restored.Select(second.GetGpus())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gpus := restored.GetGpus(); gpus[1].ComputeShareAllocated != 50 || gpus[1].SessionsAllocated != 1 {
+		t.Errorf("expected the selected share to be allocated, got %+v", gpus[1])
+	}
+}
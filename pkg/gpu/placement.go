@@ -0,0 +1,70 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package gpu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PlacementStrategy determines which GPU, or agent, is chosen when more than
+// one is able to satisfy a request.
+type PlacementStrategy int
+
+const (
+	// FirstFit chooses the first candidate able to satisfy the request
+	FirstFit PlacementStrategy = iota
+	// BestFit chooses the candidate left with the least VRAM available,
+	// packing sessions together to keep large blocks of VRAM free
+	BestFit
+	// WorstFit chooses the candidate left with the most VRAM available,
+	// spreading sessions out across the candidates
+	WorstFit
+)
+
+var placementStrategies = map[PlacementStrategy]string{
+	FirstFit: "first-fit",
+	BestFit:  "best-fit",
+	WorstFit: "worst-fit",
+}
+
+func ParsePlacementStrategy(value string) (PlacementStrategy, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for strategy, name := range placementStrategies {
+		if name == value {
+			return strategy, nil
+		}
+	}
+
+	// Allow spread as an alias of worst-fit
+	if value == "spread" {
+		return WorstFit, nil
+	}
+
+	return FirstFit, fmt.Errorf("unknown placement strategy '%s', expected one of first-fit, best-fit or worst-fit", value)
+}
+
+func (strategy PlacementStrategy) String() string {
+	name, found := placementStrategies[strategy]
+	if !found {
+		return fmt.Sprintf("PlacementStrategy(%d)", int(strategy))
+	}
+
+	return name
+}
+
+// Prefers returns true if a candidate left with vramAvailable should be chosen
+// over the current choice left with currentVramAvailable. Candidates are
+// expected to be visited in a deterministic order, ties favor the current choice.
+func (strategy PlacementStrategy) Prefers(vramAvailable uint64, currentVramAvailable uint64) bool {
+	switch strategy {
+	case BestFit:
+		return vramAvailable < currentVramAvailable
+
+	case WorstFit:
+		return vramAvailable > currentVramAvailable
+	}
+
+	return false
+}
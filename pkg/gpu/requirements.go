@@ -0,0 +1,180 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package gpu
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+// matchesName returns whether the name or model of the GPU matches one of the
+// patterns, ignoring case. Invalid patterns never match.
+func matchesName(gpu restapi.Gpu, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for _, name := range []string{gpu.Name, gpu.Model} {
+			if name == "" {
+				continue
+			}
+
+			matched, err := path.Match(pattern, strings.ToLower(name))
+			if err == nil && matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func containsDeviceId(deviceIds []uint32, deviceId uint32) bool {
+	for _, id := range deviceIds {
+		if id == deviceId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// atLeastVersion returns whether the driver version is the minimum or later,
+// versions which cannot be parsed never are
+func atLeastVersion(version string, minimum string) bool {
+	have, err := restapi.ParseDriverVersion(version)
+	if err != nil {
+		return false
+	}
+
+	want, err := restapi.ParseDriverVersion(minimum)
+	if err != nil {
+		return false
+	}
+
+	for index := 0; index < len(have) || index < len(want); index++ {
+		var lhs, rhs uint64
+		if index < len(have) {
+			lhs = have[index]
+		}
+		if index < len(want) {
+			rhs = want[index]
+		}
+
+		if lhs != rhs {
+			return lhs > rhs
+		}
+	}
+
+	return true
+}
+
+// excludes returns whether the GPU matches every field set by the exclusion
+func excludes(exclusion restapi.GpuExclusion, gpu restapi.Gpu) bool {
+	if len(exclusion.Names) == 0 && exclusion.VendorId == 0 && len(exclusion.DeviceIds) == 0 {
+		return false
+	}
+
+	return (len(exclusion.Names) == 0 || matchesName(gpu, exclusion.Names)) &&
+		(exclusion.VendorId == 0 || exclusion.VendorId == gpu.VendorId) &&
+		(len(exclusion.DeviceIds) == 0 || containsDeviceId(exclusion.DeviceIds, gpu.DeviceId))
+}
+
+// constrained returns whether the requirement restricts the kind of GPU
+func constrained(requirement restapi.GpuRequirements) bool {
+	return len(requirement.Names) > 0 || requirement.VendorId != 0 || len(requirement.DeviceIds) > 0 ||
+		requirement.MinDriverVersion != "" || len(requirement.Exclude) > 0
+}
+
+// satisfies returns whether the kind of the GPU satisfies the requirement,
+// regardless of its VRAM and PCI bus
+func satisfies(gpu restapi.Gpu, requirement restapi.GpuRequirements) bool {
+	if len(requirement.Names) > 0 && !matchesName(gpu, requirement.Names) {
+		return false
+	}
+
+	if requirement.VendorId != 0 && requirement.VendorId != gpu.VendorId {
+		return false
+	}
+
+	if len(requirement.DeviceIds) > 0 && !containsDeviceId(requirement.DeviceIds, gpu.DeviceId) {
+		return false
+	}
+
+	if requirement.MinDriverVersion != "" && !atLeastVersion(gpu.Driver, requirement.MinDriverVersion) {
+		return false
+	}
+
+	for _, exclusion := range requirement.Exclude {
+		if excludes(exclusion, gpu) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The reasons a GPU cannot satisfy a requirement
+type mismatchReason int
+
+const (
+	matched mismatchReason = iota
+	mismatchVram
+	mismatchCompute
+	mismatchSessions
+	mismatchPciBus
+	mismatchKind
+)
+
+// mismatch returns why the GPU cannot satisfy the requirement given what is
+// already selected on it, matched when it can
+func (gpu *Gpu) mismatch(requirement restapi.GpuRequirements) mismatchReason {
+	if requirement.VramRequired != 0 && gpu.vramAvailable < requirement.VramRequired {
+		return mismatchVram
+	}
+
+	if requirement.ComputeShare != 0 && gpu.computeAvailable < requirement.ComputeShare {
+		return mismatchCompute
+	}
+
+	if gpu.MaxSessions != 0 && gpu.sessions >= gpu.MaxSessions {
+		return mismatchSessions
+	}
+
+	if requirement.PciBus != "" {
+		potential := NewPCIAddressFromString(gpu.PciBus)
+		required := NewPCIAddressFromString(requirement.PciBus)
+		if potential != required {
+			return mismatchPciBus
+		}
+	}
+
+	if !satisfies(gpu.Gpu, requirement) {
+		return mismatchKind
+	}
+
+	return matched
+}
+
+func (gpu *Gpu) describe(reason mismatchReason, requirement restapi.GpuRequirements) string {
+	switch reason {
+	case mismatchVram:
+		return fmt.Sprintf("has %dMB of VRAM available, %dMB required", gpu.vramAvailable/(1024*1024), requirement.VramRequired/(1024*1024))
+
+	case mismatchCompute:
+		return fmt.Sprintf("has %d%% of its compute available, %d%% required", gpu.computeAvailable, requirement.ComputeShare)
+
+	case mismatchSessions:
+		return fmt.Sprintf("is shared by its limit of %d sessions", gpu.MaxSessions)
+
+	case mismatchPciBus:
+		return fmt.Sprintf("is on PCI bus %s, %s required", gpu.PciBus, requirement.PciBus)
+
+	case mismatchKind:
+		return fmt.Sprintf("%s is not a kind of GPU requested", gpu.Name)
+	}
+
+	return "satisfies the requirement"
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log"
 	"net/http"
@@ -12,6 +13,8 @@ import (
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
 	"github.com/auth0/go-jwt-middleware/v2/jwks"
 	"github.com/auth0/go-jwt-middleware/v2/validator"
+
+	pkgnet "github.com/Juice-Labs/Juice-Labs/pkg/net"
 )
 
 // CustomClaims contains custom data we want from the token.
@@ -75,9 +78,7 @@ func EnsureValidToken() func(next http.Handler) http.Handler {
 	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
 		log.Printf("Encountered error while validating JWT: %v", err)
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(`{"message":"Failed to validate JWT."}`))
+		pkgnet.RespondWithError(w, http.StatusUnauthorized, errors.New("Failed to validate JWT."))
 	}
 
 	middleware := jwtmiddleware.New(
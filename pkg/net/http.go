@@ -9,6 +9,14 @@ import (
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/errors"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+var (
+	// Returned by ReadRequestBody when the body of the request cannot be read
+	ErrInvalidBody = errors.New("net: invalid request body")
 )
 
 func Respond[T any](w http.ResponseWriter, code int, obj T) error {
@@ -31,6 +39,19 @@ func RespondWithString(w http.ResponseWriter, code int, msg string) error {
 	return err
 }
 
+// RespondWithError responds with a restapi.ErrorResponse describing the error
+func RespondWithError(w http.ResponseWriter, code int, err error) error {
+	return RespondWithErrorDetails(w, code, err, nil)
+}
+
+func RespondWithErrorDetails(w http.ResponseWriter, code int, err error, details map[string]string) error {
+	return Respond(w, code, restapi.ErrorResponse{
+		Code:    restapi.ErrorCodeFromStatus(code),
+		Message: err.Error(),
+		Details: details,
+	})
+}
+
 func RespondEmpty(w http.ResponseWriter, code int) {
 	w.WriteHeader(code)
 }
@@ -141,7 +162,12 @@ func PostWithBodyNoResponse[T any](client *http.Client, url string, obj T) error
 }
 
 func ReadRequestBody[T any](r *http.Request) (T, error) {
-	return ReadBody[T](r.Header, http.StatusOK, r.Body, r.ContentLength)
+	value, err := ReadBody[T](r.Header, http.StatusOK, r.Body, r.ContentLength)
+	if err != nil {
+		return value, ErrInvalidBody.Wrap(err)
+	}
+
+	return value, nil
 }
 
 func ReadResponseBody[T any](r *http.Response) (T, error) {
@@ -0,0 +1,160 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package restapi
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/errors"
+)
+
+// The WebSocket subprotocol of an agent channel
+const AgentChannelProtocol = "juice-agent-channel/1"
+
+// The time given to the controller to acknowledge the channel being closed
+const channelCloseTimeout = 5 * time.Second
+
+var (
+	ErrChannelUnsupported = errors.New("client: server does not support agent channels")
+)
+
+// AgentChannel is a persistent WebSocket between an agent and the controller.
+// Each message is JSON, the agent sends AgentUpdates as they happen and the
+// controller sends the agent whenever its sessions or drain state change.
+type AgentChannel struct {
+	conn *websocket.Conn
+
+	writeMutex sync.Mutex
+}
+
+func (api Client) OpenAgentChannel(id string) (*AgentChannel, error) {
+	return api.OpenAgentChannelWithContext(context.Background(), id)
+}
+
+// channelDialer returns a dialer using the proxy, TLS configuration and dialer
+// of the transport of the client
+func (api Client) channelDialer() *websocket.Dialer {
+	dialer := &websocket.Dialer{
+		Proxy:        http.ProxyFromEnvironment,
+		Subprotocols: []string{AgentChannelProtocol},
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if api.Client != nil && api.Client.Transport != nil {
+		transport, ok = api.Client.Transport.(*http.Transport)
+	}
+
+	if ok {
+		dialer.Proxy = transport.Proxy
+		dialer.TLSClientConfig = transport.TLSClientConfig
+		dialer.NetDialContext = transport.DialContext
+	}
+
+	return dialer
+}
+
+// OpenAgentChannelWithContext upgrades a request to /v1/agent/{id}/channel into
+// an agent channel, the channel must be closed once it is no longer used. The
+// context only applies to opening the channel. Returns ErrChannelUnsupported if
+// the server does not provide agent channels and ErrNotFound if the agent is
+// unknown to the controller.
+func (api Client) OpenAgentChannelWithContext(ctx context.Context, id string) (*AgentChannel, error) {
+	header := http.Header{}
+	if api.AccessToken != "" {
+		header.Set("Authorization", fmt.Sprintf("Bearer %s", api.AccessToken))
+	}
+
+	channelUrl := url.URL{
+		Scheme: "wss",
+		Host:   api.Address,
+		Path:   fmt.Sprint("/v1/agent/", id, "/channel"),
+	}
+
+	dialer := api.channelDialer()
+
+	conn, response, err := dialer.DialContext(ctx, channelUrl.String(), header)
+
+	// As with requests, fall back to an unencrypted connection when the server
+	// does not use TLS
+	var recordHeaderError tls.RecordHeaderError
+	if errors.As(err, &recordHeaderError) {
+		channelUrl.Scheme = "ws"
+		conn, response, err = dialer.DialContext(ctx, channelUrl.String(), header)
+	}
+
+	if err == nil {
+		if conn.Subprotocol() != AgentChannelProtocol {
+			conn.Close()
+			return nil, ErrInvalidResponse.Wrap(errors.Newf("expected subprotocol %s, received %s", AgentChannelProtocol, conn.Subprotocol()))
+		}
+
+		return &AgentChannel{
+			conn: conn,
+		}, nil
+	}
+
+	if response == nil {
+		return nil, ErrUnableToConnect.Wrap(err)
+	}
+
+	defer response.Body.Close()
+
+	err = validateResponse(response)
+	if err == nil {
+		return nil, ErrInvalidResponse.Wrap(errors.Newf("expected status %d, received %d", http.StatusSwitchingProtocols, response.StatusCode))
+	}
+
+	// Servers without agent channels do not respond with an ErrorResponse,
+	// servers unable to upgrade the connection respond that it is not implemented
+	if response.StatusCode == http.StatusMethodNotAllowed || response.StatusCode == http.StatusNotImplemented ||
+		(response.StatusCode == http.StatusNotFound && response.Header.Get("Content-Type") != "application/json") {
+		return nil, ErrChannelUnsupported
+	}
+
+	return nil, err
+}
+
+// Send writes the update to the controller, safe to call concurrently
+func (channel *AgentChannel) Send(update AgentUpdate) error {
+	channel.writeMutex.Lock()
+	defer channel.writeMutex.Unlock()
+
+	err := channel.conn.WriteJSON(update)
+	if _, ok := err.(*json.UnsupportedTypeError); ok {
+		return ErrInvalidInput.Wrap(err)
+	}
+
+	return err
+}
+
+// Receive blocks until the controller sends the agent. Returns io.EOF once the
+// controller closes the channel.
+func (channel *AgentChannel) Receive() (Agent, error) {
+	var agent Agent
+	err := channel.conn.ReadJSON(&agent)
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		return Agent{}, io.EOF
+	}
+
+	return agent, err
+}
+
+// Close tells the controller the channel is being closed before closing it
+func (channel *AgentChannel) Close() error {
+	channel.writeMutex.Lock()
+	channel.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(channelCloseTimeout))
+	channel.writeMutex.Unlock()
+
+	return channel.conn.Close()
+}
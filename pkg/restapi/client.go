@@ -19,6 +19,7 @@ var (
 	ErrInvalidScheme   = errors.New("client: invalid scheme")
 	ErrInvalidInput    = errors.New("client: invalid input")
 	ErrInvalidResponse = errors.New("client: invalid response")
+	ErrNotFound        = errors.New("client: not found")
 )
 
 type Client struct {
@@ -27,14 +28,16 @@ type Client struct {
 	AccessToken string
 }
 
-func (api Client) doUrl(ctx context.Context, method string, urlString string, contentType string, body io.Reader) (*http.Response, error) {
+func (api Client) doUrl(ctx context.Context, method string, urlString string, header http.Header, body io.Reader) (*http.Response, error) {
 	request, err := http.NewRequestWithContext(ctx, method, urlString, body)
 	if err != nil {
 		return nil, err
 	}
 
-	if body != nil {
-		request.Header.Add("Content-Type", contentType)
+	for key, values := range header {
+		for _, value := range values {
+			request.Header.Add(key, value)
+		}
 	}
 
 	if api.AccessToken != "" {
@@ -60,6 +63,15 @@ func (api Client) doUrl(ctx context.Context, method string, urlString string, co
 }
 
 func (api Client) do(ctx context.Context, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	header := http.Header{}
+	if body != nil {
+		header.Set("Content-Type", contentType)
+	}
+
+	return api.doWithHeader(ctx, method, path, header, body)
+}
+
+func (api Client) doWithHeader(ctx context.Context, method string, path string, header http.Header, body io.Reader) (*http.Response, error) {
 	pathUrl, err := url.Parse(path)
 	if err != nil {
 		return nil, err
@@ -68,7 +80,7 @@ func (api Client) do(ctx context.Context, method string, path string, contentTyp
 	pathUrl.Scheme = "https"
 	pathUrl.Host = api.Address
 
-	response, err := api.doUrl(ctx, method, pathUrl.String(), contentType, body)
+	response, err := api.doUrl(ctx, method, pathUrl.String(), header, body)
 
 	if err == nil {
 		return response, nil
@@ -78,7 +90,7 @@ func (api Client) do(ctx context.Context, method string, path string, contentTyp
 
 	pathUrl.Scheme = "http"
 
-	return api.doUrl(ctx, method, pathUrl.String(), contentType, body)
+	return api.doUrl(ctx, method, pathUrl.String(), header, body)
 }
 
 func (api Client) Get(ctx context.Context, path string) (*http.Response, error) {
@@ -139,23 +151,71 @@ func (api Client) GetSessionWithContext(ctx context.Context, id string) (Session
 	return result, nil
 }
 
+// UpdateSession cancels a session updated to canceling or closed.
+//
+// Deprecated: Sessions are updated by their agent through UpdateAgent, use CancelSession.
 func (api Client) UpdateSession(session Session) error {
 	return api.UpdateSessionWithContext(context.Background(), session)
 }
 
+// UpdateSessionWithContext cancels a session updated to canceling or closed,
+// updates to any other state are rejected.
+//
+// Deprecated: Sessions are updated by their agent through UpdateAgentWithContext,
+// use CancelSessionWithContext.
 func (api Client) UpdateSessionWithContext(ctx context.Context, session Session) error {
-	body, err := jsonReaderFromObject(session)
+	if session.State != SessionCanceling && session.State != SessionClosed {
+		return ErrInvalidInput.Wrap(fmt.Errorf("sessions may only be updated to %s or %s", SessionCanceling, SessionClosed))
+	}
+
+	return api.CancelSessionWithContext(ctx, session.Id)
+}
+
+func (api Client) GetSessionPlacement(id string) (SessionPlacement, error) {
+	return api.GetSessionPlacementWithContext(context.Background(), id)
+}
+
+// GetSessionPlacementWithContext returns the scores of the agents considered as
+// the session was assigned
+func (api Client) GetSessionPlacementWithContext(ctx context.Context, id string) (SessionPlacement, error) {
+	response, err := api.Get(ctx, fmt.Sprint("/v1/session/", id, "/placement"))
 	if err != nil {
-		return ErrInvalidInput.Wrap(err)
+		return SessionPlacement{}, err
 	}
+	defer response.Body.Close()
 
-	response, err := api.PutWithJson(ctx, fmt.Sprint("/v1/session/", session.Id), body)
+	result, err := parseJsonResponse[SessionPlacement](response)
 	if err != nil {
-		return err
+		return SessionPlacement{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) ExplainScheduling(params ExplainParams) (SchedulingExplanation, error) {
+	return api.ExplainSchedulingWithContext(context.Background(), params)
+}
+
+// ExplainSchedulingWithContext returns why each agent of the pool of a queued
+// session, or of a session with the requirements, can or cannot host it
+func (api Client) ExplainSchedulingWithContext(ctx context.Context, params ExplainParams) (SchedulingExplanation, error) {
+	body, err := jsonReaderFromObject(params)
+	if err != nil {
+		return SchedulingExplanation{}, ErrInvalidInput.Wrap(err)
+	}
+
+	response, err := api.PostWithJson(ctx, "/v1/scheduler/explain", body)
+	if err != nil {
+		return SchedulingExplanation{}, err
 	}
 	defer response.Body.Close()
 
-	return validateResponse(response)
+	result, err := parseJsonResponse[SchedulingExplanation](response)
+	if err != nil {
+		return SchedulingExplanation{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
 }
 
 func (api Client) RequestSession(requirements SessionRequirements) (string, error) {
@@ -177,6 +237,228 @@ func (api Client) RequestSessionWithContext(ctx context.Context, requirements Se
 	return parseStringResponse(response)
 }
 
+func (api Client) GetSessionGroup(id string) (SessionGroup, error) {
+	return api.GetSessionGroupWithContext(context.Background(), id)
+}
+
+// GetSessionGroupWithContext returns the group along with its members, the
+// address of each member is set once the group is assigned
+func (api Client) GetSessionGroupWithContext(ctx context.Context, id string) (SessionGroup, error) {
+	response, err := api.Get(ctx, fmt.Sprint("/v1/group/", id))
+	if err != nil {
+		return SessionGroup{}, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[SessionGroup](response)
+	if err != nil {
+		return SessionGroup{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) RequestSessionGroup(requirements SessionGroupRequirements) (string, error) {
+	return api.RequestSessionGroupWithContext(context.Background(), requirements)
+}
+
+// RequestSessionGroupWithContext queues a group of sessions and returns the id
+// of the group
+func (api Client) RequestSessionGroupWithContext(ctx context.Context, requirements SessionGroupRequirements) (string, error) {
+	body, err := jsonReaderFromObject(requirements)
+	if err != nil {
+		return "", ErrInvalidInput.Wrap(err)
+	}
+
+	response, err := api.PostWithJson(ctx, "/v1/request/group", body)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	return parseStringResponse(response)
+}
+
+func (api Client) CancelSessionGroup(id string) error {
+	return api.CancelSessionGroupWithContext(context.Background(), id)
+}
+
+// CancelSessionGroupWithContext cancels every member of the group which has
+// yet to close
+func (api Client) CancelSessionGroupWithContext(ctx context.Context, id string) error {
+	response, err := api.Delete(ctx, fmt.Sprint("/v1/group/", id))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	return validateResponse(response)
+}
+
+func (api Client) ListSessions(query url.Values) (SessionPage, error) {
+	return api.ListSessionsWithContext(context.Background(), query)
+}
+
+// ListSessionsWithContext returns a page of the sessions matching the query, the
+// following page is requested by setting the cursor parameter to the Next of the page
+func (api Client) ListSessionsWithContext(ctx context.Context, query url.Values) (SessionPage, error) {
+	path := url.URL{
+		Path:     "/v1/sessions",
+		RawQuery: query.Encode(),
+	}
+
+	response, err := api.Get(ctx, path.String())
+	if err != nil {
+		return SessionPage{}, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[SessionPage](response)
+	if err != nil {
+		return SessionPage{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) GetUsage(query url.Values) (UsageReport, error) {
+	return api.GetUsageWithContext(context.Background(), query)
+}
+
+// GetUsageWithContext returns the usage of the sessions selected by the query
+// aggregated by the groups of the group_by parameter
+func (api Client) GetUsageWithContext(ctx context.Context, query url.Values) (UsageReport, error) {
+	path := url.URL{
+		Path:     "/v1/usage",
+		RawQuery: query.Encode(),
+	}
+
+	response, err := api.Get(ctx, path.String())
+	if err != nil {
+		return UsageReport{}, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[UsageReport](response)
+	if err != nil {
+		return UsageReport{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) GetUsageRecords(query url.Values) ([]UsageRecord, error) {
+	return api.GetUsageRecordsWithContext(context.Background(), query)
+}
+
+// GetUsageRecordsWithContext returns the usage records of the sessions closed
+// within the range of time of the query
+func (api Client) GetUsageRecordsWithContext(ctx context.Context, query url.Values) ([]UsageRecord, error) {
+	path := url.URL{
+		Path:     "/v1/usage/sessions",
+		RawQuery: query.Encode(),
+	}
+
+	response, err := api.Get(ctx, path.String())
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[[]UsageRecord](response)
+	if err != nil {
+		return nil, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) CreateReservation(reservation Reservation) (Reservation, error) {
+	return api.CreateReservationWithContext(context.Background(), reservation)
+}
+
+// CreateReservationWithContext reserves GPUs of a pool for the window of the
+// reservation, returning the reservation created
+func (api Client) CreateReservationWithContext(ctx context.Context, reservation Reservation) (Reservation, error) {
+	body, err := jsonReaderFromObject(reservation)
+	if err != nil {
+		return Reservation{}, ErrInvalidInput.Wrap(err)
+	}
+
+	response, err := api.PostWithJson(ctx, "/v1/reservations", body)
+	if err != nil {
+		return Reservation{}, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[Reservation](response)
+	if err != nil {
+		return Reservation{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) GetReservation(id string) (Reservation, error) {
+	return api.GetReservationWithContext(context.Background(), id)
+}
+
+func (api Client) GetReservationWithContext(ctx context.Context, id string) (Reservation, error) {
+	response, err := api.Get(ctx, fmt.Sprint("/v1/reservations/", id))
+	if err != nil {
+		return Reservation{}, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[Reservation](response)
+	if err != nil {
+		return Reservation{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) ListReservations(query url.Values) ([]Reservation, error) {
+	return api.ListReservationsWithContext(context.Background(), query)
+}
+
+// ListReservationsWithContext returns the reservations matching the query
+// ordered by their start, reservations which have ended are only returned
+// when the from parameter is set
+func (api Client) ListReservationsWithContext(ctx context.Context, query url.Values) ([]Reservation, error) {
+	path := url.URL{
+		Path:     "/v1/reservations",
+		RawQuery: query.Encode(),
+	}
+
+	response, err := api.Get(ctx, path.String())
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[[]Reservation](response)
+	if err != nil {
+		return nil, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) DeleteReservation(id string) error {
+	return api.DeleteReservationWithContext(context.Background(), id)
+}
+
+func (api Client) DeleteReservationWithContext(ctx context.Context, id string) error {
+	response, err := api.Delete(ctx, fmt.Sprint("/v1/reservations/", id))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	return validateResponse(response)
+}
+
 func (api Client) CancelSession(id string) error {
 	return api.CancelSessionWithContext(context.Background(), id)
 }
@@ -188,21 +470,47 @@ func (api Client) CancelSessionWithContext(ctx context.Context, id string) error
 	}
 	defer response.Body.Close()
 
-	return nil
+	return validateResponse(response)
 }
 
+// ReleaseSession cancels the session.
+//
+// Deprecated: Use CancelSession.
 func (api Client) ReleaseSession(id string) error {
-	return api.ReleaseSessionWithContext(context.Background(), id)
+	return api.CancelSessionWithContext(context.Background(), id)
 }
 
+// ReleaseSessionWithContext cancels the session.
+//
+// Deprecated: Use CancelSessionWithContext.
 func (api Client) ReleaseSessionWithContext(ctx context.Context, id string) error {
-	response, err := api.Post(ctx, fmt.Sprint("/v1/release/session/", id))
+	return api.CancelSessionWithContext(ctx, id)
+}
+
+func (api Client) RenewSessionLease(id string, params LeaseParams) (SessionLease, error) {
+	return api.RenewSessionLeaseWithContext(context.Background(), id, params)
+}
+
+// RenewSessionLeaseWithContext extends the lease of the session, the session is
+// canceled by the controller unless the lease is renewed before it expires
+func (api Client) RenewSessionLeaseWithContext(ctx context.Context, id string, params LeaseParams) (SessionLease, error) {
+	body, err := jsonReaderFromObject(params)
 	if err != nil {
-		return err
+		return SessionLease{}, ErrInvalidInput.Wrap(err)
+	}
+
+	response, err := api.PostWithJson(ctx, fmt.Sprint("/v1/session/", id, "/heartbeat"), body)
+	if err != nil {
+		return SessionLease{}, err
 	}
 	defer response.Body.Close()
 
-	return validateResponse(response)
+	result, err := parseJsonResponse[SessionLease](response)
+	if err != nil {
+		return SessionLease{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
 }
 
 func (api Client) GetAgent(id string) (Agent, error) {
@@ -261,3 +569,121 @@ func (api Client) RegisterAgentWithContext(ctx context.Context, agent Agent) (st
 
 	return parseStringResponse(response)
 }
+
+func (api Client) CordonAgent(id string) (Agent, error) {
+	return api.CordonAgentWithContext(context.Background(), id)
+}
+
+// CordonAgentWithContext stops new sessions from being assigned to the agent
+func (api Client) CordonAgentWithContext(ctx context.Context, id string) (Agent, error) {
+	response, err := api.Post(ctx, fmt.Sprint("/v1/agent/", id, "/cordon"))
+	if err != nil {
+		return Agent{}, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[Agent](response)
+	if err != nil {
+		return Agent{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) DrainAgent(id string, params DrainParams) (Agent, error) {
+	return api.DrainAgentWithContext(context.Background(), id, params)
+}
+
+// DrainAgentWithContext cordons the agent and waits for its sessions to close,
+// the sessions remaining after the deadline, if any, are canceled
+func (api Client) DrainAgentWithContext(ctx context.Context, id string, params DrainParams) (Agent, error) {
+	body, err := jsonReaderFromObject(params)
+	if err != nil {
+		return Agent{}, ErrInvalidInput.Wrap(err)
+	}
+
+	response, err := api.PostWithJson(ctx, fmt.Sprint("/v1/agent/", id, "/drain"), body)
+	if err != nil {
+		return Agent{}, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[Agent](response)
+	if err != nil {
+		return Agent{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) SetAgentTaints(id string, params TaintsParams) (Agent, error) {
+	return api.SetAgentTaintsWithContext(context.Background(), id, params)
+}
+
+// SetAgentTaintsWithContext replaces the taints of the agent, sessions running
+// on the agent which do not tolerate a NoExecute taint are canceled
+func (api Client) SetAgentTaintsWithContext(ctx context.Context, id string, params TaintsParams) (Agent, error) {
+	body, err := jsonReaderFromObject(params)
+	if err != nil {
+		return Agent{}, ErrInvalidInput.Wrap(err)
+	}
+
+	response, err := api.PutWithJson(ctx, fmt.Sprint("/v1/agent/", id, "/taints"), body)
+	if err != nil {
+		return Agent{}, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[Agent](response)
+	if err != nil {
+		return Agent{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) UncordonAgent(id string) (Agent, error) {
+	return api.UncordonAgentWithContext(context.Background(), id)
+}
+
+// UncordonAgentWithContext allows new sessions to be assigned to a cordoned, draining or drained agent
+func (api Client) UncordonAgentWithContext(ctx context.Context, id string) (Agent, error) {
+	response, err := api.Post(ctx, fmt.Sprint("/v1/agent/", id, "/uncordon"))
+	if err != nil {
+		return Agent{}, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[Agent](response)
+	if err != nil {
+		return Agent{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func (api Client) ListAgents(query url.Values) (AgentPage, error) {
+	return api.ListAgentsWithContext(context.Background(), query)
+}
+
+// ListAgentsWithContext returns a page of the agents matching the query, the
+// following page is requested by setting the cursor parameter to the Next of the page
+func (api Client) ListAgentsWithContext(ctx context.Context, query url.Values) (AgentPage, error) {
+	path := url.URL{
+		Path:     "/v1/agents",
+		RawQuery: query.Encode(),
+	}
+
+	response, err := api.Get(ctx, path.String())
+	if err != nil {
+		return AgentPage{}, err
+	}
+	defer response.Body.Close()
+
+	result, err := parseJsonResponse[AgentPage](response)
+	if err != nil {
+		return AgentPage{}, ErrInvalidResponse.Wrap(err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,114 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package restapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/errors"
+)
+
+// The machine-readable codes of an ErrorResponse
+const (
+	ErrorCodeInvalidInput = "invalid_input"
+	ErrorCodeUnauthorized = "unauthorized"
+	ErrorCodeForbidden    = "forbidden"
+	ErrorCodeNotFound     = "not_found"
+	ErrorCodeConflict     = "conflict"
+	ErrorCodeInternal     = "internal"
+)
+
+var (
+	ErrBadRequest   = errors.New("client: bad request")
+	ErrUnauthorized = errors.New("client: unauthorized")
+	ErrForbidden    = errors.New("client: forbidden")
+	ErrConflict     = errors.New("client: conflict")
+	ErrServer       = errors.New("client: server error")
+)
+
+// ErrorResponse is the body of every unsuccessful response from the controller
+// and agent
+type ErrorResponse struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// ErrorCodeFromStatus returns the code describing the HTTP status
+func ErrorCodeFromStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return ErrorCodeInvalidInput
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrorCodeForbidden
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusConflict:
+		return ErrorCodeConflict
+	}
+
+	if statusCode >= 400 && statusCode < 500 {
+		return ErrorCodeInvalidInput
+	}
+
+	return ErrorCodeInternal
+}
+
+// ResponseError is returned by Client for unsuccessful responses, it matches one
+// of ErrBadRequest, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict or
+// ErrServer when compared using errors.Is
+type ResponseError struct {
+	ErrorResponse
+
+	StatusCode int
+}
+
+func (err *ResponseError) Error() string {
+	if err.Message != "" {
+		return fmt.Sprintf("error received from server, code %d\nmessage: %s", err.StatusCode, err.Message)
+	}
+
+	return fmt.Sprintf("error received from server, code %d", err.StatusCode)
+}
+
+func (err *ResponseError) Is(target error) bool {
+	var sentinel error
+	switch err.Code {
+	case ErrorCodeInvalidInput:
+		sentinel = ErrBadRequest
+	case ErrorCodeUnauthorized:
+		sentinel = ErrUnauthorized
+	case ErrorCodeForbidden:
+		sentinel = ErrForbidden
+	case ErrorCodeNotFound:
+		sentinel = ErrNotFound
+	case ErrorCodeConflict:
+		sentinel = ErrConflict
+	default:
+		sentinel = ErrServer
+	}
+
+	return errors.Is(sentinel, target)
+}
+
+// responseError describes an unsuccessful response. Servers predating the
+// ErrorResponse respond with plain text, the code is then taken from the status.
+func responseError(statusCode int, body []byte) error {
+	err := &ResponseError{
+		StatusCode: statusCode,
+	}
+
+	if json.Unmarshal(body, &err.ErrorResponse) != nil || err.Code == "" {
+		err.ErrorResponse = ErrorResponse{
+			Code:    ErrorCodeFromStatus(statusCode),
+			Message: string(body),
+		}
+	}
+
+	return err
+}
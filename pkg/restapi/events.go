@@ -0,0 +1,129 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package restapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/errors"
+)
+
+var (
+	ErrEventsUnsupported = errors.New("client: server does not support events")
+)
+
+// EventStream reads the Server-Sent Events streamed from /v1/events
+type EventStream struct {
+	response *http.Response
+	reader   *bufio.Reader
+}
+
+func (api Client) WatchEvents(filter EventFilter) (*EventStream, error) {
+	return api.WatchEventsWithContext(context.Background(), filter)
+}
+
+// WatchEventsWithContext opens a stream of the events matching the filter, the
+// stream must be closed once it is no longer used. Returns ErrEventsUnsupported
+// if the server does not provide /v1/events. The changes made by a backend
+// running in another process than the frontend are not streamed.
+func (api Client) WatchEventsWithContext(ctx context.Context, filter EventFilter) (*EventStream, error) {
+	query := url.Values{}
+	if filter.PoolId != "" {
+		query.Set("pool_id", filter.PoolId)
+	}
+	if filter.AgentId != "" {
+		query.Set("agent_id", filter.AgentId)
+	}
+	if filter.SessionId != "" {
+		query.Set("session_id", filter.SessionId)
+	}
+
+	path := "/v1/events"
+	if len(query) > 0 {
+		path = path + "?" + query.Encode()
+	}
+
+	response, err := api.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusMethodNotAllowed {
+		response.Body.Close()
+		return nil, ErrEventsUnsupported
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return nil, validateResponse(response)
+	}
+
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "text/event-stream") {
+		response.Body.Close()
+		return nil, ErrInvalidResponse.Wrap(errors.Newf("expected Content-Type=text/event-stream, received %s", response.Header.Get("Content-Type")))
+	}
+
+	return &EventStream{
+		response: response,
+		reader:   bufio.NewReader(response.Body),
+	}, nil
+}
+
+// Next blocks until the next event is received. Returns io.EOF once the server
+// closes the stream.
+func (stream *EventStream) Next() (Event, error) {
+	var data strings.Builder
+
+	for {
+		line, err := stream.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && data.Len() == 0 {
+				return Event{}, io.EOF
+			}
+
+			return Event{}, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		// A blank line dispatches the event
+		if line == "" {
+			if data.Len() == 0 {
+				continue
+			}
+
+			var event Event
+			err = json.Unmarshal([]byte(data.String()), &event)
+			if err != nil {
+				return Event{}, ErrInvalidResponse.Wrap(err)
+			}
+
+			return event, nil
+		}
+
+		// Lines starting with a colon are comments
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		// The event type and id are also part of the data so only the data is required
+		field, value, _ := strings.Cut(line, ":")
+		if field == "data" {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+		}
+	}
+}
+
+func (stream *EventStream) Close() error {
+	return stream.response.Body.Close()
+}
@@ -34,11 +34,7 @@ func parseResponse(response *http.Response, contentType string) ([]byte, error)
 	}
 
 	if response.StatusCode != 200 {
-		if body != nil {
-			return nil, fmt.Errorf("error received from server, code %d\nmessage: %s", response.StatusCode, string(body))
-		}
-
-		return nil, fmt.Errorf("error received from server, code %d", response.StatusCode)
+		return nil, responseError(response.StatusCode, body)
 	}
 
 	if response.Header.Get("Content-Type") != contentType {
@@ -76,11 +72,7 @@ func validateResponse(response *http.Response) error {
 	}
 
 	if response.StatusCode != 200 {
-		if body != nil {
-			return fmt.Errorf("error received from server, code %d\nmessage: %s", response.StatusCode, string(body))
-		}
-
-		return fmt.Errorf("error received from server, code %d", response.StatusCode)
+		return responseError(response.StatusCode, body)
 	}
 
 	return nil
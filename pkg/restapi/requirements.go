@@ -0,0 +1,80 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package restapi
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ParseDriverVersion returns the dot separated numbers of a driver version
+func ParseDriverVersion(version string) ([]uint64, error) {
+	if version == "" {
+		return nil, errors.New("driver version is empty")
+	}
+
+	parts := strings.Split(strings.TrimSpace(version), ".")
+	numbers := make([]uint64, len(parts))
+	for index, part := range parts {
+		number, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("driver version %s is not dot separated numbers", version)
+		}
+
+		numbers[index] = number
+	}
+
+	return numbers, nil
+}
+
+func validateNamePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return errors.New("GPU name pattern is empty")
+		}
+
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("GPU name pattern %s is invalid, %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate ensures the compute share is at most a whole GPU, the patterns and
+// the driver version can be matched and every exclusion sets at least one field
+func (requirements GpuRequirements) Validate() error {
+	if requirements.ComputeShare < 0 || requirements.ComputeShare > MaxComputeShare {
+		return fmt.Errorf("compute share must be between 0 and %d", MaxComputeShare)
+	}
+
+	err := validateNamePatterns(requirements.Names)
+	if err != nil {
+		return err
+	}
+
+	if requirements.MinDriverVersion != "" {
+		_, err = ParseDriverVersion(requirements.MinDriverVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, exclusion := range requirements.Exclude {
+		if len(exclusion.Names) == 0 && exclusion.VendorId == 0 && len(exclusion.DeviceIds) == 0 {
+			return errors.New("GPU exclusion must set names, vendorId or deviceIds")
+		}
+
+		err = validateNamePatterns(exclusion.Names)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
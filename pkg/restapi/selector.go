@@ -0,0 +1,146 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package restapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Validate ensures the operator is known and the number of values suits it
+func (requirement SelectorRequirement) Validate() error {
+	if requirement.Key == "" {
+		return fmt.Errorf("key is required")
+	}
+
+	switch requirement.Operator {
+	case SelectorOpIn, SelectorOpNotIn:
+		if len(requirement.Values) == 0 {
+			return fmt.Errorf("operator %s of %s requires at least one value", requirement.Operator, requirement.Key)
+		}
+
+	case SelectorOpExists, SelectorOpDoesNotExist:
+		if len(requirement.Values) != 0 {
+			return fmt.Errorf("operator %s of %s does not take values", requirement.Operator, requirement.Key)
+		}
+
+	case SelectorOpGt, SelectorOpLt:
+		if len(requirement.Values) != 1 {
+			return fmt.Errorf("operator %s of %s requires a single value", requirement.Operator, requirement.Key)
+		}
+
+		_, err := strconv.ParseInt(requirement.Values[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("operator %s of %s requires an integer value, got %s", requirement.Operator, requirement.Key, requirement.Values[0])
+		}
+
+	default:
+		return fmt.Errorf("unknown operator %s of %s, expected one of In, NotIn, Exists, DoesNotExist, Gt or Lt", requirement.Operator, requirement.Key)
+	}
+
+	return nil
+}
+
+// Validate ensures the kind of the preference is known and its weight is
+// between 1 and MaxPreferenceWeight
+func (preference Preference) Validate() error {
+	if preference.Weight < 1 || preference.Weight > MaxPreferenceWeight {
+		return fmt.Errorf("weight of preference %s must be between 1 and %d", preference.Type, MaxPreferenceWeight)
+	}
+
+	switch preference.Type {
+	case PreferLabel:
+		if preference.Key == "" {
+			return fmt.Errorf("preference %s requires a key", preference.Type)
+		}
+
+	case PreferGpu:
+		if len(preference.Values) == 0 {
+			return fmt.Errorf("preference %s requires at least one GPU name", preference.Type)
+		}
+
+	case PreferLowUtilization:
+
+	default:
+		return fmt.Errorf("unknown preference %s, expected one of label, gpu or lowUtilization", preference.Type)
+	}
+
+	return nil
+}
+
+// ParseTaint returns the value and the effect of the value of a taint, the
+// effect of a taint without one is NoSchedule
+func ParseTaint(value string) (string, string) {
+	index := strings.LastIndex(value, ":")
+	if index >= 0 {
+		switch effect := value[index+1:]; effect {
+		case TaintNoSchedule, TaintPreferNoSchedule, TaintNoExecute:
+			return value[:index], effect
+		}
+	}
+
+	return value, TaintNoSchedule
+}
+
+// parseKeyValues parses a comma separated list of key=value pairs
+func parseKeyValues(value string, name string) (map[string]string, error) {
+	keyValues := map[string]string{}
+	if strings.TrimSpace(value) == "" {
+		return keyValues, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.Contains(value, "=") {
+			return nil, fmt.Errorf("%s '%s' must be in the format key=value", name, pair)
+		}
+
+		keyValues[key] = strings.TrimSpace(value)
+	}
+
+	return keyValues, nil
+}
+
+// ParseLabels parses a comma separated list of key=value labels
+func ParseLabels(value string) (map[string]string, error) {
+	return parseKeyValues(value, "label")
+}
+
+// ValidateTaints ensures the effect of every taint is one of NoSchedule,
+// PreferNoSchedule or NoExecute
+func ValidateTaints(taints map[string]string) error {
+	for key, value := range taints {
+		if key == "" {
+			return fmt.Errorf("taint key is required")
+		}
+
+		index := strings.LastIndex(value, ":")
+		if index < 0 {
+			continue
+		}
+
+		if _, effect := ParseTaint(value); effect != value[index+1:] {
+			return fmt.Errorf("unknown effect %s of taint %s, expected one of NoSchedule, PreferNoSchedule or NoExecute", value[index+1:], key)
+		}
+	}
+
+	return nil
+}
+
+// ParseTaints parses a comma separated list of key=value[:effect] taints
+func ParseTaints(value string) (map[string]string, error) {
+	taints, err := parseKeyValues(value, "taint")
+	if err != nil {
+		return nil, err
+	}
+
+	err = ValidateTaints(taints)
+	if err != nil {
+		return nil, err
+	}
+
+	return taints, nil
+}
@@ -3,6 +3,8 @@
  */
 package restapi
 
+import "time"
+
 const (
 	SessionClosed    = "closed"
 	SessionQueued    = "queued"
@@ -11,6 +13,12 @@ const (
 	SessionCanceling = "canceling"
 )
 
+const (
+	SessionPriorityLow    = -100
+	SessionPriorityNormal = 0
+	SessionPriorityHigh   = 100
+)
+
 const (
 	AgentClosed   = "closed"
 	AgentActive   = "active"
@@ -18,6 +26,22 @@ const (
 	AgentMissing  = "missing"
 )
 
+// Cordoned, draining and drained agents are not assigned new sessions. Draining
+// agents become drained once their sessions are closed.
+const (
+	AgentSchedulable = "schedulable"
+	AgentCordoned    = "cordoned"
+	AgentDraining    = "draining"
+	AgentDrained     = "drained"
+)
+
+// The effects of a taint on the sessions which do not tolerate it
+const (
+	TaintNoSchedule       = "NoSchedule"       // Sessions are not assigned to the agent
+	TaintPreferNoSchedule = "PreferNoSchedule" // Sessions are only assigned to the agent when no other agent can host them
+	TaintNoExecute        = "NoExecute"        // Sessions are not assigned to the agent and those running are canceled
+)
+
 type Permission string
 
 const (
@@ -29,35 +53,296 @@ const (
 type GpuRequirements struct {
 	VramRequired uint64 `json:"vramRequired"`
 	PciBus       string `json:"pciBus"`
+
+	// Optional, the percentage of the compute of the GPU reserved for the
+	// session, the shares of the sessions of a GPU never exceed MaxComputeShare
+	ComputeShare int `json:"computeShare,omitempty"`
+
+	// Optional, the name or model of the GPU must match one of the patterns,
+	// see path.Match, ignoring case
+	Names []string `json:"names,omitempty"`
+	// Optional, the PCI vendor ID of the GPU
+	VendorId uint32 `json:"vendorId,omitempty"`
+	// Optional, the PCI device ID of the GPU must be one of these
+	DeviceIds []uint32 `json:"deviceIds,omitempty"`
+	// Optional, the lowest version of the driver of the GPU, versions are
+	// compared by their dot separated numbers
+	MinDriverVersion string `json:"minDriverVersion,omitempty"`
+
+	// Optional, GPUs matching any of the exclusions are never chosen
+	Exclude []GpuExclusion `json:"exclude,omitempty"`
+}
+
+// The compute of a whole GPU
+const MaxComputeShare = 100
+
+// Excludes the GPUs matching every field set
+type GpuExclusion struct {
+	Names     []string `json:"names,omitempty"`
+	VendorId  uint32   `json:"vendorId,omitempty"`
+	DeviceIds []uint32 `json:"deviceIds,omitempty"`
+}
+
+// Limits the lifetime of a session once assigned, in seconds. Zero uses the
+// default of the pool, no limit applies when the pool has no default either.
+type SessionTimeouts struct {
+	// The session is canceled once it has been assigned for longer
+	MaxDuration int64 `json:"maxDuration,omitempty"`
+
+	// The session is canceled once it has been without active connections for longer
+	IdleTimeout int64 `json:"idleTimeout,omitempty"`
 }
 
 type SessionRequirements struct {
 	Version string `json:"version"`
 	PoolId  string `json:"poolId"`
 
+	// Sessions with a higher priority are scheduled first
+	Priority int `json:"priority"`
+
+	SessionTimeouts
+
+	// Optional, the reservation the session is admitted to. During the window of
+	// the reservation the session may use the GPUs held for it and is not
+	// subject to quotas.
+	ReservationId string `json:"reservationId,omitempty"`
+
 	Gpus []GpuRequirements `json:"gpus"`
 
 	MatchLabels map[string]string `json:"matchLabels"`
 	Tolerates   map[string]string `json:"tolerates"`
+
+	// Optional, every expression must match the labels of the agent
+	MatchExpressions []SelectorRequirement `json:"matchExpressions,omitempty"`
+
+	// Optional, the session is assigned to the agent with the highest total
+	// weight of the preferences it satisfies
+	Preferences []Preference `json:"preferences,omitempty"`
+}
+
+// The kinds of a Preference
+const (
+	PreferLabel          = "label"          // Agents with the label Key set to one of Values, or set at all without Values
+	PreferGpu            = "gpu"            // Agents whose GPUs chosen for the session are named one of Values
+	PreferLowUtilization = "lowUtilization" // Agents whose GPUs report the lowest utilization
+)
+
+// The most a single preference may weigh
+const MaxPreferenceWeight = 100
+
+// A weighted preference for some agents over others, agents which do not
+// satisfy the preference may still host the session
+type Preference struct {
+	Type   string   `json:"type"`
+	Weight int      `json:"weight"`
+	Key    string   `json:"key,omitempty"`
+	Values []string `json:"values,omitempty"`
+}
+
+// The part of the score of an agent given by a preference, between zero and
+// the weight of the preference
+type ScoreComponent struct {
+	Preference Preference `json:"preference"`
+	Score      float64    `json:"score"`
+}
+
+// The score of an agent able to host a session. Agents are ranked by whether
+// they are avoided, then by score and finally by the placement strategy.
+type AgentScore struct {
+	AgentId string  `json:"agentId"`
+	Score   float64 `json:"score"`
+
+	// The agent has a PreferNoSchedule taint the session does not tolerate
+	Avoided bool `json:"avoided,omitempty"`
+
+	// The VRAM left available on the agent once the session is assigned
+	VramAvailable uint64 `json:"vramAvailable"`
+
+	Components []ScoreComponent `json:"components"`
+}
+
+// Explains the choice of the agent a session was assigned to
+type SessionPlacement struct {
+	SessionId  string    `json:"sessionId"`
+	AgentId    string    `json:"agentId"`
+	Placement  string    `json:"placement"` // The placement strategy breaking ties between scores
+	AssignedAt time.Time `json:"assignedAt"`
+
+	// The highest ranked agents able to host the session, the chosen agent first
+	Candidates []AgentScore `json:"candidates"`
+}
+
+// The session explained by the scheduler, either a queued session or the
+// requirements of a session yet to be requested
+type ExplainParams struct {
+	SessionId    string               `json:"sessionId,omitempty"`
+	Requirements *SessionRequirements `json:"requirements,omitempty"`
+}
+
+// The reasons an agent cannot host a session
+const (
+	RejectAgentState    = "agentState"         // The agent is not active, such as when it is missing
+	RejectUnschedulable = "unschedulable"      // The agent is cordoned, draining or drained
+	RejectPool          = "poolMismatch"       // The agent belongs to another pool
+	RejectLabels        = "labelMismatch"      // The agent lacks a label of MatchLabels
+	RejectExpressions   = "expressionMismatch" // The labels of the agent do not satisfy MatchExpressions
+	RejectTaint         = "untoleratedTaint"   // The agent has a NoSchedule or NoExecute taint not tolerated
+	RejectVram          = "insufficientVram"   // The agent has less VRAM available in total than required
+	RejectGpus          = "insufficientGpus"   // No set of the GPUs of the agent satisfies the GPU requirements
+)
+
+type Rejection struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// Explains whether an agent can host a session
+type AgentExplanation struct {
+	AgentId  string `json:"agentId"`
+	Hostname string `json:"hostname"`
+	State    string `json:"state"`
+
+	// Empty when the agent can host the session
+	Rejections []Rejection `json:"rejections"`
+
+	// The score of an agent able to host the session, agents ranked after the
+	// first agent chosen by FirstFit are not scored
+	Score *AgentScore `json:"score,omitempty"`
+}
+
+// Explains how the scheduler would treat a session at the time of the request
+type SchedulingExplanation struct {
+	SessionId string `json:"sessionId,omitempty"`
+
+	// The reason the session would remain queued whatever the agents, such as
+	// an exceeded quota
+	Reason string `json:"reason,omitempty"`
+
+	// The agent the session would be assigned to, empty when it would remain
+	// queued
+	AgentId string `json:"agentId,omitempty"`
+
+	// Every agent of the pool of the session
+	Agents []AgentExplanation `json:"agents"`
+}
+
+// The operators of a SelectorRequirement
+const (
+	SelectorOpIn           = "In"           // The label is one of the values
+	SelectorOpNotIn        = "NotIn"        // The label is missing or none of the values
+	SelectorOpExists       = "Exists"       // The label is present, whatever its value
+	SelectorOpDoesNotExist = "DoesNotExist" // The label is missing
+	SelectorOpGt           = "Gt"           // The label is an integer greater than the single value
+	SelectorOpLt           = "Lt"           // The label is an integer less than the single value
+)
+
+// An expression matching the value of a label of an agent
+type SelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// The placement constraints of the members of a session group
+type GroupTopology struct {
+	// Optional, the label whose value must be the same on every agent hosting a
+	// member of the group, e.g. the rack of the agents
+	SameLabel string `json:"sameLabel,omitempty"`
+}
+
+// Requests a group of sessions scheduled together, either every member of the
+// group is assigned or none are. Members may be assigned to the same agent.
+type SessionGroupRequirements struct {
+	Members  int           `json:"members"`
+	Topology GroupTopology `json:"topology"`
+
+	// The requirements of each member of the group
+	Session SessionRequirements `json:"session"`
+}
+
+// Reserves GPUs of a pool for a window of time, the GPUs are held back from
+// sessions not admitted to the reservation while the window is open
+type Reservation struct {
+	Id     string `json:"id"`
+	PoolId string `json:"poolId"`
+	UserId string `json:"userId"` // The owner, set to the user creating the reservation
+
+	Gpus []GpuRequirements `json:"gpus"`
+
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
 }
 
 type SessionGpu struct {
 	Index int `json:"index"`
 
 	VramRequired uint64 `json:"vramRequired"`
+	ComputeShare int    `json:"computeShare,omitempty"`
 }
 
 type Session struct {
-	Id      string `json:"id"`
-	State   string `json:"state"`
-	Address string `json:"address"`
-	Version string `json:"version"`
-	PoolId  string `json:"poolId"`
+	Id       string `json:"id"`
+	State    string `json:"state"`
+	Address  string `json:"address"`
+	Version  string `json:"version"`
+	PoolId   string `json:"poolId"`
+	UserId   string `json:"userId"`
+	Priority int    `json:"priority"`
+
+	// Explains why a queued session has not been assigned, empty otherwise
+	Reason string `json:"reason"`
+
+	// The group the session is a member of, empty for sessions requested alone
+	GroupId string `json:"groupId,omitempty"`
 
 	Gpus        []SessionGpu `json:"gpus"`
 	Connections []Connection `json:"connections"`
 }
 
+// A group of sessions along with its members, the state of the group is queued
+// until every member is assigned and closed once every member has closed
+type SessionGroup struct {
+	Id       string        `json:"id"`
+	State    string        `json:"state"`
+	PoolId   string        `json:"poolId"`
+	UserId   string        `json:"userId"`
+	Topology GroupTopology `json:"topology"`
+	Sessions []Session     `json:"sessions"`
+}
+
+type LeaseParams struct {
+	// Optional, the seconds until the lease expires unless renewed. The default
+	// of the controller applies when zero.
+	Ttl int64 `json:"ttl,omitempty"`
+}
+
+// The lease held by the client of a session, the session is canceled once the
+// lease expires
+type SessionLease struct {
+	SessionId string    `json:"sessionId"`
+	Ttl       int64     `json:"ttl"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// A session as listed, along with the agent it is assigned to and the time it was requested
+type ListedSession struct {
+	Session
+
+	AgentId string    `json:"agentId,omitempty"`
+	Created time.Time `json:"created"`
+
+	// The position of a queued session within the queue starting at 1, zero
+	// for sessions which are not queued
+	QueuePosition int `json:"queuePosition,omitempty"`
+}
+
+// A page of sessions, Next is the cursor of the following page and is omitted
+// from the last page
+type SessionPage struct {
+	Sessions []ListedSession `json:"sessions"`
+	Next     string          `json:"next,omitempty"`
+}
+
 type ConnectionData struct {
 	Id          string `json:"id"`
 	Pid         string `json:"pid"`
@@ -95,6 +380,14 @@ type Gpu struct {
 	Vram        uint64 `json:"vram"`
 	PciBus      string `json:"pciBus"`
 
+	// The most sessions which may share the GPU, zero when unlimited
+	MaxSessions int `json:"maxSessions,omitempty"`
+
+	// The percentage of the compute of the GPU and the number of sessions
+	// allocated, reported as the agent is listed
+	ComputeShareAllocated int `json:"computeShareAllocated"`
+	SessionsAllocated     int `json:"sessionsAllocated"`
+
 	Metrics GpuMetrics `json:"metrics"`
 }
 
@@ -109,20 +402,44 @@ type Agent struct {
 	Gpus []Gpu `json:"gpus"`
 
 	Labels map[string]string `json:"labels"`
+
+	// The value of each taint may be followed by its effect, e.g. value:NoExecute,
+	// taints without an effect have the NoSchedule effect
 	Taints map[string]string `json:"taints"`
 
 	Sessions []Session `json:"sessions"`
+
+	DrainState string `json:"drainState"`
+
+	// The sessions of a draining agent are canceled once the deadline has passed
+	DrainDeadline *time.Time `json:"drainDeadline,omitempty"`
+}
+
+// A page of agents, Next is the cursor of the following page and is omitted
+// from the last page
+type AgentPage struct {
+	Agents []Agent `json:"agents"`
+	Next   string  `json:"next,omitempty"`
 }
 
 type Status struct {
-	State    string `json:"state"`
-	Version  string `json:"version"`
-	Hostname string `json:"hostname"`
+	State      string `json:"state"`
+	Version    string `json:"version"`
+	Hostname   string `json:"hostname"`
+	DrainState string `json:"drainState,omitempty"`
 }
 
 type SessionUpdate struct {
 	State       string                `json:"State"`
 	Connections map[string]Connection `json:"connections"`
+
+	// The time the session became idle, without active connections, according
+	// to the agent. Omitted while the session has active connections.
+	IdleSince *time.Time `json:"idleSince,omitempty"`
+
+	// The connections closed since the previous update, including those created
+	// since the previous update
+	ClosedConnections []string `json:"closedConnections,omitempty"`
 }
 
 type AgentUpdate struct {
@@ -130,12 +447,117 @@ type AgentUpdate struct {
 	State          string                   `json:"state"`
 	SessionsUpdate map[string]SessionUpdate `json:"sessions"`
 	Gpus           []GpuMetrics             `json:"gpus"`
+	DrainState     string                   `json:"drainState,omitempty"`
+}
+
+type TaintsParams struct {
+	// Replaces every taint of the agent, the value of each taint may be followed
+	// by its effect
+	Taints map[string]string `json:"taints"`
+}
+
+type DrainParams struct {
+	// Optional, the sessions remaining on the agent are canceled after the deadline
+	Deadline *time.Time `json:"deadline,omitempty"`
 }
 
+// WebhookMessage is the payload posted to webhooks for each event
 type WebhookMessage struct {
+	// Unique to each message, retries of a message share the id
+	Id    string    `json:"id"`
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+
+	Pool    string `json:"pool,omitempty"`
 	Agent   string `json:"agent"`
 	Session string `json:"session"`
 	State   string `json:"state"`
+
+	// Set for connection events, ExitCode is only meaningful once the connection is closed
+	Connection *Connection `json:"connection,omitempty"`
+}
+
+// Webhook is a subscription to the events of the controller
+type Webhook struct {
+	Id  string `json:"id"`
+	Url string `json:"url"`
+
+	// Used to sign the messages, never returned by the controller
+	Secret string `json:"secret,omitempty"`
+
+	// Restricts the events to those of the pool, all pools when empty
+	PoolId string `json:"poolId"`
+
+	// Restricts the events to the event types, all events when empty
+	Events []string `json:"events"`
+}
+
+func (webhook Webhook) Matches(event Event) bool {
+	if webhook.PoolId != "" && webhook.PoolId != event.PoolId {
+		return false
+	}
+
+	if len(webhook.Events) == 0 {
+		return true
+	}
+
+	for _, eventType := range webhook.Events {
+		if eventType == event.Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+const (
+	EventSessionState     = "session_state"
+	EventAgentRegistered  = "agent_registered"
+	EventAgentState       = "agent_state"
+	EventAgentDrainState  = "agent_drain_state"
+	EventConnectionOpened = "connection_opened"
+	EventConnectionClosed = "connection_closed"
+)
+
+var EventTypes = []string{
+	EventSessionState,
+	EventAgentRegistered,
+	EventAgentState,
+	EventAgentDrainState,
+	EventConnectionOpened,
+	EventConnectionClosed,
+}
+
+// Event describes a change in the state of a session, agent or connection as
+// streamed by the controller from /v1/events. Events are only shared within a
+// controller process, a frontend running apart from the backend does not see
+// the sessions the backend assigns, preempts or expires.
+type Event struct {
+	Id   uint64    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	PoolId    string `json:"poolId,omitempty"`
+	AgentId   string `json:"agentId,omitempty"`
+	SessionId string `json:"sessionId,omitempty"`
+
+	// The new state of the session or agent, the drain state for agent_drain_state events
+	State string `json:"state,omitempty"`
+
+	Connection *Connection `json:"connection,omitempty"`
+}
+
+// EventFilter restricts the events streamed from /v1/events, empty fields match every event
+type EventFilter struct {
+	PoolId    string
+	AgentId   string
+	SessionId string
+}
+
+func (filter EventFilter) Matches(event Event) bool {
+	return (filter.PoolId == "" || filter.PoolId == event.PoolId) &&
+		(filter.AgentId == "" || filter.AgentId == event.AgentId) &&
+		(filter.SessionId == "" || filter.SessionId == event.SessionId)
 }
 
 type CreatePoolParams struct {
@@ -163,3 +585,74 @@ type UserPermissions struct {
 type PoolPermissions struct {
 	UserIds map[string][]Permission `json:"userIds"`
 }
+
+// Limits on the resources consumed by assigned sessions, zero is unlimited
+type QuotaLimits struct {
+	MaxSessions int    `json:"maxSessions"`
+	MaxVram     uint64 `json:"maxVram"`
+	MaxGpus     int    `json:"maxGpus"`
+}
+
+type QuotaParams struct {
+	// The quota applies to the pool as a whole when UserId is empty
+	UserId string `json:"userId"`
+
+	QuotaLimits
+}
+
+type PoolQuota struct {
+	PoolId string                 `json:"poolId"`
+	Pool   QuotaLimits            `json:"pool"`
+	Users  map[string]QuotaLimits `json:"users"`
+}
+
+// A GPU reserved by a session along with the name of the GPU of the agent
+type UsageGpu struct {
+	SessionGpu
+
+	Name string `json:"name"`
+}
+
+// The immutable record of a closed session kept for accounting
+type UsageRecord struct {
+	SessionId string `json:"sessionId"`
+	PoolId    string `json:"poolId"`
+	UserId    string `json:"userId"`
+	AgentId   string `json:"agentId,omitempty"`
+
+	Gpus        []UsageGpu   `json:"gpus"`
+	Vram        uint64       `json:"vram"`
+	Connections []Connection `json:"connections"`
+
+	QueuedAt   time.Time  `json:"queuedAt"`
+	AssignedAt *time.Time `json:"assignedAt,omitempty"`
+	ActiveAt   *time.Time `json:"activeAt,omitempty"`
+	ClosedAt   time.Time  `json:"closedAt"`
+}
+
+// The GPUs and VRAM reserved by the sessions of a group between the assignment
+// and closing of the sessions. Only the fields of the group are populated.
+type UsageEntry struct {
+	PoolId  string `json:"poolId,omitempty"`
+	UserId  string `json:"userId,omitempty"`
+	GpuName string `json:"gpuName,omitempty"`
+	Day     string `json:"day,omitempty"` // YYYY-MM-DD in UTC
+
+	Sessions    int     `json:"sessions"`
+	GpuHours    float64 `json:"gpuHours"`
+	VramGbHours float64 `json:"vramGbHours"`
+}
+
+const (
+	UsageGroupPool = "pool"
+	UsageGroupUser = "user"
+	UsageGroupGpu  = "gpu"
+	UsageGroupDay  = "day"
+)
+
+type UsageReport struct {
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	GroupBy []string     `json:"groupBy"`
+	Entries []UsageEntry `json:"entries"`
+}
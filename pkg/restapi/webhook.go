@@ -0,0 +1,37 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package restapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Headers sent with each webhook message
+const (
+	WebhookMessageIdHeader = "X-Juice-Message-Id"
+	WebhookEventHeader     = "X-Juice-Event"
+	WebhookTimestampHeader = "X-Juice-Timestamp"
+	WebhookSignatureHeader = "X-Juice-Signature"
+)
+
+const webhookSignaturePrefix = "sha256="
+
+// SignWebhook returns the signature of a webhook message, the HMAC-SHA256 of
+// the timestamp header and the body joined by a period using the secret of the
+// webhook. Including the timestamp allows receivers to reject replayed messages.
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook returns true if the signature header matches the message
+func VerifyWebhook(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, timestamp, body)), []byte(signature))
+}
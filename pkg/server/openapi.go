@@ -0,0 +1,346 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/logger"
+	pkgnet "github.com/Juice-Labs/Juice-Labs/pkg/net"
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+)
+
+const OpenApiPath = "/v1/openapi.json"
+
+var pathParameterRegexp = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// OpenApiDocument is the OpenAPI 3 description of the endpoints of a Server
+type OpenApiDocument struct {
+	OpenApi    string                                  `json:"openapi"`
+	Info       OpenApiInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenApiOperation `json:"paths"`
+	Components OpenApiComponents                       `json:"components"`
+}
+
+type OpenApiInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenApiComponents struct {
+	Schemas         map[string]*OpenApiSchema         `json:"schemas"`
+	SecuritySchemes map[string]*OpenApiSecurityScheme `json:"securitySchemes"`
+}
+
+type OpenApiSecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type OpenApiOperation struct {
+	Parameters  []OpenApiParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenApiRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenApiResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+}
+
+type OpenApiParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *OpenApiSchema `json:"schema"`
+}
+
+type OpenApiRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*OpenApiMediaType `json:"content"`
+}
+
+type OpenApiResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenApiMediaType `json:"content,omitempty"`
+}
+
+type OpenApiMediaType struct {
+	Schema *OpenApiSchema `json:"schema"`
+}
+
+type OpenApiSchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Items                *OpenApiSchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenApiSchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenApiSchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+}
+
+// SchemaName returns the name of the component referenced by the schema, empty
+// if the schema is not a reference
+func (schema *OpenApiSchema) SchemaName() string {
+	return strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+}
+
+// SetInfo sets the title and version of the OpenAPI document served by the server
+func (server *Server) SetInfo(title string, version string) {
+	server.info = OpenApiInfo{
+		Title:   title,
+		Version: version,
+	}
+}
+
+// OpenApi describes the endpoints added to the server
+func (server *Server) OpenApi() OpenApiDocument {
+	document := OpenApiDocument{
+		OpenApi: "3.0.3",
+		Info:    server.info,
+		Paths:   map[string]map[string]*OpenApiOperation{},
+		Components: OpenApiComponents{
+			Schemas: map[string]*OpenApiSchema{},
+			SecuritySchemes: map[string]*OpenApiSecurityScheme{
+				"bearerAuth": {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+				},
+			},
+		},
+	}
+
+	errorSchema := schemaOf(reflect.TypeOf(restapi.ErrorResponse{}), document.Components.Schemas)
+
+	// Endpoints differing only by their queries share an operation, a query is
+	// only required when every one of them requires it
+	queries := map[*OpenApiOperation]map[string]int{}
+	variants := map[*OpenApiOperation]int{}
+
+	for _, endpoint := range server.endpoints {
+		path := pathParameterRegexp.ReplaceAllString(endpoint.Path, "{$1}")
+
+		operations, found := document.Paths[path]
+		if !found {
+			operations = map[string]*OpenApiOperation{}
+			document.Paths[path] = operations
+		}
+
+		for _, method := range endpoint.Methods {
+			method = strings.ToLower(method)
+
+			operation, found := operations[method]
+			if !found {
+				operation = newOpenApiOperation(endpoint, document.Components.Schemas, errorSchema)
+				operations[method] = operation
+				queries[operation] = map[string]int{}
+			}
+
+			variants[operation]++
+			for index := 0; index+1 < len(endpoint.Queries); index += 2 {
+				queries[operation][endpoint.Queries[index]]++
+			}
+
+			// Optional parameters are listed without counting toward being required
+			for _, name := range endpoint.QueryParameters {
+				if _, found := queries[operation][name]; !found {
+					queries[operation][name] = 0
+				}
+			}
+		}
+	}
+
+	for operation, names := range queries {
+		sortedNames := make([]string, 0, len(names))
+		for name := range names {
+			sortedNames = append(sortedNames, name)
+		}
+		sort.Strings(sortedNames)
+
+		for _, name := range sortedNames {
+			operation.Parameters = append(operation.Parameters, OpenApiParameter{
+				Name:     name,
+				In:       "query",
+				Required: names[name] == variants[operation],
+				Schema:   &OpenApiSchema{Type: "string"},
+			})
+		}
+	}
+
+	return document
+}
+
+func newOpenApiOperation(endpoint *Endpoint, schemas map[string]*OpenApiSchema, errorSchema *OpenApiSchema) *OpenApiOperation {
+	operation := &OpenApiOperation{
+		Responses: map[string]*OpenApiResponse{
+			"default": {
+				Description: "Error",
+				Content: map[string]*OpenApiMediaType{
+					"application/json": {Schema: errorSchema},
+				},
+			},
+		},
+	}
+
+	for _, match := range pathParameterRegexp.FindAllStringSubmatch(endpoint.Path, -1) {
+		operation.Parameters = append(operation.Parameters, OpenApiParameter{
+			Name:     match[1],
+			In:       "path",
+			Required: true,
+			Schema:   &OpenApiSchema{Type: "string"},
+		})
+	}
+
+	if endpoint.Request != nil {
+		operation.RequestBody = &OpenApiRequestBody{
+			Required: !endpoint.RequestOptional,
+			Content: map[string]*OpenApiMediaType{
+				"application/json": {Schema: schemaOf(reflect.TypeOf(endpoint.Request), schemas)},
+			},
+		}
+	}
+
+	response := &OpenApiResponse{
+		Description: "Success",
+	}
+
+	if endpoint.Response != nil {
+		contentType := endpoint.ResponseContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+
+		response.Content = map[string]*OpenApiMediaType{
+			contentType: {Schema: schemaOf(reflect.TypeOf(endpoint.Response), schemas)},
+		}
+	}
+
+	operation.Responses["200"] = response
+
+	if endpoint.RequireAuth {
+		operation.Security = []map[string][]string{{"bearerAuth": {}}}
+	}
+
+	return operation
+}
+
+// schemaOf describes the JSON encoding of the type, named structures are added
+// to the schemas and referenced
+func schemaOf(t reflect.Type, schemas map[string]*OpenApiSchema) *OpenApiSchema {
+	if t == reflect.TypeOf(time.Time{}) {
+		return &OpenApiSchema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := schemaOf(t.Elem(), schemas)
+		if schema.Ref != "" {
+			return schema
+		}
+
+		nullable := *schema
+		nullable.Nullable = true
+		return &nullable
+
+	case reflect.Bool:
+		return &OpenApiSchema{Type: "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &OpenApiSchema{Type: "integer", Format: "int32"}
+
+	case reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &OpenApiSchema{Type: "integer", Format: "int64"}
+
+	case reflect.Float32:
+		return &OpenApiSchema{Type: "number", Format: "float"}
+
+	case reflect.Float64:
+		return &OpenApiSchema{Type: "number", Format: "double"}
+
+	case reflect.String:
+		return &OpenApiSchema{Type: "string"}
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenApiSchema{Type: "string", Format: "byte"}
+		}
+
+		return &OpenApiSchema{Type: "array", Items: schemaOf(t.Elem(), schemas)}
+
+	case reflect.Map:
+		return &OpenApiSchema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), schemas)}
+
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+
+		if _, found := schemas[t.Name()]; !found {
+			// Registered prior to describing the fields to allow recursive types
+			schemas[t.Name()] = &OpenApiSchema{}
+			*schemas[t.Name()] = *structSchema(t, schemas)
+		}
+
+		return &OpenApiSchema{Ref: "#/components/schemas/" + t.Name()}
+	}
+
+	// Interfaces may hold any value
+	return &OpenApiSchema{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]*OpenApiSchema) *OpenApiSchema {
+	schema := &OpenApiSchema{
+		Type:       "object",
+		Properties: map[string]*OpenApiSchema{},
+	}
+
+	for index := 0; index < t.NumField(); index++ {
+		field := t.Field(index)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+
+		// The fields of embedded structures are encoded as fields of the structure
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := structSchema(field.Type, schemas)
+			for embeddedName, property := range embedded.Properties {
+				schema.Properties[embeddedName] = property
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = schemaOf(field.Type, schemas)
+
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	sort.Strings(schema.Required)
+
+	return schema
+}
+
+func (server *Server) getOpenApiEp(w http.ResponseWriter, r *http.Request) {
+	err := pkgnet.Respond(w, http.StatusOK, server.OpenApi())
+	if err != nil {
+		logger.Error(err)
+	}
+}
@@ -34,6 +34,55 @@ type Endpoint struct {
 	Path        string
 	Handler     http.Handler
 	RequireAuth bool
+
+	// Values of the types of the request and response bodies, used to describe
+	// the endpoint within the OpenAPI document. Nil when there is no body.
+	Request             any
+	RequestOptional     bool
+	Response            any
+	ResponseContentType string // application/json if empty
+
+	// Query parameters the requests to the endpoint may specify, unlike Queries
+	// they are not required to match the endpoint
+	QueryParameters []string
+}
+
+// WithRequest describes the body of the requests to the endpoint by a value of its type
+func (endpoint *Endpoint) WithRequest(value any) *Endpoint {
+	endpoint.Request = value
+	return endpoint
+}
+
+// WithOptionalRequest describes a body the requests to the endpoint may omit
+func (endpoint *Endpoint) WithOptionalRequest(value any) *Endpoint {
+	endpoint.Request = value
+	endpoint.RequestOptional = true
+	return endpoint
+}
+
+// WithQueryParameters describes the optional query parameters of the endpoint
+func (endpoint *Endpoint) WithQueryParameters(names ...string) *Endpoint {
+	endpoint.QueryParameters = append(endpoint.QueryParameters, names...)
+	return endpoint
+}
+
+// WithResponse describes the JSON body of the responses of the endpoint by a value of its type
+func (endpoint *Endpoint) WithResponse(value any) *Endpoint {
+	endpoint.Response = value
+	return endpoint
+}
+
+// WithTextResponse describes an endpoint responding with plain text
+func (endpoint *Endpoint) WithTextResponse() *Endpoint {
+	return endpoint.WithResponseContent("text/plain", "")
+}
+
+// WithResponseContent describes the responses of the endpoint by their content
+// type and a value of the type of the values they contain
+func (endpoint *Endpoint) WithResponseContent(contentType string, value any) *Endpoint {
+	endpoint.Response = value
+	endpoint.ResponseContentType = contentType
+	return endpoint
 }
 
 type Server struct {
@@ -45,7 +94,8 @@ type Server struct {
 	handler   http.Handler
 	tlsConfig *tls.Config
 
-	endpoints []Endpoint
+	info      OpenApiInfo
+	endpoints []*Endpoint
 }
 
 func NewServer(address string, tlsConfig *tls.Config) (*Server, error) {
@@ -110,6 +160,8 @@ func NewServer(address string, tlsConfig *tls.Config) (*Server, error) {
 		w.WriteHeader(http.StatusOK)
 	}, false)
 
+	server.AddEndpointFunc("GET", OpenApiPath, server.getOpenApiEp, false).WithResponse(map[string]any{})
+
 	return server, nil
 }
 
@@ -117,16 +169,17 @@ func (server *Server) Port() int {
 	return server.port
 }
 
-func (server *Server) AddEndpointFunc(method string, path string, fn http.HandlerFunc, requireAuth bool) {
-	server.AddEndpoint(Endpoint{
+func (server *Server) AddEndpointFunc(method string, path string, fn http.HandlerFunc, requireAuth bool) *Endpoint {
+	return server.AddEndpoint(Endpoint{
 		Methods:     []string{method},
 		Path:        path,
 		Handler:     fn,
 		RequireAuth: requireAuth,
 	})
 }
-func (server *Server) AddEndpointFuncWithQuery(method string, path string, fn http.HandlerFunc, requireAuth bool, queries []string) {
-	server.AddEndpoint(Endpoint{
+
+func (server *Server) AddEndpointFuncWithQuery(method string, path string, fn http.HandlerFunc, requireAuth bool, queries []string) *Endpoint {
+	return server.AddEndpoint(Endpoint{
 		Methods:     []string{method},
 		Path:        path,
 		Handler:     fn,
@@ -135,8 +188,8 @@ func (server *Server) AddEndpointFuncWithQuery(method string, path string, fn ht
 	})
 }
 
-func (server *Server) AddNamedEndpointFunc(name string, method string, path string, fn http.HandlerFunc, requireAuth bool) {
-	server.AddEndpoint(Endpoint{
+func (server *Server) AddNamedEndpointFunc(name string, method string, path string, fn http.HandlerFunc, requireAuth bool) *Endpoint {
+	return server.AddEndpoint(Endpoint{
 		Name:        name,
 		Methods:     []string{method},
 		Path:        path,
@@ -145,8 +198,8 @@ func (server *Server) AddNamedEndpointFunc(name string, method string, path stri
 	})
 }
 
-func (server *Server) AddEndpointHandler(method string, path string, handler http.Handler, requireAuth bool) {
-	server.AddEndpoint(Endpoint{
+func (server *Server) AddEndpointHandler(method string, path string, handler http.Handler, requireAuth bool) *Endpoint {
+	return server.AddEndpoint(Endpoint{
 		Methods:     []string{method},
 		Path:        path,
 		Handler:     handler,
@@ -154,8 +207,11 @@ func (server *Server) AddEndpointHandler(method string, path string, handler htt
 	})
 }
 
-func (server *Server) AddEndpoint(endpoint Endpoint) {
-	server.endpoints = append(server.endpoints, endpoint)
+// AddEndpoint adds the endpoint to the server, returns the endpoint to allow
+// its request and response to be described
+func (server *Server) AddEndpoint(endpoint Endpoint) *Endpoint {
+	server.endpoints = append(server.endpoints, &endpoint)
+	return &endpoint
 }
 
 func (server *Server) RemoveEndpointByName(name string) {
@@ -0,0 +1,210 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+
+// Package servertest checks clients against the OpenAPI document of a server
+package servertest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Juice-Labs/Juice-Labs/pkg/restapi"
+	"github.com/Juice-Labs/Juice-Labs/pkg/server"
+)
+
+// The methods of restapi.Client sending arbitrary requests rather than calling an endpoint
+var rawClientMethods = map[string]bool{
+	"Get":          true,
+	"Post":         true,
+	"Delete":       true,
+	"PostWithJson": true,
+	"PutWithJson":  true,
+}
+
+type recordedRequest struct {
+	method string
+	path   string
+	body   []byte
+}
+
+// matchesTemplate returns whether the path matches a path template such as /v1/agent/{id}
+func matchesTemplate(template string, path string) bool {
+	templateSegments := strings.Split(template, "/")
+	pathSegments := strings.Split(path, "/")
+	if len(templateSegments) != len(pathSegments) {
+		return false
+	}
+
+	for index, segment := range templateSegments {
+		if !strings.HasPrefix(segment, "{") && segment != pathSegments[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findOperation returns the operation of the document matching the request
+func findOperation(document server.OpenApiDocument, method string, path string) *server.OpenApiOperation {
+	for template, operations := range document.Paths {
+		if matchesTemplate(template, path) {
+			if operation, found := operations[strings.ToLower(method)]; found {
+				return operation
+			}
+		}
+	}
+
+	return nil
+}
+
+// schemaName returns the name of the type or schema describing a response
+func schemaName(t reflect.Type, schema *server.OpenApiSchema) (string, string) {
+	expected := t.Name()
+	if t.Kind() == reflect.Slice {
+		expected = "[]" + t.Elem().Name()
+	}
+
+	if schema == nil {
+		return expected, ""
+	}
+
+	if schema.Type == "array" && schema.Items != nil {
+		return expected, "[]" + schema.Items.SchemaName()
+	}
+
+	if schema.Ref != "" {
+		return expected, schema.SchemaName()
+	}
+
+	return expected, schema.Type
+}
+
+// CheckClient calls the methods of restapi.Client accepted by the filter and
+// checks the requests made are described by the OpenAPI document, along with
+// the bodies sent and the responses expected
+func CheckClient(t *testing.T, document server.OpenApiDocument, filter func(method string) bool) {
+	t.Helper()
+
+	var mutex sync.Mutex
+	var requests []recordedRequest
+
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mutex.Lock()
+		requests = append(requests, recordedRequest{r.Method, r.URL.Path, body})
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "{}")
+	}))
+	defer httpServer.Close()
+
+	client := restapi.Client{
+		Client:  httpServer.Client(),
+		Address: strings.TrimPrefix(httpServer.URL, "http://"),
+	}
+
+	contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
+	closerType := reflect.TypeOf((*io.Closer)(nil)).Elem()
+
+	clientType := reflect.TypeOf(client)
+	for index := 0; index < clientType.NumMethod(); index++ {
+		method := clientType.Method(index)
+		if rawClientMethods[method.Name] || !filter(method.Name) {
+			continue
+		}
+
+		args := []reflect.Value{reflect.ValueOf(client)}
+		for arg := 1; arg < method.Type.NumIn(); arg++ {
+			argType := method.Type.In(arg)
+			switch {
+			case argType == contextType:
+				args = append(args, reflect.ValueOf(context.Background()))
+			case argType == reflect.TypeOf(restapi.Session{}):
+				// Sessions are only updated to be canceled
+				args = append(args, reflect.ValueOf(restapi.Session{Id: "id", State: restapi.SessionClosed}))
+			case argType.Kind() == reflect.String:
+				args = append(args, reflect.ValueOf("id"))
+			default:
+				args = append(args, reflect.Zero(argType))
+			}
+		}
+
+		mutex.Lock()
+		sent := len(requests)
+		mutex.Unlock()
+
+		results := method.Func.Call(args)
+		for _, result := range results {
+			if result.Type().Implements(closerType) && !result.IsNil() {
+				result.Interface().(io.Closer).Close()
+			}
+		}
+
+		mutex.Lock()
+		if len(requests) == sent {
+			mutex.Unlock()
+			t.Errorf("%s did not send a request", method.Name)
+			continue
+		}
+		request := requests[len(requests)-1]
+		mutex.Unlock()
+
+		operation := findOperation(document, request.method, request.path)
+		if operation == nil {
+			t.Errorf("%s calls %s %s which the server does not provide", method.Name, request.method, request.path)
+			continue
+		}
+
+		if len(request.body) > 0 {
+			if operation.RequestBody == nil {
+				t.Errorf("%s sends a body to %s %s which does not accept one", method.Name, request.method, request.path)
+				continue
+			}
+
+			var fields map[string]any
+			err := json.Unmarshal(request.body, &fields)
+			if err != nil {
+				t.Errorf("%s sends a body which is not a JSON object, %s", method.Name, err.Error())
+				continue
+			}
+
+			name := operation.RequestBody.Content["application/json"].Schema.SchemaName()
+			properties := document.Components.Schemas[name].Properties
+			for field := range fields {
+				if _, found := properties[field]; !found {
+					t.Errorf("%s sends %s which is not a field of %s", method.Name, field, name)
+				}
+			}
+		}
+
+		// Only the responses decoded into values of the restapi package are compared
+		if method.Type.NumOut() > 1 {
+			resultType := method.Type.Out(0)
+
+			var schema *server.OpenApiSchema
+			if response, found := operation.Responses["200"]; found {
+				for _, mediaType := range response.Content {
+					schema = mediaType.Schema
+				}
+			}
+
+			if resultType.Kind() != reflect.Pointer {
+				expected, documented := schemaName(resultType, schema)
+				if expected != documented {
+					t.Errorf("%s expects a response of %s, %s %s responds with %s", method.Name, expected, request.method, request.path, documented)
+				}
+			}
+		}
+	}
+}
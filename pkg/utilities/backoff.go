@@ -0,0 +1,47 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package utilities
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes exponentially increasing delays between retries. Each delay
+// is randomized between half and all of the exponential delay to keep clients
+// failing at the same time from retrying at the same time.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+
+	current time.Duration
+}
+
+func NewBackoff(initial time.Duration, max time.Duration) *Backoff {
+	return &Backoff{
+		Initial: initial,
+		Max:     max,
+	}
+}
+
+// Next returns the delay before the next retry
+func (backoff *Backoff) Next() time.Duration {
+	if backoff.current == 0 {
+		backoff.current = backoff.Initial
+	} else {
+		backoff.current *= 2
+	}
+
+	if backoff.current > backoff.Max {
+		backoff.current = backoff.Max
+	}
+
+	half := backoff.current / 2
+	return half + time.Duration(rand.Int63n(int64(backoff.current-half)+1))
+}
+
+// Reset restarts the delays from Initial, called once a retry succeeds
+func (backoff *Backoff) Reset() {
+	backoff.current = 0
+}
@@ -0,0 +1,35 @@
+/*
+ *  Copyright (c) 2023 Juice Technologies, Inc. All Rights Reserved.
+ */
+package utilities
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	backoff := NewBackoff(time.Second, 8*time.Second)
+
+	expected := []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		8 * time.Second,
+	}
+
+	for index, limit := range expected {
+		delay := backoff.Next()
+		if delay < limit/2 || delay > limit {
+			t.Errorf("expected delay %d to be between %s and %s, got %s", index, limit/2, limit, delay)
+		}
+	}
+
+	backoff.Reset()
+
+	delay := backoff.Next()
+	if delay > time.Second {
+		t.Errorf("expected the delay to restart from %s once reset, got %s", time.Second, delay)
+	}
+}